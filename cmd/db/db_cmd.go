@@ -0,0 +1,288 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package db
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ontio/mercury/cmd"
+	"github.com/ontio/mercury/common/log"
+	"github.com/ontio/mercury/service/controller"
+	"github.com/ontio/mercury/store"
+	"github.com/ontio/mercury/store/gc"
+	leveldb "github.com/ontio/mercury/store/leveldb"
+	"github.com/ontio/mercury/store/migrate"
+	"github.com/ontio/mercury/store/redis"
+	"github.com/urfave/cli"
+)
+
+var DbCommand = cli.Command{
+	Action:      cli.ShowSubcommandHelp,
+	Name:        "db",
+	Usage:       "database cli",
+	ArgsUsage:   "[arguments ...]",
+	Description: "cli management commands can be use to maintain the agent database, the agent must be stopped except for online export and inspecting a copy",
+	Subcommands: []cli.Command{
+		{
+			Name:        "migrate",
+			Usage:       "upgrade the database to the current schema version",
+			Description: "apply the pending schema migrations, the database is backed up first",
+			Action:      migrateDB,
+			Flags: []cli.Flag{
+				cmd.DbDirFlag,
+				cmd.RedisUrlFlag,
+				cmd.DryRunFlag,
+				cmd.BackupDirFlag,
+				cmd.NoBackupFlag,
+			},
+		},
+		{
+			Name:        "gc",
+			Usage:       "remove expired records",
+			Description: "remove the records expired by their ttl or the retention of their type, pending records are kept",
+			Action:      gcDB,
+			Flags: []cli.Flag{
+				cmd.DbDirFlag,
+				cmd.RetentionFlag,
+				cmd.DryRunFlag,
+			},
+		},
+		{
+			Name:        "export",
+			Usage:       "export all records to a file",
+			Description: "write a consistent snapshot of the database, with --online the running agent exports it",
+			Action:      exportDB,
+			Flags: []cli.Flag{
+				cmd.DbDirFlag,
+				cmd.ExportFileFlag,
+				cmd.EncryptFlag,
+				cmd.OnlineFlag,
+				cmd.HttpClientFlag,
+			},
+		},
+		{
+			Name:        "import",
+			Usage:       "import an export into an empty database",
+			Description: "validate and migrate the records of an export, then write them into a new database",
+			Action:      importDB,
+			Flags: []cli.Flag{
+				cmd.DbDirFlag,
+				cmd.ExportFileFlag,
+			},
+		},
+		{
+			Name:        "inspect",
+			Usage:       "show the records of the database",
+			Description: "count the records of each type, or decode the records selected by --type, --did and --id",
+			Action:      inspectDB,
+			Flags: []cli.Flag{
+				cmd.DbDirFlag,
+				cmd.RecordTypeFlag,
+				cmd.InspectDIDFlag,
+				cmd.InspectIDFlag,
+				cmd.FormatFlag,
+				cmd.CopyFlag,
+			},
+		},
+	},
+}
+
+func migrateDB(ctx *cli.Context) error {
+	dir := ctx.String(cmd.GetFlagName(cmd.DbDirFlag))
+	var db store.Store
+	var err error
+	if url := ctx.String(cmd.GetFlagName(cmd.RedisUrlFlag)); url != "" {
+		db, err = openRedisStore(url)
+	} else {
+		db, err = openStore(dir)
+	}
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	pending, err := migrate.Pending(db, controller.Migrations)
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		fmt.Printf("database is at schema version %d, nothing to migrate\n", store.SchemaVersion)
+		return nil
+	}
+	if ctx.Bool(cmd.GetFlagName(cmd.DryRunFlag)) {
+		//migrate a copy in memory to see what would change
+		mem, err := leveldb.NewMemStore()
+		if err != nil {
+			return err
+		}
+		defer mem.Close()
+		_, err = migrate.Copy(db, mem)
+		if err != nil {
+			return err
+		}
+		results, err := migrate.Run(mem, controller.Migrations)
+		if err != nil {
+			return err
+		}
+		printResults("would apply", results)
+		return nil
+	}
+	if !ctx.Bool(cmd.GetFlagName(cmd.NoBackupFlag)) {
+		backupDir := ctx.String(cmd.GetFlagName(cmd.BackupDirFlag))
+		if backupDir == "" {
+			backupDir = DefaultBackupDir(dir)
+		}
+		err = Backup(db, backupDir)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("database backed up to %s\n", backupDir)
+	}
+	results, err := migrate.Run(db, controller.Migrations)
+	if err != nil {
+		return err
+	}
+	printResults("applied", results)
+	return nil
+}
+
+func gcDB(ctx *cli.Context) error {
+	policy, err := gc.ParsePolicy(ctx.String(cmd.GetFlagName(cmd.RetentionFlag)), controller.DefaultRetention)
+	if err != nil {
+		return err
+	}
+	db, err := openStore(ctx.String(cmd.GetFlagName(cmd.DbDirFlag)))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	dryRun := ctx.Bool(cmd.GetFlagName(cmd.DryRunFlag))
+	res, err := gc.Sweep(db, policy, controller.RecordFinished(db), time.Now(), dryRun)
+	if err != nil {
+		return err
+	}
+	verb := "removed"
+	if dryRun {
+		verb = "would remove"
+	}
+	fmt.Printf("scanned %d records\n", res.Scanned)
+	for t, n := range res.Expired {
+		fmt.Printf("%s %d expired %s records\n", verb, n, t)
+	}
+	return nil
+}
+
+// MigrateOnStartup backs up and upgrades the agent database if it is outdated
+func MigrateOnStartup(dir string, db store.Store) error {
+	pending, err := migrate.Pending(db, controller.Migrations)
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		//stamps the schema version of a new database
+		_, err = migrate.Run(db, controller.Migrations)
+		return err
+	}
+	backupDir := DefaultBackupDir(dir)
+	err = Backup(db, backupDir)
+	if err != nil {
+		return err
+	}
+	log.Infof("database backed up to %s before migration", backupDir)
+	results, err := migrate.Run(db, controller.Migrations)
+	if err != nil {
+		return err
+	}
+	for _, r := range results {
+		log.Infof("database migrated to schema version %d: %s, %d records changed", r.Version, r.Description, r.Changes)
+	}
+	return nil
+}
+
+// RequireSchema fails if db is outdated, for stores shared by several agents
+// which must not all migrate them on startup
+func RequireSchema(db store.Store) error {
+	pending, err := migrate.Pending(db, controller.Migrations)
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("database is at schema version %d, run db migrate --%s once before starting the agents",
+			store.SchemaVersion-len(pending), cmd.GetFlagName(cmd.RedisUrlFlag))
+	}
+	//stamps the schema version of a new database
+	_, err = migrate.Run(db, controller.Migrations)
+	return err
+}
+
+// Backup copies every record of db into a new database at dir
+func Backup(db store.Store, dir string) error {
+	if _, err := os.Stat(dir); err == nil {
+		return fmt.Errorf("backup dir %s already exists", dir)
+	}
+	dst, err := createStore(dir)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+	_, err = migrate.Copy(db, dst)
+	return err
+}
+
+func DefaultBackupDir(dir string) string {
+	return strings.TrimRight(dir, "/\\") + ".bak." + time.Now().Format("20060102150405")
+}
+
+// openStore opens an existing database, it never creates one so that a
+// mistyped --db-dir fails instead of working on an empty database
+func openStore(dir string) (store.Store, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, fmt.Errorf("open database %s err:%s", dir, err)
+	}
+	return createStore(dir)
+}
+
+// createStore opens the database in dir, creating it if it doesn't exist
+func createStore(dir string) (store.Store, error) {
+	db, err := leveldb.NewProvider(dir).OpenStore(dir)
+	if err != nil {
+		return nil, fmt.Errorf("open database %s err:%s", dir, err)
+	}
+	return db, nil
+}
+
+func openRedisStore(url string) (store.Store, error) {
+	prov, err := redis.NewProvider(url)
+	if err != nil {
+		return nil, err
+	}
+	db, err := prov.OpenStore(cmd.DEFAULT_REDIS_NAME_SPACE)
+	if err != nil {
+		return nil, fmt.Errorf("open redis store err:%s", err)
+	}
+	return db, nil
+}
+
+func printResults(verb string, results []migrate.Result) {
+	for _, r := range results {
+		fmt.Printf("%s migration %d: %s, %d records changed\n", verb, r.Version, r.Description, r.Changes)
+	}
+}
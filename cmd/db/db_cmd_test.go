@@ -0,0 +1,47 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package db
+
+import (
+	"testing"
+
+	"github.com/ontio/mercury/store"
+	leveldb "github.com/ontio/mercury/store/leveldb"
+	"github.com/ontio/mercury/store/migrate"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequireSchema(t *testing.T) {
+	db, err := leveldb.NewMemStore()
+	assert.Nil(t, err)
+	defer db.Close()
+	assert.Nil(t, RequireSchema(db))
+	has, err := db.Has([]byte(store.SchemaVersionKey))
+	assert.Nil(t, err)
+	assert.True(t, has)
+
+	legacy, err := leveldb.NewMemStore()
+	assert.Nil(t, err)
+	defer legacy.Close()
+	assert.Nil(t, legacy.Put([]byte("Invitation_did:ont:abc_1"), []byte(`{"invitation":{"@id":"1"}}`)))
+	assert.NotNil(t, RequireSchema(legacy))
+	v, err := migrate.CurrentVersion(legacy)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, v)
+}
@@ -0,0 +1,234 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ontio/mercury/cmd"
+	"github.com/ontio/mercury/service/common"
+	"github.com/ontio/mercury/service/controller"
+	"github.com/ontio/mercury/store"
+	"github.com/ontio/mercury/store/backup"
+	leveldb "github.com/ontio/mercury/store/leveldb"
+	"github.com/ontio/mercury/store/migrate"
+	"github.com/ontio/mercury/utils"
+	"github.com/urfave/cli"
+)
+
+// maxInvalidRecords is how many invalid records import reports before giving up
+const maxInvalidRecords = 10
+
+func exportDB(ctx *cli.Context) error {
+	file := ctx.String(cmd.GetFlagName(cmd.ExportFileFlag))
+	if file == "" {
+		return fmt.Errorf("missing --%s", cmd.GetFlagName(cmd.ExportFileFlag))
+	}
+	var password []byte
+	if ctx.Bool(cmd.GetFlagName(cmd.EncryptFlag)) {
+		var err error
+		password, err = newPassword()
+		if err != nil {
+			return err
+		}
+		defer utils.ClearPasswd(password)
+	}
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	var n int
+	if ctx.Bool(cmd.GetFlagName(cmd.OnlineFlag)) {
+		n, err = exportOnline(ctx.String(cmd.GetFlagName(cmd.HttpClientFlag)), f, password)
+	} else {
+		n, err = exportOffline(ctx.String(cmd.GetFlagName(cmd.DbDirFlag)), f, password)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(file)
+		return err
+	}
+	fmt.Printf("exported %d records to %s\n", n, file)
+	return nil
+}
+
+func exportOffline(dir string, w io.Writer, password []byte) (int, error) {
+	db, err := openStore(dir)
+	if err != nil {
+		return 0, fmt.Errorf("%s, use --%s while the agent is running", err, cmd.GetFlagName(cmd.OnlineFlag))
+	}
+	defer db.Close()
+	snap, err := db.Snapshot()
+	if err != nil {
+		return 0, err
+	}
+	defer snap.Release()
+	return backup.Export(snap, w, password)
+}
+
+// exportOnline reads the export of the running agent and writes it again,
+// which checks it is complete and encrypts it locally
+func exportOnline(url string, w io.Writer, password []byte) (int, error) {
+	resp, err := http.Get(strings.TrimRight(url, "/") + common.ExportApi)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("agent export failed:%s", resp.Status)
+	}
+	er, err := backup.NewReader(resp.Body, nil)
+	if err != nil {
+		return 0, err
+	}
+	ew, err := backup.NewWriter(w, er.Header.SchemaVersion, password)
+	if err != nil {
+		return 0, err
+	}
+	n, err := er.ReadAll(ew.Write)
+	if err != nil {
+		return n, err
+	}
+	return n, ew.Close()
+}
+
+func importDB(ctx *cli.Context) error {
+	file := ctx.String(cmd.GetFlagName(cmd.ExportFileFlag))
+	if file == "" {
+		return fmt.Errorf("missing --%s", cmd.GetFlagName(cmd.ExportFileFlag))
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	db, err := createStore(ctx.String(cmd.GetFlagName(cmd.DbDirFlag)))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	n, err := Import(f, db, func() ([]byte, error) {
+		return utils.GetPassword()
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("imported %d records\n", n)
+	return nil
+}
+
+// Import reads an export into the empty database db. The records are
+// migrated to the current schema and validated in memory first, db is
+// only written if all of them are valid.
+func Import(r io.Reader, db store.Store, password func() ([]byte, error)) (int, error) {
+	iter := db.NewIterator(nil)
+	empty := !iter.Next()
+	iter.Release()
+	if !empty {
+		return 0, fmt.Errorf("database is not empty, import into a new --%s", cmd.GetFlagName(cmd.DbDirFlag))
+	}
+	er, err := backup.NewReader(r, password)
+	if err != nil {
+		return 0, err
+	}
+	if er.Header.SchemaVersion > store.SchemaVersion {
+		return 0, fmt.Errorf("export schema version %d is newer than %d, upgrade the agent", er.Header.SchemaVersion, store.SchemaVersion)
+	}
+	mem, err := leveldb.NewMemStore()
+	if err != nil {
+		return 0, err
+	}
+	defer mem.Close()
+	_, err = er.ReadAll(mem.Put)
+	if err != nil {
+		return 0, err
+	}
+	if er.Header.SchemaVersion > 0 {
+		err = mem.Put([]byte(store.SchemaVersionKey), []byte(strconv.Itoa(er.Header.SchemaVersion)))
+		if err != nil {
+			return 0, err
+		}
+	}
+	_, err = migrate.Run(mem, controller.Migrations)
+	if err != nil {
+		return 0, err
+	}
+
+	invalid := make([]string, 0)
+	miter := mem.NewIterator(nil)
+	for miter.Next() && len(invalid) < maxInvalidRecords {
+		if string(miter.Key()) == store.SchemaVersionKey {
+			continue
+		}
+		if err := controller.ValidateRecord(miter.Key(), miter.Value()); err != nil {
+			invalid = append(invalid, err.Error())
+		}
+	}
+	miter.Release()
+	if err = miter.Error(); err != nil {
+		return 0, err
+	}
+	if len(invalid) > 0 {
+		return 0, fmt.Errorf("export holds invalid records, nothing imported:\n%s", strings.Join(invalid, "\n"))
+	}
+	// write everything at once so a failed import leaves the database empty
+	batch := store.NewBatch()
+	n := 0
+	miter = mem.NewIterator(nil)
+	defer miter.Release()
+	for miter.Next() {
+		batch.Put(append([]byte{}, miter.Key()...), append([]byte{}, miter.Value()...))
+		if string(miter.Key()) != store.SchemaVersionKey {
+			n++
+		}
+	}
+	if err = miter.Error(); err != nil {
+		return 0, err
+	}
+	return n, db.Write(batch)
+}
+
+func newPassword() ([]byte, error) {
+	password, err := utils.GetPassword()
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("Re-enter ")
+	again, err := utils.GetPassword()
+	if err != nil {
+		return nil, err
+	}
+	defer utils.ClearPasswd(again)
+	if len(password) == 0 || !bytes.Equal(password, again) {
+		utils.ClearPasswd(password)
+		return nil, fmt.Errorf("passwords are empty or don't match")
+	}
+	return password, nil
+}
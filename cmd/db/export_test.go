@@ -0,0 +1,86 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package db
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ontio/mercury/common/message"
+	"github.com/ontio/mercury/store"
+	"github.com/ontio/mercury/store/backup"
+	leveldb "github.com/ontio/mercury/store/leveldb"
+	"github.com/stretchr/testify/assert"
+)
+
+func exportRecords(t *testing.T, records map[string]interface{}) []byte {
+	buf := new(bytes.Buffer)
+	ew, err := backup.NewWriter(buf, store.SchemaVersion, nil)
+	assert.Nil(t, err)
+	for k, v := range records {
+		data, err := store.NewRecord(v)
+		assert.Nil(t, err)
+		assert.Nil(t, ew.Write([]byte(k), data))
+	}
+	assert.Nil(t, ew.Close())
+	return buf.Bytes()
+}
+
+func TestImport(t *testing.T) {
+	key := string(store.Key("Invitation", "did:ont:a", "1"))
+	rec := message.InvitationRec{Invitation: message.Invitation{Id: "1"}}
+
+	db, err := leveldb.NewMemStore()
+	assert.Nil(t, err)
+	defer db.Close()
+	_, err = Import(bytes.NewReader(exportRecords(t, map[string]interface{}{
+		key:            rec,
+		"Unknown/a/b":  "x",
+		"Invitation/a": rec,
+	})), db, nil)
+	assert.NotNil(t, err)
+	iter := db.NewIterator(nil)
+	assert.False(t, iter.Next())
+	iter.Release()
+
+	n, err := Import(bytes.NewReader(exportRecords(t, map[string]interface{}{key: rec})), db, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	got := new(message.InvitationRec)
+	assert.Nil(t, store.GetRecord(db, []byte(key), got))
+	assert.Equal(t, "1", got.Invitation.Id)
+
+	_, err = Import(bytes.NewReader(exportRecords(t, map[string]interface{}{key: rec})), db, nil)
+	assert.NotNil(t, err)
+}
+
+func TestExportMissingDB(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mercury-db")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	missing := filepath.Join(dir, "missing")
+
+	_, err = exportOffline(missing, new(bytes.Buffer), nil)
+	assert.NotNil(t, err)
+	_, err = os.Stat(missing)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,271 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ontio/mercury/cmd"
+	"github.com/ontio/mercury/service/controller"
+	"github.com/ontio/mercury/store"
+	leveldb "github.com/ontio/mercury/store/leveldb"
+	"github.com/urfave/cli"
+)
+
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+
+	// maxTableValue is how much of a value the table shows
+	maxTableValue = 80
+)
+
+// InspectFilter selects the records to show, empty fields match everything
+type InspectFilter struct {
+	Type string
+	DID  string
+	ID   string
+}
+
+// Match reports whether the key parts <type>/<did>/.../<id> pass the filter
+func (f *InspectFilter) Match(parts []string) bool {
+	if f.Type != "" && parts[0] != f.Type {
+		return false
+	}
+	if f.DID != "" && (len(parts) < 2 || parts[1] != f.DID) {
+		return false
+	}
+	if f.ID != "" && (len(parts) < 3 || parts[len(parts)-1] != f.ID) {
+		return false
+	}
+	return true
+}
+
+// InspectedRecord is a record decoded for display
+type InspectedRecord struct {
+	Key      string      `json:"key"`
+	Type     string      `json:"type"`
+	Version  int         `json:"version,omitempty"`
+	Updated  int64       `json:"updated,omitempty"`
+	ExpireAt int64       `json:"expire_at,omitempty"`
+	Value    interface{} `json:"value,omitempty"`
+	Error    string      `json:"error,omitempty"`
+}
+
+func inspectDB(ctx *cli.Context) error {
+	format := ctx.String(cmd.GetFlagName(cmd.FormatFlag))
+	if format != formatTable && format != formatJSON {
+		return fmt.Errorf("unknown format %s, use %s or %s", format, formatTable, formatJSON)
+	}
+	dir := ctx.String(cmd.GetFlagName(cmd.DbDirFlag))
+	db, cleanup, err := openInspectStore(dir, ctx.Bool(cmd.GetFlagName(cmd.CopyFlag)))
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	filter := &InspectFilter{
+		Type: ctx.String(cmd.GetFlagName(cmd.RecordTypeFlag)),
+		DID:  ctx.String(cmd.GetFlagName(cmd.InspectDIDFlag)),
+		ID:   ctx.String(cmd.GetFlagName(cmd.InspectIDFlag)),
+	}
+	if *filter == (InspectFilter{}) {
+		counts, err := CountRecords(db)
+		if err != nil {
+			return err
+		}
+		return printCounts(os.Stdout, counts, format)
+	}
+	records, err := InspectRecords(db, filter)
+	if err != nil {
+		return err
+	}
+	return printRecords(os.Stdout, records, format)
+}
+
+// openInspectStore opens the database read only, or a copy of it if asked,
+// which also works while the agent holds the database
+func openInspectStore(dir string, useCopy bool) (store.Store, func(), error) {
+	if !useCopy {
+		db, err := leveldb.OpenReadOnly(dir)
+		if err != nil {
+			return nil, nil, fmt.Errorf("open database %s err:%s, use --%s to inspect a copy of a database in use", dir, err, cmd.GetFlagName(cmd.CopyFlag))
+		}
+		return db, func() { db.Close() }, nil
+	}
+	tmp, err := ioutil.TempDir("", "mercury-inspect")
+	if err != nil {
+		return nil, nil, err
+	}
+	err = copyDir(dir, tmp)
+	if err == nil {
+		var db store.Store
+		db, err = openStore(tmp)
+		if err == nil {
+			return db, func() {
+				db.Close()
+				os.RemoveAll(tmp)
+			}, nil
+		}
+	}
+	os.RemoveAll(tmp)
+	return nil, nil, err
+}
+
+// copyDir copies the files of a leveldb database except its lock, the copy
+// of a database in use may miss its latest writes
+func copyDir(src, dst string) error {
+	files, err := ioutil.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, fi := range files {
+		if fi.IsDir() || fi.Name() == "LOCK" {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(src, fi.Name()))
+		if err != nil {
+			return err
+		}
+		err = ioutil.WriteFile(filepath.Join(dst, fi.Name()), data, 0600)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CountRecords returns the number of records of each type
+func CountRecords(db store.Store) (map[string]int, error) {
+	counts := make(map[string]int)
+	iter := db.NewIterator(nil)
+	defer iter.Release()
+	for iter.Next() {
+		if string(iter.Key()) == store.SchemaVersionKey {
+			continue
+		}
+		counts[store.RecordType(iter.Key())]++
+	}
+	return counts, iter.Error()
+}
+
+// InspectRecords decodes the records passing filter, a record which can't
+// be decoded is returned with its error
+func InspectRecords(db store.Store, filter *InspectFilter) ([]InspectedRecord, error) {
+	var prefix []byte
+	if filter.Type != "" {
+		prefix = store.KeyPrefix(filter.Type)
+	}
+	records := make([]InspectedRecord, 0)
+	iter := db.NewIterator(prefix)
+	defer iter.Release()
+	for iter.Next() {
+		if string(iter.Key()) == store.SchemaVersionKey {
+			continue
+		}
+		parts, err := store.SplitKey(iter.Key())
+		if err != nil {
+			parts = []string{store.RecordType(iter.Key())}
+		}
+		if !filter.Match(parts) {
+			continue
+		}
+		ir := InspectedRecord{
+			Key:  string(iter.Key()),
+			Type: parts[0],
+		}
+		rec, v, err := controller.DecodeStoredRecord(iter.Key(), iter.Value())
+		if rec != nil {
+			ir.Version = rec.Version
+			ir.Updated = rec.Updated
+			ir.ExpireAt = rec.ExpireAt
+		}
+		if err != nil {
+			ir.Error = err.Error()
+		} else {
+			ir.Value = v
+		}
+		records = append(records, ir)
+	}
+	return records, iter.Error()
+}
+
+func printCounts(w io.Writer, counts map[string]int, format string) error {
+	if format == formatJSON {
+		return printJSON(w, counts)
+	}
+	types := make([]string, 0, len(counts))
+	for t := range counts {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "TYPE\tCOUNT")
+	for _, t := range types {
+		fmt.Fprintf(tw, "%s\t%d\n", t, counts[t])
+	}
+	return tw.Flush()
+}
+
+func printRecords(w io.Writer, records []InspectedRecord, format string) error {
+	if format == formatJSON {
+		return printJSON(w, records)
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "KEY\tVERSION\tUPDATED\tEXPIRE AT\tVALUE")
+	for _, r := range records {
+		value := "error: " + r.Error
+		if r.Error == "" {
+			data, err := json.Marshal(r.Value)
+			if err != nil {
+				return err
+			}
+			value = string(data)
+		}
+		if len(value) > maxTableValue {
+			value = value[:maxTableValue-3] + "..."
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\n", r.Key, r.Version, formatUnix(r.Updated), formatUnix(r.ExpireAt), value)
+	}
+	return tw.Flush()
+}
+
+func printJSON(w io.Writer, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
+
+func formatUnix(t int64) string {
+	if t == 0 {
+		return "-"
+	}
+	return time.Unix(t, 0).Format(time.RFC3339)
+}
@@ -0,0 +1,62 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package db
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/ontio/mercury/common/message"
+	"github.com/ontio/mercury/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInspect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mercury-db")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	db, err := openStore(dir)
+	assert.Nil(t, err)
+	assert.Nil(t, store.PutRecord(db, store.Key("Invitation", "did:ont:a", "1"), message.InvitationRec{Invitation: message.Invitation{Id: "1"}}))
+	assert.Nil(t, store.PutRecord(db, store.Key("Invitation", "did:ont:b", "2"), message.InvitationRec{Invitation: message.Invitation{Id: "2"}}))
+	assert.Nil(t, store.PutRecord(db, store.Key("Credential", "did:ont:a", "1"), message.CredentialRec{OwnerDID: "did:ont:a"}))
+
+	// the running agent holds the database
+	_, _, err = openInspectStore(dir, false)
+	assert.NotNil(t, err)
+	copied, cleanup, err := openInspectStore(dir, true)
+	assert.Nil(t, err)
+	defer cleanup()
+	db.Close()
+
+	counts, err := CountRecords(copied)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]int{"Invitation": 2, "Credential": 1}, counts)
+
+	records, err := InspectRecords(copied, &InspectFilter{DID: "did:ont:a", ID: "1"})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(records))
+	records, err = InspectRecords(copied, &InspectFilter{Type: "Invitation", DID: "did:ont:b"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(records))
+	iv, ok := records[0].Value.(*message.InvitationRec)
+	assert.True(t, ok)
+	assert.Equal(t, "2", iv.Invitation.Id)
+}
@@ -21,6 +21,7 @@ package cmd
 import (
 	"github.com/urfave/cli"
 	"strings"
+	"time"
 )
 
 const (
@@ -31,6 +32,10 @@ const (
 	DEFAULT_HTTP_IP               = "127.0.0.1"
 	DEFAULT_LOG_FILE_PATH         = "./Log/"
 	DEFAULT_STORE_DIR             = "./db_otf/"
+	DEFAULT_REDIS_NAME_SPACE      = "mercury"
+	DEFAULT_BLOB_DIR              = "./blob_otf/"
+	DEFAULT_BLOB_THRESHOLD        = 64 * 1024
+	DEFAULT_ATTACH_MAX_SIZE       = 32 * 1024 * 1024
 	DEFAULT_BLOCK_CHAIN_REST_URL  = "http://polaris2.ont.io:20334"
 	DEFAULT_BLOCK_CHAIN_RPC_URL   = "http://polaris2.ont.io:20336"
 	MIN_TRANSACTION_GAS           = 20000
@@ -48,6 +53,7 @@ const (
 	DEFAULT_CLIENT_REST_URL       = "http://127.0.0.1:8080"
 	DEFAULT_REQ_CREDENTIAL_DATA   = ""
 	DEFAULT_REQ_PRESENTATION_DATA = ""
+	DEFAULT_GC_INTERVAL           = time.Hour
 )
 
 var (
@@ -188,6 +194,131 @@ var (
 		Name:  "presentation-id",
 		Usage: "presentation id",
 	}
+	RouterFlag = cli.StringFlag{
+		Name:  "router",
+		Usage: "comma separated router list `<did#service,...>`",
+	}
+	LabelFlag = cli.StringFlag{
+		Name:  "label",
+		Usage: "label shown to the other party",
+	}
+	InvitationUrlFlag = cli.StringFlag{
+		Name:  "invitation-url",
+		Usage: "invitation `<url>` with the c_i parameter",
+	}
+	HandshakeProtocolsFlag = cli.StringFlag{
+		Name:  "handshake-protocols",
+		Usage: "comma separated `<protocols>` the invitation accepts, connections or didexchange, all by default",
+	}
+	ProtocolFlag = cli.StringFlag{
+		Name:  "protocol",
+		Usage: "handshake `<protocol>`, connections or didexchange",
+		Value: "connections",
+	}
+	MultiUseFlag = cli.BoolFlag{
+		Name:  "multi-use",
+		Usage: "the invitation accepts several connection requests",
+	}
+	MaxUsesFlag = cli.IntFlag{
+		Name:  "max-uses",
+		Usage: "accept at most `<n>` connection requests with a multi use invitation, 0 is unlimited",
+	}
+	ExpiresInFlag = cli.DurationFlag{
+		Name:  "expires-in",
+		Usage: "the invitation expires after `<duration>`, e.g. 72h, 0 never expires",
+	}
+	InvitationIdFlag = cli.StringFlag{
+		Name:  "invitation-id",
+		Usage: "invitation id",
+	}
+	ConnectionStateFlag = cli.StringFlag{
+		Name:  "state",
+		Usage: "only connections in `<state>`: invited, requested, responded or completed",
+	}
+	TheirDIDFlag = cli.StringFlag{
+		Name:  "their-did",
+		Usage: "only connections with `<did>`",
+	}
+	OffsetFlag = cli.IntFlag{
+		Name:  "offset",
+		Usage: "skip the first `<n>` results",
+	}
+	LimitFlag = cli.IntFlag{
+		Name:  "limit",
+		Usage: "return at most `<n>` results, 0 returns all",
+	}
+	RequestIdFlag = cli.StringFlag{
+		Name:  "request-id",
+		Usage: "connection request id",
+	}
+	AliasFlag = cli.StringFlag{
+		Name:  "alias",
+		Usage: "connection `<alias>`",
+	}
+	TagsFlag = cli.StringFlag{
+		Name:  "tags",
+		Usage: "comma separated connection `<tags>`",
+	}
+	MetadataFlag = cli.StringFlag{
+		Name:  "metadata",
+		Usage: "connection metadata `<json>`, null clears it",
+	}
+	MetadataQueryFlag = cli.StringFlag{
+		Name:  "metadata",
+		Usage: "json object of the metadata `<values>` the connections have",
+	}
+	CommentFlag = cli.StringFlag{
+		Name:  "comment",
+		Usage: "message `<comment>`",
+	}
+	PingTimeoutFlag = cli.DurationFlag{
+		Name:  "timeout",
+		Usage: "`<duration>` to wait for the ping response",
+		Value: 5 * time.Second,
+	}
+	NoResponseFlag = cli.BoolFlag{
+		Name:  "no-response",
+		Usage: "don't ask for a ping response",
+	}
+	ThreadIdFlag = cli.StringFlag{
+		Name:  "thread-id",
+		Usage: "message thread `<id>`",
+	}
+	ProblemCodeFlag = cli.StringFlag{
+		Name:  "code",
+		Usage: "problem `<code>`",
+	}
+	NewDIDFlag = cli.StringFlag{
+		Name:  "new-did",
+		Usage: "`<did>` replacing the did of the connection",
+	}
+	FeaturesQueryFlag = cli.StringFlag{
+		Name:  "query",
+		Usage: "protocol `<id>` to look for, a * at the end matches any suffix",
+	}
+	RefreshFlag = cli.BoolFlag{
+		Name:  "refresh",
+		Usage: "query the peer instead of using the cached features",
+	}
+	DiscoverTimeoutFlag = cli.DurationFlag{
+		Name:  "timeout",
+		Usage: "`<duration>` to wait for the disclosed features",
+		Value: 5 * time.Second,
+	}
+	QRFormatFlag = cli.StringFlag{
+		Name:  "qr-format",
+		Usage: "qr code `<format>`, png or svg",
+		Value: "png",
+	}
+	QRSizeFlag = cli.IntFlag{
+		Name:  "qr-size",
+		Usage: "qr code size in `<pixels>`",
+		Value: 256,
+	}
+	QRFileFlag = cli.StringFlag{
+		Name:  "qr-file",
+		Usage: "write the qr code to `<file>`",
+	}
 	FromDID = cli.StringFlag{
 		Name:  "from-did",
 		Usage: "from did",
@@ -196,6 +327,156 @@ var (
 		Name:  "to-did",
 		Usage: "to did",
 	}
+	RedisUrlFlag = cli.StringFlag{
+		Name:  "redis-url",
+		Usage: "keep the records in a redis server at `<redis://[:password@]host:port/db>` shared by several agents instead of the local database",
+	}
+	BlobDirFlag = cli.StringFlag{
+		Name:  "blob-dir",
+		Usage: "store attachment blobs in `<dir>`",
+		Value: DEFAULT_BLOB_DIR,
+	}
+	BlobThresholdFlag = cli.Int64Flag{
+		Name:  "blob-threshold",
+		Usage: "send attachments larger than `<bytes>` as blob links instead of inline, 0 keeps them inline",
+		Value: DEFAULT_BLOB_THRESHOLD,
+	}
+	PublicUrlFlag = cli.StringFlag{
+		Name:  "public-url",
+		Usage: "public `<url>` of the agent in blob links and invitation urls, default is http(s)://<ip>:<port>",
+	}
+	AttachMaxSizeFlag = cli.Int64Flag{
+		Name:  "attach-max-size",
+		Usage: "reject received attachments larger than `<bytes>`",
+		Value: DEFAULT_ATTACH_MAX_SIZE,
+	}
+	AttachMimeTypesFlag = cli.StringFlag{
+		Name:  "attach-mime-types",
+		Usage: "only accept received attachments of the mime types `<list>`, e.g. image/*,application/pdf, empty accepts all",
+	}
+	DbDirFlag = cli.StringFlag{
+		Name:  "db-dir",
+		Usage: "agent database `<dir>`",
+		Value: DEFAULT_STORE_DIR,
+	}
+	DryRunFlag = cli.BoolFlag{
+		Name:  "dry-run",
+		Usage: "report the changes without writing the database",
+	}
+	BackupDirFlag = cli.StringFlag{
+		Name:  "backup-dir",
+		Usage: "backup the database to `<dir>` before writing, default is <db-dir>.bak.<time>",
+	}
+	NoBackupFlag = cli.BoolFlag{
+		Name:  "no-backup",
+		Usage: "do not backup the database before writing",
+	}
+	RetentionFlag = cli.StringFlag{
+		Name:  "retention",
+		Usage: "override record retention per type after last update, e.g. `Invitation=24h,ConnectionReq=720h`, 0 keeps the records. Records still waiting for an answer are kept",
+	}
+	GcIntervalFlag = cli.DurationFlag{
+		Name:  "gc-interval",
+		Usage: "interval of removing expired records, 0 disables it",
+		Value: DEFAULT_GC_INTERVAL,
+	}
+	HealthIntervalFlag = cli.DurationFlag{
+		Name:  "health-interval",
+		Usage: "interval of probing the connections with trust pings, 0 disables it",
+	}
+	HealthTimeoutFlag = cli.DurationFlag{
+		Name:  "health-timeout",
+		Usage: "`<duration>` to wait for the response of a probe",
+		Value: 5 * time.Second,
+	}
+	HealthMaxFailuresFlag = cli.IntFlag{
+		Name:  "health-max-failures",
+		Usage: "probes failed in a row before a connection is stale",
+		Value: 3,
+	}
+	EventWebhookFlag = cli.StringFlag{
+		Name:  "event-webhook",
+		Usage: "`<url>` the connection health events are posted to as json",
+	}
+	PolicyFileFlag = cli.StringFlag{
+		Name:  "policy-file",
+		Usage: "json `<file>` of the DIDs allowed to connect, send messages and forward, reloaded on SIGHUP",
+	}
+	ForwardMessagesPerDayFlag = cli.Int64Flag{
+		Name:  "forward-messages-per-day",
+		Usage: "default quota of messages forwarded a day for a DID registered for mediation, 0 is unlimited",
+	}
+	ForwardBytesPerDayFlag = cli.Int64Flag{
+		Name:  "forward-bytes-per-day",
+		Usage: "default quota of bytes forwarded a day for a DID registered for mediation, 0 is unlimited",
+	}
+	MessagesPerDayFlag = cli.Int64Flag{
+		Name:  "messages-per-day",
+		Usage: "quota of `<n>` messages forwarded a day, 0 takes the default of the agent",
+	}
+	BytesPerDayFlag = cli.Int64Flag{
+		Name:  "bytes-per-day",
+		Usage: "quota of `<n>` bytes forwarded a day, 0 takes the default of the agent",
+	}
+	UsageDaysFlag = cli.IntFlag{
+		Name:  "days",
+		Usage: "list the usage of the last `<n>` days",
+		Value: 1,
+	}
+	GrantMediationFlag = cli.BoolFlag{
+		Name:  "grant-mediation",
+		Usage: "grant the mediate requests of the connections the policy lets the agent forward for",
+	}
+	MediatorFlag = cli.StringFlag{
+		Name:  "mediator",
+		Usage: "`<did>` of a connection which granted mediation, its router entry is added to the invitation",
+	}
+	AddKeysFlag = cli.StringFlag{
+		Name:  "add",
+		Usage: "comma separated `<dids>` the mediator forwards for",
+	}
+	RemoveKeysFlag = cli.StringFlag{
+		Name:  "remove",
+		Usage: "comma separated `<dids>` the mediator stops forwarding for",
+	}
+	MediationTimeoutFlag = cli.DurationFlag{
+		Name:  "timeout",
+		Usage: "`<duration>` to wait for the answer of the mediator",
+		Value: 5 * time.Second,
+	}
+	ExportFileFlag = cli.StringFlag{
+		Name:  "file",
+		Usage: "export `<file>` to write or read",
+	}
+	EncryptFlag = cli.BoolFlag{
+		Name:  "encrypt",
+		Usage: "encrypt the export with a password",
+	}
+	OnlineFlag = cli.BoolFlag{
+		Name:  "online",
+		Usage: "export from the running agent at --restful instead of opening the database",
+	}
+	RecordTypeFlag = cli.StringFlag{
+		Name:  "type",
+		Usage: "only records of `<type>`, e.g. Invitation, ConnectionReq, Credential",
+	}
+	InspectDIDFlag = cli.StringFlag{
+		Name:  "did",
+		Usage: "only records of `<did>`",
+	}
+	InspectIDFlag = cli.StringFlag{
+		Name:  "id",
+		Usage: "only records with `<id>`",
+	}
+	FormatFlag = cli.StringFlag{
+		Name:  "format",
+		Usage: "output `<format>`, table or json",
+		Value: "table",
+	}
+	CopyFlag = cli.BoolFlag{
+		Name:  "copy",
+		Usage: "inspect a temporary copy of the database, needed while the agent is running",
+	}
 )
 
 //GetFlagName deal with short flag, and return the flag name whether flag name have short name
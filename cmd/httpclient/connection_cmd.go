@@ -0,0 +1,245 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package httpclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ontio/mercury/cmd"
+	"github.com/ontio/mercury/common/message"
+	"github.com/ontio/mercury/service/common"
+	"github.com/urfave/cli"
+)
+
+func listConnections(ctx *cli.Context) error {
+	req := &message.ListConnectionsRequest{
+		DID:      ctx.String(cmd.GetFlagName(cmd.FromDID)),
+		State:    ctx.String(cmd.GetFlagName(cmd.ConnectionStateFlag)),
+		TheirDid: ctx.String(cmd.GetFlagName(cmd.TheirDIDFlag)),
+		Label:    ctx.String(cmd.GetFlagName(cmd.LabelFlag)),
+		Alias:    ctx.String(cmd.GetFlagName(cmd.AliasFlag)),
+		Tags:     splitList(ctx.String(cmd.GetFlagName(cmd.TagsFlag))),
+		Offset:   ctx.Int(cmd.GetFlagName(cmd.OffsetFlag)),
+		Limit:    ctx.Int(cmd.GetFlagName(cmd.LimitFlag)),
+	}
+	if metadata := ctx.String(cmd.GetFlagName(cmd.MetadataQueryFlag)); metadata != "" {
+		if err := json.Unmarshal([]byte(metadata), &req.Metadata); err != nil {
+			return fmt.Errorf("invalid metadata:%s", err)
+		}
+	}
+	body, err := postAdminMsg(ctx, common.ListConnectionsType, req)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", body)
+	return nil
+}
+
+func updateConnection(ctx *cli.Context) error {
+	req := &message.UpdateConnectionRequest{
+		DID:      ctx.String(cmd.GetFlagName(cmd.FromDID)),
+		TheirDid: ctx.String(cmd.GetFlagName(cmd.TheirDIDFlag)),
+	}
+	if ctx.IsSet(cmd.GetFlagName(cmd.AliasFlag)) {
+		alias := ctx.String(cmd.GetFlagName(cmd.AliasFlag))
+		req.Alias = &alias
+	}
+	if ctx.IsSet(cmd.GetFlagName(cmd.TagsFlag)) {
+		tags := splitList(ctx.String(cmd.GetFlagName(cmd.TagsFlag)))
+		req.Tags = &tags
+	}
+	if metadata := ctx.String(cmd.GetFlagName(cmd.MetadataFlag)); metadata != "" {
+		if !json.Valid([]byte(metadata)) {
+			return fmt.Errorf("metadata is not valid json")
+		}
+		req.Metadata = json.RawMessage(metadata)
+	}
+	body, err := postAdminMsg(ctx, common.UpdateConnectionType, req)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", body)
+	return nil
+}
+
+func queryConnectionRequest(ctx *cli.Context) error {
+	return postPendingRequest(ctx, common.QueryConnectionRequestType)
+}
+
+func cancelConnectionRequest(ctx *cli.Context) error {
+	return postPendingRequest(ctx, common.CancelConnectionRequestType)
+}
+
+func postPendingRequest(ctx *cli.Context, msgType common.MessageType) error {
+	req := &message.PendingRequest{
+		DID: ctx.String(cmd.GetFlagName(cmd.FromDID)),
+		Id:  ctx.String(cmd.GetFlagName(cmd.RequestIdFlag)),
+	}
+	body, err := postAdminMsg(ctx, msgType, req)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", body)
+	return nil
+}
+
+func trustPing(ctx *cli.Context) error {
+	responseRequested := !ctx.Bool(cmd.GetFlagName(cmd.NoResponseFlag))
+	req := &message.SendTrustPingRequest{
+		DID:               ctx.String(cmd.GetFlagName(cmd.FromDID)),
+		TheirDid:          ctx.String(cmd.GetFlagName(cmd.TheirDIDFlag)),
+		Comment:           ctx.String(cmd.GetFlagName(cmd.CommentFlag)),
+		ResponseRequested: &responseRequested,
+		Timeout:           int64(ctx.Duration(cmd.GetFlagName(cmd.PingTimeoutFlag)) / time.Millisecond),
+	}
+	body, err := postAdminMsg(ctx, common.SendTrustPingType, req)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", body)
+	return nil
+}
+
+func queryProblemReports(ctx *cli.Context) error {
+	req := &message.QueryProblemReportsRequest{
+		DID:      ctx.String(cmd.GetFlagName(cmd.FromDID)),
+		TheirDid: ctx.String(cmd.GetFlagName(cmd.TheirDIDFlag)),
+		ThreadId: ctx.String(cmd.GetFlagName(cmd.ThreadIdFlag)),
+		Code:     ctx.String(cmd.GetFlagName(cmd.ProblemCodeFlag)),
+		Offset:   ctx.Int(cmd.GetFlagName(cmd.OffsetFlag)),
+		Limit:    ctx.Int(cmd.GetFlagName(cmd.LimitFlag)),
+	}
+	body, err := postAdminMsg(ctx, common.QueryProblemReportsType, req)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", body)
+	return nil
+}
+
+func rotateDID(ctx *cli.Context) error {
+	req := &message.RotateDIDRequest{
+		DID:       ctx.String(cmd.GetFlagName(cmd.FromDID)),
+		TheirDid:  ctx.String(cmd.GetFlagName(cmd.TheirDIDFlag)),
+		NewDid:    ctx.String(cmd.GetFlagName(cmd.NewDIDFlag)),
+		NewRouter: splitList(ctx.String(cmd.GetFlagName(cmd.RouterFlag))),
+	}
+	body, err := postAdminMsg(ctx, common.RotateDIDType, req)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", body)
+	return nil
+}
+
+func discoverFeatures(ctx *cli.Context) error {
+	req := &message.DiscoverFeaturesRequest{
+		DID:      ctx.String(cmd.GetFlagName(cmd.FromDID)),
+		TheirDid: ctx.String(cmd.GetFlagName(cmd.TheirDIDFlag)),
+		Query:    ctx.String(cmd.GetFlagName(cmd.FeaturesQueryFlag)),
+		Refresh:  ctx.Bool(cmd.GetFlagName(cmd.RefreshFlag)),
+		Timeout:  int64(ctx.Duration(cmd.GetFlagName(cmd.DiscoverTimeoutFlag)) / time.Millisecond),
+	}
+	body, err := postAdminMsg(ctx, common.DiscoverFeaturesType, req)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", body)
+	return nil
+}
+
+func reloadPolicy(ctx *cli.Context) error {
+	body, err := postAdminMsg(ctx, common.ReloadPolicyType, &message.ReloadPolicyRequest{})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", body)
+	return nil
+}
+
+func registerMediation(ctx *cli.Context) error {
+	req := &message.RegisterMediationRequest{
+		TheirDid:       ctx.String(cmd.GetFlagName(cmd.TheirDIDFlag)),
+		MessagesPerDay: ctx.Int64(cmd.GetFlagName(cmd.MessagesPerDayFlag)),
+		BytesPerDay:    ctx.Int64(cmd.GetFlagName(cmd.BytesPerDayFlag)),
+	}
+	body, err := postAdminMsg(ctx, common.RegisterMediationType, req)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", body)
+	return nil
+}
+
+func removeMediation(ctx *cli.Context) error {
+	req := &message.RemoveMediationRequest{
+		TheirDid: ctx.String(cmd.GetFlagName(cmd.TheirDIDFlag)),
+	}
+	body, err := postAdminMsg(ctx, common.RemoveMediationType, req)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", body)
+	return nil
+}
+
+func queryForwardUsage(ctx *cli.Context) error {
+	req := &message.QueryForwardUsageRequest{
+		TheirDid: ctx.String(cmd.GetFlagName(cmd.TheirDIDFlag)),
+		Days:     ctx.Int(cmd.GetFlagName(cmd.UsageDaysFlag)),
+	}
+	body, err := postAdminMsg(ctx, common.QueryForwardUsageType, req)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", body)
+	return nil
+}
+
+func requestMediation(ctx *cli.Context) error {
+	req := &message.RequestMediationRequest{
+		DID:      ctx.String(cmd.GetFlagName(cmd.FromDID)),
+		TheirDid: ctx.String(cmd.GetFlagName(cmd.TheirDIDFlag)),
+		Timeout:  int64(ctx.Duration(cmd.GetFlagName(cmd.MediationTimeoutFlag)) / time.Millisecond),
+	}
+	body, err := postAdminMsg(ctx, common.RequestMediationType, req)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", body)
+	return nil
+}
+
+func updateKeylist(ctx *cli.Context) error {
+	req := &message.UpdateKeylistRequest{
+		DID:      ctx.String(cmd.GetFlagName(cmd.FromDID)),
+		TheirDid: ctx.String(cmd.GetFlagName(cmd.TheirDIDFlag)),
+		Add:      splitList(ctx.String(cmd.GetFlagName(cmd.AddKeysFlag))),
+		Remove:   splitList(ctx.String(cmd.GetFlagName(cmd.RemoveKeysFlag))),
+		Timeout:  int64(ctx.Duration(cmd.GetFlagName(cmd.MediationTimeoutFlag)) / time.Millisecond),
+	}
+	body, err := postAdminMsg(ctx, common.UpdateKeylistType, req)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", body)
+	return nil
+}
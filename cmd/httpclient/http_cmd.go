@@ -151,6 +151,309 @@ var HttpClientCmd = cli.Command{
 				cmd.PresentationIdFlag,
 			},
 		},
+		{
+			Action:      createInvitation,
+			Name:        "createinvitation",
+			Usage:       "create an invitation url",
+			Description: "the agent creates an invitation to connect to --from-did over --router and prints its url",
+			Flags: []cli.Flag{
+				cmd.HttpClientFlag,
+				cmd.RpcUrlFlag,
+				cmd.FromDID,
+				cmd.ToDID,
+				cmd.RouterFlag,
+				cmd.LabelFlag,
+				cmd.MultiUseFlag,
+				cmd.MaxUsesFlag,
+				cmd.ExpiresInFlag,
+				cmd.HandshakeProtocolsFlag,
+				cmd.MediatorFlag,
+			},
+		},
+		{
+			Action:      acceptInvitation,
+			Name:        "acceptinvitation",
+			Usage:       "accept an invitation url",
+			Description: "the agent sends a connection request from --from-did over --router to the inviter with the handshake --protocol",
+			Flags: []cli.Flag{
+				cmd.HttpClientFlag,
+				cmd.RpcUrlFlag,
+				cmd.FromDID,
+				cmd.ToDID,
+				cmd.RouterFlag,
+				cmd.LabelFlag,
+				cmd.InvitationUrlFlag,
+				cmd.ProtocolFlag,
+			},
+		},
+		{
+			Action:      invitationQRCode,
+			Name:        "invitationqr",
+			Usage:       "write the qr code of an invitation url to a file",
+			Description: "render the qr code of --invitation-url locally, or create an invitation like createinvitation and render its url",
+			Flags: []cli.Flag{
+				cmd.HttpClientFlag,
+				cmd.RpcUrlFlag,
+				cmd.FromDID,
+				cmd.ToDID,
+				cmd.RouterFlag,
+				cmd.LabelFlag,
+				cmd.MultiUseFlag,
+				cmd.MaxUsesFlag,
+				cmd.ExpiresInFlag,
+				cmd.HandshakeProtocolsFlag,
+				cmd.MediatorFlag,
+				cmd.InvitationUrlFlag,
+				cmd.QRFormatFlag,
+				cmd.QRSizeFlag,
+				cmd.QRFileFlag,
+			},
+		},
+		{
+			Action:      queryInvitation,
+			Name:        "queryinvitation",
+			Usage:       "query an invitation and its uses",
+			Description: "query the invitation --invitation-id of --from-did",
+			Flags: []cli.Flag{
+				cmd.HttpClientFlag,
+				cmd.RpcUrlFlag,
+				cmd.FromDID,
+				cmd.ToDID,
+				cmd.InvitationIdFlag,
+			},
+		},
+		{
+			Action:      revokeInvitation,
+			Name:        "revokeinvitation",
+			Usage:       "revoke an invitation",
+			Description: "reject the later connection requests of the invitation --invitation-id of --from-did",
+			Flags: []cli.Flag{
+				cmd.HttpClientFlag,
+				cmd.RpcUrlFlag,
+				cmd.FromDID,
+				cmd.ToDID,
+				cmd.InvitationIdFlag,
+			},
+		},
+		{
+			Action:      listConnections,
+			Name:        "listconnections",
+			Usage:       "list the connections of a did",
+			Description: "list the invitations, pending requests and connections of --from-did, --label and --alias match a part, --tags matches all tags",
+			Flags: []cli.Flag{
+				cmd.HttpClientFlag,
+				cmd.RpcUrlFlag,
+				cmd.FromDID,
+				cmd.ToDID,
+				cmd.ConnectionStateFlag,
+				cmd.TheirDIDFlag,
+				cmd.LabelFlag,
+				cmd.AliasFlag,
+				cmd.TagsFlag,
+				cmd.MetadataQueryFlag,
+				cmd.OffsetFlag,
+				cmd.LimitFlag,
+			},
+		},
+		{
+			Action:      updateConnection,
+			Name:        "updateconnection",
+			Usage:       "update the metadata of a connection",
+			Description: "set the alias, tags or metadata of the connection of --from-did with --their-did, flags left out are kept",
+			Flags: []cli.Flag{
+				cmd.HttpClientFlag,
+				cmd.RpcUrlFlag,
+				cmd.FromDID,
+				cmd.ToDID,
+				cmd.TheirDIDFlag,
+				cmd.AliasFlag,
+				cmd.TagsFlag,
+				cmd.MetadataFlag,
+			},
+		},
+		{
+			Action:      queryConnectionRequest,
+			Name:        "queryconnectionrequest",
+			Usage:       "query a connection request",
+			Description: "query the connection request --request-id sent or received by --from-did",
+			Flags: []cli.Flag{
+				cmd.HttpClientFlag,
+				cmd.RpcUrlFlag,
+				cmd.FromDID,
+				cmd.ToDID,
+				cmd.RequestIdFlag,
+			},
+		},
+		{
+			Action:      cancelConnectionRequest,
+			Name:        "cancelconnectionrequest",
+			Usage:       "cancel a pending connection request",
+			Description: "cancel the connection request --request-id sent or received by --from-did",
+			Flags: []cli.Flag{
+				cmd.HttpClientFlag,
+				cmd.RpcUrlFlag,
+				cmd.FromDID,
+				cmd.ToDID,
+				cmd.RequestIdFlag,
+			},
+		},
+		{
+			Action:      trustPing,
+			Name:        "trustping",
+			Usage:       "ping a connection",
+			Description: "send a trust ping from --from-did to --their-did and print the round trip time",
+			Flags: []cli.Flag{
+				cmd.HttpClientFlag,
+				cmd.RpcUrlFlag,
+				cmd.FromDID,
+				cmd.ToDID,
+				cmd.TheirDIDFlag,
+				cmd.CommentFlag,
+				cmd.PingTimeoutFlag,
+				cmd.NoResponseFlag,
+			},
+		},
+		{
+			Action:      queryProblemReports,
+			Name:        "queryproblemreports",
+			Usage:       "list the received problem reports",
+			Description: "list the problem reports received by --from-did newest first, optionally only from --their-did, on --thread-id or with --code",
+			Flags: []cli.Flag{
+				cmd.HttpClientFlag,
+				cmd.RpcUrlFlag,
+				cmd.FromDID,
+				cmd.ToDID,
+				cmd.TheirDIDFlag,
+				cmd.ThreadIdFlag,
+				cmd.ProblemCodeFlag,
+				cmd.OffsetFlag,
+				cmd.LimitFlag,
+			},
+		},
+		{
+			Action:      rotateDID,
+			Name:        "rotatedid",
+			Usage:       "rotate the did of a connection",
+			Description: "move the connection of --from-did with --their-did to --new-did reached through --router, once the other party acks",
+			Flags: []cli.Flag{
+				cmd.HttpClientFlag,
+				cmd.RpcUrlFlag,
+				cmd.FromDID,
+				cmd.ToDID,
+				cmd.TheirDIDFlag,
+				cmd.NewDIDFlag,
+				cmd.RouterFlag,
+			},
+		},
+		{
+			Action:      discoverFeatures,
+			Name:        "discoverfeatures",
+			Usage:       "list the protocols a connection supports",
+			Description: "print the protocols --their-did disclosed to --from-did matching --query, cached for a day unless --refresh",
+			Flags: []cli.Flag{
+				cmd.HttpClientFlag,
+				cmd.RpcUrlFlag,
+				cmd.FromDID,
+				cmd.ToDID,
+				cmd.TheirDIDFlag,
+				cmd.FeaturesQueryFlag,
+				cmd.RefreshFlag,
+				cmd.DiscoverTimeoutFlag,
+			},
+		},
+		{
+			Action:      reloadPolicy,
+			Name:        "reloadpolicy",
+			Usage:       "reload the policy file of the agent",
+			Description: "make a local agent read its --policy-file again and print the loaded policy",
+			Flags: []cli.Flag{
+				cmd.HttpClientFlag,
+				cmd.RpcUrlFlag,
+				cmd.FromDID,
+				cmd.ToDID,
+			},
+		},
+		{
+			Action:      registerMediation,
+			Name:        "registermediation",
+			Usage:       "forward messages for a did",
+			Description: "let a local agent forward messages for --their-did, up to --messages-per-day and --bytes-per-day",
+			Flags: []cli.Flag{
+				cmd.HttpClientFlag,
+				cmd.RpcUrlFlag,
+				cmd.FromDID,
+				cmd.ToDID,
+				cmd.TheirDIDFlag,
+				cmd.MessagesPerDayFlag,
+				cmd.BytesPerDayFlag,
+			},
+		},
+		{
+			Action:      removeMediation,
+			Name:        "removemediation",
+			Usage:       "stop forwarding messages for a did",
+			Description: "make a local agent stop forwarding messages for --their-did",
+			Flags: []cli.Flag{
+				cmd.HttpClientFlag,
+				cmd.RpcUrlFlag,
+				cmd.FromDID,
+				cmd.ToDID,
+				cmd.TheirDIDFlag,
+			},
+		},
+		{
+			Action:      queryForwardUsage,
+			Name:        "queryforwardusage",
+			Usage:       "print the forward quotas and usage of a did",
+			Description: "print the quotas of --their-did and what a local agent forwarded for it in the last --days days",
+			Flags: []cli.Flag{
+				cmd.HttpClientFlag,
+				cmd.RpcUrlFlag,
+				cmd.FromDID,
+				cmd.ToDID,
+				cmd.TheirDIDFlag,
+				cmd.UsageDaysFlag,
+			},
+		},
+		{
+			Action:      requestMediation,
+			Name:        "requestmediation",
+			Usage:       "ask a connection to forward messages for a did",
+			Description: "send a mediate request from --from-did to --their-did and print the grant with the router entry for invitations",
+			Flags: []cli.Flag{
+				cmd.HttpClientFlag,
+				cmd.RpcUrlFlag,
+				cmd.FromDID,
+				cmd.ToDID,
+				cmd.TheirDIDFlag,
+				cmd.MediationTimeoutFlag,
+			},
+		},
+		{
+			Action:      updateKeylist,
+			Name:        "updatekeylist",
+			Usage:       "change the dids a mediator forwards for",
+			Description: "ask the mediator --their-did, which granted mediation to --from-did, to also forward for the --add dids and stop for the --remove dids",
+			Flags: []cli.Flag{
+				cmd.HttpClientFlag,
+				cmd.RpcUrlFlag,
+				cmd.FromDID,
+				cmd.ToDID,
+				cmd.TheirDIDFlag,
+				cmd.AddKeysFlag,
+				cmd.RemoveKeysFlag,
+				cmd.MediationTimeoutFlag,
+			},
+		},
+		{
+			Action:      parseInvitation,
+			Name:        "parseinvitation",
+			Usage:       "print the invitation of an invitation url",
+			Description: "decode an invitation url locally",
+			Flags: []cli.Flag{
+				cmd.InvitationUrlFlag,
+			},
+		},
 	},
 }
 
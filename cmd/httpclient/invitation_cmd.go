@@ -0,0 +1,204 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package httpclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/ontio/mercury/cmd"
+	"github.com/ontio/mercury/common/message"
+	"github.com/ontio/mercury/common/packager"
+	"github.com/ontio/mercury/service/common"
+	"github.com/ontio/mercury/utils"
+	"github.com/urfave/cli"
+)
+
+func newCreateInvitationRequest(ctx *cli.Context) *message.CreateInvitationRequest {
+	req := &message.CreateInvitationRequest{
+		Did:    ctx.String(cmd.GetFlagName(cmd.FromDID)),
+		Label:  ctx.String(cmd.GetFlagName(cmd.LabelFlag)),
+		Router: splitList(ctx.String(cmd.GetFlagName(cmd.RouterFlag))),
+		Policy: message.InvitationPolicy{
+			MultiUse: ctx.Bool(cmd.GetFlagName(cmd.MultiUseFlag)),
+			MaxUses:  ctx.Int(cmd.GetFlagName(cmd.MaxUsesFlag)),
+		},
+		HandshakeProtocols: splitList(ctx.String(cmd.GetFlagName(cmd.HandshakeProtocolsFlag))),
+		Mediator:           ctx.String(cmd.GetFlagName(cmd.MediatorFlag)),
+	}
+	if ttl := ctx.Duration(cmd.GetFlagName(cmd.ExpiresInFlag)); ttl > 0 {
+		req.Policy.ExpireAt = time.Now().Add(ttl).Unix()
+	}
+	return req
+}
+
+func createInvitation(ctx *cli.Context) error {
+	req := newCreateInvitationRequest(ctx)
+	body, err := postAdminMsg(ctx, common.CreateInvitationType, req)
+	if err != nil {
+		return fmt.Errorf("CreateInvitation err:%s", err)
+	}
+	fmt.Printf("%s\n", body)
+	return nil
+}
+
+func acceptInvitation(ctx *cli.Context) error {
+	req := &message.AcceptInvitationRequest{
+		Url:      ctx.String(cmd.GetFlagName(cmd.InvitationUrlFlag)),
+		MyDid:    ctx.String(cmd.GetFlagName(cmd.FromDID)),
+		MyRouter: splitList(ctx.String(cmd.GetFlagName(cmd.RouterFlag))),
+		Label:    ctx.String(cmd.GetFlagName(cmd.LabelFlag)),
+		Protocol: ctx.String(cmd.GetFlagName(cmd.ProtocolFlag)),
+	}
+	if _, err := message.ParseInvitationURL(req.Url); err != nil {
+		return err
+	}
+	body, err := postAdminMsg(ctx, common.AcceptInvitationType, req)
+	if err != nil {
+		return fmt.Errorf("AcceptInvitation err:%s", err)
+	}
+	fmt.Printf("%s\n", body)
+	return nil
+}
+
+func invitationQRCode(ctx *cli.Context) error {
+	file := ctx.String(cmd.GetFlagName(cmd.QRFileFlag))
+	if file == "" {
+		return fmt.Errorf("--%s is required", cmd.GetFlagName(cmd.QRFileFlag))
+	}
+	format := ctx.String(cmd.GetFlagName(cmd.QRFormatFlag))
+	size := ctx.Int(cmd.GetFlagName(cmd.QRSizeFlag))
+	var img []byte
+	url := ctx.String(cmd.GetFlagName(cmd.InvitationUrlFlag))
+	if url != "" {
+		if _, err := message.ParseInvitationURL(url); err != nil {
+			return err
+		}
+		var err error
+		img, _, err = utils.QRCode(url, format, size)
+		if err != nil {
+			return err
+		}
+	} else {
+		req := newCreateInvitationRequest(ctx)
+		req.QRCode = format
+		req.QRSize = size
+		body, err := postAdminMsg(ctx, common.CreateInvitationType, req)
+		if err != nil {
+			return fmt.Errorf("CreateInvitation err:%s", err)
+		}
+		res := &struct {
+			Code int                              `json:"code"`
+			Msg  string                           `json:"msg"`
+			Data message.CreateInvitationResponse `json:"data"`
+		}{}
+		if err = json.Unmarshal(body, res); err != nil {
+			return fmt.Errorf("invalid response %s:%s", body, err)
+		}
+		if res.Code != message.SUCCEED_CODE || res.Data.QRCode == nil {
+			return fmt.Errorf("CreateInvitation failed:%s", res.Msg)
+		}
+		img, err = utils.Base64Decode(res.Data.QRCode.Base64)
+		if err != nil {
+			return err
+		}
+		url = res.Data.Url
+	}
+	if err := ioutil.WriteFile(file, img, 0644); err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", url)
+	return nil
+}
+
+func queryInvitation(ctx *cli.Context) error {
+	return postInvitationRequest(ctx, common.QueryInvitationType)
+}
+
+func revokeInvitation(ctx *cli.Context) error {
+	return postInvitationRequest(ctx, common.RevokeInvitationType)
+}
+
+func postInvitationRequest(ctx *cli.Context, msgType common.MessageType) error {
+	req := &message.InvitationRequest{
+		Did: ctx.String(cmd.GetFlagName(cmd.FromDID)),
+		Id:  ctx.String(cmd.GetFlagName(cmd.InvitationIdFlag)),
+	}
+	body, err := postAdminMsg(ctx, msgType, req)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", body)
+	return nil
+}
+
+func parseInvitation(ctx *cli.Context) error {
+	iv, err := message.ParseInvitationURL(ctx.String(cmd.GetFlagName(cmd.InvitationUrlFlag)))
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(iv, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", data)
+	return nil
+}
+
+// splitList splits a comma separated flag value like a router list
+func splitList(s string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// postAdminMsg packs req from --from-did to the agent at --to-did and posts
+// it to the api of msgType
+func postAdminMsg(ctx *cli.Context, msgType common.MessageType, req interface{}) ([]byte, error) {
+	reqData, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	pack := initPackager(ctx.String(cmd.GetFlagName(cmd.RpcUrlFlag)))
+	messageData, err := pack.PackMessage(&packager.MessageData{
+		Data:    reqData,
+		MsgType: int(msgType),
+	}, ctx.String(cmd.GetFlagName(cmd.ToDID)))
+	if err != nil {
+		return nil, err
+	}
+	msg := &packager.Envelope{
+		Message: messageData,
+		FromDID: ctx.String(cmd.GetFlagName(cmd.FromDID)),
+		ToDID:   ctx.String(cmd.GetFlagName(cmd.ToDID)),
+	}
+	data, err := pack.PackData(msg)
+	if err != nil {
+		return nil, fmt.Errorf("packMessage err:%s", err)
+	}
+	url := ctx.String(cmd.GetFlagName(cmd.HttpClientFlag)) + common.GetApiName(msgType)
+	return utils.HttpPostData(utils.NewClient(), url, string(data))
+}
@@ -19,8 +19,34 @@
 //configuration for http rest
 package config
 
+import "time"
+
 type Cfg struct {
 	Port    string
 	Ip      string
 	SelfDID string
+	//PublicURL is the url the agent is reached at, used in blob links and
+	//invitation urls
+	PublicURL string
+	//BlobThreshold is the size above which outbound attachments are sent
+	//as blob links, 0 keeps them inline
+	BlobThreshold int64
+	//AttachMaxSize bounds the size of a received attachment
+	AttachMaxSize int64
+	//AttachMimeTypes lists the mime types accepted in received
+	//attachments, e.g. image/*, empty accepts all
+	AttachMimeTypes []string
+	//HealthInterval is the interval of probing the connections with trust
+	//pings, 0 disables it. A connection is stale after HealthMaxFailures
+	//probes without response within HealthTimeout.
+	HealthInterval    time.Duration
+	HealthTimeout     time.Duration
+	HealthMaxFailures int
+	//ForwardMessagesPerDay and ForwardBytesPerDay are the default forward
+	//quotas of a DID registered for mediation, 0 is unlimited
+	ForwardMessagesPerDay int64
+	ForwardBytesPerDay    int64
+	//GrantMediation grants the mediate requests of the connections the
+	//policy lets the agent forward for
+	GrantMediation bool
 }
@@ -0,0 +1,52 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package message
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	// DIDDocAttachId is the id of the did doc attached to the did exchange
+	// messages
+	DIDDocAttachId = "did_doc"
+
+	jsonMimeType = "application/json"
+)
+
+// SignDIDDoc attaches the json did doc signed by the key kid. The data is
+// base64url encoded and signed as a JWS with a detached payload.
+func SignDIDDoc(doc []byte, kid, alg string, sign func(data []byte) ([]byte, error)) (Attachment, error) {
+	return signAttachment(DIDDocAttachId, jsonMimeType, "did doc", doc, kid, alg, sign)
+}
+
+// VerifyDIDDoc checks the signature of a did doc attachment with verify, it
+// returns the did doc and the kid of the key which signed it
+func VerifyDIDDoc(attach Attachment, verify func(kid string, data, sig []byte) error) (*DIDDoc, string, error) {
+	data, kid, err := verifyAttachment(attach, "did doc", verify)
+	if err != nil {
+		return nil, "", err
+	}
+	doc := new(DIDDoc)
+	if err = json.Unmarshal(data, doc); err != nil {
+		return nil, "", fmt.Errorf("invalid did doc:%s", err)
+	}
+	return doc, kid, nil
+}
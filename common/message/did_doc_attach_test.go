@@ -0,0 +1,105 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package message
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testSigner returns a signer and a verifier accepting its signatures as
+// did:ont:agent
+func testSigner(t *testing.T) (func([]byte) ([]byte, error), func(string, []byte, []byte) error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	sign := func(data []byte) ([]byte, error) {
+		h := sha256.Sum256(data)
+		r, s, err := ecdsa.Sign(rand.Reader, key, h[:])
+		if err != nil {
+			return nil, err
+		}
+		sig := make([]byte, 64)
+		rb, sb := r.Bytes(), s.Bytes()
+		copy(sig[32-len(rb):32], rb)
+		copy(sig[64-len(sb):], sb)
+		return sig, nil
+	}
+	verify := func(kid string, data, sig []byte) error {
+		h := sha256.Sum256(data)
+		r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+		if kid != "did:ont:agent" || !ecdsa.Verify(&key.PublicKey, h[:], r, s) {
+			return fmt.Errorf("invalid signature")
+		}
+		return nil
+	}
+	return sign, verify
+}
+
+func TestDIDDocAttachment(t *testing.T) {
+	sign, verify := testSigner(t)
+	doc := []byte(`{"id":"did:ont:alice","service":[{"id":"did:ont:alice#1","serviceEndpoint":"http://127.0.0.1:8080"}]}`)
+	attach, err := SignDIDDoc(doc, "did:ont:agent", "ES256", sign)
+	assert.Nil(t, err)
+	assert.Equal(t, DIDDocAttachId, attach.Id)
+
+	got, kid, err := VerifyDIDDoc(attach, verify)
+	assert.Nil(t, err)
+	assert.Equal(t, "did:ont:agent", kid)
+	assert.Equal(t, "did:ont:alice", got.Id)
+	assert.Equal(t, 1, len(got.Service))
+
+	tampered := attach
+	tampered.Data.Base64 = tampered.Data.Base64[:len(tampered.Data.Base64)-2] + "fQ"
+	_, _, err = VerifyDIDDoc(tampered, verify)
+	assert.NotNil(t, err)
+	unsigned := attach
+	unsigned.Data.JWS = nil
+	_, _, err = VerifyDIDDoc(unsigned, verify)
+	assert.NotNil(t, err)
+}
+
+func TestDIDRotationAttachment(t *testing.T) {
+	sign, verify := testSigner(t)
+	rotation := &DIDRotation{
+		Did:       "did:ont:alice",
+		TheirDid:  "did:ont:bob",
+		NewDid:    "did:ont:alice2",
+		NewRouter: []string{"did:ont:mediator#1"},
+	}
+	attach, err := SignDIDRotation(rotation, "did:ont:agent", "ES256", sign)
+	assert.Nil(t, err)
+	got, kid, err := VerifyDIDRotation(attach, verify)
+	assert.Nil(t, err)
+	assert.Equal(t, "did:ont:agent", kid)
+	assert.Equal(t, rotation, got)
+
+	// the signature covers the new did
+	forged, err := SignDIDRotation(&DIDRotation{Did: "did:ont:alice", TheirDid: "did:ont:bob", NewDid: "did:ont:mallory", NewRouter: rotation.NewRouter}, "did:ont:agent", "ES256", sign)
+	assert.Nil(t, err)
+	forged.Data.JWS = attach.Data.JWS
+	_, _, err = VerifyDIDRotation(forged, verify)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,54 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package message
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// DIDRotationAttachId is the id of the rotation attached to a DIDRotate
+const DIDRotationAttachId = "rotation"
+
+// SignDIDRotation attaches the rotation signed by the key kid, like a did
+// doc
+func SignDIDRotation(rotation *DIDRotation, kid, alg string, sign func(data []byte) ([]byte, error)) (Attachment, error) {
+	data, err := json.Marshal(rotation)
+	if err != nil {
+		return Attachment{}, err
+	}
+	return signAttachment(DIDRotationAttachId, jsonMimeType, "rotation", data, kid, alg, sign)
+}
+
+// VerifyDIDRotation checks the signature of a rotation attachment with
+// verify, it returns the rotation and the kid of the key which signed it
+func VerifyDIDRotation(attach Attachment, verify func(kid string, data, sig []byte) error) (*DIDRotation, string, error) {
+	data, kid, err := verifyAttachment(attach, "rotation", verify)
+	if err != nil {
+		return nil, "", err
+	}
+	rotation := new(DIDRotation)
+	if err = json.Unmarshal(data, rotation); err != nil {
+		return nil, "", fmt.Errorf("invalid rotation:%s", err)
+	}
+	if rotation.NewDid == "" || len(rotation.NewRouter) == 0 {
+		return nil, "", fmt.Errorf("rotation has no new did or router")
+	}
+	return rotation, kid, nil
+}
@@ -0,0 +1,87 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package message
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// InvitationParam is the query parameter carrying the encoded invitation
+const InvitationParam = "c_i"
+
+// InvitationURL renders iv as base?c_i=<base64url of the invitation json>
+func InvitationURL(base string, iv *Invitation) (string, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", fmt.Errorf("invalid base url %s:%s", base, err)
+	}
+	data, err := json.Marshal(iv)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set(InvitationParam, base64.RawURLEncoding.EncodeToString(data))
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// ParseInvitationURL decodes the invitation of an invitation url. The
+// parameter is accepted padded or not, in the url or the standard alphabet.
+func ParseInvitationURL(s string) (*Invitation, error) {
+	u, err := url.Parse(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("invalid invitation url:%s", err)
+	}
+	param := u.Query().Get(InvitationParam)
+	if param == "" {
+		return nil, fmt.Errorf("invitation url has no %s parameter", InvitationParam)
+	}
+	// a + of the standard alphabet may arrive decoded as a space
+	data, err := decodeBase64(strings.ReplaceAll(param, " ", "+"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid invitation encoding:%s", err)
+	}
+	iv := new(Invitation)
+	if err = json.Unmarshal(data, iv); err != nil {
+		return nil, fmt.Errorf("invalid invitation:%s", err)
+	}
+	if err = ValidateInvitation(iv); err != nil {
+		return nil, err
+	}
+	return iv, nil
+}
+
+// ValidateInvitation checks an invitation carries what a connection request
+// needs
+func ValidateInvitation(iv *Invitation) error {
+	if iv.Id == "" {
+		return fmt.Errorf("invitation has no id")
+	}
+	if iv.Did == "" {
+		return fmt.Errorf("invitation has no did")
+	}
+	if len(iv.Router) == 0 {
+		return fmt.Errorf("invitation has no router")
+	}
+	return nil
+}
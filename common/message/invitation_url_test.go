@@ -0,0 +1,54 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package message
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInvitationURL(t *testing.T) {
+	iv := &Invitation{
+		Type:   "spec/connections/1.0/invitation",
+		Id:     "iv-1",
+		Label:  "alice's agent",
+		Did:    "did:ont:alice",
+		Router: []string{"did:ont:alice#1"},
+	}
+	s, err := InvitationURL("https://agent.example.com/?lang=en", iv)
+	assert.Nil(t, err)
+	got, err := ParseInvitationURL(s)
+	assert.Nil(t, err)
+	assert.Equal(t, iv, got)
+
+	// padded standard base64 from other agents is accepted too
+	data, _ := json.Marshal(iv)
+	got, err = ParseInvitationURL("https://a.example.com/?c_i=" + base64.URLEncoding.EncodeToString(data))
+	assert.Nil(t, err)
+	assert.Equal(t, iv, got)
+
+	_, err = ParseInvitationURL("https://a.example.com/")
+	assert.NotNil(t, err)
+	data, _ = json.Marshal(&Invitation{Id: "iv-2", Did: "did:ont:alice"})
+	_, err = ParseInvitationURL("https://a.example.com/?c_i=" + base64.RawURLEncoding.EncodeToString(data))
+	assert.NotNil(t, err)
+}
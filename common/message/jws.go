@@ -0,0 +1,101 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package message
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// signAttachment attaches data signed by the key kid. The data is base64url
+// encoded and signed as a JWS with a detached payload, what names the data
+// in the errors.
+func signAttachment(id, mimeType, what string, data []byte, kid, alg string, sign func(data []byte) ([]byte, error)) (Attachment, error) {
+	header, err := json.Marshal(map[string]string{"alg": alg, "kid": kid})
+	if err != nil {
+		return Attachment{}, err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	protected := base64.RawURLEncoding.EncodeToString(header)
+	sig, err := sign([]byte(protected + "." + payload))
+	if err != nil {
+		return Attachment{}, fmt.Errorf("sign %s:%s", what, err)
+	}
+	return Attachment{
+		Id:       id,
+		MimeType: mimeType,
+		Data: Data{
+			Base64: payload,
+			JWS: &JWS{
+				Header:    map[string]string{"kid": kid},
+				Protected: protected,
+				Signature: base64.RawURLEncoding.EncodeToString(sig),
+			},
+		},
+	}, nil
+}
+
+// verifyAttachment checks the signature of an attachment signed by
+// signAttachment, it returns the data and the kid of the key which signed it
+func verifyAttachment(attach Attachment, what string, verify func(kid string, data, sig []byte) error) ([]byte, string, error) {
+	jws := attach.Data.JWS
+	if jws == nil {
+		return nil, "", fmt.Errorf("%s is not signed", what)
+	}
+	header, err := decodeBase64(jws.Protected)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid jws header:%s", err)
+	}
+	fields := make(map[string]string)
+	if err = json.Unmarshal(header, &fields); err != nil {
+		return nil, "", fmt.Errorf("invalid jws header:%s", err)
+	}
+	kid := fields["kid"]
+	if kid == "" {
+		kid = jws.Header["kid"]
+	}
+	if kid == "" {
+		return nil, "", fmt.Errorf("jws has no kid")
+	}
+	sig, err := decodeBase64(jws.Signature)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid jws signature:%s", err)
+	}
+	if err = verify(kid, []byte(jws.Protected+"."+attach.Data.Base64), sig); err != nil {
+		return nil, "", fmt.Errorf("%s signature:%s", what, err)
+	}
+	data, err := decodeBase64(attach.Data.Base64)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid %s encoding:%s", what, err)
+	}
+	return data, kid, nil
+}
+
+// decodeBase64 decodes base64 padded or not, in the url or the standard
+// alphabet
+func decodeBase64(s string) ([]byte, error) {
+	s = strings.TrimRight(s, "=")
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		data, err = base64.RawStdEncoding.DecodeString(s)
+	}
+	return data, err
+}
@@ -18,7 +18,10 @@
 
 package message
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 type Invitation struct {
 	Type   string   `json:"@type,omitempty"`
@@ -27,6 +30,7 @@ type Invitation struct {
 	Did    string   `json:"did,omitempty"`
 	Router []string `json:"router"`
 	//ServiceId string   `json:"service_id,omitempty"`
+	HandshakeProtocols []string `json:"handshake_protocols,omitempty"`
 }
 
 func (self *Invitation) GetConnection() *Connection {
@@ -37,6 +41,12 @@ type RequestInf interface {
 	GetConnection() *Connection
 }
 
+//AttachmentInf is implemented by the messages carrying attachments, the
+//returned slice shares its elements with the message
+type AttachmentInf interface {
+	GetAttachments() []Attachment
+}
+
 type ConnectionRequest struct {
 	Type         string     `json:"@type,omitempty"`
 	Id           string     `json:"@id,omitempty"`
@@ -148,6 +158,10 @@ func (self *OfferCredential) GetConnection() *Connection {
 	return &self.Connection
 }
 
+func (self *OfferCredential) GetAttachments() []Attachment {
+	return self.OffersAttach
+}
+
 type CredentialPreview struct {
 	Type       string       `json:"@type,omitempty"`
 	Attributre []Attributre `json:"attributre,omitempty"`
@@ -176,6 +190,14 @@ type Data struct {
 	Links  []string    `json:"links,omitempty"`
 	Base64 string      `json:"base64,omitempty"`
 	JSON   interface{} `json:"json,omitempty"`
+	JWS    *JWS        `json:"jws,omitempty"`
+}
+
+//JWS is the detached signature of the base64 data of an attachment
+type JWS struct {
+	Header    map[string]string `json:"header,omitempty"`
+	Protected string            `json:"protected"`
+	Signature string            `json:"signature"`
 }
 
 type Format struct {
@@ -196,6 +218,10 @@ func (self *RequestCredential) GetConnection() *Connection {
 	return &self.Connection
 }
 
+func (self *RequestCredential) GetAttachments() []Attachment {
+	return self.RequestsAttach
+}
+
 type IssueCredential struct {
 	Type              string       `json:"@type,omitempty"`
 	Id                string       `json:"@id"`
@@ -210,6 +236,10 @@ func (self *IssueCredential) GetConnection() *Connection {
 	return &self.Connection
 }
 
+func (self *IssueCredential) GetAttachments() []Attachment {
+	return self.CredentialsAttach
+}
+
 //present proof
 type ProposePresentation struct {
 	Type          string       `json:"@type,omitempty"`
@@ -232,6 +262,10 @@ func (self *RequestPresentation) GetConnection() *Connection {
 	return &self.Connection
 }
 
+func (self *RequestPresentation) GetAttachments() []Attachment {
+	return self.RequestPresentationAttach
+}
+
 type Presentation struct {
 	Type               string       `json:"@type,omitempty"`
 	Id                 string       `json:"@id,omitempty"`
@@ -246,6 +280,10 @@ func (self *Presentation) GetConnection() *Connection {
 	return &self.Connection
 }
 
+func (self *Presentation) GetAttachments() []Attachment {
+	return self.PresentationAttach
+}
+
 type BasicMessage struct {
 	Type       string     `json:"@type"`
 	Id         string     `json:"@id"`
@@ -321,6 +359,8 @@ type QueryBasicMessageRequest struct {
 	DID             string `json:"did"`
 	Latest          bool   `json:"latest"`
 	RemoveAfterRead bool   `json:"remove_after_read"`
+	Offset          int    `json:"offset,omitempty"`
+	Limit           int    `json:"limit,omitempty"`
 }
 
 func (self *QueryBasicMessageRequest) GetConnection() *Connection {
@@ -344,3 +384,584 @@ type QueryConnectionsRequest struct {
 func (q *QueryConnectionsRequest) GetConnection() *Connection {
 	return nil
 }
+
+type SearchCredentialsRequest struct {
+	DId           string `json:"did"`
+	Issuer        string `json:"issuer,omitempty"`
+	Type          string `json:"type,omitempty"`
+	Connection    string `json:"connection,omitempty"`
+	IssuedAfter   int64  `json:"issued_after,omitempty"`
+	IssuedBefore  int64  `json:"issued_before,omitempty"`
+	ExpiresAfter  int64  `json:"expires_after,omitempty"`
+	ExpiresBefore int64  `json:"expires_before,omitempty"`
+}
+
+func (self *SearchCredentialsRequest) GetConnection() *Connection {
+	return nil
+}
+
+type CredentialInfo struct {
+	Id         string   `json:"id"`
+	Issuer     string   `json:"issuer"`
+	Types      []string `json:"types,omitempty"`
+	Connection string   `json:"connection"`
+	Issued     int64    `json:"issued"`
+	Expires    int64    `json:"expires,omitempty"`
+}
+
+type SearchCredentialsResponse struct {
+	Credentials []CredentialInfo `json:"credentials"`
+}
+
+func (self *SearchCredentialsResponse) GetConnection() *Connection {
+	return nil
+}
+
+type SearchPresentationsRequest struct {
+	DId           string `json:"did"`
+	Holder        string `json:"holder,omitempty"`
+	Type          string `json:"type,omitempty"`
+	Connection    string `json:"connection,omitempty"`
+	CreatedAfter  int64  `json:"created_after,omitempty"`
+	CreatedBefore int64  `json:"created_before,omitempty"`
+}
+
+func (self *SearchPresentationsRequest) GetConnection() *Connection {
+	return nil
+}
+
+type PresentationInfo struct {
+	Id         string   `json:"id"`
+	Holder     string   `json:"holder"`
+	Types      []string `json:"types,omitempty"`
+	Connection string   `json:"connection"`
+	Created    int64    `json:"created"`
+}
+
+type SearchPresentationsResponse struct {
+	Presentations []PresentationInfo `json:"presentations"`
+}
+
+func (self *SearchPresentationsResponse) GetConnection() *Connection {
+	return nil
+}
+
+type ProblemReport struct {
+	Type         string              `json:"@type,omitempty"`
+	Id           string              `json:"@id,omitempty"`
+	Thread       Thread              `json:"~thread,omitempty"`
+	Description  ProblemDescription  `json:"description"`
+	ProblemItems []map[string]string `json:"problem_items,omitempty"`
+	Connection   Connection          `json:"connection,omitempty"`
+}
+
+type ProblemDescription struct {
+	Code string `json:"code"`
+	En   string `json:"en,omitempty"`
+}
+
+func (self *ProblemReport) GetConnection() *Connection {
+	return &self.Connection
+}
+
+//QueryProblemReportsRequest lists the problem reports received by DID
+//newest first, the filters are optional
+type QueryProblemReportsRequest struct {
+	DID      string `json:"did"`
+	TheirDid string `json:"their_did,omitempty"`
+	ThreadId string `json:"thread_id,omitempty"`
+	Code     string `json:"code,omitempty"`
+	Offset   int    `json:"offset,omitempty"`
+	Limit    int    `json:"limit,omitempty"`
+}
+
+func (self *QueryProblemReportsRequest) GetConnection() *Connection {
+	return nil
+}
+
+type QueryProblemReportsResponse struct {
+	Total   int                `json:"total"`
+	Reports []ProblemReportRec `json:"reports"`
+}
+
+//CreateInvitationRequest creates an invitation limited by Policy, QRCode
+//asks for a png or svg qr code of its url QRSize pixels wide as well
+type CreateInvitationRequest struct {
+	Did    string           `json:"did,omitempty"`
+	Label  string           `json:"label,omitempty"`
+	Router []string         `json:"router"`
+	QRCode string           `json:"qr_code,omitempty"`
+	QRSize int              `json:"qr_size,omitempty"`
+	Policy InvitationPolicy `json:"policy,omitempty"`
+	//HandshakeProtocols limits the protocols the invitation is accepted
+	//with, empty accepts all
+	HandshakeProtocols []string `json:"handshake_protocols,omitempty"`
+	//Mediator is a mediator which granted mediation to Did, its router
+	//entry is appended to Router
+	Mediator string `json:"mediator,omitempty"`
+}
+
+func (self *CreateInvitationRequest) GetConnection() *Connection {
+	return nil
+}
+
+type CreateInvitationResponse struct {
+	Invitation Invitation `json:"invitation"`
+	Url        string     `json:"url"`
+	QRCode     *QRCode    `json:"qr_code,omitempty"`
+}
+
+type QRCode struct {
+	MimeType string `json:"mime_type"`
+	Base64   string `json:"base64"`
+}
+
+//AcceptInvitationRequest accepts the invitation given either as url or as
+//is, the connection request is sent from MyDid over MyRouter
+type AcceptInvitationRequest struct {
+	Url        string      `json:"url,omitempty"`
+	Invitation *Invitation `json:"invitation,omitempty"`
+	MyDid      string      `json:"my_did"`
+	MyRouter   []string    `json:"my_router"`
+	Label      string      `json:"label,omitempty"`
+	//Protocol is the handshake protocol, connections by default
+	Protocol string `json:"protocol,omitempty"`
+}
+
+func (self *AcceptInvitationRequest) GetConnection() *Connection {
+	return nil
+}
+
+//InvitationRequest names an invitation of Did to query or revoke
+type InvitationRequest struct {
+	Did string `json:"did"`
+	Id  string `json:"id"`
+}
+
+func (self *InvitationRequest) GetConnection() *Connection {
+	return nil
+}
+
+const (
+	ConnectionInvited   = "invited"
+	ConnectionRequested = "requested"
+	ConnectionResponded = "responded"
+	ConnectionCompleted = "completed"
+)
+
+//ListConnectionsRequest lists the connections of DID in all states, the
+//filters are optional and Label matches a part of the label
+type ListConnectionsRequest struct {
+	DID      string `json:"did"`
+	State    string `json:"state,omitempty"`
+	TheirDid string `json:"their_did,omitempty"`
+	Label    string `json:"label,omitempty"`
+	//Alias matches a part of the alias, a connection matches Tags if it has
+	//all of them
+	Alias string   `json:"alias,omitempty"`
+	Tags  []string `json:"tags,omitempty"`
+	//Metadata matches the connections whose metadata has all of its keys
+	//with equal values
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+	Offset   int                    `json:"offset,omitempty"`
+	Limit    int                    `json:"limit,omitempty"`
+}
+
+func (self *ListConnectionsRequest) GetConnection() *Connection {
+	return nil
+}
+
+//ConnectionInfo is a connection seen by its owner, Id is the invitation id
+//of an invited connection, the request id of a pending one and their did
+//of a completed one
+type ConnectionInfo struct {
+	Id           string          `json:"id"`
+	State        string          `json:"state"`
+	Label        string          `json:"label,omitempty"`
+	Connection   Connection      `json:"connection"`
+	Created      int64           `json:"created"`
+	LastActivity int64           `json:"last_activity"`
+	Alias        string          `json:"alias,omitempty"`
+	Tags         []string        `json:"tags,omitempty"`
+	Metadata     json.RawMessage `json:"metadata,omitempty"`
+	LastSeen     int64           `json:"last_seen,omitempty"`
+	LastFailure  int64           `json:"last_failure,omitempty"`
+	Failures     int             `json:"failures,omitempty"`
+	Stale        bool            `json:"stale,omitempty"`
+}
+
+type ListConnectionsResponse struct {
+	Total       int              `json:"total"`
+	Connections []ConnectionInfo `json:"connections"`
+}
+
+//PendingRequest names a connection request of DID to query or cancel
+type PendingRequest struct {
+	DID string `json:"did"`
+	Id  string `json:"id"`
+}
+
+func (self *PendingRequest) GetConnection() *Connection {
+	return nil
+}
+
+//UpdateConnectionRequest changes the metadata of the connection of DID with
+//TheirDid, the fields left out are kept and a null Metadata clears it
+type UpdateConnectionRequest struct {
+	DID      string          `json:"did"`
+	TheirDid string          `json:"their_did"`
+	Alias    *string         `json:"alias,omitempty"`
+	Tags     *[]string       `json:"tags,omitempty"`
+	Metadata json.RawMessage `json:"metadata,omitempty"`
+}
+
+func (self *UpdateConnectionRequest) GetConnection() *Connection {
+	return nil
+}
+
+type TrustPing struct {
+	Type              string     `json:"@type"`
+	Id                string     `json:"@id"`
+	Comment           string     `json:"comment,omitempty"`
+	ResponseRequested bool       `json:"response_requested"`
+	Connection        Connection `json:"connection,omitempty"`
+}
+
+func (self *TrustPing) GetConnection() *Connection {
+	return &self.Connection
+}
+
+type TrustPingResponse struct {
+	Type       string     `json:"@type"`
+	Id         string     `json:"@id"`
+	Thread     Thread     `json:"~thread"`
+	Comment    string     `json:"comment,omitempty"`
+	Connection Connection `json:"connection,omitempty"`
+}
+
+func (self *TrustPingResponse) GetConnection() *Connection {
+	return &self.Connection
+}
+
+//SendTrustPingRequest pings the connection of DID with TheirDid, a response
+//is requested unless ResponseRequested is false and is waited for Timeout
+//milliseconds
+type SendTrustPingRequest struct {
+	DID               string `json:"did"`
+	TheirDid          string `json:"their_did"`
+	Comment           string `json:"comment,omitempty"`
+	ResponseRequested *bool  `json:"response_requested,omitempty"`
+	Timeout           int64  `json:"timeout,omitempty"`
+}
+
+func (self *SendTrustPingRequest) GetConnection() *Connection {
+	return nil
+}
+
+//SendTrustPingResponse reports a ping, RTT is the round trip time in
+//milliseconds of a ping which was responded
+type SendTrustPingResponse struct {
+	Id        string  `json:"id"`
+	Responded bool    `json:"responded"`
+	RTT       float64 `json:"rtt,omitempty"`
+}
+
+//DIDExchangeRequest starts the did exchange protocol, the thread pid is the
+//invitation id and the did doc of Did is attached signed by Did or its
+//router
+type DIDExchangeRequest struct {
+	Type       string     `json:"@type"`
+	Id         string     `json:"@id"`
+	Thread     Thread     `json:"~thread"`
+	Label      string     `json:"label,omitempty"`
+	Did        string     `json:"did"`
+	DIDDoc     Attachment `json:"did_doc~attach"`
+	Connection Connection `json:"connection,omitempty"`
+}
+
+func (self *DIDExchangeRequest) GetConnection() *Connection {
+	return &self.Connection
+}
+
+type DIDExchangeResponse struct {
+	Type       string     `json:"@type"`
+	Id         string     `json:"@id"`
+	Thread     Thread     `json:"~thread"`
+	Did        string     `json:"did"`
+	DIDDoc     Attachment `json:"did_doc~attach"`
+	Connection Connection `json:"connection,omitempty"`
+}
+
+func (self *DIDExchangeResponse) GetConnection() *Connection {
+	return &self.Connection
+}
+
+type DIDExchangeComplete struct {
+	Type       string     `json:"@type"`
+	Id         string     `json:"@id"`
+	Thread     Thread     `json:"~thread"`
+	Connection Connection `json:"connection,omitempty"`
+}
+
+func (self *DIDExchangeComplete) GetConnection() *Connection {
+	return &self.Connection
+}
+
+//RotateDIDRequest moves the connection of DID with TheirDid to NewDid,
+//reached through NewRouter
+type RotateDIDRequest struct {
+	DID       string   `json:"did"`
+	TheirDid  string   `json:"their_did"`
+	NewDid    string   `json:"new_did"`
+	NewRouter []string `json:"new_router"`
+}
+
+func (self *RotateDIDRequest) GetConnection() *Connection {
+	return nil
+}
+
+//DIDRotation is the signed content of a rotation, Did of the connection
+//with TheirDid is replaced by NewDid
+type DIDRotation struct {
+	Did       string   `json:"did"`
+	TheirDid  string   `json:"their_did"`
+	NewDid    string   `json:"new_did"`
+	NewRouter []string `json:"new_router"`
+}
+
+//DIDRotate announces a rotation on the connection it rotates, Rotation is
+//the DIDRotation signed by the old did or one of its routers
+type DIDRotate struct {
+	Type       string     `json:"@type"`
+	Id         string     `json:"@id"`
+	Rotation   Attachment `json:"rotation~attach"`
+	Connection Connection `json:"connection,omitempty"`
+}
+
+func (self *DIDRotate) GetConnection() *Connection {
+	return &self.Connection
+}
+
+//DIDRotateAck is sent on the rotated connection once it is saved
+type DIDRotateAck struct {
+	Type       string     `json:"@type"`
+	Id         string     `json:"@id"`
+	Thread     Thread     `json:"~thread"`
+	Status     string     `json:"status"`
+	Connection Connection `json:"connection,omitempty"`
+}
+
+func (self *DIDRotateAck) GetConnection() *Connection {
+	return &self.Connection
+}
+
+//DiscoverFeaturesRequest returns the protocols the connection of DID with
+//TheirDid supports matching Query, from the cache unless Refresh. Timeout
+//in milliseconds bounds the wait for the disclose.
+type DiscoverFeaturesRequest struct {
+	DID      string `json:"did"`
+	TheirDid string `json:"their_did"`
+	Query    string `json:"query,omitempty"`
+	Refresh  bool   `json:"refresh,omitempty"`
+	Timeout  int64  `json:"timeout,omitempty"`
+}
+
+func (self *DiscoverFeaturesRequest) GetConnection() *Connection {
+	return nil
+}
+
+//ProtocolDescriptor names a supported protocol by its id, like
+//spec/issue-credential/1.0
+type ProtocolDescriptor struct {
+	PID   string   `json:"pid"`
+	Roles []string `json:"roles,omitempty"`
+}
+
+//FeaturesQuery asks for the protocols matching Query, a * at the end
+//matches any suffix
+type FeaturesQuery struct {
+	Type       string     `json:"@type"`
+	Id         string     `json:"@id"`
+	Query      string     `json:"query"`
+	Comment    string     `json:"comment,omitempty"`
+	Connection Connection `json:"connection,omitempty"`
+}
+
+func (self *FeaturesQuery) GetConnection() *Connection {
+	return &self.Connection
+}
+
+type FeaturesDisclose struct {
+	Type       string               `json:"@type"`
+	Id         string               `json:"@id"`
+	Thread     Thread               `json:"~thread"`
+	Protocols  []ProtocolDescriptor `json:"protocols"`
+	Connection Connection           `json:"connection,omitempty"`
+}
+
+func (self *FeaturesDisclose) GetConnection() *Connection {
+	return &self.Connection
+}
+
+//DiscoverFeaturesResponse reports the protocols of a connection, Updated is
+//the unix time they were disclosed
+type DiscoverFeaturesResponse struct {
+	Protocols []ProtocolDescriptor `json:"protocols"`
+	Updated   int64                `json:"updated"`
+	Cached    bool                 `json:"cached"`
+}
+
+//ReloadPolicyRequest asks the agent to reload its policy file
+type ReloadPolicyRequest struct {
+}
+
+func (self *ReloadPolicyRequest) GetConnection() *Connection {
+	return nil
+}
+
+//RegisterMediationRequest lets the agent forward messages for TheirDid,
+//quotas left at 0 take the defaults of the agent
+type RegisterMediationRequest struct {
+	TheirDid       string `json:"their_did"`
+	MessagesPerDay int64  `json:"messages_per_day,omitempty"`
+	BytesPerDay    int64  `json:"bytes_per_day,omitempty"`
+}
+
+func (self *RegisterMediationRequest) GetConnection() *Connection {
+	return nil
+}
+
+//RemoveMediationRequest stops forwarding messages for TheirDid
+type RemoveMediationRequest struct {
+	TheirDid string `json:"their_did"`
+}
+
+func (self *RemoveMediationRequest) GetConnection() *Connection {
+	return nil
+}
+
+//QueryForwardUsageRequest lists what was forwarded for TheirDid in the
+//last Days days, today only by default
+type QueryForwardUsageRequest struct {
+	TheirDid string `json:"their_did"`
+	Days     int    `json:"days,omitempty"`
+}
+
+func (self *QueryForwardUsageRequest) GetConnection() *Connection {
+	return nil
+}
+
+//QueryForwardUsageResponse is the mediation of a DID and its usage, newest
+//day first
+type QueryForwardUsageResponse struct {
+	Mediation MediationRec      `json:"mediation"`
+	Usage     []ForwardUsageRec `json:"usage"`
+}
+
+//RequestMediationRequest asks the agent of TheirDid to forward messages for
+//DID. Timeout in milliseconds bounds the wait for the grant or deny.
+type RequestMediationRequest struct {
+	DID      string `json:"did"`
+	TheirDid string `json:"their_did"`
+	Timeout  int64  `json:"timeout,omitempty"`
+}
+
+func (self *RequestMediationRequest) GetConnection() *Connection {
+	return nil
+}
+
+type MediateRequest struct {
+	Type       string     `json:"@type"`
+	Id         string     `json:"@id"`
+	Connection Connection `json:"connection,omitempty"`
+}
+
+func (self *MediateRequest) GetConnection() *Connection {
+	return &self.Connection
+}
+
+//MediateGrant grants a mediate request, Router is the router entry of the
+//mediator to add to the routers of the mediated DIDs
+type MediateGrant struct {
+	Type       string     `json:"@type"`
+	Id         string     `json:"@id"`
+	Thread     Thread     `json:"~thread"`
+	Router     []string   `json:"router"`
+	Connection Connection `json:"connection,omitempty"`
+}
+
+func (self *MediateGrant) GetConnection() *Connection {
+	return &self.Connection
+}
+
+type MediateDeny struct {
+	Type       string     `json:"@type"`
+	Id         string     `json:"@id"`
+	Thread     Thread     `json:"~thread"`
+	Comment    string     `json:"comment,omitempty"`
+	Connection Connection `json:"connection,omitempty"`
+}
+
+func (self *MediateDeny) GetConnection() *Connection {
+	return &self.Connection
+}
+
+//UpdateKeylistRequest asks the mediator TheirDid of DID to also forward
+//messages for the DIDs of Add, and no longer for those of Remove. Timeout
+//in milliseconds bounds the wait for the response.
+type UpdateKeylistRequest struct {
+	DID      string   `json:"did"`
+	TheirDid string   `json:"their_did"`
+	Add      []string `json:"add,omitempty"`
+	Remove   []string `json:"remove,omitempty"`
+	Timeout  int64    `json:"timeout,omitempty"`
+}
+
+func (self *UpdateKeylistRequest) GetConnection() *Connection {
+	return nil
+}
+
+//The actions and results of a keylist update
+const (
+	KeylistAdd    = "add"
+	KeylistRemove = "remove"
+
+	KeylistSuccess     = "success"
+	KeylistNoChange    = "no_change"
+	KeylistClientError = "client_error"
+	KeylistServerError = "server_error"
+)
+
+type KeylistUpdateRule struct {
+	Did    string `json:"did"`
+	Action string `json:"action"`
+}
+
+type KeylistUpdate struct {
+	Type       string              `json:"@type"`
+	Id         string              `json:"@id"`
+	Updates    []KeylistUpdateRule `json:"updates"`
+	Connection Connection          `json:"connection,omitempty"`
+}
+
+func (self *KeylistUpdate) GetConnection() *Connection {
+	return &self.Connection
+}
+
+type KeylistUpdated struct {
+	Did    string `json:"did"`
+	Action string `json:"action"`
+	Result string `json:"result"`
+}
+
+type KeylistUpdateResponse struct {
+	Type       string           `json:"@type"`
+	Id         string           `json:"@id"`
+	Thread     Thread           `json:"~thread"`
+	Updated    []KeylistUpdated `json:"updated"`
+	Connection Connection       `json:"connection,omitempty"`
+}
+
+func (self *KeylistUpdateResponse) GetConnection() *Connection {
+	return &self.Connection
+}
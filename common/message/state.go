@@ -19,6 +19,7 @@
 package message
 
 import (
+	"encoding/json"
 	"fmt"
 	"time"
 )
@@ -46,23 +47,148 @@ const (
 	RequestPresentationResolved
 )
 
-type BasicMsgRec struct {
-	Msglist []BasicMessage `json:"msglist"`
+type InvitationRec struct {
+	Invitation Invitation       `json:"invitation"`
+	State      ConnectionState  `json:"state"`
+	Policy     InvitationPolicy `json:"policy,omitempty"`
+	//Uses counts the connection requests accepted with the invitation
+	Uses    int   `json:"uses,omitempty"`
+	Revoked bool  `json:"revoked,omitempty"`
+	Created int64 `json:"created,omitempty"`
 }
 
-type InvitationRec struct {
-	Invitation Invitation      `json:"invitation"`
-	State      ConnectionState `json:"state"`
+//InvitationPolicy limits the use of an invitation, the zero policy is a
+//single use invitation without expiry
+type InvitationPolicy struct {
+	MultiUse bool `json:"multi_use,omitempty"`
+	//MaxUses bounds the uses of a multi use invitation, 0 is unlimited
+	MaxUses int `json:"max_uses,omitempty"`
+	//ExpireAt is the unix time the invitation expires at, 0 never expires
+	ExpireAt int64 `json:"expire_at,omitempty"`
+}
+
+//Check tells whether the invitation can accept one more connection
+//request at now
+func (rec *InvitationRec) Check(now time.Time) error {
+	id := rec.Invitation.Id
+	if rec.Revoked {
+		return fmt.Errorf("invitation %s is revoked", id)
+	}
+	if rec.Policy.ExpireAt > 0 && now.Unix() >= rec.Policy.ExpireAt {
+		return fmt.Errorf("invitation %s expired", id)
+	}
+	if !rec.Policy.MultiUse && (rec.Uses > 0 || rec.State >= InvitationUsed) {
+		return fmt.Errorf("invitation %s is used", id)
+	}
+	if rec.Policy.MaxUses > 0 && rec.Uses >= rec.Policy.MaxUses {
+		return fmt.Errorf("invitation %s is used %d times", id, rec.Uses)
+	}
+	return nil
+}
+
+//TrustPingRec is a sent ping, Sent and Responded are unix nano times
+type TrustPingRec struct {
+	Ping      TrustPing `json:"ping"`
+	Sent      int64     `json:"sent"`
+	Responded int64     `json:"responded,omitempty"`
+}
+
+//DIDRotationRec is a rotation sent and waiting for its ack, Sent and
+//Completed are unix times
+type DIDRotationRec struct {
+	Rotate    DIDRotate   `json:"rotate"`
+	Rotation  DIDRotation `json:"rotation"`
+	Sent      int64       `json:"sent"`
+	Completed int64       `json:"completed,omitempty"`
+}
+
+//FeaturesRec caches the protocols disclosed by the other party of a
+//connection, QueryId is the query they answered and Updated a unix time
+type FeaturesRec struct {
+	QueryId   string               `json:"query_id,omitempty"`
+	Protocols []ProtocolDescriptor `json:"protocols"`
+	Updated   int64                `json:"updated"`
+}
+
+//MediationRec registers a DID the agent forwards messages for, the quotas
+//bound what is forwarded per day and 0 is unlimited. A DID added to the
+//keylist of a mediation has the Owner of the mediation, whose quotas and
+//usage apply.
+type MediationRec struct {
+	Did            string `json:"did"`
+	MessagesPerDay int64  `json:"messages_per_day"`
+	BytesPerDay    int64  `json:"bytes_per_day"`
+	Created        int64  `json:"created"`
+	Owner          string `json:"owner,omitempty"`
+}
+
+//The states of a mediation requested from a mediator
+const (
+	MediationRequested = "requested"
+	MediationGranted   = "granted"
+	MediationDenied    = "denied"
+)
+
+//MediationGrantRec is the mediation a DID requested from a mediator,
+//RequestId is the mediate request and KeylistUpdateId the last keylist
+//update. Router is the router entry of the mediator once granted, Keys the
+//other DIDs it forwards for. Updated is a unix time.
+type MediationGrantRec struct {
+	RequestId       string   `json:"request_id"`
+	State           string   `json:"state"`
+	Router          []string `json:"router,omitempty"`
+	Keys            []string `json:"keys,omitempty"`
+	KeylistUpdateId string   `json:"keylist_update_id,omitempty"`
+	Comment         string   `json:"comment,omitempty"`
+	Updated         int64    `json:"updated"`
+}
+
+//ForwardUsageRec accounts for what was forwarded for a DID on Day, a UTC
+//date like 2006-01-02
+type ForwardUsageRec struct {
+	Did      string `json:"did"`
+	Day      string `json:"day"`
+	Messages int64  `json:"messages"`
+	Bytes    int64  `json:"bytes"`
+}
+
+//ProblemReportRec is a received problem report, Received is a unix time
+type ProblemReportRec struct {
+	Report   ProblemReport `json:"report"`
+	Received int64         `json:"received"`
 }
 
 type ConnectionRequestRec struct {
 	ConnReq ConnectionRequest `json:"conn_req"`
 	State   ConnectionState   `json:"state"`
+	//TheirLabel is the label of the invitation a sent request answers
+	TheirLabel   string `json:"their_label,omitempty"`
+	Created      int64  `json:"created,omitempty"`
+	ResponseSent bool   `json:"response_sent,omitempty"`
+	Cancelled    bool   `json:"cancelled,omitempty"`
+	//Protocol is the handshake protocol of the request, empty is
+	//connections
+	Protocol string `json:"protocol,omitempty"`
 }
 
 type ConnectionRec struct {
-	OwnerDID    string                `json:"owner_did"`
-	Connections map[string]Connection `json:"connections"`
+	OwnerDID   string     `json:"owner_did"`
+	Connection Connection `json:"connection"`
+	Timestamp  time.Time  `json:"timestamp"`
+	//Label is the label the other party gave when connecting
+	Label        string `json:"label,omitempty"`
+	LastActivity int64  `json:"last_activity,omitempty"`
+	//Alias, Tags and Metadata are set by the operator, Alias starts as
+	//Label
+	Alias    string          `json:"alias,omitempty"`
+	Tags     []string        `json:"tags,omitempty"`
+	Metadata json.RawMessage `json:"metadata,omitempty"`
+	//LastSeen and LastFailure are the unix times of the last answered and
+	//unanswered probes, Failures counts the probes failed in a row
+	LastSeen    int64 `json:"last_seen,omitempty"`
+	LastFailure int64 `json:"last_failure,omitempty"`
+	Failures    int   `json:"failures,omitempty"`
+	Stale       bool  `json:"stale,omitempty"`
 }
 
 type RequestCredentialRec struct {
@@ -80,13 +206,30 @@ type CredentialRec struct {
 type ServiceDoc struct {
 	ServiceID       string `json:"id"`
 	ServiceType     string `json:"type"`
-	ServiceEndpoint string `json:"serviceEndpint"` //todo fix this typo with ontology update
+	ServiceEndpoint string `json:"serviceEndpoint"`
+}
+
+// UnmarshalJSON also accepts the misspelled serviceEndpint which older ontology nodes return
+func (s *ServiceDoc) UnmarshalJSON(data []byte) error {
+	type serviceDoc ServiceDoc
+	aux := struct {
+		*serviceDoc
+		LegacyEndpoint string `json:"serviceEndpint"`
+	}{serviceDoc: (*serviceDoc)(s)}
+	err := json.Unmarshal(data, &aux)
+	if err != nil {
+		return err
+	}
+	if s.ServiceEndpoint == "" {
+		s.ServiceEndpoint = aux.LegacyEndpoint
+	}
+	return nil
 }
 
 type RequestPresentationRec struct {
-	RequesterDID       string                   `json:"requester_did"`
-	RerquestPrentation RequestPresentation      `json:"rerquest_prentation"`
-	State              RequestPresentationState `json:"state"`
+	RequesterDID        string                   `json:"requester_did"`
+	RequestPresentation RequestPresentation      `json:"request_presentation"`
+	State               RequestPresentationState `json:"state"`
 }
 
 type PresentationRec struct {
@@ -24,9 +24,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/ethereum/go-ethereum/crypto/ecies"
 	"github.com/ontio/mercury/common/packager"
 	"github.com/ontio/mercury/utils"
-	"github.com/ethereum/go-ethereum/crypto/ecies"
 	"github.com/ontio/ontology-crypto/ec"
 	"github.com/ontio/ontology-crypto/keypair"
 	"github.com/ontio/ontology-crypto/signature"
@@ -159,6 +159,44 @@ func (bp *Packager) UnpackMessage(data *packager.MessageData, sourceDid string)
 	}, nil
 }
 
+// SigAlg names the signature algorithm of the agent account as in a JWS
+// header
+func (bp *Packager) SigAlg() string {
+	if bp.acct.SigScheme == signature.SHA256withECDSA {
+		return "ES256"
+	}
+	return bp.acct.SigScheme.Name()
+}
+
+// Sign signs data with the agent account
+func (bp *Packager) Sign(data []byte) ([]byte, error) {
+	return bp.acct.Sign(data)
+}
+
+// Verify checks that sig of data is made by the key kid of a did
+func (bp *Packager) Verify(kid string, data, sig []byte) error {
+	pub, err := utils.GetPubKeyByKeyId(kid, bp.ontSdk)
+	if err != nil {
+		return err
+	}
+	pubKey, err := hex.DecodeString(pub)
+	if err != nil {
+		return err
+	}
+	pk, err := keypair.DeserializePublicKey(pubKey)
+	if err != nil {
+		return err
+	}
+	s, err := signature.Deserialize(sig)
+	if err != nil {
+		return err
+	}
+	if !signature.Verify(pk, data, s) {
+		return fmt.Errorf("verify sign failed")
+	}
+	return nil
+}
+
 func (bp *Packager) PackData(envelope *packager.Envelope) ([]byte, error) {
 	jsonBytes, err := json.Marshal(envelope)
 	if err != nil {
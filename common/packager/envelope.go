@@ -34,4 +34,6 @@ type Envelope struct {
 	Connection *MsgConnection `json:"connection,omitempty"`
 	FromDID    string         `json:"fromdid,omitempty"`
 	ToDID      string         `json:"todid,omitempty"`
+	//Hops is the number of agents which forwarded the message
+	Hops int `json:"hops,omitempty"`
 }
@@ -0,0 +1,186 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// Package policy decides which DIDs may connect to the agent, which
+// messages each of them may send and which may use the agent as a router.
+// The policy is read from a json file and can be reloaded at runtime.
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+)
+
+// Default is the key of the protocol rules of the DIDs without their own
+const Default = "*"
+
+// Rules matches a DID or message type against patterns, a pattern is a
+// value, * for all, or a prefix followed by *. A denied value is rejected
+// even if allowed, and with an allow list only the values it matches pass.
+type Rules struct {
+	Allow []string `json:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
+}
+
+// Permits reports whether the rules let value pass
+func (r *Rules) Permits(value string) bool {
+	if r == nil {
+		return true
+	}
+	if matchAny(r.Deny, value) {
+		return false
+	}
+	return len(r.Allow) == 0 || matchAny(r.Allow, value)
+}
+
+func matchAny(patterns []string, value string) bool {
+	for _, p := range patterns {
+		if Match(p, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match matches value against a pattern, see Rules
+func Match(pattern, value string) bool {
+	if pattern == "*" {
+		return true
+	}
+	if strings.HasSuffix(pattern, "*") {
+		return strings.HasPrefix(value, pattern[:len(pattern)-1])
+	}
+	return pattern == value
+}
+
+// Policy is the content of a policy file
+type Policy struct {
+	// DIDs are the DIDs which may connect and send messages
+	DIDs Rules `json:"dids"`
+	// Protocols are the message types a DID may send by the DID, Default
+	// applies to the DIDs not listed. Message types are the @type of the
+	// messages, e.g. spec/present-proof/1.0/* for a whole protocol.
+	Protocols map[string]Rules `json:"protocols,omitempty"`
+	// Forward are the DIDs which may send messages through the agent as
+	// their router
+	Forward Rules `json:"forward"`
+}
+
+// AllowDID rejects a DID which may not talk to the agent
+func (p *Policy) AllowDID(did string) error {
+	if p != nil && !p.DIDs.Permits(did) {
+		return fmt.Errorf("%s is not allowed by the policy", did)
+	}
+	return nil
+}
+
+// AllowMessage rejects a message of type spec from did which did may not
+// send
+func (p *Policy) AllowMessage(did, spec string) error {
+	if err := p.AllowDID(did); err != nil {
+		return err
+	}
+	if p == nil {
+		return nil
+	}
+	rules, ok := p.Protocols[did]
+	if !ok {
+		rules, ok = p.Protocols[Default]
+	}
+	if ok && !rules.Permits(spec) {
+		return fmt.Errorf("%s may not send %s", did, spec)
+	}
+	return nil
+}
+
+// AllowForward rejects a DID which may not use the agent as its router
+func (p *Policy) AllowForward(did string) error {
+	if err := p.AllowDID(did); err != nil {
+		return err
+	}
+	if p != nil && !p.Forward.Permits(did) {
+		return fmt.Errorf("%s may not forward through this agent", did)
+	}
+	return nil
+}
+
+// Parse reads a policy, unknown fields are rejected so a misspelled rule
+// isn't silently ignored
+func Parse(data []byte) (*Policy, error) {
+	p := new(Policy)
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(p); err != nil {
+		return nil, fmt.Errorf("invalid policy:%s", err)
+	}
+	return p, nil
+}
+
+// Engine holds the policy of the agent loaded from a file. A nil engine or
+// an engine without a file allows everything.
+type Engine struct {
+	path   string
+	lock   sync.RWMutex
+	policy *Policy
+}
+
+// NewEngine loads the policy file at path, an empty path allows everything
+func NewEngine(path string) (*Engine, error) {
+	e := &Engine{path: path}
+	if path == "" {
+		return e, nil
+	}
+	if _, err := e.Reload(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Reload reads the policy file again, the current policy is kept if the
+// file is invalid
+func (e *Engine) Reload() (*Policy, error) {
+	if e.path == "" {
+		return nil, fmt.Errorf("no policy file")
+	}
+	data, err := ioutil.ReadFile(e.path)
+	if err != nil {
+		return nil, err
+	}
+	p, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	e.lock.Lock()
+	e.policy = p
+	e.lock.Unlock()
+	return p, nil
+}
+
+// Policy returns the current policy, nil allows everything
+func (e *Engine) Policy() *Policy {
+	if e == nil {
+		return nil
+	}
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+	return e.policy
+}
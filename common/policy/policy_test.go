@@ -0,0 +1,94 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package policy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testPolicy = `{
+	"dids": {"allow": ["did:ont:*"], "deny": ["did:ont:banned"]},
+	"protocols": {
+		"did:ont:verifier": {"allow": ["spec/present-proof/*"], "deny": ["spec/issue-credential/1.0/propose-credential"]},
+		"*": {"deny": ["spec/present-proof/1.0/request-presentation"]}
+	},
+	"forward": {"allow": ["did:ont:mobile*"]}
+}`
+
+func TestPolicy(t *testing.T) {
+	p, err := Parse([]byte(testPolicy))
+	assert.Nil(t, err)
+
+	assert.Nil(t, p.AllowDID("did:ont:alice"))
+	assert.NotNil(t, p.AllowDID("did:ont:banned"))
+	assert.NotNil(t, p.AllowDID("did:other:bob"))
+
+	assert.Nil(t, p.AllowMessage("did:ont:verifier", "spec/present-proof/1.0/request-presentation"))
+	assert.NotNil(t, p.AllowMessage("did:ont:verifier", "spec/issue-credential/1.0/propose-credential"))
+	assert.NotNil(t, p.AllowMessage("did:ont:verifier", "spec/connections/1.0/request"))
+	assert.NotNil(t, p.AllowMessage("did:ont:alice", "spec/present-proof/1.0/request-presentation"))
+	assert.Nil(t, p.AllowMessage("did:ont:alice", "spec/issue-credential/1.0/propose-credential"))
+	assert.NotNil(t, p.AllowMessage("did:ont:banned", "spec/connections/1.0/request"))
+
+	assert.Nil(t, p.AllowForward("did:ont:mobile1"))
+	assert.NotNil(t, p.AllowForward("did:ont:alice"))
+
+	// no policy allows everything
+	var none *Policy
+	assert.Nil(t, none.AllowMessage("did:other:bob", "spec/connections/1.0/request"))
+	assert.Nil(t, none.AllowForward("did:other:bob"))
+
+	_, err = Parse([]byte(`{"dids": {"alow": ["*"]}}`))
+	assert.NotNil(t, err)
+}
+
+func TestEngineReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mercury-policy")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "policy.json")
+	assert.Nil(t, ioutil.WriteFile(path, []byte(testPolicy), 0600))
+
+	e, err := NewEngine(path)
+	assert.Nil(t, err)
+	assert.NotNil(t, e.Policy().AllowDID("did:ont:banned"))
+
+	assert.Nil(t, ioutil.WriteFile(path, []byte(`{"dids": {"deny": ["did:ont:alice"]}}`), 0600))
+	_, err = e.Reload()
+	assert.Nil(t, err)
+	assert.Nil(t, e.Policy().AllowDID("did:ont:banned"))
+	assert.NotNil(t, e.Policy().AllowDID("did:ont:alice"))
+
+	// an invalid file keeps the current policy
+	assert.Nil(t, ioutil.WriteFile(path, []byte(`{`), 0600))
+	_, err = e.Reload()
+	assert.NotNil(t, err)
+	assert.NotNil(t, e.Policy().AllowDID("did:ont:alice"))
+
+	e, err = NewEngine("")
+	assert.Nil(t, err)
+	assert.Nil(t, e.Policy())
+	_, err = e.Reload()
+	assert.NotNil(t, err)
+}
@@ -24,17 +24,25 @@ import (
 	"os/signal"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"syscall"
 
 	"github.com/ontio/mercury/cmd"
+	db_cmd "github.com/ontio/mercury/cmd/db"
 	"github.com/ontio/mercury/cmd/did"
 	http_cmd "github.com/ontio/mercury/cmd/httpclient"
 	"github.com/ontio/mercury/common/config"
 	"github.com/ontio/mercury/common/log"
 	"github.com/ontio/mercury/common/packager/ecdsa"
+	"github.com/ontio/mercury/common/policy"
 	"github.com/ontio/mercury/service"
 	"github.com/ontio/mercury/service/common"
-	store "github.com/ontio/mercury/store/leveldb"
+	"github.com/ontio/mercury/service/controller"
+	"github.com/ontio/mercury/store"
+	"github.com/ontio/mercury/store/blob"
+	"github.com/ontio/mercury/store/gc"
+	leveldb "github.com/ontio/mercury/store/leveldb"
+	"github.com/ontio/mercury/store/redis"
 	"github.com/ontio/mercury/utils"
 	"github.com/ontio/mercury/vdri/ontdid"
 	sdk "github.com/ontio/ontology-go-sdk"
@@ -56,10 +64,27 @@ func setupAPP() *cli.App {
 		cmd.SelfDIDFlag,
 		cmd.EnableHttpsFlag,
 		cmd.EnablePackageFlag,
+		cmd.RetentionFlag,
+		cmd.GcIntervalFlag,
+		cmd.RedisUrlFlag,
+		cmd.BlobDirFlag,
+		cmd.BlobThresholdFlag,
+		cmd.PublicUrlFlag,
+		cmd.AttachMaxSizeFlag,
+		cmd.AttachMimeTypesFlag,
+		cmd.HealthIntervalFlag,
+		cmd.HealthTimeoutFlag,
+		cmd.HealthMaxFailuresFlag,
+		cmd.EventWebhookFlag,
+		cmd.PolicyFileFlag,
+		cmd.ForwardMessagesPerDayFlag,
+		cmd.ForwardBytesPerDayFlag,
+		cmd.GrantMediationFlag,
 	}
 	app.Commands = []cli.Command{
 		did.DidCommand,
 		http_cmd.HttpClientCmd,
+		db_cmd.DbCommand,
 	}
 	app.Before = func(context *cli.Context) error {
 		runtime.GOMAXPROCS(runtime.NumCPU())
@@ -93,21 +118,83 @@ func startAgent(ctx *cli.Context) {
 	}
 	selfDid := ctx.String(cmd.GetFlagName(cmd.SelfDIDFlag))
 	ip := ctx.String(cmd.GetFlagName(cmd.HttpIpFlag))
-	prov := store.NewProvider(cmd.DEFAULT_STORE_DIR)
-	db, err := prov.OpenStore(cmd.DEFAULT_STORE_DIR)
+	db, err := openStore(ctx)
 	if err != nil {
 		panic(err)
 	}
+	if ctx.String(cmd.GetFlagName(cmd.RedisUrlFlag)) != "" {
+		err = db_cmd.RequireSchema(db)
+	} else {
+		err = db_cmd.MigrateOnStartup(cmd.DEFAULT_STORE_DIR, db)
+	}
+	if err != nil {
+		panic(err)
+	}
+	//stops are run in reverse order on shutdown, the store is closed last
+	stops := []func(){func() { db.Close() }}
+	if interval := ctx.Duration(cmd.GetFlagName(cmd.GcIntervalFlag)); interval > 0 {
+		policy, err := gc.ParsePolicy(ctx.String(cmd.GetFlagName(cmd.RetentionFlag)), controller.DefaultRetention)
+		if err != nil {
+			panic(err)
+		}
+		sweeper := gc.NewSweeper(db, policy, controller.RecordFinished(db), interval)
+		sweeper.Start()
+		stops = append(stops, sweeper.Stop)
+	}
 	cfg := &config.Cfg{
-		Port:    port,
-		Ip:      ip,
-		SelfDID: selfDid,
+		Port:              port,
+		Ip:                ip,
+		SelfDID:           selfDid,
+		PublicURL:         ctx.String(cmd.GetFlagName(cmd.PublicUrlFlag)),
+		BlobThreshold:     ctx.Int64(cmd.GetFlagName(cmd.BlobThresholdFlag)),
+		AttachMaxSize:     ctx.Int64(cmd.GetFlagName(cmd.AttachMaxSizeFlag)),
+		HealthInterval:    ctx.Duration(cmd.GetFlagName(cmd.HealthIntervalFlag)),
+		HealthTimeout:     ctx.Duration(cmd.GetFlagName(cmd.HealthTimeoutFlag)),
+		HealthMaxFailures: ctx.Int(cmd.GetFlagName(cmd.HealthMaxFailuresFlag)),
+
+		ForwardMessagesPerDay: ctx.Int64(cmd.GetFlagName(cmd.ForwardMessagesPerDayFlag)),
+		ForwardBytesPerDay:    ctx.Int64(cmd.GetFlagName(cmd.ForwardBytesPerDayFlag)),
+		GrantMediation:        ctx.Bool(cmd.GetFlagName(cmd.GrantMediationFlag)),
+	}
+	if mimeTypes := ctx.String(cmd.GetFlagName(cmd.AttachMimeTypesFlag)); mimeTypes != "" {
+		cfg.AttachMimeTypes = strings.Split(mimeTypes, ",")
+	}
+	if cfg.PublicURL == "" {
+		scheme := "http://"
+		if ctx.Bool(cmd.GetFlagName(cmd.EnableHttpsFlag)) {
+			scheme = "https://"
+		}
+		cfg.PublicURL = scheme + ip + ":" + port
+	}
+	blobs, err := blob.NewFileStore(ctx.String(cmd.GetFlagName(cmd.BlobDirFlag)))
+	if err != nil {
+		panic(err)
 	}
 	ontVdri := ontdid.NewOntVDRI(ontSdk, account, selfDid)
 	msgSvr := common.NewMessageService(ontVdri, ontSdk, account, ctx.Bool(cmd.GetFlagName(cmd.EnablePackageFlag)), cfg)
-	r := service.NewApiRouter(ecdsa.New(ontSdk, account), db, msgSvr, ontVdri)
+	msgSvr.SetBlobStore(blobs)
+	engine, err := policy.NewEngine(ctx.String(cmd.GetFlagName(cmd.PolicyFileFlag)))
+	if err != nil {
+		panic(err)
+	}
+	msgSvr.SetPolicy(engine)
+	go reloadPolicyOnHangup(engine)
+	if url := ctx.String(cmd.GetFlagName(cmd.EventWebhookFlag)); url != "" {
+		webhook := common.NewEventWebhook(msgSvr.Events(), url)
+		webhook.Start()
+		stops = append(stops, webhook.Stop)
+	}
+	packager := ecdsa.New(ontSdk, account)
+	systemController := controller.NewSystemController(packager, db, msgSvr)
+	if cfg.HealthInterval > 0 {
+		monitor := controller.NewHealthMonitor(systemController, cfg.HealthInterval, cfg.HealthTimeout)
+		monitor.Start()
+		stops = append(stops, monitor.Stop)
+	}
+	r := service.NewApiRouter(systemController, packager, db, msgSvr, ontVdri)
 	log.Infof("start agent svr account:%s,port:%s", account.Address.ToBase58(), cfg.Port)
 	startPort := ip + ":" + port
+	go stopOnSignal(stops)
 	if ctx.Bool(cmd.GetFlagName(cmd.EnableHttpsFlag)) {
 		err = r.RunTLS(startPort, cmd.DEFAULT_CERT_PATH, cmd.DEFAULT_KEY_PATH)
 		if err != nil {
@@ -119,7 +206,18 @@ func startAgent(ctx *cli.Context) {
 			panic(err)
 		}
 	}
-	signalHandle()
+}
+
+// openStore opens the redis store if configured, the local leveldb otherwise
+func openStore(ctx *cli.Context) (store.Store, error) {
+	if url := ctx.String(cmd.GetFlagName(cmd.RedisUrlFlag)); url != "" {
+		prov, err := redis.NewProvider(url)
+		if err != nil {
+			return nil, err
+		}
+		return prov.OpenStore(cmd.DEFAULT_REDIS_NAME_SPACE)
+	}
+	return leveldb.NewProvider(cmd.DEFAULT_STORE_DIR).OpenStore(cmd.DEFAULT_STORE_DIR)
 }
 
 func initLog(ctx *cli.Context) {
@@ -134,6 +232,30 @@ func initLog(ctx *cli.Context) {
 	}
 }
 
+// reloadPolicyOnHangup reloads the policy file on every SIGHUP, an invalid
+// file keeps the current policy
+func reloadPolicyOnHangup(engine *policy.Engine) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	for range ch {
+		if _, err := engine.Reload(); err != nil {
+			log.Errorf("reload policy err:%s", err)
+			continue
+		}
+		log.Infof("policy reloaded")
+	}
+}
+
+// stopOnSignal waits for the agent to be asked to stop, then runs stops in
+// reverse order and exits
+func stopOnSignal(stops []func()) {
+	signalHandle()
+	for i := len(stops) - 1; i >= 0; i-- {
+		stops[i]()
+	}
+	os.Exit(0)
+}
+
 func signalHandle() {
 	var (
 		ch = make(chan os.Signal, 1)
@@ -30,6 +30,39 @@ type SystemApiServicer interface {
 	SendBasicMsg(ctx *gin.Context)
 	ReceiveBasicMsg(ctx *gin.Context)
 	QueryBasicMsg(ctx *gin.Context)
+	ProblemReport(ctx *gin.Context)
+	CreateInvitation(ctx *gin.Context)
+	AcceptInvitation(ctx *gin.Context)
+	QueryInvitation(ctx *gin.Context)
+	RevokeInvitation(ctx *gin.Context)
+	ListConnections(ctx *gin.Context)
+	QueryConnectionRequest(ctx *gin.Context)
+	CancelConnectionRequest(ctx *gin.Context)
+	UpdateConnection(ctx *gin.Context)
+	SendTrustPing(ctx *gin.Context)
+	TrustPing(ctx *gin.Context)
+	TrustPingResponse(ctx *gin.Context)
+	DIDExchangeRequest(ctx *gin.Context)
+	DIDExchangeResponse(ctx *gin.Context)
+	DIDExchangeComplete(ctx *gin.Context)
+	QueryProblemReports(ctx *gin.Context)
+	RotateDID(ctx *gin.Context)
+	DIDRotate(ctx *gin.Context)
+	DIDRotateAck(ctx *gin.Context)
+	DiscoverFeatures(ctx *gin.Context)
+	FeaturesQuery(ctx *gin.Context)
+	FeaturesDisclose(ctx *gin.Context)
+	ReloadPolicy(ctx *gin.Context)
+	RegisterMediation(ctx *gin.Context)
+	RemoveMediation(ctx *gin.Context)
+	QueryForwardUsage(ctx *gin.Context)
+	RequestMediation(ctx *gin.Context)
+	MediateRequest(ctx *gin.Context)
+	MediateGrant(ctx *gin.Context)
+	MediateDeny(ctx *gin.Context)
+	UpdateKeylist(ctx *gin.Context)
+	KeylistUpdate(ctx *gin.Context)
+	KeylistResponse(ctx *gin.Context)
 }
 
 type CredentialApiServicer interface {
@@ -40,6 +73,7 @@ type CredentialApiServicer interface {
 	RequestCredential(ctx *gin.Context)
 	IssueCredential(ctx *gin.Context)
 	CredentialAck(ctx *gin.Context)
+	SearchCredentials(ctx *gin.Context)
 }
 
 type PresentationApiServicer interface {
@@ -48,4 +82,5 @@ type PresentationApiServicer interface {
 	PresentProof(ctx *gin.Context)
 	PresentationAck(ctx *gin.Context)
 	QueryPresentation(ctx *gin.Context)
+	SearchPresentations(ctx *gin.Context)
 }
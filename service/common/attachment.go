@@ -0,0 +1,152 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"strings"
+
+	"github.com/ontio/mercury/common/message"
+	"github.com/ontio/mercury/store/blob"
+	"github.com/ontio/mercury/utils"
+)
+
+const defaultMimeType = "application/octet-stream"
+
+// AttachmentError tells which attachment was rejected and why
+type AttachmentError struct {
+	Id     string
+	Reason string
+}
+
+func (e *AttachmentError) Error() string {
+	return fmt.Sprintf("attachment %s rejected: %s", e.Id, e.Reason)
+}
+
+func (m *MsgService) maxAttachSize() int64 {
+	if m.Cfg.AttachMaxSize > 0 {
+		return m.Cfg.AttachMaxSize
+	}
+	return MaxBlobSize
+}
+
+// ReceiveAttachments fetches the blobs linked from msg and verifies all its
+// attachments. A rejected message is answered with a problem report on the
+// thread thid, conn is the connection of the received message. Large inline
+// contents are then moved to the blob store like those of sent messages.
+func (m *MsgService) ReceiveAttachments(msg message.AttachmentInf, conn message.Connection, thid string) error {
+	err := m.ResolveAttachments(msg)
+	if err == nil {
+		err = m.VerifyAttachments(msg.GetAttachments())
+	}
+	if err != nil {
+		m.SendProblemReport(conn, thid, ProblemAttachmentInvalid, err)
+		return err
+	}
+	return m.ExternalizeAttachments(msg)
+}
+
+// VerifyAttachments checks the content of every attachment against its
+// sha256, byte count and mime type and the size limit
+func (m *MsgService) VerifyAttachments(attaches []message.Attachment) error {
+	for _, attach := range attaches {
+		content, err := m.attachmentContent(attach)
+		if err != nil {
+			return &AttachmentError{Id: attach.Id, Reason: err.Error()}
+		}
+		if err = m.checkAttachment(attach, content); err != nil {
+			return &AttachmentError{Id: attach.Id, Reason: err.Error()}
+		}
+	}
+	return nil
+}
+
+// attachmentContent returns the bytes an attachment carries. A jwt is
+// carried in base64 as is, its content is the compact jwt. Json content is
+// hashed in its json encoding.
+func (m *MsgService) attachmentContent(attach message.Attachment) ([]byte, error) {
+	data := attach.Data
+	switch {
+	case data.Base64 != "":
+		content, err := utils.Base64Decode(data.Base64)
+		if err == nil {
+			return content, nil
+		}
+		if _, jerr := utils.ParseJWTPayload(data.Base64); jerr == nil {
+			return []byte(data.Base64), nil
+		}
+		return nil, fmt.Errorf("invalid base64 data")
+	case data.Sha256 != "":
+		if m.blobs == nil {
+			return nil, fmt.Errorf("linked data, blobs are disabled")
+		}
+		return m.blobs.Get(strings.ToLower(data.Sha256))
+	case data.JSON != nil:
+		return json.Marshal(data.JSON)
+	case len(data.Links) > 0:
+		return nil, fmt.Errorf("linked data without sha256 can't be verified")
+	}
+	return nil, fmt.Errorf("no data")
+}
+
+func (m *MsgService) checkAttachment(attach message.Attachment, content []byte) error {
+	if attach.Data.Sha256 != "" {
+		if err := blob.Verify(content, strings.ToLower(attach.Data.Sha256)); err != nil {
+			return err
+		}
+	}
+	if attach.ByteCount > 0 && attach.ByteCount != int64(len(content)) {
+		return fmt.Errorf("has %d bytes, byte_count says %d", len(content), attach.ByteCount)
+	}
+	if max := m.maxAttachSize(); int64(len(content)) > max {
+		return fmt.Errorf("has %d bytes, more than the %d allowed", len(content), max)
+	}
+	if !MimeTypeAllowed(attach.MimeType, m.Cfg.AttachMimeTypes) {
+		return fmt.Errorf("mime type %q is not allowed", attach.MimeType)
+	}
+	return nil
+}
+
+// MimeTypeAllowed matches a mime type against a list like image/*,
+// application/pdf, an empty list allows all and an empty mime type is
+// application/octet-stream
+func MimeTypeAllowed(mimeType string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	if mimeType == "" {
+		mimeType = defaultMimeType
+	}
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return false
+	}
+	for _, a := range allowed {
+		a = strings.ToLower(strings.TrimSpace(a))
+		if a == "*/*" || a == mediaType {
+			return true
+		}
+		if strings.HasSuffix(a, "/*") && strings.HasPrefix(mediaType, a[:len(a)-1]) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package common
+
+import (
+	"testing"
+
+	"github.com/ontio/mercury/common/message"
+	"github.com/ontio/mercury/store/blob"
+	"github.com/ontio/mercury/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyAttachments(t *testing.T) {
+	m, cleanup := newBlobService(t, "")
+	defer cleanup()
+	m.Cfg.AttachMaxSize = 16
+	m.Cfg.AttachMimeTypes = []string{"image/*", "application/pdf"}
+
+	content := []byte("a scan")
+	good := message.Attachment{
+		Id:        "scan",
+		MimeType:  "image/png",
+		ByteCount: int64(len(content)),
+		Data:      message.Data{Base64: utils.Base64Encode(content), Sha256: blob.Sum(content)},
+	}
+	assert.Nil(t, m.VerifyAttachments([]message.Attachment{good}))
+
+	reject := func(modify func(a *message.Attachment)) {
+		a := good
+		modify(&a)
+		err := m.VerifyAttachments([]message.Attachment{a})
+		assert.NotNil(t, err)
+		_, ok := err.(*AttachmentError)
+		assert.True(t, ok)
+	}
+	reject(func(a *message.Attachment) { a.Data.Base64 = utils.Base64Encode([]byte("a scam")) })
+	reject(func(a *message.Attachment) { a.ByteCount = 5 })
+	reject(func(a *message.Attachment) { a.MimeType = "application/x-msdownload" })
+	reject(func(a *message.Attachment) { a.MimeType = "" })
+	reject(func(a *message.Attachment) { a.Data.Base64 = "!not base64" })
+	reject(func(a *message.Attachment) { a.Data = message.Data{} })
+	reject(func(a *message.Attachment) { a.Data = message.Data{Links: []string{"http://example.com/scan"}} })
+	big := make([]byte, 17)
+	reject(func(a *message.Attachment) {
+		a.ByteCount = 0
+		a.Data = message.Data{Base64: utils.Base64Encode(big)}
+	})
+
+	// linked content is read from the blob store
+	sum, err := m.BlobStore().Put(content)
+	assert.Nil(t, err)
+	linked := good
+	linked.Data = message.Data{Sha256: sum, Links: []string{"http://example.com/scan"}}
+	assert.Nil(t, m.VerifyAttachments([]message.Attachment{linked}))
+
+	// a jwt is carried as is
+	m.Cfg.AttachMaxSize = 0
+	m.Cfg.AttachMimeTypes = nil
+	jwt := message.Attachment{Id: "vc", Data: message.Data{Base64: "eyJhbGciOiJFUzI1NiJ9.eyJpc3MiOiJkaWQ6b250OmEifQ.c2ln"}}
+	assert.Nil(t, m.VerifyAttachments([]message.Attachment{jwt}))
+
+	assert.True(t, MimeTypeAllowed("application/pdf; charset=binary", []string{"application/pdf"}))
+	assert.False(t, MimeTypeAllowed("imagery/png", []string{"image/*"}))
+}
@@ -0,0 +1,245 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package common
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ontio/mercury/common/message"
+	"github.com/ontio/mercury/store/blob"
+	"github.com/ontio/mercury/utils"
+)
+
+// MaxBlobSize is the default bound of the size of a blob fetched for an
+// attachment
+const MaxBlobSize = 32 << 20
+
+const (
+	// BlobFetchTimeout bounds the fetch of one blob
+	BlobFetchTimeout = 30 * time.Second
+	// MaxBlobFetches bounds the blobs fetched at the same time, a message
+	// arriving while all are busy is rejected
+	MaxBlobFetches = 4
+)
+
+// internalNets are the addresses a blob is never fetched from, so a peer
+// can't make the agent reach its own or internal services
+var internalNets = parseNets(
+	"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16",
+	"172.16.0.0/12", "192.0.0.0/24", "192.168.0.0/16", "198.18.0.0/15",
+	"::1/128", "fc00::/7", "fe80::/10",
+)
+
+func parseNets(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+// PublicIP reports whether ip is neither loopback, private, link local nor
+// multicast
+func PublicIP(ip net.IP) bool {
+	if ip.IsUnspecified() || ip.IsMulticast() || ip.IsLoopback() || ip.IsLinkLocalUnicast() {
+		return false
+	}
+	for _, n := range internalNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// NewBlobClient returns the client blobs are fetched with. It only connects
+// to public addresses, which is checked on the resolved address of every
+// connection, redirects included.
+func NewBlobClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || !PublicIP(ip) {
+				return fmt.Errorf("blob link to internal address %s", host)
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext:           dialer.DialContext,
+			ResponseHeaderTimeout: 10 * time.Second,
+		},
+		Timeout: BlobFetchTimeout,
+	}
+}
+
+// SetBlobStore enables blob links for large attachments
+func (m *MsgService) SetBlobStore(bs blob.Store) {
+	m.blobs = bs
+}
+
+// BlobStore returns the blob store, nil if blobs are disabled
+func (m *MsgService) BlobStore() blob.Store {
+	return m.blobs
+}
+
+// BlobLink returns the url the agent serves the blob with sum at
+func (m *MsgService) BlobLink(sum string) string {
+	return strings.TrimRight(m.Cfg.PublicURL, "/") + BlobApi + "/" + sum
+}
+
+// ExternalizeAttachments moves the inline contents larger than the blob
+// threshold into the blob store, the attachments keep their sha256 and a
+// link instead. Contents which aren't base64, like jwt credentials, stay
+// inline.
+func (m *MsgService) ExternalizeAttachments(content interface{}) error {
+	holder, ok := content.(message.AttachmentInf)
+	if !ok || m.blobs == nil || m.Cfg.BlobThreshold <= 0 {
+		return nil
+	}
+	attaches := holder.GetAttachments()
+	for i := range attaches {
+		attach := &attaches[i]
+		if attach.Data.Base64 == "" {
+			continue
+		}
+		data, err := utils.Base64Decode(attach.Data.Base64)
+		if err != nil || int64(len(data)) <= m.Cfg.BlobThreshold {
+			continue
+		}
+		sum, err := m.blobs.Put(data)
+		if err != nil {
+			return fmt.Errorf("store attachment %s err:%s", attach.Id, err)
+		}
+		attach.Data.Sha256 = sum
+		attach.Data.Links = append(attach.Data.Links, m.BlobLink(sum))
+		attach.Data.Base64 = ""
+		attach.ByteCount = int64(len(data))
+	}
+	return nil
+}
+
+// ResolveAttachments fetches the blobs of the attachments sent as links
+// into the blob store, each blob is verified against the sha256 and byte
+// count of its attachment. The attachments keep referencing the blobs.
+// Blobs are only fetched from public addresses, at most MaxBlobFetches at
+// a time.
+func (m *MsgService) ResolveAttachments(content interface{}) error {
+	holder, ok := content.(message.AttachmentInf)
+	if !ok {
+		return nil
+	}
+	for _, attach := range holder.GetAttachments() {
+		if attach.Data.Base64 != "" || attach.Data.Sha256 == "" {
+			continue
+		}
+		if m.blobs == nil {
+			return &AttachmentError{Id: attach.Id, Reason: "linked data, blobs are disabled"}
+		}
+		sum := strings.ToLower(attach.Data.Sha256)
+		if !blob.ValidSum(sum) {
+			return &AttachmentError{Id: attach.Id, Reason: "invalid sha256 " + attach.Data.Sha256}
+		}
+		has, err := m.blobs.Has(sum)
+		if err != nil {
+			return err
+		}
+		if has {
+			continue
+		}
+		if len(attach.Data.Links) == 0 {
+			return &AttachmentError{Id: attach.Id, Reason: "no link to fetch it from"}
+		}
+		errs := make([]string, 0)
+		for _, link := range attach.Data.Links {
+			err = m.fetchBlob(link, sum, attach.ByteCount)
+			if err == nil {
+				break
+			}
+			errs = append(errs, err.Error())
+		}
+		if err != nil {
+			return &AttachmentError{Id: attach.Id, Reason: "fetch failed:" + strings.Join(errs, "; ")}
+		}
+	}
+	return nil
+}
+
+func (m *MsgService) fetchBlob(link, sum string, size int64) error {
+	u, err := url.Parse(link)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported link %s", link)
+	}
+	if m.blobClient == nil {
+		return fmt.Errorf("blob fetching is disabled")
+	}
+	if m.blobFetches != nil {
+		select {
+		case m.blobFetches <- struct{}{}:
+			defer func() { <-m.blobFetches }()
+		default:
+			return fmt.Errorf("too many blobs are being fetched, try again later")
+		}
+	}
+	resp, err := m.blobClient.Get(link)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", link, resp.Status)
+	}
+	max := m.maxAttachSize()
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, max+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(data)) > max {
+		return fmt.Errorf("%s is larger than %d bytes", link, max)
+	}
+	if size > 0 && int64(len(data)) != size {
+		return fmt.Errorf("%s has %d bytes, expect %d", link, len(data), size)
+	}
+	if err = blob.Verify(data, sum); err != nil {
+		return err
+	}
+	_, err = m.blobs.Put(data)
+	return err
+}
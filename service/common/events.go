@@ -0,0 +1,96 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package common
+
+import (
+	"sync"
+
+	"github.com/ontio/mercury/common/log"
+)
+
+const (
+	// EventProbeFailed is emitted when a connection doesn't answer a probe
+	EventProbeFailed = "connection.probe_failed"
+	// EventConnectionStale is emitted when a connection becomes stale
+	EventConnectionStale = "connection.stale"
+	// EventConnectionRecovered is emitted when a stale connection answers
+	// again
+	EventConnectionRecovered = "connection.recovered"
+)
+
+// Event tells what happened to the connection of DID with TheirDid
+type Event struct {
+	Type     string `json:"type"`
+	DID      string `json:"did"`
+	TheirDid string `json:"their_did"`
+	Time     int64  `json:"time"`
+	Detail   string `json:"detail,omitempty"`
+}
+
+// EventBus hands the events to its subscribers. A subscriber too slow to
+// take an event misses it, so publishing never blocks. The methods are no-op
+// on a nil bus.
+type EventBus struct {
+	lock sync.RWMutex
+	subs map[int]chan Event
+	next int
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{subs: make(map[int]chan Event)}
+}
+
+// Subscribe returns the events published from now on and the function
+// which unsubscribes and closes the channel
+func (b *EventBus) Subscribe(buffer int) (<-chan Event, func()) {
+	c := make(chan Event, buffer)
+	if b == nil {
+		close(c)
+		return c, func() {}
+	}
+	b.lock.Lock()
+	id := b.next
+	b.next++
+	b.subs[id] = c
+	b.lock.Unlock()
+	var once sync.Once
+	return c, func() {
+		once.Do(func() {
+			b.lock.Lock()
+			delete(b.subs, id)
+			b.lock.Unlock()
+			close(c)
+		})
+	}
+}
+
+func (b *EventBus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+	log.Infof("event %s did:%s their did:%s %s", e.Type, e.DID, e.TheirDid, e.Detail)
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	for _, c := range b.subs {
+		select {
+		case c <- e:
+		default:
+		}
+	}
+}
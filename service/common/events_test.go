@@ -0,0 +1,66 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package common
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventBus(t *testing.T) {
+	b := NewEventBus()
+	events, cancel := b.Subscribe(1)
+	b.Publish(Event{Type: EventConnectionStale, TheirDid: "did:ont:bob"})
+	// the buffer is full, the subscriber misses it
+	b.Publish(Event{Type: EventConnectionRecovered, TheirDid: "did:ont:bob"})
+	e := <-events
+	assert.Equal(t, EventConnectionStale, e.Type)
+	cancel()
+	cancel()
+	_, ok := <-events
+	assert.False(t, ok)
+
+	var nilBus *EventBus
+	nilBus.Publish(e)
+	events, _ = nilBus.Subscribe(1)
+	_, ok = <-events
+	assert.False(t, ok)
+}
+
+func TestEventWebhook(t *testing.T) {
+	received := make(chan Event, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e Event
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&e))
+		received <- e
+	}))
+	defer srv.Close()
+	b := NewEventBus()
+	w := NewEventWebhook(b, srv.URL)
+	w.Start()
+	b.Publish(Event{Type: EventConnectionStale, DID: "did:ont:alice", TheirDid: "did:ont:bob"})
+	w.Stop()
+	e := <-received
+	assert.Equal(t, EventConnectionStale, e.Type)
+	assert.Equal(t, "did:ont:bob", e.TheirDid)
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package common
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ontio/mercury/common/message"
+	"github.com/ontio/mercury/vdri"
+)
+
+// messageSpecs are the @type of the messages peers send, by their type
+var messageSpecs = map[MessageType]string{
+	InvitationType:          vdri.InvitationSpec,
+	ConnectionRequestType:   vdri.ConnectionRequestSpec,
+	ConnectionResponseType:  vdri.ConnectionResponseSpec,
+	ConnectionAckType:       vdri.ConnectionACKSpec,
+	ProposalCredentialType:  vdri.ProposalCredentialSpec,
+	OfferCredentialType:     vdri.OfferCredentialSpec,
+	RequestCredentialType:   vdri.RequestCredentialSpec,
+	IssueCredentialType:     vdri.IssueCredentialSpec,
+	CredentialAckType:       vdri.CredentialACKSpec,
+	RequestPresentationType: vdri.RequestPresentationSpec,
+	PresentationType:        vdri.PresentationProofSpec,
+	PresentationAckType:     vdri.PresentationACKSpec,
+	ReceiveBasicMsgType:     vdri.BasicMsgSpec,
+	ProblemReportType:       vdri.ProblemReportSpec,
+	TrustPingType:           vdri.TrustPingSpec,
+	TrustPingResponseType:   vdri.TrustPingResponseSpec,
+	DIDExchangeRequestType:  vdri.DIDExchangeRequestSpec,
+	DIDExchangeResponseType: vdri.DIDExchangeResponseSpec,
+	DIDExchangeCompleteType: vdri.DIDExchangeCompleteSpec,
+	DIDRotateType:           vdri.DIDRotateSpec,
+	DIDRotateAckType:        vdri.DIDRotateAckSpec,
+	FeaturesQueryType:       vdri.FeaturesQuerySpec,
+	FeaturesDiscloseType:    vdri.FeaturesDiscloseSpec,
+	MediateRequestType:      vdri.MediateRequestSpec,
+	MediateGrantType:        vdri.MediateGrantSpec,
+	MediateDenyType:         vdri.MediateDenySpec,
+	KeylistUpdateType:       vdri.KeylistUpdateSpec,
+	KeylistResponseType:     vdri.KeylistResponseSpec,
+}
+
+// features is the set of message specs the agent has handlers for
+type features struct {
+	lock  sync.RWMutex
+	specs map[string]bool
+}
+
+// RegisterRoutes records the peer messages routes handles, they are
+// disclosed to the peers asking for the features of the agent
+func (m *MsgService) RegisterRoutes(routes Routes) {
+	m.features.lock.Lock()
+	defer m.features.lock.Unlock()
+	if m.features.specs == nil {
+		m.features.specs = make(map[string]bool)
+	}
+	for _, route := range routes {
+		for t, spec := range messageSpecs {
+			if GetApiName(t) == route.Pattern {
+				m.features.specs[spec] = true
+			}
+		}
+	}
+}
+
+// Protocols returns the protocols of the registered handlers matching
+// query, sorted by id
+func (m *MsgService) Protocols(query string) []message.ProtocolDescriptor {
+	m.features.lock.RLock()
+	defer m.features.lock.RUnlock()
+	pids := make(map[string]bool)
+	for spec := range m.features.specs {
+		pid := ProtocolOf(spec)
+		if MatchFeature(query, pid) {
+			pids[pid] = true
+		}
+	}
+	ret := make([]message.ProtocolDescriptor, 0, len(pids))
+	for pid := range pids {
+		ret = append(ret, message.ProtocolDescriptor{PID: pid})
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].PID < ret[j].PID })
+	return ret
+}
+
+// ProtocolOf returns the protocol id of a message spec, the spec without
+// its message name
+func ProtocolOf(spec string) string {
+	if i := strings.LastIndex(spec, "/"); i > 0 {
+		return spec[:i]
+	}
+	return spec
+}
+
+// MatchFeature matches a protocol id against a query, a * at the end of the
+// query matches any suffix and an empty query matches all
+func MatchFeature(query, pid string) bool {
+	if query == "" || query == "*" {
+		return true
+	}
+	if strings.HasSuffix(query, "*") {
+		return strings.HasPrefix(pid, query[:len(query)-1])
+	}
+	return query == pid
+}
@@ -0,0 +1,48 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package common
+
+import (
+	"testing"
+
+	"github.com/ontio/mercury/common/message"
+	"github.com/ontio/mercury/vdri"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProtocols(t *testing.T) {
+	m := &MsgService{}
+	assert.Empty(t, m.Protocols("*"))
+	m.RegisterRoutes(Routes{
+		{Pattern: TrustPingApi},
+		{Pattern: TrustPingResponseApi},
+		{Pattern: RequestCredentialApi},
+		{Pattern: SendTrustPingApi},
+	})
+	assert.Equal(t, []message.ProtocolDescriptor{
+		{PID: "spec/issue-credential/" + vdri.Version},
+		{PID: "spec/trust_ping/" + vdri.Version},
+	}, m.Protocols(""))
+	assert.Equal(t, []message.ProtocolDescriptor{{PID: "spec/trust_ping/" + vdri.Version}}, m.Protocols("spec/trust_ping/*"))
+	assert.Empty(t, m.Protocols("spec/present-proof/"+vdri.Version))
+
+	assert.Equal(t, "spec/present-proof/"+vdri.Version, ProtocolOf(vdri.PresentationACKSpec))
+	assert.True(t, MatchFeature("spec/*", "spec/did-exchange/1.0"))
+	assert.False(t, MatchFeature("spec/did-exchange/1.1", "spec/did-exchange/1.0"))
+}
@@ -0,0 +1,111 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package common
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ontio/mercury/common/message"
+	"github.com/ontio/mercury/utils"
+)
+
+// ForwardAuthorizer decides whether the agent forwards a message of size
+// bytes for did and accounts for it
+type ForwardAuthorizer interface {
+	// OwnConnection reports whether conn is a connection of a DID of the
+	// agent with the routers it is stored with, whose messages are sent
+	// rather than forwarded
+	OwnConnection(conn *message.Connection) bool
+	// AuthorizeForward accounts for a message of did whose route starts or
+	// ends at routed, on the side of did. routed must be registered for
+	// mediation, and did must be routed itself or in its keylist.
+	AuthorizeForward(did, routed string, size int64) error
+}
+
+// SetForwardAuthorizer restricts forwarding to what a allows, nil forwards
+// for everyone
+func (m *MsgService) SetForwardAuthorizer(a ForwardAuthorizer) {
+	m.forwards = a
+}
+
+// ForwardFor returns the DID the agent forwards a message of conn for: the
+// sender if the agent is one of its routers, the receiver otherwise
+func (m *MsgService) ForwardFor(conn *message.Connection) string {
+	idx, err := RouterLastIndexOf(m.Cfg.SelfDID, MergeRouter(conn.MyRouter, conn.TheirRouter))
+	if err == nil && idx < len(conn.MyRouter) {
+		return conn.MyDid
+	}
+	return conn.TheirDid
+}
+
+// RoutedBy returns the router the agent forwards a message of conn for,
+// the router right before the agent if it is one of the sender's routers,
+// and the router right after it otherwise. The agent only mediates for the
+// end of the route next to it, so that router must be the first or the
+// last one of the route.
+func (m *MsgService) RoutedBy(conn *message.Connection) (string, error) {
+	routers := MergeRouter(conn.MyRouter, conn.TheirRouter)
+	idx, err := RouterLastIndexOf(m.Cfg.SelfDID, routers)
+	if err != nil {
+		return "", err
+	}
+	others := make([]string, 0)
+	if idx < len(conn.MyRouter) {
+		others = append(others, routers[:idx]...)
+	} else {
+		others = append(others, routers[idx+1:]...)
+	}
+	routed := ""
+	for _, r := range others {
+		did := utils.CutDId(r)
+		if strings.EqualFold(did, m.Cfg.SelfDID) {
+			continue
+		}
+		if routed != "" && !strings.EqualFold(did, routed) {
+			return "", fmt.Errorf("the agent only forwards to or from the router it mediates for")
+		}
+		routed = did
+	}
+	if routed == "" {
+		return "", fmt.Errorf("no router to forward for")
+	}
+	return routed, nil
+}
+
+// checkForward rejects a message to forward for a DID which may not use
+// the agent as its router, or which is over its quota. The messages of a
+// connection of the agent are only sent on the routers it is stored with.
+func (m *MsgService) checkForward(conn *message.Connection, size int64) error {
+	if m.forwards != nil && m.forwards.OwnConnection(conn) {
+		return nil
+	}
+	did := m.ForwardFor(conn)
+	if err := m.policy.Policy().AllowForward(did); err != nil {
+		return err
+	}
+	if m.forwards == nil {
+		return nil
+	}
+	routed, err := m.RoutedBy(conn)
+	if err != nil {
+		return err
+	}
+	return m.forwards.AuthorizeForward(did, routed, size)
+}
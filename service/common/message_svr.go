@@ -20,6 +20,7 @@ package common
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strings"
 
@@ -28,6 +29,8 @@ import (
 	"github.com/ontio/mercury/common/message"
 	"github.com/ontio/mercury/common/packager"
 	"github.com/ontio/mercury/common/packager/ecdsa"
+	"github.com/ontio/mercury/common/policy"
+	"github.com/ontio/mercury/store/blob"
 	"github.com/ontio/mercury/utils"
 	"github.com/ontio/mercury/vdri"
 	sdk "github.com/ontio/ontology-go-sdk"
@@ -42,29 +45,55 @@ type MsgService struct {
 	packager      *ecdsa.Packager
 	enableEnvelop bool
 	Cfg           *config.Cfg
+	blobs         blob.Store
+	blobClient    *http.Client
+	blobFetches   chan struct{}
+	events        *EventBus
+	features      features
+	policy        *policy.Engine
+	forwards      ForwardAuthorizer
+	connections   ConnectionStore
 }
 
 type OutboundMsg struct {
 	Msg       Message
 	Conn      message.Connection
 	IsForward bool
+	// Hops is the number of agents which forwarded the message, this one
+	// included
+	Hops int
 }
 
 func NewMessageService(v vdri.VDRI, ontSdk *sdk.OntologySdk, acct *sdk.Account, enableEnvelop bool, conf *config.Cfg) *MsgService {
 	ms := &MsgService{
 		msgQueue:      make(chan OutboundMsg, 64),
 		client:        utils.NewClient(),
+		blobClient:    NewBlobClient(),
+		blobFetches:   make(chan struct{}, MaxBlobFetches),
 		quitC:         make(chan struct{}),
 		v:             v,
 		packager:      ecdsa.New(ontSdk, acct),
 		enableEnvelop: enableEnvelop,
 		Cfg:           conf,
+		events:        NewEventBus(),
 	}
 	go ms.popMessage()
 	return ms
 }
 
+// Events returns the event bus of the agent, nil for a service not made by
+// NewMessageService
+func (m *MsgService) Events() *EventBus {
+	return m.events
+}
+
 func (m *MsgService) HandleOutBound(omsg OutboundMsg) error {
+	if !omsg.IsForward {
+		err := m.ExternalizeAttachments(omsg.Msg.Content)
+		if err != nil {
+			return err
+		}
+	}
 	go m.pushMessage(omsg)
 	return nil
 }
@@ -84,19 +113,30 @@ func (m *MsgService) popMessage() {
 	}
 }
 
+// SendMsg delivers msg to the next router of its connection. A forwarded
+// message which can't be delivered is reported to its sender.
 func (m *MsgService) SendMsg(msg OutboundMsg) {
+	err := m.sendMsg(msg)
+	if err == nil {
+		return
+	}
+	log.Errorf("error on sendMsg:%s\n", err.Error())
+	if msg.IsForward {
+		m.ReportRoutingFailure(&msg.Conn, err)
+	}
+}
+
+func (m *MsgService) sendMsg(msg OutboundMsg) error {
 	conn := msg.Conn
 	routerList := MergeRouter(conn.MyRouter, conn.TheirRouter)
 	nextRouter, err := m.GetNextRouter(routerList)
 	if err != nil {
-		log.Errorf("error on sendMsg:%s\n", err.Error())
-		return
+		return err
 	}
 	var url string
 	url, err = m.GetServiceURLByRouter(nextRouter, msg.Msg.MessageType)
 	if err != nil {
-		log.Errorf("error on sendMsg:%s\n", err.Error())
-		return
+		return err
 	}
 	log.Infof("===SendMsg messageType:%d", msg.Msg.MessageType)
 	log.Infof("===SendMsg url:%s", url)
@@ -106,8 +146,7 @@ func (m *MsgService) SendMsg(msg OutboundMsg) {
 		if !msg.IsForward {
 			mData, err := json.Marshal(msg.Msg.Content)
 			if err != nil {
-				log.Errorf("json marshal sendMsg:%s", err)
-				return
+				return fmt.Errorf("json marshal sendMsg:%s", err)
 			}
 			messageData := &packager.MessageData{
 				Data:    mData,
@@ -115,51 +154,47 @@ func (m *MsgService) SendMsg(msg OutboundMsg) {
 			}
 			msgData, err = m.packager.PackMessage(messageData, m.Cfg.SelfDID)
 			if err != nil {
-				log.Errorf("pack message err:%s", err)
-				return
+				return fmt.Errorf("pack message err:%s", err)
 			}
 		} else {
 			var ok bool
 			msgData, ok = (msg.Msg.Content).(*packager.MessageData)
 			if !ok {
-				log.Errorf("convert message data failed")
-				return
+				return fmt.Errorf("convert message data failed")
 			}
 		}
 		connectionData, err := json.Marshal(msg.Conn)
 		if err != nil {
-			log.Errorf("convert message data failed err:%s", err)
-			return
+			return fmt.Errorf("convert message data failed err:%s", err)
 		}
 		connectData, err := m.packager.PackConnection(connectionData, utils.CutDId(nextRouter))
 		if err != nil {
-			log.Errorf("convert message data failed")
-			return
+			return fmt.Errorf("pack connection err:%s", err)
 		}
 		msg := &packager.Envelope{
 			Message:    msgData,
 			Connection: connectData,
 			FromDID:    m.Cfg.SelfDID,
 			ToDID:      utils.CutDId(nextRouter),
+			Hops:       msg.Hops,
 		}
 		sendData, err = m.packager.PackData(msg)
 		if err != nil {
-			log.Errorf("err while sendMsg:%s\n", err)
-			return
+			return fmt.Errorf("err while sendMsg:%s", err)
 		}
 	} else {
 		mData, err := json.Marshal(msg.Msg.Content)
 		if err != nil {
-			log.Errorf("json marshal sendMsg:%s", err)
-			return
+			return fmt.Errorf("json marshal sendMsg:%s", err)
 		}
 		sendData = mData
 	}
 	log.Infof("url:%s,data:%s\n", url, sendData)
 	_, err = utils.HttpPostData(m.client, url, string(sendData))
 	if err != nil {
-		log.Errorf("SendMsg msg url:%s,type:%d,err:%s", url, msg.Msg.MessageType, err)
+		return fmt.Errorf("SendMsg msg url:%s,type:%d,err:%s", url, msg.Msg.MessageType, err)
 	}
+	return nil
 }
 
 func (m *MsgService) GetServiceURL(msg OutboundMsg) (string, error) {
@@ -179,6 +214,12 @@ func (m *MsgService) GetServiceURL(msg OutboundMsg) (string, error) {
 	}
 	return endpoint + GetApiName(msg.Msg.MessageType), nil
 }
+
+// GetDIDDoc resolves the did doc of did
+func (m *MsgService) GetDIDDoc(did string) (vdri.CommonDIDDoc, error) {
+	return m.v.GetDIDDoc(utils.CutDId(did))
+}
+
 func (m *MsgService) GetServiceURLByRouter(router string, msgType MessageType) (string, error) {
 	doc, err := m.v.GetDIDDoc(utils.CutDId(router))
 	if err != nil {
@@ -191,23 +232,22 @@ func (m *MsgService) GetServiceURLByRouter(router string, msgType MessageType) (
 	return endpoint + GetApiName(msgType), nil
 }
 
+// GetNextRouter returns the router after this agent in routers, or this
+// agent if it is the last one
 func (m *MsgService) GetNextRouter(routers []string) (string, error) {
-	myDid := m.Cfg.SelfDID
-	//if the last one is myself
-	if strings.EqualFold(myDid, utils.CutDId(routers[len(routers)-1])) {
-		return routers[len(routers)-1], nil
+	if err := ValidateRoute(routers); err != nil {
+		return "", err
 	}
-	idx, err := RouterLastIndexOf(myDid, routers)
+	idx, err := RouterLastIndexOf(m.Cfg.SelfDID, routers)
 	if err != nil {
-		log.Errorf("error on sendMsg:%s\n", err.Error())
 		return "", err
 	}
-	if strings.EqualFold(myDid, utils.CutDId(routers[idx+1])) {
-		return routers[idx+2], nil
+	if idx == len(routers)-1 {
+		return routers[idx], nil
 	}
 	return routers[idx+1], nil
 }
 
 func (m *MsgService) NeedForwardMsg(router string, routers []string) bool {
-	return strings.EqualFold(router, routers[len(routers)-1])
+	return len(routers) > 0 && strings.EqualFold(router, routers[len(routers)-1])
 }
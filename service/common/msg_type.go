@@ -49,6 +49,53 @@ const (
 	ReceiveBasicMsgType
 	QueryBasicMessageType
 	QueryConnectionsType
+
+	SearchCredentialsType
+	SearchPresentationsType
+
+	ProblemReportType
+
+	CreateInvitationType
+	AcceptInvitationType
+	QueryInvitationType
+	RevokeInvitationType
+
+	ListConnectionsType
+	QueryConnectionRequestType
+	CancelConnectionRequestType
+	UpdateConnectionType
+
+	SendTrustPingType
+	TrustPingType
+	TrustPingResponseType
+
+	DIDExchangeRequestType
+	DIDExchangeResponseType
+	DIDExchangeCompleteType
+
+	QueryProblemReportsType
+
+	RotateDIDType
+	DIDRotateType
+	DIDRotateAckType
+
+	DiscoverFeaturesType
+	FeaturesQueryType
+	FeaturesDiscloseType
+
+	ReloadPolicyType
+
+	RegisterMediationType
+	RemoveMediationType
+	QueryForwardUsageType
+
+	RequestMediationType
+	MediateRequestType
+	MediateGrantType
+	MediateDenyType
+	UpdateKeylistType
+	KeylistUpdateType
+	KeylistResponseType
 )
 
 type Message struct {
@@ -82,6 +129,43 @@ const (
 	ReceiveBasicMsgApi           = "/api/v1/receivebasicmsg"
 	QueryBasicMsgApi             = "/api/v1/querybasicmsg"
 	QueryConnectionsApi          = "/api/v1/queryconnections"
+	SearchCredentialsApi         = "/api/v1/searchcredentials"
+	SearchPresentationsApi       = "/api/v1/searchpresentations"
+	ExportApi                    = "/api/v1/admin/export"
+	BlobApi                      = "/api/v1/blob"
+	ProblemReportApi             = "/api/v1/problemreport"
+	CreateInvitationApi          = "/api/v1/createinvitation"
+	AcceptInvitationApi          = "/api/v1/acceptinvitation"
+	QueryInvitationApi           = "/api/v1/queryinvitation"
+	RevokeInvitationApi          = "/api/v1/revokeinvitation"
+	ListConnectionsApi           = "/api/v1/listconnections"
+	QueryConnectionRequestApi    = "/api/v1/queryconnectionrequest"
+	CancelConnectionRequestApi   = "/api/v1/cancelconnectionrequest"
+	UpdateConnectionApi          = "/api/v1/updateconnection"
+	SendTrustPingApi             = "/api/v1/sendtrustping"
+	TrustPingApi                 = "/api/v1/trustping"
+	TrustPingResponseApi         = "/api/v1/trustpingresponse"
+	DIDExchangeRequestApi        = "/api/v1/didexchangerequest"
+	DIDExchangeResponseApi       = "/api/v1/didexchangeresponse"
+	DIDExchangeCompleteApi       = "/api/v1/didexchangecomplete"
+	QueryProblemReportsApi       = "/api/v1/queryproblemreports"
+	RotateDIDApi                 = "/api/v1/admin/rotatedid"
+	DIDRotateApi                 = "/api/v1/didrotate"
+	DIDRotateAckApi              = "/api/v1/didrotateack"
+	DiscoverFeaturesApi          = "/api/v1/discoverfeatures"
+	FeaturesQueryApi             = "/api/v1/featuresquery"
+	FeaturesDiscloseApi          = "/api/v1/featuresdisclose"
+	ReloadPolicyApi              = "/api/v1/admin/reloadpolicy"
+	RegisterMediationApi         = "/api/v1/admin/registermediation"
+	RemoveMediationApi           = "/api/v1/admin/removemediation"
+	QueryForwardUsageApi         = "/api/v1/admin/queryforwardusage"
+	RequestMediationApi          = "/api/v1/admin/requestmediation"
+	MediateRequestApi            = "/api/v1/mediaterequest"
+	MediateGrantApi              = "/api/v1/mediategrant"
+	MediateDenyApi               = "/api/v1/mediatedeny"
+	UpdateKeylistApi             = "/api/v1/admin/updatekeylist"
+	KeylistUpdateApi             = "/api/v1/keylistupdate"
+	KeylistResponseApi           = "/api/v1/keylistresponse"
 )
 
 func GetApiName(msgType MessageType) string {
@@ -124,6 +208,76 @@ func GetApiName(msgType MessageType) string {
 		return QueryPresentationApi
 	case QueryConnectionsType:
 		return QueryConnectionsApi
+	case SearchCredentialsType:
+		return SearchCredentialsApi
+	case SearchPresentationsType:
+		return SearchPresentationsApi
+	case ProblemReportType:
+		return ProblemReportApi
+	case CreateInvitationType:
+		return CreateInvitationApi
+	case AcceptInvitationType:
+		return AcceptInvitationApi
+	case QueryInvitationType:
+		return QueryInvitationApi
+	case RevokeInvitationType:
+		return RevokeInvitationApi
+	case ListConnectionsType:
+		return ListConnectionsApi
+	case QueryConnectionRequestType:
+		return QueryConnectionRequestApi
+	case CancelConnectionRequestType:
+		return CancelConnectionRequestApi
+	case UpdateConnectionType:
+		return UpdateConnectionApi
+	case SendTrustPingType:
+		return SendTrustPingApi
+	case TrustPingType:
+		return TrustPingApi
+	case TrustPingResponseType:
+		return TrustPingResponseApi
+	case DIDExchangeRequestType:
+		return DIDExchangeRequestApi
+	case DIDExchangeResponseType:
+		return DIDExchangeResponseApi
+	case DIDExchangeCompleteType:
+		return DIDExchangeCompleteApi
+	case QueryProblemReportsType:
+		return QueryProblemReportsApi
+	case RotateDIDType:
+		return RotateDIDApi
+	case DIDRotateType:
+		return DIDRotateApi
+	case DIDRotateAckType:
+		return DIDRotateAckApi
+	case DiscoverFeaturesType:
+		return DiscoverFeaturesApi
+	case FeaturesQueryType:
+		return FeaturesQueryApi
+	case FeaturesDiscloseType:
+		return FeaturesDiscloseApi
+	case ReloadPolicyType:
+		return ReloadPolicyApi
+	case RegisterMediationType:
+		return RegisterMediationApi
+	case RemoveMediationType:
+		return RemoveMediationApi
+	case QueryForwardUsageType:
+		return QueryForwardUsageApi
+	case RequestMediationType:
+		return RequestMediationApi
+	case MediateRequestType:
+		return MediateRequestApi
+	case MediateGrantType:
+		return MediateGrantApi
+	case MediateDenyType:
+		return MediateDenyApi
+	case UpdateKeylistType:
+		return UpdateKeylistApi
+	case KeylistUpdateType:
+		return KeylistUpdateApi
+	case KeylistResponseType:
+		return KeylistResponseApi
 	default:
 		return ""
 	}
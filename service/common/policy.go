@@ -0,0 +1,83 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package common
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ontio/mercury/common/message"
+	"github.com/ontio/mercury/common/policy"
+	"github.com/ontio/mercury/utils"
+)
+
+// SetPolicy enables the connection and forwarding policy, nil allows all
+func (m *MsgService) SetPolicy(e *policy.Engine) {
+	m.policy = e
+}
+
+// Policy returns the policy engine, nil if no policy is set
+func (m *MsgService) Policy() *policy.Engine {
+	return m.policy
+}
+
+// checkSender rejects an enveloped message of conn which doesn't come from
+// its sender, from is the DID whose key signed the envelope. A message is
+// sent by MyDid itself, or by the router before this agent on its route,
+// which vouches for the DIDs it routes for.
+func (m *MsgService) checkSender(conn *message.Connection, from string) error {
+	if strings.EqualFold(utils.CutDId(from), utils.CutDId(conn.MyDid)) {
+		return nil
+	}
+	routers := MergeRouter(conn.MyRouter, conn.TheirRouter)
+	idx, err := RouterLastIndexOf(m.Cfg.SelfDID, routers)
+	if err != nil {
+		return err
+	}
+	for i := idx - 1; i >= 0; i-- {
+		prev := utils.CutDId(routers[i])
+		if strings.EqualFold(prev, m.Cfg.SelfDID) {
+			continue
+		}
+		if strings.EqualFold(prev, utils.CutDId(from)) {
+			return nil
+		}
+		break
+	}
+	return fmt.Errorf("message of %s is sent by %s", conn.MyDid, from)
+}
+
+// checkPolicy rejects a message from a peer the policy doesn't allow to
+// send it. The sender is MyDid of the connection the message carries, and
+// for an enveloped message also from, the DID which signed the envelope.
+// Admin requests and disconnects are not checked.
+func (m *MsgService) checkPolicy(messageType MessageType, msg message.RequestInf, from string) error {
+	spec, ok := messageSpecs[messageType]
+	conn := msg.GetConnection()
+	if !ok || conn == nil {
+		return nil
+	}
+	if err := m.policy.Policy().AllowMessage(conn.MyDid, spec); err != nil {
+		return err
+	}
+	if from == "" || strings.EqualFold(utils.CutDId(from), utils.CutDId(conn.MyDid)) {
+		return nil
+	}
+	return m.policy.Policy().AllowMessage(utils.CutDId(from), spec)
+}
@@ -0,0 +1,142 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package common
+
+import (
+	"github.com/ontio/mercury/common/log"
+	"github.com/ontio/mercury/common/message"
+	"github.com/ontio/mercury/utils"
+	"github.com/ontio/mercury/vdri"
+)
+
+// The problem codes of the reports sent when a received message fails its
+// flow
+const (
+	// ProblemAttachmentInvalid is the problem code of a message rejected
+	// for one of its attachments
+	ProblemAttachmentInvalid = "attachment-invalid"
+	// ProblemRequestNotAccepted rejects a connection or did exchange
+	// request
+	ProblemRequestNotAccepted = "request-not-accepted"
+	// ProblemResponseNotAccepted rejects the response to a connection or
+	// did exchange request
+	ProblemResponseNotAccepted = "response-not-accepted"
+	// ProblemConnectionAbandoned tells that a connection request was
+	// dropped after a failed ack
+	ProblemConnectionAbandoned = "connection-abandoned"
+	// ProblemIssuanceFailed tells that a proposal or request of a
+	// credential could not be answered
+	ProblemIssuanceFailed = "issuance-failed"
+	// ProblemCredentialNotAccepted rejects an offered or issued credential
+	ProblemCredentialNotAccepted = "credential-not-accepted"
+	// ProblemPresentationFailed tells that a presentation request could
+	// not be answered
+	ProblemPresentationFailed = "presentation-failed"
+	// ProblemPresentationNotAccepted rejects a presentation
+	ProblemPresentationNotAccepted = "presentation-not-accepted"
+	// ProblemRotationNotAccepted rejects a did rotation
+	ProblemRotationNotAccepted = "rotation-not-accepted"
+	// ProblemMediationNotGranted rejects a keylist update of a connection
+	// without mediation
+	ProblemMediationNotGranted = "mediation-not-granted"
+)
+
+// problemDescriptions are the descriptions sent with each problem code, the
+// error behind a report is only logged as it may tell about the agent
+var problemDescriptions = map[string]string{
+	ProblemAttachmentInvalid:       "an attachment of the message was rejected",
+	ProblemRequestNotAccepted:      "the connection request was not accepted",
+	ProblemResponseNotAccepted:     "the connection response was not accepted",
+	ProblemConnectionAbandoned:     "the connection request was abandoned",
+	ProblemIssuanceFailed:          "the credential could not be issued",
+	ProblemCredentialNotAccepted:   "the credential was not accepted",
+	ProblemPresentationFailed:      "the presentation could not be made",
+	ProblemPresentationNotAccepted: "the presentation was not accepted",
+	ProblemRotationNotAccepted:     "the did rotation was not accepted",
+	ProblemMediationNotGranted:     "mediation is not granted",
+	ProblemRoutingFailed:           "the message could not be forwarded",
+}
+
+// ProblemDescription returns the description sent with a problem code
+func ProblemDescription(code string) string {
+	if desc, ok := problemDescriptions[code]; ok {
+		return desc
+	}
+	return "the message was rejected"
+}
+
+// ConnectionStore finds the connections stored by the agent
+type ConnectionStore interface {
+	// GetConnection returns the connection of myDID with theirDID with the
+	// routers it is stored with
+	GetConnection(myDID, theirDID string) (message.Connection, error)
+}
+
+// SetConnectionStore lets the problem reports go over the routers of the
+// stored connections
+func (m *MsgService) SetConnectionStore(c ConnectionStore) {
+	m.connections = c
+}
+
+// replyConnection returns the connection to answer a message received on
+// conn with, the stored connection if there is one so that the answer
+// doesn't follow the routers the message claimed
+func (m *MsgService) replyConnection(conn message.Connection) message.Connection {
+	reply := ReverseConnection(conn)
+	if m.connections == nil {
+		return reply
+	}
+	stored, err := m.connections.GetConnection(reply.MyDid, reply.TheirDid)
+	if err != nil {
+		return reply
+	}
+	return stored
+}
+
+// SendProblemReport tells the sender of a message on conn that it was
+// rejected, thid is the thread of the failed flow. The report only carries
+// the description of code, reason is logged. The caller has to make sure
+// conn is a known connection or belongs to a saved request, the report
+// goes over the routers of the stored connection if there is one.
+func (m *MsgService) SendProblemReport(conn message.Connection, thid, code string, reason error) {
+	log.Infof("problem report %s on thread %s to %s:%s", code, thid, conn.MyDid, reason)
+	report := &message.ProblemReport{
+		Type:   vdri.ProblemReportSpec,
+		Id:     utils.GenUUID(),
+		Thread: message.Thread{ID: thid},
+		Description: message.ProblemDescription{
+			Code: code,
+			En:   ProblemDescription(code),
+		},
+		Connection: m.replyConnection(conn),
+	}
+	if ae, ok := reason.(*AttachmentError); ok {
+		report.ProblemItems = []map[string]string{{"attachment": ae.Id}}
+	}
+	err := m.HandleOutBound(OutboundMsg{
+		Msg: Message{
+			MessageType: ProblemReportType,
+			Content:     report,
+		},
+		Conn: report.Connection,
+	})
+	if err != nil {
+		log.Errorf("error on SendProblemReport:%s", err.Error())
+	}
+}
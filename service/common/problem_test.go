@@ -0,0 +1,61 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package common
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/ontio/mercury/common/message"
+	"github.com/stretchr/testify/assert"
+)
+
+type testConnections map[string]message.Connection
+
+func (c testConnections) GetConnection(myDID, theirDID string) (message.Connection, error) {
+	conn, ok := c[myDID+" "+theirDID]
+	if !ok {
+		return message.Connection{}, fmt.Errorf("connection not found!")
+	}
+	return conn, nil
+}
+
+func TestReplyConnection(t *testing.T) {
+	m := &MsgService{}
+	received := message.Connection{
+		MyDid:       "did:ont:bob",
+		MyRouter:    []string{"did:ont:evil#1"},
+		TheirDid:    "did:ont:alice",
+		TheirRouter: []string{"did:ont:alice#1"},
+	}
+	reply := m.replyConnection(received)
+	assert.Equal(t, ReverseConnection(received), reply)
+
+	stored := message.Connection{
+		MyDid:       "did:ont:alice",
+		MyRouter:    []string{"did:ont:alice#1"},
+		TheirDid:    "did:ont:bob",
+		TheirRouter: []string{"did:ont:bob#1", "did:ont:mediator#1"},
+	}
+	m.SetConnectionStore(testConnections{"did:ont:alice did:ont:bob": stored})
+	assert.Equal(t, stored, m.replyConnection(received))
+
+	received.MyDid = "did:ont:carol"
+	assert.Equal(t, ReverseConnection(received), m.replyConnection(received))
+}
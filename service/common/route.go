@@ -0,0 +1,138 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package common
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ontio/mercury/common/log"
+	"github.com/ontio/mercury/common/message"
+	"github.com/ontio/mercury/utils"
+	"github.com/ontio/mercury/vdri"
+)
+
+const (
+	// MaxRouters bounds the routers of the route of a message
+	MaxRouters = 16
+	// MaxForwardHops is the hop counter of an envelope at which a router
+	// drops the message. The counter is not signed, any forwarder can reset
+	// it and messages without envelope carry none, so it doesn't bound
+	// forwarding and only catches agents misrouting to each other. Loops
+	// are bounded by ValidateRoute, as a route without repeated routers
+	// takes a message through each router at most once.
+	MaxForwardHops = 16
+
+	// ProblemRoutingFailed tells the sender of a message that a router
+	// could not forward it
+	ProblemRoutingFailed = "routing-failed"
+	// ProblemItemTheirDid is the problem item naming the receiver of the
+	// message a router failed to forward
+	ProblemItemTheirDid = "their_did"
+)
+
+// ValidateRoute checks the route of a message, the merged routers of its
+// connection. Every router must be a did, and a router may only repeat
+// right after itself, as when both parties use the same mediator. Any
+// other repeat could send the message back to a router it already passed.
+func ValidateRoute(routers []string) error {
+	if len(routers) == 0 {
+		return fmt.Errorf("empty route")
+	}
+	if len(routers) > MaxRouters {
+		return fmt.Errorf("route of %d routers, at most %d are allowed", len(routers), MaxRouters)
+	}
+	seen := make(map[string]bool, len(routers))
+	prev := ""
+	for _, r := range routers {
+		did := strings.ToLower(utils.CutDId(r))
+		if !strings.HasPrefix(did, "did:") {
+			return fmt.Errorf("invalid router %q", r)
+		}
+		if did == prev {
+			continue
+		}
+		if seen[did] {
+			return fmt.Errorf("router %s repeats in the route", r)
+		}
+		seen[did] = true
+		prev = did
+	}
+	return nil
+}
+
+// checkRoute validates the route of a message received on conn and tells
+// whether the agent has to forward it
+func (m *MsgService) checkRoute(conn *message.Connection) (bool, error) {
+	routers := MergeRouter(conn.MyRouter, conn.TheirRouter)
+	if err := ValidateRoute(routers); err != nil {
+		return false, err
+	}
+	if _, err := RouterLastIndexOf(m.Cfg.SelfDID, routers); err != nil {
+		return false, fmt.Errorf("this agent is not a router of the message")
+	}
+	return !IsReceiver(m.Cfg.SelfDID, routers), nil
+}
+
+// checkHops rejects a message forwarded through too many agents, hops is
+// the number of agents it passed before this one
+func checkHops(hops int) error {
+	if hops < 0 || hops >= MaxForwardHops {
+		return fmt.Errorf("message forwarded %d times, at most %d are allowed", hops, MaxForwardHops)
+	}
+	return nil
+}
+
+// ReportRoutingFailure tells the sender of a message on conn that the agent
+// could not forward or deliver it. The report goes back on the routers the
+// message passed, so nothing is sent if the agent isn't on a valid route.
+// The report only carries the description of its code, reason is logged.
+func (m *MsgService) ReportRoutingFailure(conn *message.Connection, reason error) {
+	log.Infof("routing failure of a message from %s to %s:%s", conn.MyDid, conn.TheirDid, reason)
+	routers := MergeRouter(conn.MyRouter, conn.TheirRouter)
+	idx, err := RouterLastIndexOf(m.Cfg.SelfDID, routers)
+	if err != nil || ValidateRoute(routers[:idx+1]) != nil {
+		return
+	}
+	report := &message.ProblemReport{
+		Type: vdri.ProblemReportSpec,
+		Id:   utils.GenUUID(),
+		Description: message.ProblemDescription{
+			Code: ProblemRoutingFailed,
+			En:   ProblemDescription(ProblemRoutingFailed),
+		},
+		ProblemItems: []map[string]string{{ProblemItemTheirDid: conn.TheirDid}},
+		Connection: message.Connection{
+			MyDid:       m.Cfg.SelfDID,
+			MyRouter:    []string{routers[idx]},
+			TheirDid:    conn.MyDid,
+			TheirRouter: append([]string{}, routers[:idx]...),
+		},
+	}
+	err = m.HandleOutBound(OutboundMsg{
+		Msg: Message{
+			MessageType: ProblemReportType,
+			Content:     report,
+		},
+		Conn: report.Connection,
+	})
+	if err != nil {
+		log.Errorf("error on ReportRoutingFailure:%s", err.Error())
+	}
+}
@@ -8,10 +8,10 @@ import (
 	"io/ioutil"
 	"strings"
 
+	"github.com/gin-gonic/gin"
 	"github.com/ontio/mercury/common/log"
 	"github.com/ontio/mercury/common/message"
 	"github.com/ontio/mercury/common/packager/ecdsa"
-	"github.com/gin-gonic/gin"
 )
 
 var (
@@ -27,28 +27,42 @@ func ReverseConnection(conn message.Connection) message.Connection {
 	}
 }
 
-func ParseConnectionMsg(c *gin.Context, packager *ecdsa.Packager) (*message.Connection, *packager.MessageData, error) {
+// ParseConnectionMsg unpacks an envelope into its connection, its message,
+// the number of agents which forwarded it and the DID of the agent which
+// sent it. The sender is only authenticated for an envelope with a
+// connection, whose signature is checked against its key.
+func ParseConnectionMsg(c *gin.Context, packager *ecdsa.Packager) (*message.Connection, *packager.MessageData, int, string, error) {
 	body, err := ioutil.ReadAll(c.Request.Body)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, 0, "", err
 	}
 	msg, err := packager.UnPackData(body)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, 0, "", err
 	}
 	if msg.Connection == nil {
-		return nil, msg.Message, nil
+		return nil, msg.Message, msg.Hops, "", nil
 	}
 	data, err := packager.UnPackConnection(msg)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, 0, "", err
 	}
 	connection := &message.Connection{}
 	err = json.Unmarshal(data.Data, connection)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, 0, "", err
 	}
-	return connection, msg.Message, nil
+	return connection, msg.Message, msg.Hops, msg.FromDID, nil
+}
+
+// senderKey keeps the DID which signed the envelope of a message in the
+// gin context
+const senderKey = "mercury.sender"
+
+// Sender returns the DID whose key signed the envelope of the message
+// ParseMessage parsed, empty for a message without an envelope
+func Sender(ctx *gin.Context) string {
+	return ctx.GetString(senderKey)
 }
 
 func ParseMessage(enablePackage bool, ctx *gin.Context, packager *ecdsa.Packager, messageType MessageType, msgSvr *MsgService) (interface{}, bool, error) {
@@ -56,13 +70,33 @@ func ParseMessage(enablePackage bool, ctx *gin.Context, packager *ecdsa.Packager
 	if err != nil {
 		return nil, false, err
 	}
+	//the agent which sent the message, known for enveloped messages only
+	sender := ""
 	if enablePackage {
-		connections, messageData, err := ParseConnectionMsg(ctx, packager)
+		connections, messageData, hops, from, err := ParseConnectionMsg(ctx, packager)
 		if err != nil {
 			return nil, false, err
 		}
+		forward := false
+		if connections != nil {
+			if forward, err = msgSvr.checkRoute(connections); err != nil {
+				msgSvr.ReportRoutingFailure(connections, err)
+				return nil, false, err
+			}
+			if err = msgSvr.checkSender(connections, from); err != nil {
+				return nil, false, err
+			}
+		}
 		//check need router forward
-		if connections != nil && !IsReceiver(msgSvr.Cfg.SelfDID, MergeRouter(connections.MyRouter, connections.TheirRouter)) {
+		if forward {
+			if err = checkHops(hops); err != nil {
+				msgSvr.ReportRoutingFailure(connections, err)
+				return nil, false, err
+			}
+			if err = msgSvr.checkForward(connections, int64(len(messageData.Data))); err != nil {
+				msgSvr.ReportRoutingFailure(connections, err)
+				return nil, false, err
+			}
 			outMsg := OutboundMsg{
 				Msg: Message{
 					MessageType: TransferForwardMsgType(messageType),
@@ -70,6 +104,7 @@ func ParseMessage(enablePackage bool, ctx *gin.Context, packager *ecdsa.Packager
 				},
 				Conn:      *connections,
 				IsForward: true,
+				Hops:      hops + 1,
 			}
 			err = msgSvr.HandleOutBound(outMsg)
 			if err != nil {
@@ -87,6 +122,12 @@ func ParseMessage(enablePackage bool, ctx *gin.Context, packager *ecdsa.Packager
 		if err != nil {
 			return nil, false, err
 		}
+		if conn := msgObject.GetConnection(); conn != nil && connections != nil &&
+			(conn.MyDid != connections.MyDid || conn.TheirDid != connections.TheirDid) {
+			return nil, false, fmt.Errorf("message connection differs from the envelope connection")
+		}
+		sender = from
+		ctx.Set(senderKey, from)
 	} else {
 		err = ctx.Bind(msgObject)
 		if err != nil {
@@ -95,8 +136,21 @@ func ParseMessage(enablePackage bool, ctx *gin.Context, packager *ecdsa.Packager
 
 		connections := msgObject.GetConnection()
 		if connections != nil {
+			forward, err := msgSvr.checkRoute(connections)
+			if err != nil {
+				msgSvr.ReportRoutingFailure(connections, err)
+				return nil, false, err
+			}
 			//check need router forward
-			if !IsReceiver(msgSvr.Cfg.SelfDID, MergeRouter(connections.MyRouter, connections.TheirRouter)) {
+			if forward {
+				content, err := json.Marshal(msgObject)
+				if err != nil {
+					return nil, false, err
+				}
+				if err = msgSvr.checkForward(connections, int64(len(content))); err != nil {
+					msgSvr.ReportRoutingFailure(connections, err)
+					return nil, false, err
+				}
 				outMsg := OutboundMsg{
 					Msg: Message{
 						MessageType: TransferForwardMsgType(messageType),
@@ -115,6 +169,9 @@ func ParseMessage(enablePackage bool, ctx *gin.Context, packager *ecdsa.Packager
 		}
 
 	}
+	if err = msgSvr.checkPolicy(messageType, msgObject, sender); err != nil {
+		return nil, false, err
+	}
 	return msgObject, false, nil
 }
 
@@ -167,6 +224,72 @@ func getMsgObjectByType(messageType MessageType) (message.RequestInf, error) {
 		req = &message.DeletePresentationRequest{}
 	case QueryConnectionsType:
 		req = &message.QueryConnectionsRequest{}
+	case SearchCredentialsType:
+		req = &message.SearchCredentialsRequest{}
+	case SearchPresentationsType:
+		req = &message.SearchPresentationsRequest{}
+	case ProblemReportType:
+		req = &message.ProblemReport{}
+	case CreateInvitationType:
+		req = &message.CreateInvitationRequest{}
+	case AcceptInvitationType:
+		req = &message.AcceptInvitationRequest{}
+	case QueryInvitationType, RevokeInvitationType:
+		req = &message.InvitationRequest{}
+	case ListConnectionsType:
+		req = &message.ListConnectionsRequest{}
+	case QueryConnectionRequestType, CancelConnectionRequestType:
+		req = &message.PendingRequest{}
+	case UpdateConnectionType:
+		req = &message.UpdateConnectionRequest{}
+	case SendTrustPingType:
+		req = &message.SendTrustPingRequest{}
+	case TrustPingType:
+		req = &message.TrustPing{}
+	case TrustPingResponseType:
+		req = &message.TrustPingResponse{}
+	case DIDExchangeRequestType:
+		req = &message.DIDExchangeRequest{}
+	case DIDExchangeResponseType:
+		req = &message.DIDExchangeResponse{}
+	case DIDExchangeCompleteType:
+		req = &message.DIDExchangeComplete{}
+	case QueryProblemReportsType:
+		req = &message.QueryProblemReportsRequest{}
+	case RotateDIDType:
+		req = &message.RotateDIDRequest{}
+	case DIDRotateType:
+		req = &message.DIDRotate{}
+	case DIDRotateAckType:
+		req = &message.DIDRotateAck{}
+	case DiscoverFeaturesType:
+		req = &message.DiscoverFeaturesRequest{}
+	case FeaturesQueryType:
+		req = &message.FeaturesQuery{}
+	case FeaturesDiscloseType:
+		req = &message.FeaturesDisclose{}
+	case ReloadPolicyType:
+		req = &message.ReloadPolicyRequest{}
+	case RegisterMediationType:
+		req = &message.RegisterMediationRequest{}
+	case RemoveMediationType:
+		req = &message.RemoveMediationRequest{}
+	case QueryForwardUsageType:
+		req = &message.QueryForwardUsageRequest{}
+	case RequestMediationType:
+		req = &message.RequestMediationRequest{}
+	case MediateRequestType:
+		req = &message.MediateRequest{}
+	case MediateGrantType:
+		req = &message.MediateGrant{}
+	case MediateDenyType:
+		req = &message.MediateDeny{}
+	case UpdateKeylistType:
+		req = &message.UpdateKeylistRequest{}
+	case KeylistUpdateType:
+		req = &message.KeylistUpdate{}
+	case KeylistResponseType:
+		req = &message.KeylistUpdateResponse{}
 	default:
 		return nil, fmt.Errorf("msg type err:%v", messageType)
 	}
@@ -19,8 +19,12 @@
 package common
 
 import (
-	"github.com/stretchr/testify/assert"
+	"fmt"
 	"testing"
+
+	"github.com/ontio/mercury/common/config"
+	"github.com/ontio/mercury/common/message"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestRouterLastIndexOf(t *testing.T) {
@@ -69,3 +73,90 @@ func TestMergeRouter(t *testing.T) {
 	l, _ := RouterLastIndexOf("did:ont:ddddd", res)
 	assert.Equal(t, l, 3)
 }
+
+func TestForwardFor(t *testing.T) {
+	m := &MsgService{Cfg: &config.Cfg{SelfDID: "did:ont:mediator"}}
+	conn := &message.Connection{
+		MyDid:       "did:ont:alice",
+		MyRouter:    []string{"did:ont:alice#1"},
+		TheirDid:    "did:ont:bob",
+		TheirRouter: []string{"did:ont:bob#1", "did:ont:mediator#1"},
+	}
+	assert.Equal(t, "did:ont:bob", m.ForwardFor(conn))
+	conn.MyRouter = []string{"did:ont:alice#1", "did:ont:mediator#1"}
+	conn.TheirRouter = []string{"did:ont:bob#1"}
+	assert.Equal(t, "did:ont:alice", m.ForwardFor(conn))
+}
+
+func TestRoutedBy(t *testing.T) {
+	m := &MsgService{Cfg: &config.Cfg{SelfDID: "did:ont:mediator"}}
+	conn := &message.Connection{
+		MyDid:       "did:ont:alice",
+		MyRouter:    []string{"did:ont:alice#1"},
+		TheirDid:    "did:ont:bob",
+		TheirRouter: []string{"did:ont:bob#1", "did:ont:mediator#1"},
+	}
+	routed, err := m.RoutedBy(conn)
+	assert.Nil(t, err)
+	assert.Equal(t, "did:ont:bob", routed)
+	conn.MyRouter = []string{"did:ont:alice#1", "did:ont:mediator#1"}
+	conn.TheirRouter = []string{"did:ont:bob#1"}
+	routed, err = m.RoutedBy(conn)
+	assert.Nil(t, err)
+	assert.Equal(t, "did:ont:alice", routed)
+	// the agent doesn't relay on to further routers
+	conn.MyRouter = []string{"did:ont:alice#1"}
+	conn.TheirRouter = []string{"did:ont:bob#1", "did:ont:relay#1", "did:ont:mediator#1"}
+	_, err = m.RoutedBy(conn)
+	assert.NotNil(t, err)
+}
+
+func TestValidateRoute(t *testing.T) {
+	assert.NotNil(t, ValidateRoute(nil))
+	assert.Nil(t, ValidateRoute([]string{"did:ont:alice#1", "did:ont:mediator#1", "did:ont:mediator#1", "did:ont:bob#1"}))
+	assert.NotNil(t, ValidateRoute([]string{"did:ont:alice#1", "did:ont:bob#1", "did:ont:alice#1"}))
+	assert.NotNil(t, ValidateRoute([]string{"did:ont:alice#1", "", "did:ont:bob#1"}))
+	long := make([]string, MaxRouters+1)
+	for i := range long {
+		long[i] = fmt.Sprintf("did:ont:router%d#1", i)
+	}
+	assert.NotNil(t, ValidateRoute(long))
+
+	assert.Nil(t, checkHops(MaxForwardHops-1))
+	assert.NotNil(t, checkHops(MaxForwardHops))
+}
+
+func TestGetNextRouter(t *testing.T) {
+	m := &MsgService{Cfg: &config.Cfg{SelfDID: "did:ont:mediator"}}
+	next, err := m.GetNextRouter([]string{"did:ont:alice#1", "did:ont:mediator#1", "did:ont:mediator#1", "did:ont:bob#1"})
+	assert.Nil(t, err)
+	assert.Equal(t, "did:ont:bob#1", next)
+	next, err = m.GetNextRouter([]string{"did:ont:alice#1", "did:ont:mediator#1"})
+	assert.Nil(t, err)
+	assert.Equal(t, "did:ont:mediator#1", next)
+
+	// malformed routes fail instead of panicking or bouncing
+	_, err = m.GetNextRouter(nil)
+	assert.NotNil(t, err)
+	_, err = m.GetNextRouter([]string{"did:ont:alice#1", "did:ont:bob#1"})
+	assert.NotNil(t, err)
+	_, err = m.GetNextRouter([]string{"did:ont:mediator#1", "did:ont:bob#1", "did:ont:mediator#1", "did:ont:bob#1"})
+	assert.NotNil(t, err)
+}
+
+func TestCheckSender(t *testing.T) {
+	m := &MsgService{Cfg: &config.Cfg{SelfDID: "did:ont:bob"}}
+	conn := &message.Connection{
+		MyDid:       "did:ont:alice",
+		MyRouter:    []string{"did:ont:agent#1", "did:ont:mediator#1"},
+		TheirDid:    "did:ont:bob",
+		TheirRouter: []string{"did:ont:bob#1"},
+	}
+	assert.Nil(t, m.checkSender(conn, "did:ont:alice"))
+	assert.Nil(t, m.checkSender(conn, "did:ont:mediator"))
+	// only the router right before this agent sent the message
+	assert.NotNil(t, m.checkSender(conn, "did:ont:agent"))
+	assert.NotNil(t, m.checkSender(conn, "did:ont:mallory"))
+	conn.MyRouter = []string{"did:ont:bob#1"}
+	assert.NotNil(t, m.checkSender(conn, "did:ont:mallory"))
+}
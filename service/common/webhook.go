@@ -0,0 +1,93 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ontio/mercury/common/log"
+)
+
+const (
+	// webhookBuffer is how many events wait for the webhook before the
+	// next ones are missed
+	webhookBuffer  = 64
+	webhookTimeout = 10 * time.Second
+)
+
+// EventWebhook posts every event of a bus as json to a url, one request per
+// event. An event the url doesn't accept is logged and dropped.
+type EventWebhook struct {
+	url    string
+	client *http.Client
+	events <-chan Event
+	cancel func()
+	done   chan struct{}
+}
+
+func NewEventWebhook(bus *EventBus, url string) *EventWebhook {
+	events, cancel := bus.Subscribe(webhookBuffer)
+	return &EventWebhook{
+		url:    url,
+		client: &http.Client{Timeout: webhookTimeout},
+		events: events,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+}
+
+func (w *EventWebhook) Start() {
+	go w.run()
+}
+
+// Stop unsubscribes from the bus and waits for the events already
+// published to be posted
+func (w *EventWebhook) Stop() {
+	w.cancel()
+	<-w.done
+}
+
+func (w *EventWebhook) run() {
+	defer close(w.done)
+	for e := range w.events {
+		if err := w.post(e); err != nil {
+			log.Warnf("event webhook %s dropped %s:%s", w.url, e.Type, err)
+		}
+	}
+}
+
+func (w *EventWebhook) post(e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	resp, err := w.client.Post(w.url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned %s", w.url, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package controller
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ontio/mercury/common/log"
+	"github.com/ontio/mercury/common/message"
+	"github.com/ontio/mercury/service/common"
+	"github.com/ontio/mercury/store/blob"
+)
+
+// BlobController serves the blobs linked from the attachments the agent
+// sent, a blob is only found by its sha256
+type BlobController struct {
+	msgSvr *common.MsgService
+}
+
+func NewBlobController(msgSvr *common.MsgService) common.Router {
+	return &BlobController{
+		msgSvr: msgSvr,
+	}
+}
+
+func (b *BlobController) Routes() common.Routes {
+	return common.Routes{
+		{
+			Name:        "GetBlob",
+			Method:      strings.ToUpper("Get"),
+			Pattern:     common.BlobApi + "/:sha",
+			HandlerFunc: b.GetBlob,
+		},
+	}
+}
+
+func (b *BlobController) GetBlob(ctx *gin.Context) {
+	resp := common.Gin{C: ctx}
+	bs := b.msgSvr.BlobStore()
+	sum := ctx.Param("sha")
+	if bs == nil || !blob.ValidSum(sum) {
+		resp.Response(http.StatusNotFound, message.ERROR_CODE_INNER, "blob not found", nil)
+		return
+	}
+	data, err := bs.Get(sum)
+	if err == blob.ErrNotFound {
+		resp.Response(http.StatusNotFound, message.ERROR_CODE_INNER, "blob not found", nil)
+		return
+	}
+	if err != nil {
+		log.Errorf("error on GetBlob:%s", err.Error())
+		resp.Response(http.StatusInternalServerError, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	ctx.Data(http.StatusOK, "application/octet-stream", data)
+}
@@ -0,0 +1,362 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ontio/mercury/common/message"
+	"github.com/ontio/mercury/service/common"
+	"github.com/ontio/mercury/store"
+	"github.com/ontio/mercury/utils"
+)
+
+// SaveSentConnectionRequest keeps a connection request sent by its
+// Connection.MyDid, theirLabel is the label of the invitation it answers
+func (s *SystemController) SaveSentConnectionRequest(cr message.ConnectionRequest, theirLabel string) error {
+	return s.saveConnectionRequestRec(cr.Connection.MyDid, &message.ConnectionRequestRec{
+		ConnReq:    cr,
+		State:      message.ConnectionRequestSent,
+		TheirLabel: theirLabel,
+	})
+}
+
+// MarkResponseSent records that a received connection request was answered
+func (s *SystemController) MarkResponseSent(did, id string) error {
+	_, err := s.updateConnectionRequest(did, id, func(rec *message.ConnectionRequestRec) error {
+		rec.ResponseSent = true
+		return nil
+	})
+	return err
+}
+
+// ReceiveConnectionResponse moves the sent connection request answered by a
+// response to ConnectionResponseReceived. Requests sent without being kept
+// are not found and return nil.
+func (s *SystemController) ReceiveConnectionResponse(did, id string) (*message.ConnectionRequestRec, error) {
+	rec, err := s.updateConnectionRequest(did, id, func(rec *message.ConnectionRequestRec) error {
+		if rec.State != message.ConnectionRequestSent {
+			return fmt.Errorf("connection request %s is not waiting for a response", id)
+		}
+		rec.State = message.ConnectionResponseReceived
+		return nil
+	})
+	if err == store.ErrNotFound {
+		return nil, nil
+	}
+	return rec, err
+}
+
+// CancelConnectionRequestInStore cancels a pending connection request, its
+// later response or ack is rejected
+func (s *SystemController) CancelConnectionRequestInStore(did, id string) (*message.ConnectionRequestRec, error) {
+	return s.updateConnectionRequest(did, id, func(rec *message.ConnectionRequestRec) error {
+		if rec.State >= message.ConnectionResponseReceived {
+			return fmt.Errorf("connection request %s is completed", id)
+		}
+		rec.Cancelled = true
+		return nil
+	})
+}
+
+// MaxConnectionMetadataSize bounds the json metadata of a connection
+const MaxConnectionMetadataSize = 16 << 10
+
+// UpdateConnectionInStore changes the alias, tags or metadata of a
+// connection
+func (s *SystemController) UpdateConnectionInStore(req *message.UpdateConnectionRequest) (*message.ConnectionInfo, error) {
+	if len(req.Metadata) > MaxConnectionMetadataSize {
+		return nil, fmt.Errorf("metadata is larger than %d bytes", MaxConnectionMetadataSize)
+	}
+	key := store.Key(utils.ConnectionKey, req.DID, req.TheirDid)
+	for i := 0; i < maxUpdateRetries; i++ {
+		old, err := s.store.Get(key)
+		if err == store.ErrNotFound {
+			return nil, fmt.Errorf("connection not found!")
+		}
+		if err != nil {
+			return nil, err
+		}
+		rec := new(message.ConnectionRec)
+		r, err := store.DecodeRecord(old, rec)
+		if err != nil {
+			return nil, err
+		}
+		if req.Alias != nil {
+			rec.Alias = strings.TrimSpace(*req.Alias)
+		}
+		if req.Tags != nil {
+			rec.Tags = normalizeTags(*req.Tags)
+		}
+		if req.Metadata != nil {
+			rec.Metadata = req.Metadata
+			if string(req.Metadata) == "null" {
+				rec.Metadata = nil
+			}
+		}
+		data, err := store.EncodeRecord(rec, r.ExpireAt)
+		if err != nil {
+			return nil, err
+		}
+		ok, err := s.store.CompareAndSwap(key, old, data)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			info := completedInfo(rec, r)
+			return &info, nil
+		}
+	}
+	return nil, fmt.Errorf("connection %s is busy, try again", req.TheirDid)
+}
+
+// normalizeTags trims the tags and drops the empty and repeated ones
+func normalizeTags(tags []string) []string {
+	ret := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag != "" && !containsFold(ret, tag) {
+			ret = append(ret, tag)
+		}
+	}
+	return ret
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// ListConnectionsFromStore lists the usable invitations, the pending
+// requests and the connections of req.DID matching the filters of req,
+// newest first
+func (s *SystemController) ListConnectionsFromStore(req *message.ListConnectionsRequest) (*message.ListConnectionsResponse, error) {
+	if req.DID == "" {
+		return nil, fmt.Errorf("did is required")
+	}
+	switch req.State {
+	case "", message.ConnectionInvited, message.ConnectionRequested, message.ConnectionResponded, message.ConnectionCompleted:
+	default:
+		return nil, fmt.Errorf("unknown connection state %q", req.State)
+	}
+	all := make([]message.ConnectionInfo, 0)
+	for _, list := range []func(string) ([]message.ConnectionInfo, error){
+		s.listInvited, s.listPending, s.listCompleted,
+	} {
+		infos, err := list(req.DID)
+		if err != nil {
+			return nil, err
+		}
+		for _, info := range infos {
+			if matchConnection(req, &info) {
+				all = append(all, info)
+			}
+		}
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		if all[i].Created != all[j].Created {
+			return all[i].Created > all[j].Created
+		}
+		return all[i].Id < all[j].Id
+	})
+	res := &message.ListConnectionsResponse{Total: len(all), Connections: all}
+	if req.Offset > 0 || req.Limit > 0 {
+		start, end := pageBounds(len(all), req.Offset, req.Limit)
+		res.Connections = all[start:end]
+	}
+	return res, nil
+}
+
+// pageBounds returns the bounds of the page of n items from offset with at
+// most limit items, no limit when limit is 0
+func pageBounds(n, offset, limit int) (int, int) {
+	start := offset
+	if start > n {
+		start = n
+	}
+	end := n
+	if limit > 0 && start+limit < end {
+		end = start + limit
+	}
+	return start, end
+}
+
+func matchConnection(req *message.ListConnectionsRequest, info *message.ConnectionInfo) bool {
+	if req.State != "" && info.State != req.State {
+		return false
+	}
+	if req.TheirDid != "" && info.Connection.TheirDid != req.TheirDid {
+		return false
+	}
+	if req.Label != "" && !containsPart(info.Label, req.Label) {
+		return false
+	}
+	if req.Alias != "" && !containsPart(info.Alias, req.Alias) {
+		return false
+	}
+	for _, tag := range req.Tags {
+		if !containsFold(info.Tags, strings.TrimSpace(tag)) {
+			return false
+		}
+	}
+	return matchMetadata(info.Metadata, req.Metadata)
+}
+
+// matchMetadata tells whether the json object metadata has all the keys of
+// query with equal values
+func matchMetadata(metadata json.RawMessage, query map[string]interface{}) bool {
+	if len(query) == 0 {
+		return true
+	}
+	fields := make(map[string]interface{})
+	if len(metadata) == 0 || json.Unmarshal(metadata, &fields) != nil {
+		return false
+	}
+	for k, v := range query {
+		field, ok := fields[k]
+		if !ok || !reflect.DeepEqual(field, v) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsPart(s, part string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(part))
+}
+
+func (s *SystemController) listInvited(did string) ([]message.ConnectionInfo, error) {
+	infos := make([]message.ConnectionInfo, 0)
+	now := time.Now()
+	iter := s.store.NewIterator(store.KeyPrefix(utils.InvitationKey, did))
+	defer iter.Release()
+	for iter.Next() {
+		rec := new(message.InvitationRec)
+		r, err := store.DecodeRecord(iter.Value(), rec)
+		if err != nil {
+			return nil, err
+		}
+		if rec.Check(now) != nil {
+			continue
+		}
+		infos = append(infos, message.ConnectionInfo{
+			Id:    rec.Invitation.Id,
+			State: message.ConnectionInvited,
+			Label: rec.Invitation.Label,
+			Connection: message.Connection{
+				MyDid:    rec.Invitation.Did,
+				MyRouter: rec.Invitation.Router,
+			},
+			Created:      createdAt(rec.Created, r),
+			LastActivity: r.Updated,
+		})
+	}
+	return infos, iter.Error()
+}
+
+// listPending lists the requests sent by did and the requests received by
+// did which are neither cancelled nor completed
+func (s *SystemController) listPending(did string) ([]message.ConnectionInfo, error) {
+	infos := make([]message.ConnectionInfo, 0)
+	iter := s.store.NewIterator(store.KeyPrefix(utils.ConnectionReqKey, did))
+	defer iter.Release()
+	for iter.Next() {
+		rec := new(message.ConnectionRequestRec)
+		r, err := store.DecodeRecord(iter.Value(), rec)
+		if err != nil {
+			return nil, err
+		}
+		if rec.Cancelled || rec.State >= message.ConnectionResponseReceived {
+			continue
+		}
+		info := message.ConnectionInfo{
+			Id:           rec.ConnReq.Id,
+			State:        message.ConnectionRequested,
+			Created:      createdAt(rec.Created, r),
+			LastActivity: r.Updated,
+		}
+		if rec.State == message.ConnectionRequestSent {
+			info.Label = rec.TheirLabel
+			info.Connection = rec.ConnReq.Connection
+		} else {
+			info.Label = rec.ConnReq.Label
+			info.Connection = common.ReverseConnection(rec.ConnReq.Connection)
+			if rec.ResponseSent {
+				info.State = message.ConnectionResponded
+			}
+		}
+		infos = append(infos, info)
+	}
+	return infos, iter.Error()
+}
+
+func (s *SystemController) listCompleted(did string) ([]message.ConnectionInfo, error) {
+	infos := make([]message.ConnectionInfo, 0)
+	iter := s.store.NewIterator(store.KeyPrefix(utils.ConnectionKey, did))
+	defer iter.Release()
+	for iter.Next() {
+		rec := new(message.ConnectionRec)
+		r, err := store.DecodeRecord(iter.Value(), rec)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, completedInfo(rec, r))
+	}
+	return infos, iter.Error()
+}
+
+func completedInfo(rec *message.ConnectionRec, r *store.Record) message.ConnectionInfo {
+	info := message.ConnectionInfo{
+		Id:           rec.Connection.TheirDid,
+		State:        message.ConnectionCompleted,
+		Label:        rec.Label,
+		Connection:   rec.Connection,
+		Created:      createdAt(rec.Timestamp.Unix(), r),
+		LastActivity: rec.LastActivity,
+		Alias:        rec.Alias,
+		Tags:         rec.Tags,
+		Metadata:     rec.Metadata,
+		LastSeen:     rec.LastSeen,
+		LastFailure:  rec.LastFailure,
+		Failures:     rec.Failures,
+		Stale:        rec.Stale,
+	}
+	if info.LastActivity == 0 {
+		info.LastActivity = info.Created
+	}
+	return info
+}
+
+// createdAt falls back to the last update of records written before their
+// creation time was kept
+func createdAt(created int64, r *store.Record) int64 {
+	if created > 0 {
+		return created
+	}
+	return r.Updated
+}
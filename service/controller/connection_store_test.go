@@ -0,0 +1,161 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package controller
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/ontio/mercury/common/config"
+	"github.com/ontio/mercury/common/message"
+	"github.com/ontio/mercury/service/common"
+	leveldb "github.com/ontio/mercury/store/leveldb"
+	"github.com/ontio/mercury/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListConnections(t *testing.T) {
+	db, err := leveldb.NewMemStore()
+	assert.Nil(t, err)
+	defer db.Close()
+	s := &SystemController{store: db, msgSvr: &common.MsgService{Cfg: &config.Cfg{SelfDID: "did:ont:alice"}}}
+	router := []string{"did:ont:alice#1"}
+
+	iv, err := s.NewInvitation(&message.CreateInvitationRequest{Label: "alice", Router: router})
+	assert.Nil(t, err)
+	// bob accepts, alice answers
+	fromBob := message.ConnectionRequest{
+		Id:           "req-bob",
+		Label:        "Bob",
+		Connection:   message.Connection{MyDid: "did:ont:bob", TheirDid: "did:ont:alice", TheirRouter: router},
+		InvitationId: iv.Id,
+	}
+	assert.Nil(t, s.SaveConnectionRequest(fromBob, message.ConnectionRequestReceived))
+	assert.Nil(t, s.MarkResponseSent("did:ont:alice", "req-bob"))
+	// alice accepts carol's invitation
+	toCarol := message.ConnectionRequest{
+		Id:         "req-carol",
+		Connection: message.Connection{MyDid: "did:ont:alice", MyRouter: router, TheirDid: "did:ont:carol"},
+	}
+	assert.Nil(t, s.SaveSentConnectionRequest(toCarol, "Carol"))
+	assert.Nil(t, s.SaveConnection(message.Connection{MyDid: "did:ont:alice", TheirDid: "did:ont:dave"}, "Dave"))
+	assert.Nil(t, utils.CheckConnection("did:ont:alice", "did:ont:dave", db))
+
+	res, err := s.ListConnectionsFromStore(&message.ListConnectionsRequest{DID: "did:ont:alice"})
+	assert.Nil(t, err)
+	assert.Equal(t, 4, res.Total)
+	states := make(map[string]message.ConnectionInfo)
+	for _, info := range res.Connections {
+		states[info.State] = info
+	}
+	assert.Equal(t, iv.Id, states[message.ConnectionInvited].Id)
+	assert.Equal(t, "did:ont:bob", states[message.ConnectionResponded].Connection.TheirDid)
+	assert.Equal(t, "Carol", states[message.ConnectionRequested].Label)
+	assert.Equal(t, "did:ont:dave", states[message.ConnectionCompleted].Id)
+	assert.True(t, states[message.ConnectionCompleted].LastActivity > 0)
+
+	res, err = s.ListConnectionsFromStore(&message.ListConnectionsRequest{DID: "did:ont:alice", Label: "car"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, res.Total)
+	res, err = s.ListConnectionsFromStore(&message.ListConnectionsRequest{DID: "did:ont:alice", Offset: 1, Limit: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, 4, res.Total)
+	assert.Equal(t, 2, len(res.Connections))
+	_, err = s.ListConnectionsFromStore(&message.ListConnectionsRequest{DID: "did:ont:alice", State: "lost"})
+	assert.NotNil(t, err)
+
+	// a cancelled request is no longer pending and rejects its response
+	_, err = s.CancelConnectionRequestInStore("did:ont:alice", "req-carol")
+	assert.Nil(t, err)
+	_, err = s.ReceiveConnectionResponse("did:ont:alice", "req-carol")
+	assert.NotNil(t, err)
+	res, err = s.ListConnectionsFromStore(&message.ListConnectionsRequest{DID: "did:ont:alice", State: message.ConnectionRequested})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, res.Total)
+
+	// responses to requests which weren't kept are still accepted
+	rec, err := s.ReceiveConnectionResponse("did:ont:alice", "req-unknown")
+	assert.Nil(t, err)
+	assert.Nil(t, rec)
+}
+
+func TestUpdateConnection(t *testing.T) {
+	db, err := leveldb.NewMemStore()
+	assert.Nil(t, err)
+	defer db.Close()
+	s := &SystemController{store: db}
+	assert.Nil(t, s.SaveConnection(message.Connection{MyDid: "did:ont:alice", TheirDid: "did:ont:acme"}, "ACME"))
+	assert.Nil(t, s.SaveConnection(message.Connection{MyDid: "did:ont:alice", TheirDid: "did:ont:bob"}, "Bob"))
+
+	alias := "ACME HR department"
+	tags := []string{"employer", " hr ", "HR", ""}
+	info, err := s.UpdateConnectionInStore(&message.UpdateConnectionRequest{
+		DID:      "did:ont:alice",
+		TheirDid: "did:ont:acme",
+		Alias:    &alias,
+		Tags:     &tags,
+		Metadata: json.RawMessage(`{"contact":"hr@acme.example"}`),
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, alias, info.Alias)
+	assert.Equal(t, []string{"employer", "hr"}, info.Tags)
+	assert.Equal(t, "ACME", info.Label)
+
+	// fields left out are kept, null clears the metadata
+	info, err = s.UpdateConnectionInStore(&message.UpdateConnectionRequest{
+		DID:      "did:ont:alice",
+		TheirDid: "did:ont:acme",
+		Metadata: json.RawMessage(`null`),
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, alias, info.Alias)
+	assert.Nil(t, info.Metadata)
+
+	res, err := s.ListConnectionsFromStore(&message.ListConnectionsRequest{DID: "did:ont:alice", Alias: "hr dep", Tags: []string{"HR"}})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, res.Total)
+	assert.Equal(t, "did:ont:acme", res.Connections[0].Id)
+	res, err = s.ListConnectionsFromStore(&message.ListConnectionsRequest{DID: "did:ont:alice", Alias: "bob"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, res.Total)
+
+	// metadata matches by the values of its keys
+	_, err = s.UpdateConnectionInStore(&message.UpdateConnectionRequest{
+		DID:      "did:ont:alice",
+		TheirDid: "did:ont:bob",
+		Metadata: json.RawMessage(`{"dept":"accounting","level":3,"remote":true}`),
+	})
+	assert.Nil(t, err)
+	for query, total := range map[string]int{
+		`{"dept":"accounting"}`:           1,
+		`{"dept":"accounting","level":3}`: 1,
+		`{"level":3,"remote":false}`:      0,
+		`{"dept":"Accounting"}`:           0,
+		`{"contact":null}`:                0,
+	} {
+		req := &message.ListConnectionsRequest{DID: "did:ont:alice"}
+		assert.Nil(t, json.Unmarshal([]byte(query), &req.Metadata))
+		res, err = s.ListConnectionsFromStore(req)
+		assert.Nil(t, err)
+		assert.Equal(t, total, res.Total, query)
+	}
+
+	_, err = s.UpdateConnectionInStore(&message.UpdateConnectionRequest{DID: "did:ont:alice", TheirDid: "did:ont:carol", Alias: &alias})
+	assert.NotNil(t, err)
+}
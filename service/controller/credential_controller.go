@@ -23,6 +23,7 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/gin-gonic/gin"
 	"github.com/ontio/mercury/common/log"
 	"github.com/ontio/mercury/common/message"
 	"github.com/ontio/mercury/common/packager/ecdsa"
@@ -30,7 +31,6 @@ import (
 	"github.com/ontio/mercury/store"
 	"github.com/ontio/mercury/utils"
 	"github.com/ontio/mercury/vdri"
-	"github.com/gin-gonic/gin"
 )
 
 type CredentialController struct {
@@ -106,6 +106,12 @@ func (c *CredentialController) Routes() common.Routes {
 			Pattern:     common.DeleteCredetialApi,
 			HandlerFunc: c.DeleteCredential,
 		},
+		{
+			Name:        "SearchCredentials",
+			Method:      strings.ToUpper("Post"),
+			Pattern:     common.SearchCredentialsApi,
+			HandlerFunc: c.SearchCredentials,
+		},
 	}
 }
 
@@ -132,6 +138,12 @@ func (c *CredentialController) SendProposalCredential(ctx *gin.Context) {
 		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
 		return
 	}
+	err = checkPeerFeatures(c.store, req.Connection.MyDid, req.Connection.TheirDid, vdri.ProposalCredentialSpec)
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	warning := staleWarning(c.store, req.Connection.MyDid, req.Connection.TheirDid)
 
 	outMsg := common.OutboundMsg{
 		Msg: common.Message{
@@ -146,7 +158,7 @@ func (c *CredentialController) SendProposalCredential(ctx *gin.Context) {
 		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
 		return
 	}
-	resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
+	resp.Response(http.StatusOK, message.SUCCEED_CODE, warning, nil)
 	return
 }
 
@@ -176,6 +188,7 @@ func (c *CredentialController) ProposalCredential(ctx *gin.Context) {
 	offer, err := c.vdri.OfferCredential(req)
 	if err != nil {
 		log.Errorf("error on offerCredetial")
+		c.msgSvr.SendProblemReport(req.Connection, req.Id, common.ProblemIssuanceFailed, err)
 		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
 		return
 	}
@@ -218,9 +231,16 @@ func (c *CredentialController) OfferCredential(ctx *gin.Context) {
 		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
 		return
 	}
+	err = c.msgSvr.ReceiveAttachments(req, req.Connection, req.Thread.ID)
+	if err != nil {
+		log.Errorf("error on ReceiveAttachments:%s", err.Error())
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
 	err = c.SaveOfferCredential(req.Connection.TheirDid, req.Thread.ID, req)
 	if err != nil {
 		log.Errorf("error on SaveOfferCredential:%s", err.Error())
+		c.msgSvr.SendProblemReport(req.Connection, req.Thread.ID, common.ProblemCredentialNotAccepted, err)
 		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
 		return
 	}
@@ -251,6 +271,12 @@ func (c *CredentialController) SendRequestCredential(ctx *gin.Context) {
 		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
 		return
 	}
+	err = checkPeerFeatures(c.store, req.Connection.MyDid, req.Connection.TheirDid, vdri.RequestCredentialSpec)
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	warning := staleWarning(c.store, req.Connection.MyDid, req.Connection.TheirDid)
 
 	outMsg := common.OutboundMsg{
 		Msg: common.Message{
@@ -265,7 +291,7 @@ func (c *CredentialController) SendRequestCredential(ctx *gin.Context) {
 		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
 		return
 	}
-	resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
+	resp.Response(http.StatusOK, message.SUCCEED_CODE, warning, nil)
 	return
 }
 
@@ -291,9 +317,16 @@ func (c *CredentialController) RequestCredential(ctx *gin.Context) {
 		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
 		return
 	}
+	err = c.msgSvr.ReceiveAttachments(req, req.Connection, req.Id)
+	if err != nil {
+		log.Errorf("error on ReceiveAttachments:%s", err.Error())
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
 	err = c.SaveRequestCredential(req.Connection.MyDid, req.Id, *req)
 	if err != nil {
 		log.Errorf("error on SaveRequestCredential:%s\n", err.Error())
+		c.msgSvr.SendProblemReport(req.Connection, req.Id, common.ProblemIssuanceFailed, err)
 		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
 		return
 	}
@@ -301,6 +334,7 @@ func (c *CredentialController) RequestCredential(ctx *gin.Context) {
 	credential, err := c.vdri.IssueCredential(req)
 	if err != nil {
 		log.Errorf("error on IssueCredential:%s\n", err.Error())
+		c.msgSvr.SendProblemReport(req.Connection, req.Id, common.ProblemIssuanceFailed, err)
 		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
 		return
 	}
@@ -337,10 +371,23 @@ func (c *CredentialController) IssueCredential(ctx *gin.Context) {
 		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, fmt.Errorf("data convert err").Error(), nil)
 		return
 	}
+	err = utils.CheckConnection(req.Connection.TheirDid, req.Connection.MyDid, c.store)
+	if err != nil {
+		log.Infof("no connect found with did:%s", req.Connection.MyDid)
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	err = c.msgSvr.ReceiveAttachments(req, req.Connection, req.Thread.ID)
+	if err != nil {
+		log.Errorf("error on ReceiveAttachments:%s", err.Error())
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
 
 	err = c.SaveCredential(req.Connection.TheirDid, req.Thread.ID, *req)
 	if err != nil {
 		log.Errorf("error on SaveCredential:%s\n", err.Error())
+		c.msgSvr.SendProblemReport(req.Connection, req.Thread.ID, common.ProblemCredentialNotAccepted, err)
 		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
 		return
 	}
@@ -447,3 +494,31 @@ func (c *CredentialController) DeleteCredential(ctx *gin.Context) {
 	resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
 	return
 }
+
+func (c *CredentialController) SearchCredentials(ctx *gin.Context) {
+	resp := common.Gin{C: ctx}
+	data, isForward, err := common.ParseMessage(common.EnablePackage, ctx, c.packager, common.SearchCredentialsType, c.msgSvr)
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	if isForward {
+		resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
+		return
+	}
+	req, ok := data.(*message.SearchCredentialsRequest)
+	if !ok {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, fmt.Errorf("data convert err").Error(), nil)
+		return
+	}
+	infos, err := c.SearchCredentialsFromStore(req)
+	if err != nil {
+		log.Errorf("error on SearchCredentials:%s\n", err.Error())
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	resp.Response(http.StatusOK, message.SUCCEED_CODE, "", &message.SearchCredentialsResponse{
+		Credentials: infos,
+	})
+	return
+}
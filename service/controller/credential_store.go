@@ -19,11 +19,12 @@
 package controller
 
 import (
-	"encoding/json"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/ontio/mercury/common/message"
+	"github.com/ontio/mercury/store"
 )
 
 const (
@@ -33,7 +34,7 @@ const (
 )
 
 func (c *CredentialController) SaveOfferCredential(did, id string, propsal *message.OfferCredential) error {
-	key := []byte(fmt.Sprintf("%s_%s_%s", OfferCredentialKey, did, id))
+	key := store.Key(OfferCredentialKey, did, id)
 	b, err := c.store.Has(key)
 	if err != nil {
 		return err
@@ -42,15 +43,11 @@ func (c *CredentialController) SaveOfferCredential(did, id string, propsal *mess
 		return fmt.Errorf("id:%s already exist\n", id)
 	}
 
-	data, err := json.Marshal(propsal)
-	if err != nil {
-		return err
-	}
-	return c.store.Put(key, data)
+	return store.PutRecord(c.store, key, propsal)
 }
 
 func (c *CredentialController) SaveCredential(did, id string, credential message.IssueCredential) error {
-	key := []byte(fmt.Sprintf("%s_%s_%s", CredentialKey, did, id))
+	key := store.Key(CredentialKey, did, id)
 	b, err := c.store.Has(key)
 	if err != nil {
 		return err
@@ -64,15 +61,21 @@ func (c *CredentialController) SaveCredential(did, id string, credential message
 		Credential: credential,
 		Timestamp:  time.Now(),
 	}
-	data, err := json.Marshal(rec)
+	data, err := store.NewRecord(rec)
 	if err != nil {
 		return err
 	}
-	return c.store.Put(key, data)
+	batch := store.NewBatch()
+	batch.Put(key, data)
+	err = putIndex(batch, CredentialIndexKey, did, id, credentialIndex(credentialInfo(id, &rec)))
+	if err != nil {
+		return err
+	}
+	return c.store.Write(batch)
 }
 
 func (c *CredentialController) SaveRequestCredential(did, id string, requestCredential message.RequestCredential) error {
-	key := []byte(fmt.Sprintf("%s_%s_%s", RequestCredentialKey, did, id))
+	key := store.Key(RequestCredentialKey, did, id)
 	b, err := c.store.Has(key)
 	if err != nil {
 		return err
@@ -86,23 +89,14 @@ func (c *CredentialController) SaveRequestCredential(did, id string, requestCred
 		RequestCredential: requestCredential,
 		State:             message.RequestCredentialReceived,
 	}
-	data, err := json.Marshal(rec)
-	if err != nil {
-		return err
-	}
-	return c.store.Put(key, data)
+	return store.PutRecord(c.store, key, rec)
 }
 
 func (c *CredentialController) QueryCredentialFromStore(did, id string) (message.IssueCredential, error) {
-	key := []byte(fmt.Sprintf("%s_%s_%s", CredentialKey, did, id))
-
-	data, err := c.store.Get(key)
-	if err != nil {
-		return message.IssueCredential{}, err
-	}
+	key := store.Key(CredentialKey, did, id)
 
 	rec := new(message.CredentialRec)
-	err = json.Unmarshal(data, rec)
+	err := store.GetRecord(c.store, key, rec)
 	if err != nil {
 		return message.IssueCredential{}, err
 	}
@@ -110,14 +104,9 @@ func (c *CredentialController) QueryCredentialFromStore(did, id string) (message
 }
 
 func (c *CredentialController) UpdateRequestCredential(did, id string, state message.RequestCredentialState) error {
-	key := []byte(fmt.Sprintf("%s_%s_%s", RequestCredentialKey, did, id))
-	data, err := c.store.Get(key)
-	if err != nil {
-		return err
-	}
-
+	key := store.Key(RequestCredentialKey, did, id)
 	rec := new(message.RequestCredentialRec)
-	err = json.Unmarshal(data, rec)
+	err := store.GetRecord(c.store, key, rec)
 	if err != nil {
 		return err
 	}
@@ -125,19 +114,78 @@ func (c *CredentialController) UpdateRequestCredential(did, id string, state mes
 		return fmt.Errorf("UpdateRequestCredential id :%s state invalid\n", id)
 	}
 	rec.State = state
-	data, err = json.Marshal(rec)
-	if err != nil {
-		return err
-	}
-	return c.store.Put(key, data)
+	return store.PutRecord(c.store, key, rec)
 }
 
 func (c *CredentialController) DelRequestCredential(did, id string) error {
-	key := []byte(fmt.Sprintf("%s_%s_%s", RequestCredentialKey, did, id))
+	key := store.Key(RequestCredentialKey, did, id)
 	return c.store.Delete(key)
 }
 
 func (c *CredentialController) DelCredential(did, id string) error {
-	key := []byte(fmt.Sprintf("%s_%s_%s", CredentialKey, did, id))
-	return c.store.Delete(key)
+	key := store.Key(CredentialKey, did, id)
+	batch := store.NewBatch()
+	batch.Delete(key)
+	rec := new(message.CredentialRec)
+	if err := store.GetRecord(c.store, key, rec); err == nil {
+		delIndex(batch, CredentialIndexKey, did, id, credentialIndex(credentialInfo(id, rec)))
+	}
+	return c.store.Write(batch)
+}
+
+// SearchCredentialsFromStore returns the credentials of did matching all filters of req,
+// the most selective filter picks the index and the others are checked on the records
+func (c *CredentialController) SearchCredentialsFromStore(req *message.SearchCredentialsRequest) ([]message.CredentialInfo, error) {
+	var hits []indexHit
+	var err error
+	switch {
+	case req.Issuer != "":
+		hits, err = lookupIndex(c.store, CredentialIndexKey, req.DId, IndexIssuer, req.Issuer)
+	case req.Connection != "":
+		hits, err = lookupIndex(c.store, CredentialIndexKey, req.DId, IndexConnection, req.Connection)
+	case req.Type != "":
+		hits, err = lookupIndex(c.store, CredentialIndexKey, req.DId, IndexType, req.Type)
+	case req.ExpiresAfter > 0 || req.ExpiresBefore > 0:
+		hits, err = lookupIndexRange(c.store, CredentialIndexKey, req.DId, IndexExpires, req.ExpiresAfter, req.ExpiresBefore)
+	case req.IssuedAfter > 0 || req.IssuedBefore > 0:
+		hits, err = lookupIndexRange(c.store, CredentialIndexKey, req.DId, IndexIssued, req.IssuedAfter, req.IssuedBefore)
+	default:
+		hits, err = scanRecords(c.store, CredentialKey, req.DId)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	infos := make([]message.CredentialInfo, 0)
+	for _, hit := range hits {
+		if seen[hit.id] {
+			continue
+		}
+		seen[hit.id] = true
+		key := store.Key(CredentialKey, req.DId, hit.id)
+		rec := new(message.CredentialRec)
+		err = store.GetRecord(c.store, key, rec)
+		if err == store.ErrNotFound {
+			err = dropStaleIndex(c.store, hit)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		info := credentialInfo(hit.id, rec)
+		if matchCredential(req, info) {
+			infos = append(infos, *info)
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Issued != infos[j].Issued {
+			return infos[i].Issued < infos[j].Issued
+		}
+		return infos[i].Id < infos[j].Id
+	})
+	return infos, nil
 }
@@ -0,0 +1,176 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ontio/mercury/common/message"
+	"github.com/ontio/mercury/service/common"
+	"github.com/ontio/mercury/utils"
+	"github.com/ontio/mercury/vdri"
+)
+
+// handshakeProtocol returns the protocol named by name, a protocol id or
+// its short name, the connections protocol by default
+func handshakeProtocol(name string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "connections", vdri.ConnectionsProtocol:
+		return vdri.ConnectionsProtocol, nil
+	case "didexchange", vdri.DIDExchangeProtocol:
+		return vdri.DIDExchangeProtocol, nil
+	}
+	return "", fmt.Errorf("unknown handshake protocol %s", name)
+}
+
+func handshakeProtocols(names []string) ([]string, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	protocols := make([]string, 0, len(names))
+	for _, name := range names {
+		p, err := handshakeProtocol(name)
+		if err != nil {
+			return nil, err
+		}
+		if !containsFold(protocols, p) {
+			protocols = append(protocols, p)
+		}
+	}
+	return protocols, nil
+}
+
+// acceptsProtocol reports whether an invitation can be accepted with
+// protocol, an invitation listing no protocols accepts all
+func acceptsProtocol(iv *message.Invitation, protocol string) bool {
+	return len(iv.HandshakeProtocols) == 0 || containsFold(iv.HandshakeProtocols, protocol)
+}
+
+// newDIDExchangeRequest turns the connection request answering an
+// invitation into a did exchange request
+func (s *SystemController) newDIDExchangeRequest(cr *message.ConnectionRequest) (*message.DIDExchangeRequest, error) {
+	doc, err := s.signDIDDoc(cr.Connection.MyDid)
+	if err != nil {
+		return nil, err
+	}
+	return &message.DIDExchangeRequest{
+		Type:       vdri.DIDExchangeRequestSpec,
+		Id:         cr.Id,
+		Thread:     message.Thread{PID: cr.InvitationId},
+		Label:      cr.Label,
+		Did:        cr.Connection.MyDid,
+		DIDDoc:     doc,
+		Connection: cr.Connection,
+	}, nil
+}
+
+// signDIDDoc attaches the did doc of did signed by a key of did, the agent
+// only holds the key of its own did
+func (s *SystemController) signDIDDoc(did string) (message.Attachment, error) {
+	if utils.CutDId(did) != utils.CutDId(s.msgSvr.Cfg.SelfDID) {
+		return message.Attachment{}, fmt.Errorf("no key of %s to sign its did doc", did)
+	}
+	doc, err := s.msgSvr.GetDIDDoc(did)
+	if err != nil {
+		return message.Attachment{}, fmt.Errorf("resolve did doc of %s:%s", did, err)
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return message.Attachment{}, err
+	}
+	return message.SignDIDDoc(data, s.msgSvr.Cfg.SelfDID, s.packager.SigAlg(), s.packager.Sign)
+}
+
+// verifyDIDDoc checks the did doc attached for did is the doc of did and is
+// signed by a key of did
+func (s *SystemController) verifyDIDDoc(attach message.Attachment, did string) error {
+	doc, kid, err := message.VerifyDIDDoc(attach, s.packager.Verify)
+	if err != nil {
+		return err
+	}
+	return checkDIDDocSigner(doc, kid, did)
+}
+
+func checkDIDDocSigner(doc *message.DIDDoc, kid, did string) error {
+	if utils.CutDId(doc.Id) != utils.CutDId(did) {
+		return fmt.Errorf("did doc of %s is attached for %s", doc.Id, did)
+	}
+	if signer := utils.CutDId(kid); signer != utils.CutDId(did) {
+		return fmt.Errorf("did doc of %s is signed by %s", did, signer)
+	}
+	return nil
+}
+
+func didExchangeConnectionRequest(req *message.DIDExchangeRequest) message.ConnectionRequest {
+	return message.ConnectionRequest{
+		Type:         req.Type,
+		Id:           req.Id,
+		Label:        req.Label,
+		Connection:   req.Connection,
+		InvitationId: req.Thread.PID,
+	}
+}
+
+// SaveSentDIDExchangeRequest keeps a did exchange request sent by its
+// Connection.MyDid with the connection requests
+func (s *SystemController) SaveSentDIDExchangeRequest(req *message.DIDExchangeRequest, theirLabel string) error {
+	return s.saveConnectionRequestRec(req.Connection.MyDid, &message.ConnectionRequestRec{
+		ConnReq:    didExchangeConnectionRequest(req),
+		State:      message.ConnectionRequestSent,
+		TheirLabel: theirLabel,
+		Protocol:   vdri.DIDExchangeProtocol,
+	})
+}
+
+// SaveDIDExchangeRequest keeps a received did exchange request with the
+// connection requests
+func (s *SystemController) SaveDIDExchangeRequest(req *message.DIDExchangeRequest) error {
+	return s.saveConnectionRequestRec(req.Connection.TheirDid, &message.ConnectionRequestRec{
+		ConnReq:  didExchangeConnectionRequest(req),
+		State:    message.ConnectionRequestReceived,
+		Protocol: vdri.DIDExchangeProtocol,
+	})
+}
+
+// requestProtocol returns the handshake protocol of a connection request
+func requestProtocol(rec *message.ConnectionRequestRec) string {
+	if rec.Protocol == "" {
+		return vdri.ConnectionsProtocol
+	}
+	return rec.Protocol
+}
+
+// completeConnectionRequest saves the connection of a received request
+// once the other party acknowledged the response
+func (s *SystemController) completeConnectionRequest(did, id, protocol string) error {
+	cr, err := s.GetConnectionRequest(did, id)
+	if err != nil {
+		return err
+	}
+	if requestProtocol(cr) != protocol {
+		return fmt.Errorf("connection request %s is not a %s request", id, protocol)
+	}
+	err = s.UpdateConnectionRequest(did, id, message.ConnectionACKReceived)
+	if err != nil {
+		return err
+	}
+	return s.SaveConnection(common.ReverseConnection(cr.ConnReq.Connection), cr.ConnReq.Label)
+}
@@ -0,0 +1,75 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package controller
+
+import (
+	"testing"
+
+	"github.com/ontio/mercury/common/config"
+	"github.com/ontio/mercury/common/message"
+	"github.com/ontio/mercury/service/common"
+	leveldb "github.com/ontio/mercury/store/leveldb"
+	"github.com/ontio/mercury/vdri"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDIDExchangeRecords(t *testing.T) {
+	db, err := leveldb.NewMemStore()
+	assert.Nil(t, err)
+	defer db.Close()
+	s := &SystemController{store: db, msgSvr: &common.MsgService{Cfg: &config.Cfg{SelfDID: "did:ont:agent"}}}
+	router := []string{"did:ont:agent#1"}
+
+	_, err = s.NewInvitation(&message.CreateInvitationRequest{Router: router, HandshakeProtocols: []string{"telepathy"}})
+	assert.NotNil(t, err)
+	iv, err := s.NewInvitation(&message.CreateInvitationRequest{Router: router, HandshakeProtocols: []string{"didexchange"}})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{vdri.DIDExchangeProtocol}, iv.HandshakeProtocols)
+	_, err = s.UseInvitation(iv.Did, iv.Id, vdri.ConnectionsProtocol)
+	assert.NotNil(t, err)
+	_, err = s.UseInvitation(iv.Did, iv.Id, vdri.DIDExchangeProtocol)
+	assert.Nil(t, err)
+
+	req := &message.DIDExchangeRequest{
+		Id:         "dx-1",
+		Thread:     message.Thread{PID: iv.Id},
+		Label:      "Bob",
+		Did:        "did:ont:bob",
+		Connection: message.Connection{MyDid: "did:ont:bob", MyRouter: []string{"did:ont:bob#1"}, TheirDid: iv.Did, TheirRouter: router},
+	}
+	assert.Nil(t, s.SaveDIDExchangeRequest(req))
+	// a connections ack can't complete a did exchange
+	assert.NotNil(t, s.completeConnectionRequest(iv.Did, req.Id, vdri.ConnectionsProtocol))
+	assert.Nil(t, s.completeConnectionRequest(iv.Did, req.Id, vdri.DIDExchangeProtocol))
+	rec, err := s.GetConnectionRequest(iv.Did, req.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, message.ConnectionACKReceived, rec.State)
+	assert.Equal(t, iv.Id, rec.ConnReq.InvitationId)
+	conn, err := s.GetConnection(iv.Did, "did:ont:bob")
+	assert.Nil(t, err)
+	assert.Equal(t, req.Connection.MyRouter, conn.TheirRouter)
+
+	doc := &message.DIDDoc{Id: "did:ont:bob"}
+	assert.Nil(t, checkDIDDocSigner(doc, "did:ont:bob#keys-1", "did:ont:bob"))
+	assert.NotNil(t, checkDIDDocSigner(doc, "did:ont:router", "did:ont:bob"))
+	assert.NotNil(t, checkDIDDocSigner(doc, "did:ont:bob", "did:ont:carol"))
+
+	_, err = s.signDIDDoc("did:ont:bob")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,231 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ontio/mercury/common/log"
+	"github.com/ontio/mercury/common/message"
+	"github.com/ontio/mercury/store"
+	"github.com/ontio/mercury/utils"
+	"github.com/ontio/mercury/vdri"
+)
+
+const DIDRotationKey = "DIDRotation"
+
+// newDIDRotate builds the rotation of the connection of req.DID with
+// req.TheirDid, signed by the key of req.DID. The agent only holds the key
+// of its own did, so only its connections can be rotated.
+func (s *SystemController) newDIDRotate(req *message.RotateDIDRequest) (*message.DIDRotate, *message.DIDRotation, error) {
+	if req.NewDid == "" || len(req.NewRouter) == 0 {
+		return nil, nil, fmt.Errorf("new_did and new_router are required")
+	}
+	if utils.CutDId(req.DID) != utils.CutDId(s.msgSvr.Cfg.SelfDID) {
+		return nil, nil, fmt.Errorf("no key of %s to sign its rotation", req.DID)
+	}
+	if req.NewDid == req.DID {
+		return nil, nil, fmt.Errorf("new did is the did of the connection")
+	}
+	conn, err := s.GetConnection(req.DID, req.TheirDid)
+	if err != nil {
+		return nil, nil, err
+	}
+	rotation := &message.DIDRotation{
+		Did:       req.DID,
+		TheirDid:  req.TheirDid,
+		NewDid:    req.NewDid,
+		NewRouter: req.NewRouter,
+	}
+	attach, err := message.SignDIDRotation(rotation, req.DID, s.packager.SigAlg(), s.packager.Sign)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &message.DIDRotate{
+		Type:       vdri.DIDRotateSpec,
+		Id:         utils.GenUUID(),
+		Rotation:   attach,
+		Connection: conn,
+	}, rotation, nil
+}
+
+// verifyDIDRotate checks a received rotation against the connection it
+// arrived on, it returns the rotation and the connection
+func (s *SystemController) verifyDIDRotate(req *message.DIDRotate) (*message.DIDRotation, message.Connection, error) {
+	conn, err := s.GetConnection(req.Connection.TheirDid, req.Connection.MyDid)
+	if err != nil {
+		return nil, conn, err
+	}
+	rotation, kid, err := message.VerifyDIDRotation(req.Rotation, s.packager.Verify)
+	if err != nil {
+		return nil, conn, err
+	}
+	return rotation, conn, checkRotation(rotation, kid, conn)
+}
+
+// checkRotation accepts a rotation of the other party of conn signed by its
+// did as known before the rotation, a router can't rotate the did it routes
+func checkRotation(rotation *message.DIDRotation, kid string, conn message.Connection) error {
+	if rotation.Did != conn.TheirDid || rotation.TheirDid != conn.MyDid {
+		return fmt.Errorf("rotation of %s with %s arrived on the connection of %s with %s",
+			rotation.Did, rotation.TheirDid, conn.TheirDid, conn.MyDid)
+	}
+	if rotation.NewDid == rotation.Did {
+		return fmt.Errorf("rotation keeps did %s", rotation.Did)
+	}
+	signer := utils.CutDId(kid)
+	if signer == utils.CutDId(conn.TheirDid) {
+		return nil
+	}
+	return fmt.Errorf("rotation of %s is signed by %s", rotation.Did, signer)
+}
+
+// SaveDIDRotation keeps a sent rotation until it is acknowledged on the
+// rotated connection
+func (s *SystemController) SaveDIDRotation(rotate *message.DIDRotate, rotation *message.DIDRotation) error {
+	key := store.Key(DIDRotationKey, rotation.NewDid, rotate.Id)
+	data, err := store.NewRecord(&message.DIDRotationRec{
+		Rotate:   *rotate,
+		Rotation: *rotation,
+		Sent:     time.Now().Unix(),
+	})
+	if err != nil {
+		return err
+	}
+	ok, err := s.store.CompareAndSwap(key, nil, data)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("did rotation with id:%s existed", rotate.Id)
+	}
+	return nil
+}
+
+func (s *SystemController) GetDIDRotation(newDid, id string) (*message.DIDRotationRec, error) {
+	rec := new(message.DIDRotationRec)
+	err := store.GetRecord(s.store, store.Key(DIDRotationKey, newDid, id), rec)
+	if err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// RotateTheirDid applies a received rotation to the connection of myDid
+func (s *SystemController) RotateTheirDid(myDid string, rotation *message.DIDRotation) (message.Connection, error) {
+	rec, err := s.moveConnection(
+		store.Key(utils.ConnectionKey, myDid, rotation.Did),
+		store.Key(utils.ConnectionKey, myDid, rotation.NewDid),
+		func(rec *message.ConnectionRec) {
+			rec.Connection.TheirDid = rotation.NewDid
+			rec.Connection.TheirRouter = rotation.NewRouter
+		})
+	if err != nil {
+		return message.Connection{}, err
+	}
+	return rec.Connection, nil
+}
+
+// CompleteDIDRotation applies the rotation id sent to newDid once the other
+// party acknowledged it
+func (s *SystemController) CompleteDIDRotation(newDid, id, theirDid string) (*message.DIDRotationRec, error) {
+	key := store.Key(DIDRotationKey, newDid, id)
+	old, err := s.store.Get(key)
+	if err != nil {
+		return nil, fmt.Errorf("did rotation %s:%s", id, err)
+	}
+	rec := new(message.DIDRotationRec)
+	if _, err = store.DecodeRecord(old, rec); err != nil {
+		return nil, err
+	}
+	if rec.Completed > 0 {
+		return nil, fmt.Errorf("did rotation %s is completed", id)
+	}
+	if rec.Rotation.TheirDid != theirDid {
+		return nil, fmt.Errorf("did rotation %s is not with %s", id, theirDid)
+	}
+	rotation := rec.Rotation
+	_, err = s.moveConnection(
+		store.Key(utils.ConnectionKey, rotation.Did, rotation.TheirDid),
+		store.Key(utils.ConnectionKey, rotation.NewDid, rotation.TheirDid),
+		func(conn *message.ConnectionRec) {
+			conn.OwnerDID = rotation.NewDid
+			conn.Connection.MyDid = rotation.NewDid
+			conn.Connection.MyRouter = rotation.NewRouter
+		})
+	if err != nil {
+		return nil, err
+	}
+	rec.Completed = time.Now().Unix()
+	data, err := store.NewRecord(rec)
+	if err != nil {
+		return nil, err
+	}
+	// the connection is moved, a repeated ack finds no connection to move
+	if _, err = s.store.CompareAndSwap(key, old, data); err != nil {
+		log.Warnf("mark did rotation %s completed err:%s", id, err)
+	}
+	return rec, nil
+}
+
+// moveConnection moves the connection record at from to the key to,
+// changed by update. The new record is written before the old one is
+// removed, and released if the old one changed meanwhile, so a rotation is
+// applied completely or not at all and only one of concurrent rotations of
+// a connection wins.
+func (s *SystemController) moveConnection(from, to []byte, update func(rec *message.ConnectionRec)) (*message.ConnectionRec, error) {
+	for i := 0; i < maxUpdateRetries; i++ {
+		old, err := s.store.Get(from)
+		if err == store.ErrNotFound {
+			return nil, fmt.Errorf("connection not found!")
+		}
+		if err != nil {
+			return nil, err
+		}
+		rec := new(message.ConnectionRec)
+		r, err := store.DecodeRecord(old, rec)
+		if err != nil {
+			return nil, err
+		}
+		update(rec)
+		data, err := store.EncodeRecord(rec, r.ExpireAt)
+		if err != nil {
+			return nil, err
+		}
+		ok, err := s.store.CompareAndSwap(to, nil, data)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("connection of %s with %s existed", rec.Connection.MyDid, rec.Connection.TheirDid)
+		}
+		ok, err = s.store.CompareAndSwap(from, old, nil)
+		if err == nil && ok {
+			return rec, nil
+		}
+		if _, rerr := s.store.CompareAndSwap(to, data, nil); rerr != nil {
+			return nil, rerr
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("connection is busy, try again")
+}
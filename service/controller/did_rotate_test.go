@@ -0,0 +1,92 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package controller
+
+import (
+	"testing"
+
+	"github.com/ontio/mercury/common/config"
+	"github.com/ontio/mercury/common/message"
+	"github.com/ontio/mercury/service/common"
+	leveldb "github.com/ontio/mercury/store/leveldb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDIDRotation(t *testing.T) {
+	db, err := leveldb.NewMemStore()
+	assert.Nil(t, err)
+	defer db.Close()
+	s := &SystemController{store: db, msgSvr: &common.MsgService{Cfg: &config.Cfg{SelfDID: "did:ont:agent"}}}
+
+	// bob's side of the connection with alice
+	bobConn := message.Connection{MyDid: "did:ont:bob", MyRouter: []string{"did:ont:bob#1"}, TheirDid: "did:ont:alice", TheirRouter: []string{"did:ont:agent#1"}}
+	assert.Nil(t, s.SaveConnection(bobConn, "Alice"))
+	// the agent holds no key of bob to sign a rotation with
+	_, _, err = s.newDIDRotate(&message.RotateDIDRequest{DID: "did:ont:bob", TheirDid: "did:ont:alice", NewDid: "did:ont:bob2", NewRouter: []string{"did:ont:bob2#1"}})
+	assert.NotNil(t, err)
+	rotation := &message.DIDRotation{
+		Did:       "did:ont:alice",
+		TheirDid:  "did:ont:bob",
+		NewDid:    "did:ont:alice2",
+		NewRouter: []string{"did:ont:mediator#1"},
+	}
+	assert.Nil(t, checkRotation(rotation, "did:ont:alice#keys-1", bobConn))
+	// a router of the connection can't rotate the did it routes
+	assert.NotNil(t, checkRotation(rotation, "did:ont:agent", bobConn))
+	assert.NotNil(t, checkRotation(rotation, "did:ont:mallory", bobConn))
+	assert.NotNil(t, checkRotation(&message.DIDRotation{Did: "did:ont:carol", TheirDid: "did:ont:bob", NewDid: "did:ont:alice2"}, "did:ont:carol", bobConn))
+
+	conn, err := s.RotateTheirDid("did:ont:bob", rotation)
+	assert.Nil(t, err)
+	assert.Equal(t, "did:ont:alice2", conn.TheirDid)
+	assert.Equal(t, rotation.NewRouter, conn.TheirRouter)
+	_, err = s.GetConnection("did:ont:bob", "did:ont:alice")
+	assert.NotNil(t, err)
+	rotated, err := s.GetConnection("did:ont:bob", "did:ont:alice2")
+	assert.Nil(t, err)
+	assert.Equal(t, conn, rotated)
+	// a replayed rotation finds no connection
+	_, err = s.RotateTheirDid("did:ont:bob", rotation)
+	assert.NotNil(t, err)
+
+	// alice's side moves once bob acks
+	aliceConn := message.Connection{MyDid: "did:ont:alice", MyRouter: []string{"did:ont:agent#1"}, TheirDid: "did:ont:bob", TheirRouter: []string{"did:ont:bob#1"}}
+	assert.Nil(t, s.SaveConnection(aliceConn, "Bob"))
+	rotate := &message.DIDRotate{Id: "rotate-1", Connection: aliceConn}
+	assert.Nil(t, s.SaveDIDRotation(rotate, rotation))
+	_, err = s.CompleteDIDRotation("did:ont:alice2", rotate.Id, "did:ont:carol")
+	assert.NotNil(t, err)
+	rec, err := s.CompleteDIDRotation("did:ont:alice2", rotate.Id, "did:ont:bob")
+	assert.Nil(t, err)
+	assert.True(t, rec.Completed > 0)
+	conn, err = s.GetConnection("did:ont:alice2", "did:ont:bob")
+	assert.Nil(t, err)
+	assert.Equal(t, rotation.NewRouter, conn.MyRouter)
+	_, err = s.GetConnection("did:ont:alice", "did:ont:bob")
+	assert.NotNil(t, err)
+	_, err = s.CompleteDIDRotation("did:ont:alice2", rotate.Id, "did:ont:bob")
+	assert.NotNil(t, err)
+
+	// a rotation to a did already connected is rejected and changes nothing
+	assert.Nil(t, s.SaveConnection(message.Connection{MyDid: "did:ont:bob", TheirDid: "did:ont:carol"}, ""))
+	_, err = s.RotateTheirDid("did:ont:bob", &message.DIDRotation{Did: "did:ont:alice2", TheirDid: "did:ont:bob", NewDid: "did:ont:carol", NewRouter: []string{"did:ont:carol#1"}})
+	assert.NotNil(t, err)
+	_, err = s.GetConnection("did:ont:bob", "did:ont:alice2")
+	assert.Nil(t, err)
+}
@@ -0,0 +1,168 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ontio/mercury/common/log"
+	"github.com/ontio/mercury/common/message"
+	"github.com/ontio/mercury/service/common"
+	"github.com/ontio/mercury/store"
+	"github.com/ontio/mercury/utils"
+	"github.com/ontio/mercury/vdri"
+)
+
+const (
+	FeaturesKey = "Features"
+
+	// FeaturesCacheTTL is how long the disclosed features of a connection
+	// are used before they are queried again
+	FeaturesCacheTTL = day
+)
+
+// discoverFeatures queries all the features of the other party of conn and
+// waits for the disclose, which is cached
+func (s *SystemController) discoverFeatures(conn message.Connection, timeout time.Duration) (*message.FeaturesRec, error) {
+	query := &message.FeaturesQuery{
+		Type:       vdri.FeaturesQuerySpec,
+		Id:         utils.GenUUID(),
+		Query:      "*",
+		Connection: conn,
+	}
+	wake := s.pings.add(query.Id)
+	defer s.pings.remove(query.Id)
+	err := s.msgSvr.HandleOutBound(common.OutboundMsg{
+		Msg: common.Message{
+			MessageType: common.FeaturesQueryType,
+			Content:     query,
+		},
+		Conn: conn,
+	})
+	if err != nil {
+		log.Errorf("err on HandleOutBound:%s\n", err.Error())
+		return nil, err
+	}
+	return s.waitFeatures(conn.MyDid, conn.TheirDid, query.Id, wake, timeout)
+}
+
+// waitFeatures waits until the disclose answering the query id is cached or
+// timeout, wake is closed when this agent receives it
+func (s *SystemController) waitFeatures(myDid, theirDid, id string, wake chan struct{}, timeout time.Duration) (*message.FeaturesRec, error) {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	poll := time.NewTicker(pingPollInterval)
+	defer poll.Stop()
+	for {
+		select {
+		case <-wake:
+			wake = nil
+		case <-poll.C:
+		case <-deadline.C:
+			return nil, fmt.Errorf("no features disclosed within %s", timeout)
+		}
+		rec, err := s.GetFeatures(myDid, theirDid)
+		if err != nil && err != store.ErrNotFound {
+			return nil, err
+		}
+		if rec != nil && rec.QueryId == id {
+			return rec, nil
+		}
+	}
+}
+
+// SaveFeatures caches the protocols disclosed by theirDid to myDid in answer
+// to the query queryId
+func (s *SystemController) SaveFeatures(myDid, theirDid, queryId string, protocols []message.ProtocolDescriptor) error {
+	err := store.PutRecord(s.store, store.Key(FeaturesKey, myDid, theirDid), &message.FeaturesRec{
+		QueryId:   queryId,
+		Protocols: protocols,
+		Updated:   time.Now().Unix(),
+	})
+	if err != nil {
+		return err
+	}
+	if s.pings != nil && queryId != "" {
+		s.pings.notify(queryId)
+	}
+	return nil
+}
+
+// cachedFeatures returns the features of theirDid cached for less than
+// FeaturesCacheTTL, nil if there are none
+func (s *SystemController) cachedFeatures(myDid, theirDid string) *message.FeaturesRec {
+	rec, err := s.GetFeatures(myDid, theirDid)
+	if err != nil || time.Since(time.Unix(rec.Updated, 0)) >= FeaturesCacheTTL {
+		return nil
+	}
+	return rec
+}
+
+func (s *SystemController) GetFeatures(myDid, theirDid string) (*message.FeaturesRec, error) {
+	return getFeatures(s.store, myDid, theirDid)
+}
+
+func getFeatures(db store.Store, myDid, theirDid string) (*message.FeaturesRec, error) {
+	rec := new(message.FeaturesRec)
+	err := store.GetRecord(db, store.Key(FeaturesKey, myDid, theirDid), rec)
+	if err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// featuresResponse returns the protocols of rec matching query
+func featuresResponse(rec *message.FeaturesRec, query string, cached bool) *message.DiscoverFeaturesResponse {
+	res := &message.DiscoverFeaturesResponse{
+		Protocols: make([]message.ProtocolDescriptor, 0, len(rec.Protocols)),
+		Updated:   rec.Updated,
+		Cached:    cached,
+	}
+	for _, p := range rec.Protocols {
+		if common.MatchFeature(query, p.PID) {
+			res.Protocols = append(res.Protocols, p)
+		}
+	}
+	return res
+}
+
+// checkPeerFeatures rejects a message of type spec for the connection of
+// myDid with theirDid if theirDid disclosed features without its protocol.
+// A party whose features are unknown, or were disclosed longer than
+// FeaturesCacheTTL ago, is assumed to support it.
+func checkPeerFeatures(db store.Store, myDid, theirDid, spec string) error {
+	rec, err := getFeatures(db, myDid, theirDid)
+	if err == store.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if time.Since(time.Unix(rec.Updated, 0)) >= FeaturesCacheTTL {
+		return nil
+	}
+	pid := common.ProtocolOf(spec)
+	for _, p := range rec.Protocols {
+		if p.PID == pid {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s doesn't support %s", theirDid, pid)
+}
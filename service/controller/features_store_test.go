@@ -0,0 +1,72 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ontio/mercury/common/message"
+	"github.com/ontio/mercury/store"
+	leveldb "github.com/ontio/mercury/store/leveldb"
+	"github.com/ontio/mercury/vdri"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFeatures(t *testing.T) {
+	db, err := leveldb.NewMemStore()
+	assert.Nil(t, err)
+	defer db.Close()
+	s := &SystemController{store: db, pings: newPingWaiters()}
+
+	// nothing is known about bob yet
+	assert.Nil(t, checkPeerFeatures(db, "did:ont:alice", "did:ont:bob", vdri.DIDRotateSpec))
+	assert.Nil(t, s.cachedFeatures("did:ont:alice", "did:ont:bob"))
+
+	protocols := []message.ProtocolDescriptor{
+		{PID: "spec/issue-credential/" + vdri.Version},
+		{PID: "spec/trust_ping/" + vdri.Version},
+	}
+	wake := s.pings.add("query-1")
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		assert.Nil(t, s.SaveFeatures("did:ont:alice", "did:ont:bob", "query-1", protocols))
+	}()
+	rec, err := s.waitFeatures("did:ont:alice", "did:ont:bob", "query-1", wake, time.Second)
+	assert.Nil(t, err)
+	assert.Equal(t, protocols, rec.Protocols)
+	assert.NotNil(t, s.cachedFeatures("did:ont:alice", "did:ont:bob"))
+
+	_, err = s.waitFeatures("did:ont:alice", "did:ont:bob", "query-2", s.pings.add("query-2"), 50*time.Millisecond)
+	assert.NotNil(t, err)
+
+	assert.Nil(t, checkPeerFeatures(db, "did:ont:alice", "did:ont:bob", vdri.RequestCredentialSpec))
+	assert.NotNil(t, checkPeerFeatures(db, "did:ont:alice", "did:ont:bob", vdri.DIDRotateSpec))
+
+	// an expired disclosure is as good as none
+	assert.Nil(t, store.PutRecord(db, store.Key(FeaturesKey, "did:ont:alice", "did:ont:bob"), &message.FeaturesRec{
+		Protocols: protocols,
+		Updated:   time.Now().Add(-FeaturesCacheTTL).Unix(),
+	}))
+	assert.Nil(t, checkPeerFeatures(db, "did:ont:alice", "did:ont:bob", vdri.DIDRotateSpec))
+
+	res := featuresResponse(rec, "spec/trust_ping/*", true)
+	assert.True(t, res.Cached)
+	assert.Equal(t, protocols[1:], res.Protocols)
+}
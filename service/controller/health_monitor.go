@@ -0,0 +1,212 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package controller
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ontio/mercury/common/log"
+	"github.com/ontio/mercury/common/message"
+	"github.com/ontio/mercury/service/common"
+	"github.com/ontio/mercury/store"
+	"github.com/ontio/mercury/utils"
+)
+
+const (
+	DefaultHealthMaxFailures = 3
+
+	// healthProbeWorkers bounds the connections probed at a time
+	healthProbeWorkers = 8
+)
+
+func (s *SystemController) healthMaxFailures() int {
+	if s.msgSvr != nil && s.msgSvr.Cfg != nil && s.msgSvr.Cfg.HealthMaxFailures > 0 {
+		return s.msgSvr.Cfg.HealthMaxFailures
+	}
+	return DefaultHealthMaxFailures
+}
+
+func (s *SystemController) publish(e common.Event) {
+	if s.msgSvr != nil {
+		s.msgSvr.Events().Publish(e)
+	}
+}
+
+// RecordProbe records whether the connection of did with theirDid answered
+// a probe. The connection is stale after too many failures in a row, and
+// recovers on the next answer.
+func (s *SystemController) RecordProbe(did, theirDid string, answered bool) error {
+	key := store.Key(utils.ConnectionKey, did, theirDid)
+	for i := 0; i < maxUpdateRetries; i++ {
+		old, err := s.store.Get(key)
+		if err == store.ErrNotFound {
+			return fmt.Errorf("connection not found!")
+		}
+		if err != nil {
+			return err
+		}
+		rec := new(message.ConnectionRec)
+		r, err := store.DecodeRecord(old, rec)
+		if err != nil {
+			return err
+		}
+		wasStale := rec.Stale
+		now := time.Now().Unix()
+		if answered {
+			rec.LastSeen = now
+			rec.Failures = 0
+			rec.Stale = false
+		} else {
+			rec.LastFailure = now
+			rec.Failures++
+			rec.Stale = rec.Failures >= s.healthMaxFailures()
+		}
+		data, err := store.EncodeRecord(rec, r.ExpireAt)
+		if err != nil {
+			return err
+		}
+		ok, err := s.store.CompareAndSwap(key, old, data)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		e := common.Event{DID: did, TheirDid: theirDid, Time: now}
+		if !answered {
+			e.Type = common.EventProbeFailed
+			e.Detail = fmt.Sprintf("%d probes failed in a row", rec.Failures)
+			s.publish(e)
+		}
+		if rec.Stale && !wasStale {
+			e.Type = common.EventConnectionStale
+			s.publish(e)
+		}
+		if wasStale && !rec.Stale {
+			e.Type = common.EventConnectionRecovered
+			e.Detail = ""
+			s.publish(e)
+		}
+		return nil
+	}
+	return fmt.Errorf("connection %s is busy, try again", theirDid)
+}
+
+// staleWarning returns the warning for a message sent on a stale
+// connection, which may never be delivered, empty if the connection is
+// healthy
+func staleWarning(db store.Store, myDid, theirDid string) string {
+	rec := new(message.ConnectionRec)
+	err := store.GetRecord(db, store.Key(utils.ConnectionKey, myDid, theirDid), rec)
+	if err != nil || !rec.Stale {
+		return ""
+	}
+	seen := "never answered a probe"
+	if rec.LastSeen > 0 {
+		seen = "last seen at " + time.Unix(rec.LastSeen, 0).UTC().Format(time.RFC3339)
+	}
+	warning := fmt.Sprintf("connection with %s is stale, %d probes failed, %s", theirDid, rec.Failures, seen)
+	log.Warnf("did:%s %s", myDid, warning)
+	return warning
+}
+
+// HealthMonitor probes all connections periodically in background with
+// trust pings
+type HealthMonitor struct {
+	s        *SystemController
+	interval time.Duration
+	timeout  time.Duration
+	quitC    chan struct{}
+}
+
+func NewHealthMonitor(s *SystemController, interval, timeout time.Duration) *HealthMonitor {
+	if timeout <= 0 {
+		timeout = DefaultTrustPingTimeout
+	}
+	return &HealthMonitor{
+		s:        s,
+		interval: interval,
+		timeout:  timeout,
+		quitC:    make(chan struct{}),
+	}
+}
+
+func (h *HealthMonitor) Start() {
+	go h.run()
+}
+
+func (h *HealthMonitor) Stop() {
+	close(h.quitC)
+}
+
+func (h *HealthMonitor) run() {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			n, err := h.ProbeAll()
+			if err != nil {
+				log.Errorf("health probe err:%s", err)
+				continue
+			}
+			log.Debugf("health probed %d connections", n)
+		case <-h.quitC:
+			return
+		}
+	}
+}
+
+// ProbeAll pings every connection and returns how many were probed
+func (h *HealthMonitor) ProbeAll() (int, error) {
+	conns := make([]message.Connection, 0)
+	iter := h.s.store.NewIterator(store.KeyPrefix(utils.ConnectionKey))
+	for iter.Next() {
+		rec := new(message.ConnectionRec)
+		if _, err := store.DecodeRecord(iter.Value(), rec); err != nil {
+			log.Warnf("health skip connection %s:%s", iter.Key(), err)
+			continue
+		}
+		conns = append(conns, rec.Connection)
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return 0, err
+	}
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, healthProbeWorkers)
+	for _, conn := range conns {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(conn message.Connection) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			_, err := h.s.pingConnection(conn, "", true, h.timeout)
+			if err != nil {
+				log.Debugf("health probe %s of %s:%s", conn.TheirDid, conn.MyDid, err)
+			}
+		}(conn)
+	}
+	wg.Wait()
+	return len(conns), nil
+}
@@ -0,0 +1,54 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package controller
+
+import (
+	"testing"
+
+	"github.com/ontio/mercury/common/config"
+	"github.com/ontio/mercury/common/message"
+	"github.com/ontio/mercury/service/common"
+	leveldb "github.com/ontio/mercury/store/leveldb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordProbe(t *testing.T) {
+	db, err := leveldb.NewMemStore()
+	assert.Nil(t, err)
+	defer db.Close()
+	s := &SystemController{store: db, msgSvr: &common.MsgService{Cfg: &config.Cfg{HealthMaxFailures: 2}}}
+	assert.Nil(t, s.SaveConnection(message.Connection{MyDid: "did:ont:alice", TheirDid: "did:ont:bob"}, "Bob"))
+
+	assert.Nil(t, s.RecordProbe("did:ont:alice", "did:ont:bob", true))
+	assert.Nil(t, s.RecordProbe("did:ont:alice", "did:ont:bob", false))
+	assert.Equal(t, "", staleWarning(db, "did:ont:alice", "did:ont:bob"))
+	assert.Nil(t, s.RecordProbe("did:ont:alice", "did:ont:bob", false))
+	assert.Contains(t, staleWarning(db, "did:ont:alice", "did:ont:bob"), "2 probes failed")
+
+	res, err := s.ListConnectionsFromStore(&message.ListConnectionsRequest{DID: "did:ont:alice"})
+	assert.Nil(t, err)
+	info := res.Connections[0]
+	assert.True(t, info.Stale)
+	assert.Equal(t, 2, info.Failures)
+	assert.True(t, info.LastSeen > 0 && info.LastFailure >= info.LastSeen)
+
+	assert.Nil(t, s.RecordProbe("did:ont:alice", "did:ont:bob", true))
+	assert.Equal(t, "", staleWarning(db, "did:ont:alice", "did:ont:bob"))
+	assert.NotNil(t, s.RecordProbe("did:ont:alice", "did:ont:carol", true))
+}
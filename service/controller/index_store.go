@@ -0,0 +1,332 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package controller
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/ontio/mercury/common/message"
+	"github.com/ontio/mercury/store"
+	"github.com/ontio/mercury/utils"
+)
+
+// Secondary indexes are kept next to the records they point to, an entry
+// <Index>/<did>/<field>/<value>/<id> holds the id of the indexed record.
+// Time values are zero padded so that entries of a field sort by time.
+const (
+	CredentialIndexKey   = "CredentialIndex"
+	PresentationIndexKey = "PresentationIndex"
+
+	IndexIssuer     = "issuer"
+	IndexHolder     = "holder"
+	IndexType       = "type"
+	IndexConnection = "connection"
+	IndexIssued     = "issued"
+	IndexExpires    = "expires"
+	IndexCreated    = "created"
+)
+
+type indexEntry struct {
+	field string
+	value string
+}
+
+// indexHit is an id found by an index lookup, key is the index entry
+// which found it or nil when the records were scanned directly
+type indexHit struct {
+	id    string
+	key   []byte
+	value []byte
+}
+
+func timeIndexValue(t int64) string {
+	return fmt.Sprintf("%020d", t)
+}
+
+func indexKey(kind, did, field, value, id string) []byte {
+	return store.Key(kind, did, field, value, id)
+}
+
+func putIndex(b *store.Batch, kind, did, id string, entries []indexEntry) error {
+	data, err := store.NewRecord(id)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		b.Put(indexKey(kind, did, e.field, e.value, id), data)
+	}
+	return nil
+}
+
+func delIndex(b *store.Batch, kind, did, id string, entries []indexEntry) {
+	for _, e := range entries {
+		b.Delete(indexKey(kind, did, e.field, e.value, id))
+	}
+}
+
+// lookupIndex returns the ids indexed under an exact field value
+func lookupIndex(db store.Store, kind, did, field, value string) ([]indexHit, error) {
+	return scanIndex(db, store.KeyPrefix(kind, did, field, value), nil)
+}
+
+// lookupIndexRange returns the ids indexed under a time field between
+// after and before, a zero bound is open
+func lookupIndexRange(db store.Store, kind, did, field string, after, before int64) ([]indexHit, error) {
+	prefix := store.KeyPrefix(kind, did, field)
+	return scanIndex(db, prefix, func(key []byte) (bool, bool) {
+		if len(key) < len(prefix)+20 {
+			return false, false
+		}
+		t, err := strconv.ParseInt(string(key[len(prefix):len(prefix)+20]), 10, 64)
+		if err != nil || t < after {
+			return false, false
+		}
+		if before > 0 && t > before {
+			return false, true
+		}
+		return true, false
+	})
+}
+
+// scanIndex collects the ids under prefix, accept reports whether a key
+// matches and whether the scan can stop there
+func scanIndex(db store.Store, prefix []byte, accept func(key []byte) (bool, bool)) ([]indexHit, error) {
+	hits := make([]indexHit, 0)
+	iter := db.NewIterator(prefix)
+	defer iter.Release()
+	for iter.Next() {
+		if accept != nil {
+			ok, stop := accept(iter.Key())
+			if stop {
+				break
+			}
+			if !ok {
+				continue
+			}
+		}
+		var id string
+		_, err := store.DecodeRecord(iter.Value(), &id)
+		if err != nil {
+			return nil, err
+		}
+		hits = append(hits, indexHit{
+			id:    id,
+			key:   append([]byte{}, iter.Key()...),
+			value: append([]byte{}, iter.Value()...),
+		})
+	}
+	return hits, iter.Error()
+}
+
+// scanRecords returns the ids of all records of kind owned by did
+func scanRecords(db store.Store, kind, did string) ([]indexHit, error) {
+	hits := make([]indexHit, 0)
+	iter := db.NewIterator(store.KeyPrefix(kind, did))
+	defer iter.Release()
+	for iter.Next() {
+		parts, err := store.SplitKey(iter.Key())
+		if err != nil {
+			return nil, err
+		}
+		hits = append(hits, indexHit{id: parts[len(parts)-1]})
+	}
+	return hits, iter.Error()
+}
+
+// dropStaleIndex removes an index entry whose record is gone, unless it
+// was rewritten in the meantime
+func dropStaleIndex(db store.Store, hit indexHit) error {
+	if hit.key == nil {
+		return nil
+	}
+	_, err := db.CompareAndSwap(hit.key, hit.value, nil)
+	return err
+}
+
+func inRange(t, after, before int64) bool {
+	return t >= after && (before == 0 || t <= before)
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func appendUnique(list []string, items ...string) []string {
+	for _, s := range items {
+		if !containsString(list, s) {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+// parseAttachedJWT reads the jwt carried by an attachment, either as is or
+// base64 encoded once more
+func parseAttachedJWT(attach message.Attachment) (*utils.JWTPayload, error) {
+	payload, err := utils.ParseJWTPayload(attach.Data.Base64)
+	if err == nil {
+		return payload, nil
+	}
+	bts, err := utils.Base64Decode(attach.Data.Base64)
+	if err != nil {
+		return nil, err
+	}
+	return utils.ParseJWTPayload(string(bts))
+}
+
+// credentialInfo extracts the searchable fields of a credential, the jwt
+// payload wins over what the connection and store time tell
+func credentialInfo(id string, rec *message.CredentialRec) *message.CredentialInfo {
+	info := &message.CredentialInfo{
+		Id:         id,
+		Issuer:     rec.Credential.Connection.MyDid,
+		Connection: rec.Credential.Connection.MyDid,
+	}
+	if !rec.Timestamp.IsZero() {
+		info.Issued = rec.Timestamp.Unix()
+	}
+	parsed := false
+	for _, attach := range rec.Credential.CredentialsAttach {
+		payload, err := parseAttachedJWT(attach)
+		if err != nil {
+			continue
+		}
+		if !parsed {
+			if payload.Iss != "" {
+				info.Issuer = payload.Iss
+			}
+			if payload.Iat > 0 {
+				info.Issued = payload.Iat
+			} else if payload.Nbf > 0 {
+				info.Issued = payload.Nbf
+			}
+			parsed = true
+		}
+		if payload.Exp > 0 && (info.Expires == 0 || payload.Exp < info.Expires) {
+			info.Expires = payload.Exp
+		}
+		if payload.VC != nil {
+			info.Types = appendUnique(info.Types, payload.VC.Type...)
+		}
+	}
+	return info
+}
+
+func credentialIndex(info *message.CredentialInfo) []indexEntry {
+	entries := make([]indexEntry, 0)
+	if info.Issuer != "" {
+		entries = append(entries, indexEntry{IndexIssuer, info.Issuer})
+	}
+	if info.Connection != "" {
+		entries = append(entries, indexEntry{IndexConnection, info.Connection})
+	}
+	for _, t := range info.Types {
+		entries = append(entries, indexEntry{IndexType, t})
+	}
+	if info.Issued > 0 {
+		entries = append(entries, indexEntry{IndexIssued, timeIndexValue(info.Issued)})
+	}
+	if info.Expires > 0 {
+		entries = append(entries, indexEntry{IndexExpires, timeIndexValue(info.Expires)})
+	}
+	return entries
+}
+
+func matchCredential(req *message.SearchCredentialsRequest, info *message.CredentialInfo) bool {
+	if req.Issuer != "" && req.Issuer != info.Issuer {
+		return false
+	}
+	if req.Connection != "" && req.Connection != info.Connection {
+		return false
+	}
+	if req.Type != "" && !containsString(info.Types, req.Type) {
+		return false
+	}
+	if (req.IssuedAfter > 0 || req.IssuedBefore > 0) && !inRange(info.Issued, req.IssuedAfter, req.IssuedBefore) {
+		return false
+	}
+	if (req.ExpiresAfter > 0 || req.ExpiresBefore > 0) && (info.Expires == 0 || !inRange(info.Expires, req.ExpiresAfter, req.ExpiresBefore)) {
+		return false
+	}
+	return true
+}
+
+// presentationInfo extracts the searchable fields of a presentation
+func presentationInfo(id string, rec *message.PresentationRec) *message.PresentationInfo {
+	info := &message.PresentationInfo{
+		Id:         id,
+		Holder:     rec.Presentation.Connection.MyDid,
+		Connection: rec.Presentation.Connection.MyDid,
+	}
+	if !rec.Timestamp.IsZero() {
+		info.Created = rec.Timestamp.Unix()
+	}
+	for i, attach := range rec.Presentation.PresentationAttach {
+		payload, err := parseAttachedJWT(attach)
+		if err != nil {
+			continue
+		}
+		if i == 0 && payload.Iss != "" {
+			info.Holder = payload.Iss
+		}
+		if payload.VP != nil {
+			info.Types = appendUnique(info.Types, payload.VP.Type...)
+		}
+	}
+	return info
+}
+
+func presentationIndex(info *message.PresentationInfo) []indexEntry {
+	entries := make([]indexEntry, 0)
+	if info.Holder != "" {
+		entries = append(entries, indexEntry{IndexHolder, info.Holder})
+	}
+	if info.Connection != "" {
+		entries = append(entries, indexEntry{IndexConnection, info.Connection})
+	}
+	for _, t := range info.Types {
+		entries = append(entries, indexEntry{IndexType, t})
+	}
+	if info.Created > 0 {
+		entries = append(entries, indexEntry{IndexCreated, timeIndexValue(info.Created)})
+	}
+	return entries
+}
+
+func matchPresentation(req *message.SearchPresentationsRequest, info *message.PresentationInfo) bool {
+	if req.Holder != "" && req.Holder != info.Holder {
+		return false
+	}
+	if req.Connection != "" && req.Connection != info.Connection {
+		return false
+	}
+	if req.Type != "" && !containsString(info.Types, req.Type) {
+		return false
+	}
+	if (req.CreatedAfter > 0 || req.CreatedBefore > 0) && !inRange(info.Created, req.CreatedAfter, req.CreatedBefore) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,96 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package controller
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/ontio/mercury/common/message"
+	leveldb "github.com/ontio/mercury/store/leveldb"
+	"github.com/stretchr/testify/assert"
+)
+
+func testJWT(t *testing.T, payload map[string]interface{}) string {
+	data, err := json.Marshal(payload)
+	assert.Nil(t, err)
+	return "eyJhbGciOiJFUzI1NiJ9." + base64.RawURLEncoding.EncodeToString(data) + ".c2ln"
+}
+
+func testCredential(t *testing.T, issuer, vcType string, iat, exp int64) message.IssueCredential {
+	return message.IssueCredential{
+		CredentialsAttach: []message.Attachment{{
+			Id: "1",
+			Data: message.Data{
+				Base64: testJWT(t, map[string]interface{}{
+					"iss": issuer,
+					"iat": iat,
+					"exp": exp,
+					"vc":  map[string]interface{}{"type": []string{"VerifiableCredential", vcType}},
+				}),
+			},
+		}},
+		Connection: message.Connection{
+			MyDid:    issuer,
+			TheirDid: "did:ont:holder",
+		},
+	}
+}
+
+func TestSearchCredentials(t *testing.T) {
+	db, err := leveldb.NewMemStore()
+	assert.Nil(t, err)
+	defer db.Close()
+	c := &CredentialController{store: db}
+
+	holder := "did:ont:holder"
+	assert.Nil(t, c.SaveCredential(holder, "1", testCredential(t, "did:ont:issuerA", "Degree", 100, 1000)))
+	assert.Nil(t, c.SaveCredential(holder, "2", testCredential(t, "did:ont:issuerA", "License", 200, 2000)))
+	assert.Nil(t, c.SaveCredential(holder, "3", testCredential(t, "did:ont:issuerB", "Degree", 300, 3000)))
+
+	infos, err := c.SearchCredentialsFromStore(&message.SearchCredentialsRequest{DId: holder})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(infos))
+
+	infos, err = c.SearchCredentialsFromStore(&message.SearchCredentialsRequest{DId: holder, Issuer: "did:ont:issuerA"})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(infos))
+	assert.Equal(t, "1", infos[0].Id)
+	assert.Equal(t, int64(100), infos[0].Issued)
+
+	infos, err = c.SearchCredentialsFromStore(&message.SearchCredentialsRequest{DId: holder, Issuer: "did:ont:issuerA", Type: "Degree"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(infos))
+	assert.Equal(t, "1", infos[0].Id)
+
+	infos, err = c.SearchCredentialsFromStore(&message.SearchCredentialsRequest{DId: holder, ExpiresAfter: 1500, ExpiresBefore: 3000})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(infos))
+	assert.Equal(t, "2", infos[0].Id)
+	assert.Equal(t, "3", infos[1].Id)
+
+	assert.Nil(t, c.DelCredential(holder, "3"))
+	infos, err = c.SearchCredentialsFromStore(&message.SearchCredentialsRequest{DId: holder, Type: "Degree"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(infos))
+	hits, err := lookupIndex(db, CredentialIndexKey, holder, IndexIssuer, "did:ont:issuerB")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(hits))
+}
@@ -0,0 +1,356 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package controller
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ontio/mercury/common/log"
+	"github.com/ontio/mercury/common/message"
+	"github.com/ontio/mercury/service/common"
+	"github.com/ontio/mercury/store"
+	"github.com/ontio/mercury/utils"
+	"github.com/ontio/mercury/vdri"
+)
+
+// MediationGrantKey keeps the mediations a DID requested, by the DID and the
+// mediator
+const MediationGrantKey = "MediationGrant"
+
+// mediatorRouter returns the router entry of this agent on its side of the
+// connection of myDid with theirDid, which routes to myDid through it
+func (s *SystemController) mediatorRouter(myDid, theirDid string) ([]string, error) {
+	conn, err := s.GetConnection(myDid, theirDid)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range conn.MyRouter {
+		if strings.EqualFold(utils.CutDId(r), s.msgSvr.Cfg.SelfDID) {
+			return []string{r}, nil
+		}
+	}
+	return nil, fmt.Errorf("this agent is not a router of the connection")
+}
+
+// grantMediation registers theirDid for mediation if the agent grants
+// mediation and its policy lets it forward for theirDid. A DID already
+// registered keeps its quotas. A keylist claims a DID without proof that
+// its owner controls it, so a DID asking for itself is taken out of the
+// keylist it is in.
+func (s *SystemController) grantMediation(theirDid string) error {
+	if !s.msgSvr.Cfg.GrantMediation {
+		return fmt.Errorf("this agent doesn't grant mediation")
+	}
+	if err := s.msgSvr.Policy().Policy().AllowForward(theirDid); err != nil {
+		return err
+	}
+	med, err := s.GetMediation(theirDid)
+	if err == nil && med.Owner != "" {
+		log.Infof("%s leaves the keylist of %s for its own mediation", theirDid, med.Owner)
+		err = store.ErrNotFound
+	}
+	if err != store.ErrNotFound {
+		return err
+	}
+	_, err = s.SaveMediation(&message.RegisterMediationRequest{TheirDid: theirDid})
+	return err
+}
+
+// UpdateKeylistInStore applies the keylist updates of owner, which must
+// have been granted mediation
+func (s *SystemController) UpdateKeylistInStore(owner string, updates []message.KeylistUpdateRule) ([]message.KeylistUpdated, error) {
+	med, err := s.GetMediation(owner)
+	if err == store.ErrNotFound || (err == nil && med.Owner != "") {
+		return nil, fmt.Errorf("%s has no mediation granted", owner)
+	}
+	if err != nil {
+		return nil, err
+	}
+	results := make([]message.KeylistUpdated, 0, len(updates))
+	for _, u := range updates {
+		results = append(results, message.KeylistUpdated{
+			Did:    u.Did,
+			Action: u.Action,
+			Result: s.updateKey(owner, u),
+		})
+	}
+	return results, nil
+}
+
+// updateKey adds or removes a DID in the keylist of owner and returns the
+// result of the update
+func (s *SystemController) updateKey(owner string, u message.KeylistUpdateRule) string {
+	if !strings.HasPrefix(u.Did, "did:") || u.Did == owner {
+		return message.KeylistClientError
+	}
+	key := store.Key(MediationKey, u.Did)
+	switch u.Action {
+	case message.KeylistAdd:
+		data, err := store.NewRecord(&message.MediationRec{Did: u.Did, Created: time.Now().Unix(), Owner: owner})
+		if err != nil {
+			return message.KeylistServerError
+		}
+		ok, err := s.store.CompareAndSwap(key, nil, data)
+		if err != nil {
+			return message.KeylistServerError
+		}
+		if ok {
+			return message.KeylistSuccess
+		}
+		med, err := s.GetMediation(u.Did)
+		if err == nil && med.Owner == owner {
+			return message.KeylistNoChange
+		}
+		return message.KeylistClientError
+	case message.KeylistRemove:
+		old, err := s.store.Get(key)
+		if err == store.ErrNotFound {
+			return message.KeylistNoChange
+		}
+		if err != nil {
+			return message.KeylistServerError
+		}
+		med := new(message.MediationRec)
+		if _, err = store.DecodeRecord(old, med); err != nil {
+			return message.KeylistServerError
+		}
+		if med.Owner != owner {
+			return message.KeylistClientError
+		}
+		ok, err := s.store.CompareAndSwap(key, old, nil)
+		if err != nil || !ok {
+			return message.KeylistServerError
+		}
+		return message.KeylistSuccess
+	}
+	return message.KeylistClientError
+}
+
+// requestMediation sends a mediate request on conn and waits for the grant
+// or deny until timeout. The keys of an earlier grant are kept.
+func (s *SystemController) requestMediation(conn message.Connection, timeout time.Duration) (*message.MediationGrantRec, error) {
+	req := &message.MediateRequest{
+		Type:       vdri.MediateRequestSpec,
+		Id:         utils.GenUUID(),
+		Connection: conn,
+	}
+	_, err := s.updateMediationGrant(conn.MyDid, conn.TheirDid, true, func(rec *message.MediationGrantRec) error {
+		rec.RequestId = req.Id
+		rec.State = message.MediationRequested
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	wake := s.pings.add(req.Id)
+	defer s.pings.remove(req.Id)
+	err = s.msgSvr.HandleOutBound(common.OutboundMsg{
+		Msg: common.Message{
+			MessageType: common.MediateRequestType,
+			Content:     req,
+		},
+		Conn: conn,
+	})
+	if err != nil {
+		log.Errorf("err on HandleOutBound:%s\n", err.Error())
+		return nil, err
+	}
+	return s.waitMediationGrant(conn.MyDid, conn.TheirDid, wake, timeout, func(rec *message.MediationGrantRec) bool {
+		return rec.RequestId == req.Id && rec.State != message.MediationRequested
+	})
+}
+
+// sendKeylistUpdate sends the keylist updates of conn.MyDid to its mediator
+// and waits for the response until timeout
+func (s *SystemController) sendKeylistUpdate(conn message.Connection, add, remove []string, timeout time.Duration) (*message.MediationGrantRec, error) {
+	rec, err := s.GetMediationGrant(conn.MyDid, conn.TheirDid)
+	if err != nil {
+		return nil, err
+	}
+	if rec.State != message.MediationGranted {
+		return nil, fmt.Errorf("mediation is not granted by %s", conn.TheirDid)
+	}
+	update := &message.KeylistUpdate{
+		Type:       vdri.KeylistUpdateSpec,
+		Id:         utils.GenUUID(),
+		Updates:    make([]message.KeylistUpdateRule, 0, len(add)+len(remove)),
+		Connection: conn,
+	}
+	for _, did := range add {
+		update.Updates = append(update.Updates, message.KeylistUpdateRule{Did: did, Action: message.KeylistAdd})
+	}
+	for _, did := range remove {
+		update.Updates = append(update.Updates, message.KeylistUpdateRule{Did: did, Action: message.KeylistRemove})
+	}
+	if len(update.Updates) == 0 {
+		return nil, fmt.Errorf("no keylist update")
+	}
+	wake := s.pings.add(update.Id)
+	defer s.pings.remove(update.Id)
+	err = s.msgSvr.HandleOutBound(common.OutboundMsg{
+		Msg: common.Message{
+			MessageType: common.KeylistUpdateType,
+			Content:     update,
+		},
+		Conn: conn,
+	})
+	if err != nil {
+		log.Errorf("err on HandleOutBound:%s\n", err.Error())
+		return nil, err
+	}
+	return s.waitMediationGrant(conn.MyDid, conn.TheirDid, wake, timeout, func(rec *message.MediationGrantRec) bool {
+		return rec.KeylistUpdateId == update.Id
+	})
+}
+
+// waitMediationGrant waits until the mediation myDid requested from
+// theirDid is done or timeout, wake is closed when this agent receives the
+// answer
+func (s *SystemController) waitMediationGrant(myDid, theirDid string, wake chan struct{}, timeout time.Duration, done func(rec *message.MediationGrantRec) bool) (*message.MediationGrantRec, error) {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	poll := time.NewTicker(pingPollInterval)
+	defer poll.Stop()
+	for {
+		select {
+		case <-wake:
+			wake = nil
+		case <-poll.C:
+		case <-deadline.C:
+			return nil, fmt.Errorf("no answer from the mediator within %s", timeout)
+		}
+		rec, err := s.GetMediationGrant(myDid, theirDid)
+		if err != nil {
+			return nil, err
+		}
+		if done(rec) {
+			return rec, nil
+		}
+	}
+}
+
+// SaveMediationAnswer records the grant or deny of the mediate request thid
+// of myDid to theirDid
+func (s *SystemController) SaveMediationAnswer(myDid, theirDid, thid, state string, router []string, comment string) error {
+	_, err := s.updateMediationGrant(myDid, theirDid, false, func(rec *message.MediationGrantRec) error {
+		if rec.RequestId != thid {
+			return fmt.Errorf("unknown mediate request %s", thid)
+		}
+		rec.State = state
+		rec.Router = router
+		rec.Comment = comment
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if s.pings != nil {
+		s.pings.notify(thid)
+	}
+	return nil
+}
+
+// SaveKeylistResponse applies the results of the keylist update thid of
+// myDid to the keys of its mediation granted by theirDid
+func (s *SystemController) SaveKeylistResponse(myDid, theirDid, thid string, updated []message.KeylistUpdated) error {
+	_, err := s.updateMediationGrant(myDid, theirDid, false, func(rec *message.MediationGrantRec) error {
+		if rec.State != message.MediationGranted {
+			return fmt.Errorf("mediation is not granted by %s", theirDid)
+		}
+		for _, u := range updated {
+			if u.Result != message.KeylistSuccess && u.Result != message.KeylistNoChange {
+				continue
+			}
+			rec.Keys = removeKey(rec.Keys, u.Did)
+			if u.Action == message.KeylistAdd {
+				rec.Keys = append(rec.Keys, u.Did)
+			}
+		}
+		rec.KeylistUpdateId = thid
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if s.pings != nil {
+		s.pings.notify(thid)
+	}
+	return nil
+}
+
+func removeKey(keys []string, did string) []string {
+	ret := keys[:0]
+	for _, k := range keys {
+		if k != did {
+			ret = append(ret, k)
+		}
+	}
+	return ret
+}
+
+func (s *SystemController) GetMediationGrant(myDid, theirDid string) (*message.MediationGrantRec, error) {
+	rec := new(message.MediationGrantRec)
+	err := store.GetRecord(s.store, store.Key(MediationGrantKey, myDid, theirDid), rec)
+	if err == store.ErrNotFound {
+		return nil, fmt.Errorf("no mediation requested from %s", theirDid)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// updateMediationGrant updates the mediation myDid requested from theirDid,
+// create starts one if there is none
+func (s *SystemController) updateMediationGrant(myDid, theirDid string, create bool, update func(rec *message.MediationGrantRec) error) (*message.MediationGrantRec, error) {
+	key := store.Key(MediationGrantKey, myDid, theirDid)
+	for i := 0; i < maxUpdateRetries; i++ {
+		old, err := s.store.Get(key)
+		if err == store.ErrNotFound && !create {
+			return nil, fmt.Errorf("no mediation requested from %s", theirDid)
+		}
+		if err != nil && err != store.ErrNotFound {
+			return nil, err
+		}
+		rec := new(message.MediationGrantRec)
+		if old != nil {
+			if _, err = store.DecodeRecord(old, rec); err != nil {
+				return nil, err
+			}
+		}
+		if err = update(rec); err != nil {
+			return nil, err
+		}
+		rec.Updated = time.Now().Unix()
+		data, err := store.NewRecord(rec)
+		if err != nil {
+			return nil, err
+		}
+		ok, err := s.store.CompareAndSwap(key, old, data)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return rec, nil
+		}
+	}
+	return nil, fmt.Errorf("mediation of %s is busy, try again", myDid)
+}
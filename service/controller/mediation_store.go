@@ -0,0 +1,227 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ontio/mercury/common/message"
+	"github.com/ontio/mercury/store"
+)
+
+const (
+	MediationKey    = "Mediation"
+	ForwardUsageKey = "ForwardUsage"
+
+	// usageDayLayout is the layout of the UTC day of a usage record
+	usageDayLayout = "2006-01-02"
+	// maxUsageDays bounds the days of usage a query lists
+	maxUsageDays = 30
+)
+
+func usageDay(t time.Time) string {
+	return t.UTC().Format(usageDayLayout)
+}
+
+// SaveMediation lets the agent forward messages for req.TheirDid, the
+// quotas not set take the defaults of the agent. Registering again updates
+// the quotas.
+func (s *SystemController) SaveMediation(req *message.RegisterMediationRequest) (*message.MediationRec, error) {
+	if req.TheirDid == "" {
+		return nil, fmt.Errorf("their_did is required")
+	}
+	if req.MessagesPerDay < 0 || req.BytesPerDay < 0 {
+		return nil, fmt.Errorf("quotas can't be negative")
+	}
+	rec := &message.MediationRec{
+		Did:            req.TheirDid,
+		MessagesPerDay: req.MessagesPerDay,
+		BytesPerDay:    req.BytesPerDay,
+		Created:        time.Now().Unix(),
+	}
+	if cfg := s.msgSvr.Cfg; cfg != nil {
+		if rec.MessagesPerDay == 0 {
+			rec.MessagesPerDay = cfg.ForwardMessagesPerDay
+		}
+		if rec.BytesPerDay == 0 {
+			rec.BytesPerDay = cfg.ForwardBytesPerDay
+		}
+	}
+	if err := store.PutRecord(s.store, store.Key(MediationKey, rec.Did), rec); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// RemoveMediationInStore stops forwarding messages for did and the DIDs of
+// its keylist, its usage is kept
+func (s *SystemController) RemoveMediationInStore(did string) error {
+	key := store.Key(MediationKey, did)
+	has, err := s.store.Has(key)
+	if err != nil {
+		return err
+	}
+	if !has {
+		return fmt.Errorf("%s is not registered for mediation", did)
+	}
+	keys := make([][]byte, 0)
+	iter := s.store.NewIterator(store.KeyPrefix(MediationKey))
+	for iter.Next() {
+		rec := new(message.MediationRec)
+		if _, err = store.DecodeRecord(iter.Value(), rec); err == nil && rec.Owner == did {
+			keys = append(keys, append([]byte{}, iter.Key()...))
+		}
+	}
+	iter.Release()
+	if err = iter.Error(); err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if err = s.store.Delete(k); err != nil {
+			return err
+		}
+	}
+	return s.store.Delete(key)
+}
+
+func (s *SystemController) GetMediation(did string) (*message.MediationRec, error) {
+	rec := new(message.MediationRec)
+	err := store.GetRecord(s.store, store.Key(MediationKey, did), rec)
+	if err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// OwnConnection reports whether conn is a connection stored by the agent
+// with the same routers, the admin requests to send a message of a
+// connection go through the forwarding of their route
+func (s *SystemController) OwnConnection(conn *message.Connection) bool {
+	stored, err := s.GetConnection(conn.MyDid, conn.TheirDid)
+	return err == nil && sameRouters(stored.MyRouter, conn.MyRouter) && sameRouters(stored.TheirRouter, conn.TheirRouter)
+}
+
+func sameRouters(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// AuthorizeForward lets the agent forward a message of size bytes for did
+// through routed, which must be registered for mediation and under its
+// quotas. did is routed or a DID of its keylist. The message is accounted
+// in the usage of routed for the day.
+func (s *SystemController) AuthorizeForward(did, routed string, size int64) error {
+	med, err := s.GetMediation(routed)
+	if err == nil && med.Owner != "" {
+		err = store.ErrNotFound
+	}
+	if err == store.ErrNotFound {
+		return fmt.Errorf("%s is not registered for mediation", routed)
+	}
+	if err != nil {
+		return err
+	}
+	if did != routed {
+		key, err := s.GetMediation(did)
+		if err != nil || key.Owner != routed {
+			return fmt.Errorf("%s is not in the keylist of %s", did, routed)
+		}
+	}
+	_, err = s.addForwardUsage(med, usageDay(time.Now()), size)
+	return err
+}
+
+// addForwardUsage accounts for a message of size bytes in the usage of day,
+// unless it would exceed the quotas of med
+func (s *SystemController) addForwardUsage(med *message.MediationRec, day string, size int64) (*message.ForwardUsageRec, error) {
+	key := store.Key(ForwardUsageKey, med.Did, day)
+	for i := 0; i < maxUpdateRetries; i++ {
+		old, err := s.store.Get(key)
+		if err != nil && err != store.ErrNotFound {
+			return nil, err
+		}
+		rec := &message.ForwardUsageRec{Did: med.Did, Day: day}
+		if old != nil {
+			if _, err = store.DecodeRecord(old, rec); err != nil {
+				return nil, err
+			}
+		}
+		if med.MessagesPerDay > 0 && rec.Messages+1 > med.MessagesPerDay {
+			return nil, fmt.Errorf("%s is over its quota of %d messages a day", med.Did, med.MessagesPerDay)
+		}
+		if med.BytesPerDay > 0 && rec.Bytes+size > med.BytesPerDay {
+			return nil, fmt.Errorf("%s is over its quota of %d bytes a day", med.Did, med.BytesPerDay)
+		}
+		rec.Messages++
+		rec.Bytes += size
+		data, err := store.EncodeRecord(rec, 0)
+		if err != nil {
+			return nil, err
+		}
+		ok, err := s.store.CompareAndSwap(key, old, data)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return rec, nil
+		}
+	}
+	return nil, fmt.Errorf("forward usage of %s is busy, try again", med.Did)
+}
+
+// QueryForwardUsageFromStore returns the mediation of req.TheirDid with its
+// usage of the last req.Days days, the days without usage are left out
+func (s *SystemController) QueryForwardUsageFromStore(req *message.QueryForwardUsageRequest) (*message.QueryForwardUsageResponse, error) {
+	med, err := s.GetMediation(req.TheirDid)
+	if err == store.ErrNotFound {
+		return nil, fmt.Errorf("%s is not registered for mediation", req.TheirDid)
+	}
+	if err != nil {
+		return nil, err
+	}
+	days := req.Days
+	if days <= 0 {
+		days = 1
+	}
+	if days > maxUsageDays {
+		days = maxUsageDays
+	}
+	res := &message.QueryForwardUsageResponse{Mediation: *med, Usage: make([]message.ForwardUsageRec, 0)}
+	now := time.Now()
+	for i := 0; i < days; i++ {
+		rec := new(message.ForwardUsageRec)
+		err = store.GetRecord(s.store, store.Key(ForwardUsageKey, med.Did, usageDay(now.AddDate(0, 0, -i))), rec)
+		if err == store.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		res.Usage = append(res.Usage, *rec)
+	}
+	return res, nil
+}
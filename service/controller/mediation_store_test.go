@@ -0,0 +1,83 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package controller
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/ontio/mercury/common/config"
+	"github.com/ontio/mercury/common/message"
+	"github.com/ontio/mercury/service/common"
+	leveldb "github.com/ontio/mercury/store/leveldb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForwardQuotas(t *testing.T) {
+	db, err := leveldb.NewMemStore()
+	assert.Nil(t, err)
+	defer db.Close()
+	cfg := &config.Cfg{SelfDID: "did:ont:mediator", ForwardBytesPerDay: 100}
+	s := &SystemController{store: db, msgSvr: &common.MsgService{Cfg: cfg}}
+
+	assert.NotNil(t, s.AuthorizeForward("did:ont:bob", "did:ont:bob", 10))
+	conn := message.Connection{MyDid: "did:ont:alice", MyRouter: []string{"did:ont:mediator#1"}, TheirDid: "did:ont:bob", TheirRouter: []string{"did:ont:bob#1"}}
+	assert.False(t, s.OwnConnection(&conn))
+	assert.Nil(t, s.SaveConnection(conn, "Bob"))
+	assert.True(t, s.OwnConnection(&conn))
+	// the stored pair doesn't exempt a message routed elsewhere
+	assert.False(t, s.OwnConnection(&message.Connection{MyDid: "did:ont:alice", MyRouter: []string{"did:ont:mediator#1"}, TheirDid: "did:ont:bob", TheirRouter: []string{"did:ont:mallory#1"}}))
+
+	med, err := s.SaveMediation(&message.RegisterMediationRequest{TheirDid: "did:ont:bob", MessagesPerDay: 5})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(100), med.BytesPerDay)
+
+	// concurrent forwards never exceed the quota
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	passed := 0
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if s.AuthorizeForward("did:ont:bob", "did:ont:bob", 10) == nil {
+				lock.Lock()
+				passed++
+				lock.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 5, passed)
+
+	res, err := s.QueryForwardUsageFromStore(&message.QueryForwardUsageRequest{TheirDid: "did:ont:bob", Days: 7})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(res.Usage))
+	assert.Equal(t, int64(5), res.Usage[0].Messages)
+	assert.Equal(t, int64(50), res.Usage[0].Bytes)
+
+	_, err = s.SaveMediation(&message.RegisterMediationRequest{TheirDid: "did:ont:bob", MessagesPerDay: 10})
+	assert.Nil(t, err)
+	assert.NotNil(t, s.AuthorizeForward("did:ont:bob", "did:ont:bob", 60))
+	assert.Nil(t, s.AuthorizeForward("did:ont:bob", "did:ont:bob", 50))
+
+	assert.Nil(t, s.RemoveMediationInStore("did:ont:bob"))
+	assert.NotNil(t, s.AuthorizeForward("did:ont:bob", "did:ont:bob", 1))
+	assert.NotNil(t, s.RemoveMediationInStore("did:ont:bob"))
+}
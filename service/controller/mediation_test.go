@@ -0,0 +1,126 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package controller
+
+import (
+	"testing"
+
+	"github.com/ontio/mercury/common/config"
+	"github.com/ontio/mercury/common/message"
+	"github.com/ontio/mercury/service/common"
+	leveldb "github.com/ontio/mercury/store/leveldb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeylist(t *testing.T) {
+	db, err := leveldb.NewMemStore()
+	assert.Nil(t, err)
+	defer db.Close()
+	cfg := &config.Cfg{SelfDID: "did:ont:mediator", ForwardMessagesPerDay: 2}
+	s := &SystemController{store: db, msgSvr: &common.MsgService{Cfg: cfg}}
+
+	assert.NotNil(t, s.grantMediation("did:ont:bob"))
+	cfg.GrantMediation = true
+	assert.Nil(t, s.grantMediation("did:ont:bob"))
+	assert.Nil(t, s.grantMediation("did:ont:bob"))
+
+	_, err = s.UpdateKeylistInStore("did:ont:carol", []message.KeylistUpdateRule{{Did: "did:ont:bob1", Action: message.KeylistAdd}})
+	assert.NotNil(t, err)
+	updated, err := s.UpdateKeylistInStore("did:ont:bob", []message.KeylistUpdateRule{
+		{Did: "did:ont:bob1", Action: message.KeylistAdd},
+		{Did: "did:ont:bob1", Action: message.KeylistAdd},
+		{Did: "did:ont:bob", Action: message.KeylistAdd},
+		{Did: "did:ont:bob2", Action: message.KeylistRemove},
+		{Did: "bob3", Action: message.KeylistAdd},
+	})
+	assert.Nil(t, err)
+	results := make([]string, 0)
+	for _, u := range updated {
+		results = append(results, u.Result)
+	}
+	assert.Equal(t, []string{message.KeylistSuccess, message.KeylistNoChange, message.KeylistClientError, message.KeylistNoChange, message.KeylistClientError}, results)
+
+	// a keylist DID can't be listed by another DID
+	assert.Nil(t, s.grantMediation("did:ont:carol"))
+	updated, err = s.UpdateKeylistInStore("did:ont:carol", []message.KeylistUpdateRule{
+		{Did: "did:ont:bob1", Action: message.KeylistAdd},
+		{Did: "did:ont:bob1", Action: message.KeylistRemove},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, message.KeylistClientError, updated[0].Result)
+	assert.Equal(t, message.KeylistClientError, updated[1].Result)
+
+	// forwards for the keylist are charged to the grant of its owner
+	assert.Nil(t, s.AuthorizeForward("did:ont:bob1", "did:ont:bob", 1))
+	assert.Nil(t, s.AuthorizeForward("did:ont:bob", "did:ont:bob", 1))
+	assert.NotNil(t, s.AuthorizeForward("did:ont:bob1", "did:ont:bob", 1))
+	// a route must go through the grant itself, and the keylist of its owner
+	assert.NotNil(t, s.AuthorizeForward("did:ont:bob", "did:ont:bob1", 1))
+	assert.NotNil(t, s.AuthorizeForward("did:ont:bob1", "did:ont:carol", 1))
+
+	// a DID squatted in a keylist still gets its own grant
+	updated, err = s.UpdateKeylistInStore("did:ont:carol", []message.KeylistUpdateRule{{Did: "did:ont:dave", Action: message.KeylistAdd}})
+	assert.Nil(t, err)
+	assert.Equal(t, message.KeylistSuccess, updated[0].Result)
+	assert.Nil(t, s.grantMediation("did:ont:dave"))
+	med, err := s.GetMediation("did:ont:dave")
+	assert.Nil(t, err)
+	assert.Equal(t, "", med.Owner)
+	updated, err = s.UpdateKeylistInStore("did:ont:carol", []message.KeylistUpdateRule{{Did: "did:ont:dave", Action: message.KeylistRemove}})
+	assert.Nil(t, err)
+	assert.Equal(t, message.KeylistClientError, updated[0].Result)
+
+	assert.Nil(t, s.RemoveMediationInStore("did:ont:bob"))
+	_, err = s.GetMediation("did:ont:bob1")
+	assert.NotNil(t, err)
+}
+
+func TestMediationGrant(t *testing.T) {
+	db, err := leveldb.NewMemStore()
+	assert.Nil(t, err)
+	defer db.Close()
+	s := &SystemController{store: db, msgSvr: &common.MsgService{Cfg: &config.Cfg{SelfDID: "did:ont:alice"}}}
+
+	assert.NotNil(t, s.SaveMediationAnswer("did:ont:alice", "did:ont:mediator", "req1", message.MediationGranted, nil, ""))
+	_, err = s.updateMediationGrant("did:ont:alice", "did:ont:mediator", true, func(rec *message.MediationGrantRec) error {
+		rec.RequestId = "req1"
+		rec.State = message.MediationRequested
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.NotNil(t, s.SaveKeylistResponse("did:ont:alice", "did:ont:mediator", "upd1", nil))
+	assert.NotNil(t, s.SaveMediationAnswer("did:ont:alice", "did:ont:mediator", "req0", message.MediationGranted, nil, ""))
+	assert.Nil(t, s.SaveMediationAnswer("did:ont:alice", "did:ont:mediator", "req1", message.MediationGranted, []string{"did:ont:mediator#1"}, ""))
+
+	err = s.SaveKeylistResponse("did:ont:alice", "did:ont:mediator", "upd1", []message.KeylistUpdated{
+		{Did: "did:ont:alice1", Action: message.KeylistAdd, Result: message.KeylistSuccess},
+		{Did: "did:ont:alice2", Action: message.KeylistAdd, Result: message.KeylistClientError},
+	})
+	assert.Nil(t, err)
+	rec, err := s.GetMediationGrant("did:ont:alice", "did:ont:mediator")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"did:ont:alice1"}, rec.Keys)
+	assert.Equal(t, "upd1", rec.KeylistUpdateId)
+
+	iv, err := s.NewInvitation(&message.CreateInvitationRequest{Mediator: "did:ont:mediator"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"did:ont:mediator#1"}, iv.Router)
+	_, err = s.NewInvitation(&message.CreateInvitationRequest{Mediator: "did:ont:other"})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,421 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/ontio/mercury/common/message"
+	"github.com/ontio/mercury/store"
+	"github.com/ontio/mercury/store/migrate"
+	"github.com/ontio/mercury/utils"
+)
+
+// Migrations upgrade the records written by older versions of the agent,
+// the i-th entry brings the database to schema version i+1
+var Migrations = []migrate.Migration{
+	{
+		Version:     1,
+		Description: "wrap legacy values into versioned records",
+		Migrate:     wrapLegacyRecords,
+	},
+	{
+		Version:     2,
+		Description: "stamp the update time used by record expiry",
+		Migrate:     stampUpdateTime,
+	},
+	{
+		Version:     3,
+		Description: "build the credential and presentation search indexes",
+		Migrate:     buildSearchIndexes,
+	},
+	{
+		Version:     4,
+		Description: "move records to escaped keys",
+		Migrate:     escapeLegacyKeys,
+	},
+	{
+		Version:     5,
+		Description: "split message lists and connection maps into one record per entry",
+		Migrate:     splitPerDIDRecords,
+	},
+}
+
+// legacyBasicMsgRec and legacyConnectionRec hold every message and every
+// connection of a did in one value, as written before schema version 5
+type legacyBasicMsgRec struct {
+	Msglist []message.BasicMessage `json:"msglist"`
+}
+
+type legacyConnectionRec struct {
+	OwnerDID    string                        `json:"owner_did"`
+	Connections map[string]message.Connection `json:"connections"`
+}
+
+// wrapLegacyRecords puts every raw json value into a record envelope and
+// renames the misspelled rerquest_prentation field of request presentations
+func wrapLegacyRecords(db store.Store, b *store.Batch) error {
+	iter := db.NewIterator(nil)
+	defer iter.Release()
+	for iter.Next() {
+		key := string(iter.Key())
+		if key == store.SchemaVersionKey {
+			continue
+		}
+		if _, err := store.ParseRecord(iter.Value()); err == nil {
+			continue
+		}
+		value := append([]byte{}, iter.Value()...)
+		if strings.HasPrefix(key, RequestPresentationKey+"_") {
+			fields := make(map[string]json.RawMessage)
+			err := json.Unmarshal(value, &fields)
+			if err != nil {
+				return err
+			}
+			if rp, ok := fields["rerquest_prentation"]; ok {
+				fields["request_presentation"] = rp
+				delete(fields, "rerquest_prentation")
+			}
+			value, err = json.Marshal(fields)
+			if err != nil {
+				return err
+			}
+		}
+		data, err := json.Marshal(&store.Record{
+			Version: 1,
+			Data:    value,
+		})
+		if err != nil {
+			return err
+		}
+		b.Put([]byte(key), data)
+	}
+	return iter.Error()
+}
+
+// stampUpdateTime sets the update time of records written before expiry
+// existed, so their retention starts with the migration
+func stampUpdateTime(db store.Store, b *store.Batch) error {
+	now := time.Now().Unix()
+	iter := db.NewIterator(nil)
+	defer iter.Release()
+	for iter.Next() {
+		if string(iter.Key()) == store.SchemaVersionKey {
+			continue
+		}
+		rec, err := store.ParseRecord(iter.Value())
+		if err != nil {
+			return err
+		}
+		if rec.Updated != 0 {
+			continue
+		}
+		rec.Version = 2
+		rec.Updated = now
+		data, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		b.Put(append([]byte{}, iter.Key()...), data)
+	}
+	return iter.Error()
+}
+
+// buildSearchIndexes indexes the credentials and presentations stored
+// before the search indexes existed
+func buildSearchIndexes(db store.Store, b *store.Batch) error {
+	err := indexLegacyRecords(db, CredentialKey, func(did, id string, value []byte) error {
+		rec := new(message.CredentialRec)
+		_, err := store.DecodeRecord(value, rec)
+		if err != nil {
+			return err
+		}
+		return putLegacyIndex(b, CredentialIndexKey, did, id, legacyCredentialIndex(rec))
+	})
+	if err != nil {
+		return err
+	}
+	return indexLegacyRecords(db, PresentationKey, func(did, id string, value []byte) error {
+		rec := new(message.PresentationRec)
+		_, err := store.DecodeRecord(value, rec)
+		if err != nil {
+			return err
+		}
+		return putLegacyIndex(b, PresentationIndexKey, did, id, legacyPresentationIndex(rec))
+	})
+}
+
+// putLegacyIndex writes index entries as schema version 3 laid them out,
+// <Index>_<did>_<field>_<value>_<id> holding the id of the indexed record
+func putLegacyIndex(b *store.Batch, kind, did, id string, entries []indexEntry) error {
+	data, err := store.NewRecord(id)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		b.Put([]byte(fmt.Sprintf("%s_%s_%s_%s_%s", kind, did, e.field, e.value, id)), data)
+	}
+	return nil
+}
+
+// legacyCredentialIndex returns the entries schema version 3 indexed a
+// credential under, the jwt payload wins over the connection and store time
+func legacyCredentialIndex(rec *message.CredentialRec) []indexEntry {
+	issuer := rec.Credential.Connection.MyDid
+	var issued, expires int64
+	if !rec.Timestamp.IsZero() {
+		issued = rec.Timestamp.Unix()
+	}
+	var types []string
+	parsed := false
+	for _, attach := range rec.Credential.CredentialsAttach {
+		payload, err := parseAttachedJWT(attach)
+		if err != nil {
+			continue
+		}
+		if !parsed {
+			if payload.Iss != "" {
+				issuer = payload.Iss
+			}
+			if payload.Iat > 0 {
+				issued = payload.Iat
+			} else if payload.Nbf > 0 {
+				issued = payload.Nbf
+			}
+			parsed = true
+		}
+		if payload.Exp > 0 && (expires == 0 || payload.Exp < expires) {
+			expires = payload.Exp
+		}
+		if payload.VC != nil {
+			types = appendUnique(types, payload.VC.Type...)
+		}
+	}
+
+	entries := make([]indexEntry, 0)
+	if issuer != "" {
+		entries = append(entries, indexEntry{"issuer", issuer})
+	}
+	if rec.Credential.Connection.MyDid != "" {
+		entries = append(entries, indexEntry{"connection", rec.Credential.Connection.MyDid})
+	}
+	for _, t := range types {
+		entries = append(entries, indexEntry{"type", t})
+	}
+	if issued > 0 {
+		entries = append(entries, indexEntry{"issued", fmt.Sprintf("%020d", issued)})
+	}
+	if expires > 0 {
+		entries = append(entries, indexEntry{"expires", fmt.Sprintf("%020d", expires)})
+	}
+	return entries
+}
+
+// legacyPresentationIndex returns the entries schema version 3 indexed a
+// presentation under
+func legacyPresentationIndex(rec *message.PresentationRec) []indexEntry {
+	holder := rec.Presentation.Connection.MyDid
+	var created int64
+	if !rec.Timestamp.IsZero() {
+		created = rec.Timestamp.Unix()
+	}
+	var types []string
+	for i, attach := range rec.Presentation.PresentationAttach {
+		payload, err := parseAttachedJWT(attach)
+		if err != nil {
+			continue
+		}
+		if i == 0 && payload.Iss != "" {
+			holder = payload.Iss
+		}
+		if payload.VP != nil {
+			types = appendUnique(types, payload.VP.Type...)
+		}
+	}
+
+	entries := make([]indexEntry, 0)
+	if holder != "" {
+		entries = append(entries, indexEntry{"holder", holder})
+	}
+	if rec.Presentation.Connection.MyDid != "" {
+		entries = append(entries, indexEntry{"connection", rec.Presentation.Connection.MyDid})
+	}
+	for _, t := range types {
+		entries = append(entries, indexEntry{"type", t})
+	}
+	if created > 0 {
+		entries = append(entries, indexEntry{"created", fmt.Sprintf("%020d", created)})
+	}
+	return entries
+}
+
+// indexLegacyRecords calls fn for every <kind>_<did>_<id> record,
+// dids never contain an underscore so the first one ends the did
+func indexLegacyRecords(db store.Store, kind string, fn func(did, id string, value []byte) error) error {
+	prefix := kind + "_"
+	iter := db.NewIterator([]byte(prefix))
+	defer iter.Release()
+	for iter.Next() {
+		parts := strings.SplitN(strings.TrimPrefix(string(iter.Key()), prefix), "_", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid %s key:%s", kind, iter.Key())
+		}
+		err := fn(parts[0], parts[1], iter.Value())
+		if err != nil {
+			return err
+		}
+	}
+	return iter.Error()
+}
+
+// escapeLegacyKeys moves the records stored under <type>_<did>_<id> keys
+// and the search index entries to keys built by store.Key
+func escapeLegacyKeys(db store.Store, b *store.Batch) error {
+	withID := map[string]bool{
+		utils.InvitationKey:    true,
+		utils.ConnectionReqKey: true,
+		CredentialKey:          true,
+		RequestCredentialKey:   true,
+		OfferCredentialKey:     true,
+		RequestPresentationKey: true,
+		PresentationKey:        true,
+	}
+	didOnly := map[string]bool{
+		utils.ConnectionKey: true,
+		utils.BasicMsgKey:   true,
+	}
+	index := map[string]bool{
+		CredentialIndexKey:   true,
+		PresentationIndexKey: true,
+	}
+
+	iter := db.NewIterator(nil)
+	defer iter.Release()
+	for iter.Next() {
+		key := string(iter.Key())
+		parts := strings.SplitN(key, "_", 3)
+		kind := parts[0]
+		switch {
+		case index[kind] && len(parts) == 3:
+			newKey, err := escapeLegacyIndexKey(kind, parts[1], parts[2], iter.Value())
+			if err != nil {
+				return err
+			}
+			b.Put(newKey, append([]byte{}, iter.Value()...))
+		case didOnly[kind] && len(parts) > 1:
+			b.Put(store.Key(kind, strings.TrimPrefix(key, kind+"_")), append([]byte{}, iter.Value()...))
+		case withID[kind] && len(parts) == 3:
+			b.Put(store.Key(kind, parts[1], parts[2]), append([]byte{}, iter.Value()...))
+		default:
+			// already escaped or not written by the agent
+			continue
+		}
+		b.Delete([]byte(key))
+	}
+	return iter.Error()
+}
+
+// escapeLegacyIndexKey splits the <field>_<value>_<id> rest of a schema
+// version 3 index entry, field names have no underscore and the entry
+// holds the id so the value is what lies between them
+func escapeLegacyIndexKey(kind, did, rest string, value []byte) ([]byte, error) {
+	var id string
+	if _, err := store.DecodeRecord(value, &id); err != nil {
+		return nil, err
+	}
+	fields := strings.SplitN(rest, "_", 2)
+	if len(fields) != 2 || !strings.HasSuffix(fields[1], "_"+id) {
+		return nil, fmt.Errorf("invalid %s key:%s_%s_%s", kind, kind, did, rest)
+	}
+	return store.Key(kind, did, fields[0], strings.TrimSuffix(fields[1], "_"+id), id), nil
+}
+
+// splitPerDIDRecords moves the messages and connections of every did into
+// records of their own, messages keep the order of the list
+func splitPerDIDRecords(db store.Store, b *store.Batch) error {
+	iter := db.NewIterator(store.KeyPrefix(utils.BasicMsgKey))
+	defer iter.Release()
+	for iter.Next() {
+		parts, err := store.SplitKey(iter.Key())
+		if err != nil {
+			return err
+		}
+		if len(parts) != 2 {
+			continue
+		}
+		rec := new(legacyBasicMsgRec)
+		r, err := store.DecodeRecord(iter.Value(), rec)
+		if err != nil {
+			return err
+		}
+		updated := time.Unix(r.Updated, 0)
+		for i, m := range rec.Msglist {
+			// older messages get older keys, the list order wins over send times
+			t := updated.Add(time.Duration(i-len(rec.Msglist)) * time.Nanosecond)
+			id := m.Id
+			if id == "" {
+				id = fmt.Sprintf("%d", i)
+			}
+			data, err := store.NewRecord(m)
+			if err != nil {
+				return err
+			}
+			// <Basic>/<did>/<reversed send time>/<id>, latest message first
+			b.Put(store.Key(utils.BasicMsgKey, parts[1], fmt.Sprintf("%020d", math.MaxInt64-t.UnixNano()), id), data)
+		}
+		b.Delete(append([]byte{}, iter.Key()...))
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+
+	citer := db.NewIterator(store.KeyPrefix(utils.ConnectionKey))
+	defer citer.Release()
+	for citer.Next() {
+		parts, err := store.SplitKey(citer.Key())
+		if err != nil {
+			return err
+		}
+		if len(parts) != 2 {
+			continue
+		}
+		rec := new(legacyConnectionRec)
+		r, err := store.DecodeRecord(citer.Value(), rec)
+		if err != nil {
+			return err
+		}
+		for theirDID, con := range rec.Connections {
+			data, err := store.NewRecord(&message.ConnectionRec{
+				OwnerDID:   parts[1],
+				Connection: con,
+				Timestamp:  time.Unix(r.Updated, 0),
+			})
+			if err != nil {
+				return err
+			}
+			b.Put(store.Key(utils.ConnectionKey, parts[1], theirDID), data)
+		}
+		b.Delete(append([]byte{}, citer.Key()...))
+	}
+	return citer.Error()
+}
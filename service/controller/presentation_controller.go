@@ -23,6 +23,7 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/gin-gonic/gin"
 	"github.com/ontio/mercury/common/log"
 	"github.com/ontio/mercury/common/message"
 	"github.com/ontio/mercury/common/packager/ecdsa"
@@ -30,7 +31,6 @@ import (
 	"github.com/ontio/mercury/store"
 	"github.com/ontio/mercury/utils"
 	"github.com/ontio/mercury/vdri"
-	"github.com/gin-gonic/gin"
 )
 
 type PresentationController struct {
@@ -88,6 +88,12 @@ func (c *PresentationController) Routes() common.Routes {
 			Pattern:     common.DeletePresentationApi,
 			HandlerFunc: c.DeletePresentation,
 		},
+		{
+			Name:        "SearchPresentations",
+			Method:      strings.ToUpper("Post"),
+			Pattern:     common.SearchPresentationsApi,
+			HandlerFunc: c.SearchPresentations,
+		},
 	}
 }
 
@@ -114,6 +120,12 @@ func (p *PresentationController) SendRequestPresentation(ctx *gin.Context) {
 		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
 		return
 	}
+	err = checkPeerFeatures(p.store, req.Connection.MyDid, req.Connection.TheirDid, vdri.RequestPresentationSpec)
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	warning := staleWarning(p.store, req.Connection.MyDid, req.Connection.TheirDid)
 
 	outMsg := common.OutboundMsg{
 		Msg: common.Message{
@@ -128,7 +140,7 @@ func (p *PresentationController) SendRequestPresentation(ctx *gin.Context) {
 		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
 		return
 	}
-	resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
+	resp.Response(http.StatusOK, message.SUCCEED_CODE, warning, nil)
 	return
 }
 
@@ -155,9 +167,16 @@ func (p *PresentationController) RequestPresentation(ctx *gin.Context) {
 		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
 		return
 	}
+	err = p.msgSvr.ReceiveAttachments(req, req.Connection, req.Id)
+	if err != nil {
+		log.Errorf("error on ReceiveAttachments:%s", err.Error())
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
 	presentation, err := p.vdri.PresentProof(req, p.store)
 	if err != nil {
 		log.Errorf("errors on PresentProof :%s", err.Error())
+		p.msgSvr.SendProblemReport(req.Connection, req.Id, common.ProblemPresentationFailed, err)
 		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
 		return
 	}
@@ -165,6 +184,7 @@ func (p *PresentationController) RequestPresentation(ctx *gin.Context) {
 	err = p.SaveRequestPresentation(req.Connection.MyDid, req.Id, *req)
 	if err != nil {
 		log.Errorf("error on SaveRequestPresentation:%s", err.Error())
+		p.msgSvr.SendProblemReport(req.Connection, req.Id, common.ProblemPresentationFailed, err)
 		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
 		return
 	}
@@ -208,8 +228,15 @@ func (p *PresentationController) PresentProof(ctx *gin.Context) {
 		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
 		return
 	}
+	err = p.msgSvr.ReceiveAttachments(req, req.Connection, req.Thread.ID)
+	if err != nil {
+		log.Errorf("error on ReceiveAttachments:%s", err.Error())
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
 	err = p.SavePresentation(req.Connection.TheirDid, req.Thread.ID, *req)
 	if err != nil {
+		p.msgSvr.SendProblemReport(req.Connection, req.Thread.ID, common.ProblemPresentationNotAccepted, err)
 		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
 		return
 	}
@@ -317,3 +344,31 @@ func (c *PresentationController) DeletePresentation(ctx *gin.Context) {
 	resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
 	return
 }
+
+func (p *PresentationController) SearchPresentations(ctx *gin.Context) {
+	resp := common.Gin{C: ctx}
+	data, isForward, err := common.ParseMessage(common.EnablePackage, ctx, p.packager, common.SearchPresentationsType, p.msgSvr)
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	if isForward {
+		resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
+		return
+	}
+	req, ok := data.(*message.SearchPresentationsRequest)
+	if !ok {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, fmt.Errorf("data convert err").Error(), nil)
+		return
+	}
+	infos, err := p.SearchPresentationsFromStore(req)
+	if err != nil {
+		log.Errorf("error on SearchPresentations:%s", err.Error())
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	resp.Response(http.StatusOK, message.SUCCEED_CODE, "", &message.SearchPresentationsResponse{
+		Presentations: infos,
+	})
+	return
+}
@@ -19,11 +19,12 @@
 package controller
 
 import (
-	"encoding/json"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/ontio/mercury/common/message"
+	"github.com/ontio/mercury/store"
 )
 
 const (
@@ -32,7 +33,7 @@ const (
 )
 
 func (p *PresentationController) SaveRequestPresentation(did, id string, rr message.RequestPresentation) error {
-	key := []byte(fmt.Sprintf("%s_%s_%s", RequestPresentationKey, did, id))
+	key := store.Key(RequestPresentationKey, did, id)
 	b, err := p.store.Has(key)
 	if err != nil {
 		return err
@@ -42,26 +43,17 @@ func (p *PresentationController) SaveRequestPresentation(did, id string, rr mess
 	}
 
 	rec := new(message.RequestPresentationRec)
-	rec.RerquestPrentation = rr
+	rec.RequestPresentation = rr
 	rec.RequesterDID = rr.Connection.MyDid
 	rec.State = message.RequestPresentationReceived
 
-	data, err := json.Marshal(rec)
-	if err != nil {
-		return err
-	}
-
-	return p.store.Put(key, data)
+	return store.PutRecord(p.store, key, rec)
 }
 
 func (p *PresentationController) UpdateRequestPresentaion(did, id string, state message.RequestPresentationState) error {
-	key := []byte(fmt.Sprintf("%s_%s_%s", RequestPresentationKey, did, id))
-	data, err := p.store.Get(key)
-	if err != nil {
-		return err
-	}
+	key := store.Key(RequestPresentationKey, did, id)
 	rec := new(message.RequestPresentationRec)
-	err = json.Unmarshal(data, rec)
+	err := store.GetRecord(p.store, key, rec)
 	if err != nil {
 		return err
 	}
@@ -70,15 +62,11 @@ func (p *PresentationController) UpdateRequestPresentaion(did, id string, state
 	}
 
 	rec.State = state
-	data, err = json.Marshal(rec)
-	if err != nil {
-		return err
-	}
-	return p.store.Put(key, data)
+	return store.PutRecord(p.store, key, rec)
 }
 
 func (p *PresentationController) SavePresentation(did, id string, pr message.Presentation) error {
-	key := []byte(fmt.Sprintf("%s_%s_%s", PresentationKey, did, id))
+	key := store.Key(PresentationKey, did, id)
 	b, err := p.store.Has(key)
 	if err != nil {
 		return err
@@ -92,22 +80,23 @@ func (p *PresentationController) SavePresentation(did, id string, pr message.Pre
 	rec.OwnerDID = pr.Connection.TheirDid
 	rec.Timestamp = time.Now()
 
-	data, err := json.Marshal(rec)
+	data, err := store.NewRecord(rec)
 	if err != nil {
 		return err
 	}
-
-	return p.store.Put(key, data)
+	batch := store.NewBatch()
+	batch.Put(key, data)
+	err = putIndex(batch, PresentationIndexKey, did, id, presentationIndex(presentationInfo(id, rec)))
+	if err != nil {
+		return err
+	}
+	return p.store.Write(batch)
 }
 
 func (p *PresentationController) QueryPresentationFromStore(did, id string) (message.Presentation, error) {
-	key := []byte(fmt.Sprintf("%s_%s_%s", PresentationKey, did, id))
-	data, err := p.store.Get(key)
-	if err != nil {
-		return message.Presentation{}, err
-	}
+	key := store.Key(PresentationKey, did, id)
 	rec := new(message.PresentationRec)
-	err = json.Unmarshal(data, rec)
+	err := store.GetRecord(p.store, key, rec)
 	if err != nil {
 		return message.Presentation{}, err
 	}
@@ -115,11 +104,71 @@ func (p *PresentationController) QueryPresentationFromStore(did, id string) (mes
 }
 
 func (p *PresentationController) DelPresentation(did, id string) error {
-	key := []byte(fmt.Sprintf("%s_%s_%s", PresentationKey, did, id))
-	return p.store.Delete(key)
+	key := store.Key(PresentationKey, did, id)
+	batch := store.NewBatch()
+	batch.Delete(key)
+	rec := new(message.PresentationRec)
+	if err := store.GetRecord(p.store, key, rec); err == nil {
+		delIndex(batch, PresentationIndexKey, did, id, presentationIndex(presentationInfo(id, rec)))
+	}
+	return p.store.Write(batch)
+}
+
+// SearchPresentationsFromStore returns the presentations received by did matching all filters of req
+func (p *PresentationController) SearchPresentationsFromStore(req *message.SearchPresentationsRequest) ([]message.PresentationInfo, error) {
+	var hits []indexHit
+	var err error
+	switch {
+	case req.Holder != "":
+		hits, err = lookupIndex(p.store, PresentationIndexKey, req.DId, IndexHolder, req.Holder)
+	case req.Connection != "":
+		hits, err = lookupIndex(p.store, PresentationIndexKey, req.DId, IndexConnection, req.Connection)
+	case req.Type != "":
+		hits, err = lookupIndex(p.store, PresentationIndexKey, req.DId, IndexType, req.Type)
+	case req.CreatedAfter > 0 || req.CreatedBefore > 0:
+		hits, err = lookupIndexRange(p.store, PresentationIndexKey, req.DId, IndexCreated, req.CreatedAfter, req.CreatedBefore)
+	default:
+		hits, err = scanRecords(p.store, PresentationKey, req.DId)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	infos := make([]message.PresentationInfo, 0)
+	for _, hit := range hits {
+		if seen[hit.id] {
+			continue
+		}
+		seen[hit.id] = true
+		key := store.Key(PresentationKey, req.DId, hit.id)
+		rec := new(message.PresentationRec)
+		err = store.GetRecord(p.store, key, rec)
+		if err == store.ErrNotFound {
+			err = dropStaleIndex(p.store, hit)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		info := presentationInfo(hit.id, rec)
+		if matchPresentation(req, info) {
+			infos = append(infos, *info)
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Created != infos[j].Created {
+			return infos[i].Created < infos[j].Created
+		}
+		return infos[i].Id < infos[j].Id
+	})
+	return infos, nil
 }
 
 func (p *PresentationController) DelRequestPresentation(did, id string) error {
-	key := []byte(fmt.Sprintf("%s_%s_%s", RequestPresentationKey, did, id))
+	key := store.Key(RequestPresentationKey, did, id)
 	return p.store.Delete(key)
 }
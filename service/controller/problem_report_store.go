@@ -0,0 +1,155 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ontio/mercury/common/message"
+	"github.com/ontio/mercury/service/common"
+	"github.com/ontio/mercury/store"
+	"github.com/ontio/mercury/utils"
+)
+
+const ProblemReportKey = "ProblemReport"
+
+// SaveProblemReport keeps a report received by its Connection.TheirDid, a
+// repeated report is kept once
+func (s *SystemController) SaveProblemReport(report message.ProblemReport) error {
+	key := store.Key(ProblemReportKey, report.Connection.TheirDid, report.Id)
+	data, err := store.NewRecord(&message.ProblemReportRec{
+		Report:   report,
+		Received: time.Now().Unix(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = s.store.CompareAndSwap(key, nil, data)
+	return err
+}
+
+// checkProblemReport accepts a report from a connection, or on the thread
+// of a connection request before the connection exists
+func (s *SystemController) checkProblemReport(report *message.ProblemReport, sender string) error {
+	err := utils.CheckConnection(report.Connection.TheirDid, report.Connection.MyDid, s.store)
+	if err == nil {
+		return nil
+	}
+	if s.reportFromRouter(report, sender) {
+		return nil
+	}
+	rec, rerr := s.GetConnectionRequest(report.Connection.TheirDid, report.Thread.ID)
+	if rerr != nil || !requestWith(rec, report.Connection.MyDid) {
+		return err
+	}
+	return nil
+}
+
+// reportFromRouter reports whether the report comes from a router of the
+// connection its their_did item names, as when the router failed to forward
+// a message of the connection. The router must have signed the envelope of
+// the report itself, sender is the DID which did.
+func (s *SystemController) reportFromRouter(report *message.ProblemReport, sender string) bool {
+	if sender == "" || !strings.EqualFold(utils.CutDId(sender), utils.CutDId(report.Connection.MyDid)) {
+		return false
+	}
+	for _, item := range report.ProblemItems {
+		theirDid, ok := item[common.ProblemItemTheirDid]
+		if !ok {
+			continue
+		}
+		conn, err := s.GetConnection(report.Connection.TheirDid, theirDid)
+		if err != nil {
+			return false
+		}
+		_, err = common.RouterLastIndexOf(report.Connection.MyDid, common.MergeRouter(conn.MyRouter, conn.TheirRouter))
+		return err == nil
+	}
+	return false
+}
+
+// cancelRequestOnReport cancels the pending connection request the report
+// is on the thread of, only when the request is with the sender of the
+// report so that a router or another party can't cancel it
+func (s *SystemController) cancelRequestOnReport(report *message.ProblemReport) bool {
+	rec, err := s.GetConnectionRequest(report.Connection.TheirDid, report.Thread.ID)
+	if err != nil || !requestWith(rec, report.Connection.MyDid) {
+		return false
+	}
+	_, err = s.CancelConnectionRequestInStore(report.Connection.TheirDid, report.Thread.ID)
+	return err == nil
+}
+
+// requestWith reports whether the connection request is between its owner
+// and did
+func requestWith(rec *message.ConnectionRequestRec, did string) bool {
+	conn := rec.ConnReq.Connection
+	return conn.MyDid == did || conn.TheirDid == did
+}
+
+// QueryProblemReportsFromStore lists the reports received by req.DID
+// matching the filters of req, newest first
+func (s *SystemController) QueryProblemReportsFromStore(req *message.QueryProblemReportsRequest) (*message.QueryProblemReportsResponse, error) {
+	if req.DID == "" {
+		return nil, fmt.Errorf("did is required")
+	}
+	all := make([]message.ProblemReportRec, 0)
+	iter := s.store.NewIterator(store.KeyPrefix(ProblemReportKey, req.DID))
+	defer iter.Release()
+	for iter.Next() {
+		rec := new(message.ProblemReportRec)
+		if _, err := store.DecodeRecord(iter.Value(), rec); err != nil {
+			return nil, err
+		}
+		if matchProblemReport(req, &rec.Report) {
+			all = append(all, *rec)
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		if all[i].Received != all[j].Received {
+			return all[i].Received > all[j].Received
+		}
+		return all[i].Report.Id < all[j].Report.Id
+	})
+	res := &message.QueryProblemReportsResponse{Total: len(all), Reports: all}
+	if req.Offset > 0 || req.Limit > 0 {
+		start, end := pageBounds(len(all), req.Offset, req.Limit)
+		res.Reports = all[start:end]
+	}
+	return res, nil
+}
+
+func matchProblemReport(req *message.QueryProblemReportsRequest, report *message.ProblemReport) bool {
+	if req.TheirDid != "" && report.Connection.MyDid != req.TheirDid {
+		return false
+	}
+	if req.ThreadId != "" && report.Thread.ID != req.ThreadId {
+		return false
+	}
+	if req.Code != "" && report.Description.Code != req.Code {
+		return false
+	}
+	return true
+}
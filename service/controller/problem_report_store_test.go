@@ -0,0 +1,112 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package controller
+
+import (
+	"testing"
+
+	"github.com/ontio/mercury/common/message"
+	"github.com/ontio/mercury/service/common"
+	leveldb "github.com/ontio/mercury/store/leveldb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProblemReports(t *testing.T) {
+	db, err := leveldb.NewMemStore()
+	assert.Nil(t, err)
+	defer db.Close()
+	s := &SystemController{store: db}
+
+	report := func(id, from, thid, code string) message.ProblemReport {
+		return message.ProblemReport{
+			Id:          id,
+			Thread:      message.Thread{ID: thid},
+			Description: message.ProblemDescription{Code: code, En: "failed"},
+			Connection:  message.Connection{MyDid: from, TheirDid: "did:ont:alice"},
+		}
+	}
+	// a report is accepted on the thread of a pending request before the
+	// connection exists
+	r1 := report("r1", "did:ont:bob", "req-1", common.ProblemRequestNotAccepted)
+	assert.NotNil(t, s.checkProblemReport(&r1, "did:ont:bob"))
+	cr := message.ConnectionRequest{
+		Id:         "req-1",
+		Connection: message.Connection{MyDid: "did:ont:alice", TheirDid: "did:ont:bob"},
+	}
+	assert.Nil(t, s.SaveSentConnectionRequest(cr, ""))
+	assert.Nil(t, s.checkProblemReport(&r1, "did:ont:bob"))
+	r2 := report("r2", "did:ont:carol", "req-1", common.ProblemRequestNotAccepted)
+	assert.NotNil(t, s.checkProblemReport(&r2, "did:ont:carol"))
+	// only the party of the request cancels it
+	assert.False(t, s.cancelRequestOnReport(&r2))
+	rec, err := s.GetConnectionRequest("did:ont:alice", "req-1")
+	assert.Nil(t, err)
+	assert.False(t, rec.Cancelled)
+
+	// a router of a connection reports the messages it failed to forward
+	assert.Nil(t, s.SaveConnection(message.Connection{
+		MyDid:       "did:ont:alice",
+		MyRouter:    []string{"did:ont:alice#1"},
+		TheirDid:    "did:ont:dave",
+		TheirRouter: []string{"did:ont:dave#1", "did:ont:mediator#1"},
+	}, "Dave"))
+	routed := report("routed", "did:ont:mediator", "", common.ProblemRoutingFailed)
+	routed.ProblemItems = []map[string]string{{common.ProblemItemTheirDid: "did:ont:dave"}}
+	assert.Nil(t, s.checkProblemReport(&routed, "did:ont:mediator"))
+	// the router must have signed the envelope of the report itself
+	assert.NotNil(t, s.checkProblemReport(&routed, "did:ont:carol"))
+	assert.NotNil(t, s.checkProblemReport(&routed, ""))
+	// a router's report on the thread of a request doesn't cancel it
+	routed.Thread.ID = "req-1"
+	assert.False(t, s.cancelRequestOnReport(&routed))
+	routed.Connection.MyDid = "did:ont:carol"
+	assert.NotNil(t, s.checkProblemReport(&routed, "did:ont:carol"))
+	assert.True(t, s.cancelRequestOnReport(&r1))
+	rec, err = s.GetConnectionRequest("did:ont:alice", "req-1")
+	assert.Nil(t, err)
+	assert.True(t, rec.Cancelled)
+
+	assert.Nil(t, s.SaveProblemReport(r1))
+	assert.Nil(t, s.SaveProblemReport(r1))
+	assert.Nil(t, s.SaveProblemReport(report("r3", "did:ont:bob", "cred-1", common.ProblemIssuanceFailed)))
+	assert.Nil(t, s.SaveProblemReport(report("r4", "did:ont:carol", "proof-1", common.ProblemPresentationFailed)))
+
+	res, err := s.QueryProblemReportsFromStore(&message.QueryProblemReportsRequest{DID: "did:ont:alice"})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, res.Total)
+	res, err = s.QueryProblemReportsFromStore(&message.QueryProblemReportsRequest{DID: "did:ont:alice", TheirDid: "did:ont:bob"})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, res.Total)
+	res, err = s.QueryProblemReportsFromStore(&message.QueryProblemReportsRequest{DID: "did:ont:alice", ThreadId: "cred-1"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, res.Total)
+	assert.Equal(t, "r3", res.Reports[0].Report.Id)
+	res, err = s.QueryProblemReportsFromStore(&message.QueryProblemReportsRequest{DID: "did:ont:alice", Code: common.ProblemPresentationFailed})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, res.Total)
+	res, err = s.QueryProblemReportsFromStore(&message.QueryProblemReportsRequest{DID: "did:ont:alice", Offset: 1, Limit: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, res.Total)
+	assert.Len(t, res.Reports, 1)
+	res, err = s.QueryProblemReportsFromStore(&message.QueryProblemReportsRequest{DID: "did:ont:bob"})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, res.Total)
+	_, err = s.QueryProblemReportsFromStore(&message.QueryProblemReportsRequest{})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,185 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ontio/mercury/common/message"
+	"github.com/ontio/mercury/store"
+	"github.com/ontio/mercury/utils"
+)
+
+const day = 24 * time.Hour
+
+// DefaultRetention is how long records of each type are kept after their
+// last update, types not listed are kept until they are deleted. Records
+// still waiting for an answer are kept, see RecordFinished.
+var DefaultRetention = map[string]time.Duration{
+	utils.InvitationKey:    day,
+	utils.ConnectionReqKey: 30 * day,
+	OfferCredentialKey:     30 * day,
+	RequestCredentialKey:   30 * day,
+	RequestPresentationKey: 30 * day,
+	TrustPingKey:           day,
+	ProblemReportKey:       30 * day,
+	DIDRotationKey:         30 * day,
+	FeaturesKey:            30 * day,
+	ForwardUsageKey:        30 * day,
+}
+
+type recordType struct {
+	// parts is the number of key parts including the type
+	parts int
+	value func() interface{}
+}
+
+// recordTypes lists the records the agent writes and what they hold
+var recordTypes = map[string]recordType{
+	utils.InvitationKey:    {3, func() interface{} { return new(message.InvitationRec) }},
+	utils.ConnectionReqKey: {3, func() interface{} { return new(message.ConnectionRequestRec) }},
+	utils.ConnectionKey:    {3, func() interface{} { return new(message.ConnectionRec) }},
+	utils.BasicMsgKey:      {4, func() interface{} { return new(message.BasicMessage) }},
+	CredentialKey:          {3, func() interface{} { return new(message.CredentialRec) }},
+	OfferCredentialKey:     {3, func() interface{} { return new(message.OfferCredential) }},
+	RequestCredentialKey:   {3, func() interface{} { return new(message.RequestCredentialRec) }},
+	PresentationKey:        {3, func() interface{} { return new(message.PresentationRec) }},
+	RequestPresentationKey: {3, func() interface{} { return new(message.RequestPresentationRec) }},
+	CredentialIndexKey:     {6, func() interface{} { return new(string) }},
+	PresentationIndexKey:   {6, func() interface{} { return new(string) }},
+	TrustPingKey:           {3, func() interface{} { return new(message.TrustPingRec) }},
+	ProblemReportKey:       {3, func() interface{} { return new(message.ProblemReportRec) }},
+	DIDRotationKey:         {3, func() interface{} { return new(message.DIDRotationRec) }},
+	FeaturesKey:            {3, func() interface{} { return new(message.FeaturesRec) }},
+	MediationKey:           {2, func() interface{} { return new(message.MediationRec) }},
+	ForwardUsageKey:        {3, func() interface{} { return new(message.ForwardUsageRec) }},
+	MediationGrantKey:      {3, func() interface{} { return new(message.MediationGrantRec) }},
+}
+
+// ValidateRecord checks that the key is of a known record type and the value
+// is a record of the current schema holding that type
+func ValidateRecord(key, value []byte) error {
+	parts, err := store.SplitKey(key)
+	if err != nil {
+		return err
+	}
+	rt, ok := recordTypes[parts[0]]
+	if !ok {
+		return fmt.Errorf("unknown record type of key %q", key)
+	}
+	if len(parts) != rt.parts {
+		return fmt.Errorf("key %q should have %d parts", key, rt.parts)
+	}
+	rec, err := store.ParseRecord(value)
+	if err != nil {
+		return fmt.Errorf("key %q:%s", key, err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(rec.Data))
+	dec.DisallowUnknownFields()
+	err = dec.Decode(rt.value())
+	if err != nil {
+		return fmt.Errorf("key %q:%s", key, err)
+	}
+	return nil
+}
+
+// DecodeStoredRecord parses a stored value and decodes its payload into the
+// type named by the key, payloads of unknown types are returned as raw json
+func DecodeStoredRecord(key, value []byte) (*store.Record, interface{}, error) {
+	rec, err := store.ParseRecord(value)
+	if err != nil {
+		return nil, nil, err
+	}
+	rt, ok := recordTypes[store.RecordType(key)]
+	if !ok {
+		return rec, rec.Data, nil
+	}
+	v := rt.value()
+	err = json.Unmarshal(rec.Data, v)
+	if err != nil {
+		return rec, nil, err
+	}
+	return rec, v, nil
+}
+
+// RecordFinished tells the gc whether a record is done with. Multi use or
+// expiring invitations which can still be used, connection, credential and
+// presentation requests waiting for an answer, offers without their
+// credential, pings still waited for and rotations without an ack are not.
+// A single use invitation without expiry follows the retention whether it
+// is used or not. The records of other types are always finished.
+func RecordFinished(db store.Store) func(key []byte, rec *store.Record) bool {
+	return func(key []byte, rec *store.Record) bool {
+		parts, err := store.SplitKey(key)
+		if err != nil {
+			return true
+		}
+		switch parts[0] {
+		case utils.InvitationKey:
+			v := new(message.InvitationRec)
+			if json.Unmarshal(rec.Data, v) != nil {
+				return false
+			}
+			if !v.Policy.MultiUse && v.Policy.ExpireAt == 0 {
+				return true
+			}
+			return v.Check(time.Now()) != nil
+		case utils.ConnectionReqKey:
+			v := new(message.ConnectionRequestRec)
+			if json.Unmarshal(rec.Data, v) != nil {
+				return false
+			}
+			return v.Cancelled || v.State >= message.ConnectionResponseReceived
+		case OfferCredentialKey:
+			if len(parts) != 3 {
+				return true
+			}
+			has, err := db.Has(store.Key(CredentialKey, parts[1], parts[2]))
+			return err == nil && has
+		case RequestCredentialKey:
+			v := new(message.RequestCredentialRec)
+			if json.Unmarshal(rec.Data, v) != nil {
+				return false
+			}
+			return v.State == message.RequestCredentialResolved
+		case RequestPresentationKey:
+			v := new(message.RequestPresentationRec)
+			if json.Unmarshal(rec.Data, v) != nil {
+				return false
+			}
+			return v.State == message.RequestPresentationResolved
+		case TrustPingKey:
+			v := new(message.TrustPingRec)
+			if json.Unmarshal(rec.Data, v) != nil {
+				return false
+			}
+			return v.Responded > 0 || time.Since(time.Unix(0, v.Sent)) > MaxTrustPingTimeout
+		case DIDRotationKey:
+			v := new(message.DIDRotationRec)
+			if json.Unmarshal(rec.Data, v) != nil {
+				return false
+			}
+			return v.Completed > 0
+		}
+		return true
+	}
+}
@@ -0,0 +1,71 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ontio/mercury/common/message"
+	"github.com/ontio/mercury/store"
+	leveldb "github.com/ontio/mercury/store/leveldb"
+	"github.com/ontio/mercury/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordFinished(t *testing.T) {
+	db, err := leveldb.NewMemStore()
+	assert.Nil(t, err)
+	defer db.Close()
+	finished := RecordFinished(db)
+	check := func(key []byte, v interface{}) bool {
+		data, err := store.NewRecord(v)
+		assert.Nil(t, err)
+		rec, err := store.ParseRecord(data)
+		assert.Nil(t, err)
+		return finished(key, rec)
+	}
+
+	invKey := store.Key(utils.InvitationKey, "did:ont:alice", "1")
+	assert.True(t, check(invKey, &message.InvitationRec{}))
+	assert.True(t, check(invKey, &message.InvitationRec{Uses: 1}))
+	assert.False(t, check(invKey, &message.InvitationRec{Policy: message.InvitationPolicy{ExpireAt: time.Now().Add(time.Hour).Unix()}}))
+	assert.False(t, check(invKey, &message.InvitationRec{Policy: message.InvitationPolicy{MultiUse: true}}))
+	assert.True(t, check(invKey, &message.InvitationRec{Policy: message.InvitationPolicy{MultiUse: true}, Revoked: true}))
+
+	reqKey := store.Key(utils.ConnectionReqKey, "did:ont:alice", "1")
+	assert.False(t, check(reqKey, &message.ConnectionRequestRec{State: message.ConnectionRequestSent}))
+	assert.True(t, check(reqKey, &message.ConnectionRequestRec{State: message.ConnectionRequestSent, Cancelled: true}))
+	assert.True(t, check(reqKey, &message.ConnectionRequestRec{State: message.ConnectionACKReceived}))
+
+	credKey := store.Key(RequestCredentialKey, "did:ont:alice", "1")
+	assert.False(t, check(credKey, &message.RequestCredentialRec{State: message.RequestCredentialReceived}))
+	assert.True(t, check(credKey, &message.RequestCredentialRec{State: message.RequestCredentialResolved}))
+
+	offerKey := store.Key(OfferCredentialKey, "did:ont:alice", "1")
+	assert.False(t, check(offerKey, &message.OfferCredential{}))
+	assert.Nil(t, store.PutRecord(db, store.Key(CredentialKey, "did:ont:alice", "1"), &message.CredentialRec{}))
+	assert.True(t, check(offerKey, &message.OfferCredential{}))
+
+	pingKey := store.Key(TrustPingKey, "did:ont:alice", "1")
+	assert.False(t, check(pingKey, &message.TrustPingRec{Sent: time.Now().UnixNano()}))
+	assert.True(t, check(pingKey, &message.TrustPingRec{Sent: time.Now().Add(-time.Hour).UnixNano()}))
+
+	assert.True(t, check(store.Key(ProblemReportKey, "did:ont:alice", "1"), &message.ProblemReportRec{}))
+}
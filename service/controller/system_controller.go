@@ -20,32 +20,40 @@ package controller
 
 import (
 	"fmt"
+	"net"
 	"net/http"
 	"strings"
 
+	"github.com/gin-gonic/gin"
 	"github.com/ontio/mercury/common/log"
 	"github.com/ontio/mercury/common/message"
 	"github.com/ontio/mercury/common/packager/ecdsa"
 	"github.com/ontio/mercury/service/common"
 	"github.com/ontio/mercury/store"
+	"github.com/ontio/mercury/store/backup"
 	"github.com/ontio/mercury/utils"
 	"github.com/ontio/mercury/vdri"
-	"github.com/gin-gonic/gin"
 )
 
 type SystemController struct {
 	packager *ecdsa.Packager
 	store    store.Store
 	msgSvr   *common.MsgService
+	pings    *pingWaiters
 }
 
 func NewSystemController(packager *ecdsa.Packager, store store.Store,
-	msgSvr *common.MsgService) common.Router {
-	return &SystemController{
+	msgSvr *common.MsgService) *SystemController {
+	s := &SystemController{
 		packager: packager,
 		store:    store,
 		msgSvr:   msgSvr,
+		pings:    newPingWaiters(),
 	}
+	//only the DIDs registered for mediation are forwarded for
+	msgSvr.SetForwardAuthorizer(s)
+	msgSvr.SetConnectionStore(s)
+	return s
 }
 
 func (s *SystemController) Routes() common.Routes {
@@ -110,6 +118,210 @@ func (s *SystemController) Routes() common.Routes {
 			Pattern:     common.QueryConnectionsApi,
 			HandlerFunc: s.QueryConnections,
 		},
+		{
+			Name:        "ProblemReport",
+			Method:      strings.ToUpper("Post"),
+			Pattern:     common.ProblemReportApi,
+			HandlerFunc: s.ProblemReport,
+		},
+		{
+			Name:        "CreateInvitation",
+			Method:      strings.ToUpper("Post"),
+			Pattern:     common.CreateInvitationApi,
+			HandlerFunc: s.CreateInvitation,
+		},
+		{
+			Name:        "AcceptInvitation",
+			Method:      strings.ToUpper("Post"),
+			Pattern:     common.AcceptInvitationApi,
+			HandlerFunc: s.AcceptInvitation,
+		},
+		{
+			Name:        "QueryInvitation",
+			Method:      strings.ToUpper("Post"),
+			Pattern:     common.QueryInvitationApi,
+			HandlerFunc: s.QueryInvitation,
+		},
+		{
+			Name:        "RevokeInvitation",
+			Method:      strings.ToUpper("Post"),
+			Pattern:     common.RevokeInvitationApi,
+			HandlerFunc: s.RevokeInvitation,
+		},
+		{
+			Name:        "ListConnections",
+			Method:      strings.ToUpper("Post"),
+			Pattern:     common.ListConnectionsApi,
+			HandlerFunc: s.ListConnections,
+		},
+		{
+			Name:        "QueryConnectionRequest",
+			Method:      strings.ToUpper("Post"),
+			Pattern:     common.QueryConnectionRequestApi,
+			HandlerFunc: s.QueryConnectionRequest,
+		},
+		{
+			Name:        "CancelConnectionRequest",
+			Method:      strings.ToUpper("Post"),
+			Pattern:     common.CancelConnectionRequestApi,
+			HandlerFunc: s.CancelConnectionRequest,
+		},
+		{
+			Name:        "UpdateConnection",
+			Method:      strings.ToUpper("Post"),
+			Pattern:     common.UpdateConnectionApi,
+			HandlerFunc: s.UpdateConnection,
+		},
+		{
+			Name:        "SendTrustPing",
+			Method:      strings.ToUpper("Post"),
+			Pattern:     common.SendTrustPingApi,
+			HandlerFunc: s.SendTrustPing,
+		},
+		{
+			Name:        "TrustPing",
+			Method:      strings.ToUpper("Post"),
+			Pattern:     common.TrustPingApi,
+			HandlerFunc: s.TrustPing,
+		},
+		{
+			Name:        "TrustPingResponse",
+			Method:      strings.ToUpper("Post"),
+			Pattern:     common.TrustPingResponseApi,
+			HandlerFunc: s.TrustPingResponse,
+		},
+		{
+			Name:        "DIDExchangeRequest",
+			Method:      strings.ToUpper("Post"),
+			Pattern:     common.DIDExchangeRequestApi,
+			HandlerFunc: s.DIDExchangeRequest,
+		},
+		{
+			Name:        "DIDExchangeResponse",
+			Method:      strings.ToUpper("Post"),
+			Pattern:     common.DIDExchangeResponseApi,
+			HandlerFunc: s.DIDExchangeResponse,
+		},
+		{
+			Name:        "DIDExchangeComplete",
+			Method:      strings.ToUpper("Post"),
+			Pattern:     common.DIDExchangeCompleteApi,
+			HandlerFunc: s.DIDExchangeComplete,
+		},
+		{
+			Name:        "QueryProblemReports",
+			Method:      strings.ToUpper("Post"),
+			Pattern:     common.QueryProblemReportsApi,
+			HandlerFunc: s.QueryProblemReports,
+		},
+		{
+			Name:        "RotateDID",
+			Method:      strings.ToUpper("Post"),
+			Pattern:     common.RotateDIDApi,
+			HandlerFunc: s.RotateDID,
+		},
+		{
+			Name:        "DIDRotate",
+			Method:      strings.ToUpper("Post"),
+			Pattern:     common.DIDRotateApi,
+			HandlerFunc: s.DIDRotate,
+		},
+		{
+			Name:        "DIDRotateAck",
+			Method:      strings.ToUpper("Post"),
+			Pattern:     common.DIDRotateAckApi,
+			HandlerFunc: s.DIDRotateAck,
+		},
+		{
+			Name:        "DiscoverFeatures",
+			Method:      strings.ToUpper("Post"),
+			Pattern:     common.DiscoverFeaturesApi,
+			HandlerFunc: s.DiscoverFeatures,
+		},
+		{
+			Name:        "FeaturesQuery",
+			Method:      strings.ToUpper("Post"),
+			Pattern:     common.FeaturesQueryApi,
+			HandlerFunc: s.FeaturesQuery,
+		},
+		{
+			Name:        "FeaturesDisclose",
+			Method:      strings.ToUpper("Post"),
+			Pattern:     common.FeaturesDiscloseApi,
+			HandlerFunc: s.FeaturesDisclose,
+		},
+		{
+			Name:        "ReloadPolicy",
+			Method:      strings.ToUpper("Post"),
+			Pattern:     common.ReloadPolicyApi,
+			HandlerFunc: s.ReloadPolicy,
+		},
+		{
+			Name:        "RegisterMediation",
+			Method:      strings.ToUpper("Post"),
+			Pattern:     common.RegisterMediationApi,
+			HandlerFunc: s.RegisterMediation,
+		},
+		{
+			Name:        "RemoveMediation",
+			Method:      strings.ToUpper("Post"),
+			Pattern:     common.RemoveMediationApi,
+			HandlerFunc: s.RemoveMediation,
+		},
+		{
+			Name:        "QueryForwardUsage",
+			Method:      strings.ToUpper("Post"),
+			Pattern:     common.QueryForwardUsageApi,
+			HandlerFunc: s.QueryForwardUsage,
+		},
+		{
+			Name:        "RequestMediation",
+			Method:      strings.ToUpper("Post"),
+			Pattern:     common.RequestMediationApi,
+			HandlerFunc: s.RequestMediation,
+		},
+		{
+			Name:        "MediateRequest",
+			Method:      strings.ToUpper("Post"),
+			Pattern:     common.MediateRequestApi,
+			HandlerFunc: s.MediateRequest,
+		},
+		{
+			Name:        "MediateGrant",
+			Method:      strings.ToUpper("Post"),
+			Pattern:     common.MediateGrantApi,
+			HandlerFunc: s.MediateGrant,
+		},
+		{
+			Name:        "MediateDeny",
+			Method:      strings.ToUpper("Post"),
+			Pattern:     common.MediateDenyApi,
+			HandlerFunc: s.MediateDeny,
+		},
+		{
+			Name:        "UpdateKeylist",
+			Method:      strings.ToUpper("Post"),
+			Pattern:     common.UpdateKeylistApi,
+			HandlerFunc: s.UpdateKeylist,
+		},
+		{
+			Name:        "KeylistUpdate",
+			Method:      strings.ToUpper("Post"),
+			Pattern:     common.KeylistUpdateApi,
+			HandlerFunc: s.KeylistUpdate,
+		},
+		{
+			Name:        "KeylistResponse",
+			Method:      strings.ToUpper("Post"),
+			Pattern:     common.KeylistResponseApi,
+			HandlerFunc: s.KeylistResponse,
+		},
+		{
+			Name:        "Export",
+			Method:      strings.ToUpper("Get"),
+			Pattern:     common.ExportApi,
+			HandlerFunc: s.Export,
+		},
 	}
 }
 
@@ -154,22 +366,17 @@ func (s *SystemController) ConnectionRequest(ctx *gin.Context) {
 		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, fmt.Errorf("data convert err").Error(), nil)
 		return
 	}
-	ivrc, err := s.GetInvitation(req.Connection.TheirDid, req.InvitationId)
+	//count the use against the invitation policy
+	ivrc, err := s.UseInvitation(req.Connection.TheirDid, req.InvitationId, vdri.ConnectionsProtocol)
 	if err != nil {
-		log.Infof("err on GetInvitation:%s\n", err.Error())
+		log.Infof("err on UseInvitation:%s\n", err.Error())
 		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
 		return
 	}
 	err = s.SaveConnectionRequest(*req, message.ConnectionRequestReceived)
 	if err != nil {
 		log.Infof("err on SaveConnectionRequest:%s\n", err.Error())
-		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
-		return
-	}
-	//update invitation to used state
-	err = s.UpdateInvitation(ivrc.Invitation.Did, ivrc.Invitation.Id, message.InvitationUsed)
-	if err != nil {
-		log.Infof("err on UpdateInvitation:%s\n", err.Error())
+		s.ReleaseInvitation(req.Connection.TheirDid, req.InvitationId)
 		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
 		return
 	}
@@ -198,9 +405,14 @@ func (s *SystemController) ConnectionRequest(ctx *gin.Context) {
 	})
 	if err != nil {
 		log.Errorf("err on HandleOutBound:%s\n", err.Error())
+		s.abandonConnectionRequest(req.Connection.TheirDid, req.InvitationId, req.Id)
 		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
 		return
 	}
+	err = s.MarkResponseSent(req.Connection.TheirDid, req.Id)
+	if err != nil {
+		log.Errorf("err on MarkResponseSent:%s\n", err.Error())
+	}
 	resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
 	return
 }
@@ -222,9 +434,21 @@ func (s *SystemController) ConnectionResponse(ctx *gin.Context) {
 		return
 	}
 	connId := req.Thread.ID
-	err = s.SaveConnection(common.ReverseConnection(req.Connection))
+	sent, err := s.ReceiveConnectionResponse(req.Connection.TheirDid, connId)
+	if err != nil {
+		log.Errorf("err on ReceiveConnectionResponse:%s\n", err.Error())
+		s.reportConnectionProblem(req.Connection, connId, common.ProblemResponseNotAccepted, err)
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	label := ""
+	if sent != nil {
+		label = sent.TheirLabel
+	}
+	err = s.SaveConnection(common.ReverseConnection(req.Connection), label)
 	if err != nil {
 		log.Errorf("err on SaveConnection:%s\n", err.Error())
+		s.reportConnectionProblem(req.Connection, connId, common.ProblemResponseNotAccepted, err)
 		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
 		return
 	}
@@ -268,25 +492,19 @@ func (s *SystemController) ConnectionAck(ctx *gin.Context) {
 		return
 	}
 	if req.Status != utils.ACK_SUCCEED {
-		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, fmt.Errorf("got failed ACK ").Error(), nil)
-		return
-	}
-	connId := req.Thread.ID
-	err = s.UpdateConnectionRequest(req.Connection.TheirDid, connId, message.ConnectionACKReceived)
-	if err != nil {
-		log.Errorf("err on UpdateConnectionRequest:%s\n", err.Error())
-		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
-		return
-	}
-	cr, err := s.GetConnectionRequest(req.Connection.TheirDid, connId)
-	if err != nil {
-		log.Errorf("err on GetConnectionRequest:%s\n", err.Error())
+		//the request is dropped, a later ack on it is rejected
+		err = fmt.Errorf("got failed ACK on connection request %s", req.Thread.ID)
+		if _, cerr := s.CancelConnectionRequestInStore(req.Connection.TheirDid, req.Thread.ID); cerr != nil {
+			log.Warnf("err on CancelConnectionRequestInStore:%s\n", cerr.Error())
+		}
+		s.reportConnectionProblem(req.Connection, req.Thread.ID, common.ProblemConnectionAbandoned, err)
 		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
 		return
 	}
-	err = s.SaveConnection(common.ReverseConnection(cr.ConnReq.Connection))
+	err = s.completeConnectionRequest(req.Connection.TheirDid, req.Thread.ID, vdri.ConnectionsProtocol)
 	if err != nil {
-		log.Errorf("err on SaveConnection:%s\n", err.Error())
+		log.Errorf("err on completeConnectionRequest:%s\n", err.Error())
+		s.reportConnectionProblem(req.Connection, req.Thread.ID, common.ProblemConnectionAbandoned, err)
 		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
 		return
 	}
@@ -463,7 +681,7 @@ func (s *SystemController) QueryBasicMsg(ctx *gin.Context) {
 		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, fmt.Errorf("data convert err").Error(), nil)
 		return
 	}
-	ret, err := s.QueryBasicMsgFromStore(req.DID, req.Latest, req.RemoveAfterRead)
+	ret, err := s.QueryBasicMsgFromStore(req.DID, req.Latest, req.RemoveAfterRead, req.Offset, req.Limit)
 	if err != nil {
 		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
 		return
@@ -495,3 +713,1386 @@ func (s *SystemController) QueryConnections(ctx *gin.Context) {
 	resp.Response(http.StatusOK, message.SUCCEED_CODE, "", ret)
 	return
 }
+
+func (s *SystemController) ProblemReport(ctx *gin.Context) {
+	resp := common.Gin{C: ctx}
+	data, isForward, err := common.ParseMessage(common.EnablePackage, ctx, s.packager, common.ProblemReportType, s.msgSvr)
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	if isForward {
+		resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
+		return
+	}
+	req, ok := data.(*message.ProblemReport)
+	if !ok {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, fmt.Errorf("data convert err").Error(), nil)
+		return
+	}
+	err = s.checkProblemReport(req, common.Sender(ctx))
+	if err != nil {
+		log.Infof("no connect found with did:%s", req.Connection.MyDid)
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	log.Warnf("problem report from %s on thread %s, code:%s, %s", req.Connection.MyDid, req.Thread.ID, req.Description.Code, req.Description.En)
+	err = s.SaveProblemReport(*req)
+	if err != nil {
+		log.Errorf("err on SaveProblemReport:%s\n", err.Error())
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	//a pending connection request failed on the other side
+	if s.cancelRequestOnReport(req) {
+		log.Infof("connection request %s cancelled by a problem report", req.Thread.ID)
+	}
+	resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
+	return
+}
+
+// QueryProblemReports lists the problem reports received by a did
+func (s *SystemController) QueryProblemReports(ctx *gin.Context) {
+	resp := common.Gin{C: ctx}
+	data, isForward, err := common.ParseMessage(common.EnablePackage, ctx, s.packager, common.QueryProblemReportsType, s.msgSvr)
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	if isForward {
+		resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
+		return
+	}
+	req, ok := data.(*message.QueryProblemReportsRequest)
+	if !ok {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, fmt.Errorf("data convert err").Error(), nil)
+		return
+	}
+	ret, err := s.QueryProblemReportsFromStore(req)
+	if err != nil {
+		log.Errorf("err on QueryProblemReportsFromStore:%s\n", err.Error())
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	resp.Response(http.StatusOK, message.SUCCEED_CODE, "", ret)
+	return
+}
+
+// Export streams a snapshot of the whole database, only local clients are served
+func (s *SystemController) Export(ctx *gin.Context) {
+	if !fromLoopback(ctx) {
+		ctx.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+	snap, err := s.store.Snapshot()
+	if err != nil {
+		resp := common.Gin{C: ctx}
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	defer snap.Release()
+	ctx.Header("Content-Type", "application/x-ndjson")
+	ctx.Status(http.StatusOK)
+	//a failed export misses its trailer, which the reader detects
+	n, err := backup.Export(snap, ctx.Writer, nil)
+	if err != nil {
+		log.Errorf("error on Export after %d records:%s", n, err.Error())
+		return
+	}
+	log.Infof("exported %d records", n)
+}
+
+func fromLoopback(ctx *gin.Context) bool {
+	host, _, err := net.SplitHostPort(ctx.Request.RemoteAddr)
+	return err == nil && net.ParseIP(host).IsLoopback()
+}
+
+// CreateInvitation creates an invitation to connect to a did of the agent
+// and returns it with its invitation url
+func (s *SystemController) CreateInvitation(ctx *gin.Context) {
+	resp := common.Gin{C: ctx}
+	data, isForward, err := common.ParseMessage(common.EnablePackage, ctx, s.packager, common.CreateInvitationType, s.msgSvr)
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	if isForward {
+		resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
+		return
+	}
+	req, ok := data.(*message.CreateInvitationRequest)
+	if !ok {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, fmt.Errorf("data convert err").Error(), nil)
+		return
+	}
+	if req.QRCode != "" {
+		if err = utils.CheckQRCode(req.QRCode, req.QRSize); err != nil {
+			resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+			return
+		}
+	}
+	iv, err := s.NewInvitation(req)
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	url, err := message.InvitationURL(s.msgSvr.Cfg.PublicURL, iv)
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	res := &message.CreateInvitationResponse{
+		Invitation: *iv,
+		Url:        url,
+	}
+	if req.QRCode != "" {
+		img, mimeType, err := utils.QRCode(url, req.QRCode, req.QRSize)
+		if err != nil {
+			resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+			return
+		}
+		res.QRCode = &message.QRCode{MimeType: mimeType, Base64: utils.Base64Encode(img)}
+	}
+	resp.Response(http.StatusOK, message.SUCCEED_CODE, "", res)
+	return
+}
+
+// AcceptInvitation sends the connection request answering an invitation,
+// the connection is saved once the inviter responds
+func (s *SystemController) AcceptInvitation(ctx *gin.Context) {
+	resp := common.Gin{C: ctx}
+	data, isForward, err := common.ParseMessage(common.EnablePackage, ctx, s.packager, common.AcceptInvitationType, s.msgSvr)
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	if isForward {
+		resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
+		return
+	}
+	req, ok := data.(*message.AcceptInvitationRequest)
+	if !ok {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, fmt.Errorf("data convert err").Error(), nil)
+		return
+	}
+	cr, iv, err := newConnectionRequest(req)
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	protocol, err := handshakeProtocol(req.Protocol)
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	if !acceptsProtocol(iv, protocol) {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, fmt.Errorf("invitation doesn't accept %s", protocol).Error(), nil)
+		return
+	}
+	outMsg := common.Message{
+		MessageType: common.ConnectionRequestType,
+		Content:     cr,
+	}
+	if protocol == vdri.DIDExchangeProtocol {
+		dx, err := s.newDIDExchangeRequest(cr)
+		if err != nil {
+			resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+			return
+		}
+		err = s.SaveSentDIDExchangeRequest(dx, iv.Label)
+		if err != nil {
+			resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+			return
+		}
+		outMsg = common.Message{
+			MessageType: common.DIDExchangeRequestType,
+			Content:     dx,
+		}
+	} else {
+		err = s.SaveSentConnectionRequest(*cr, iv.Label)
+		if err != nil {
+			resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+			return
+		}
+	}
+	err = s.msgSvr.HandleOutBound(common.OutboundMsg{
+		Msg:  outMsg,
+		Conn: cr.Connection,
+	})
+	if err != nil {
+		log.Errorf("err on HandleOutBound:%s\n", err.Error())
+		if _, cerr := s.CancelConnectionRequestInStore(cr.Connection.MyDid, cr.Id); cerr != nil {
+			log.Errorf("err on CancelConnectionRequestInStore:%s\n", cerr.Error())
+		}
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	resp.Response(http.StatusOK, message.SUCCEED_CODE, "", outMsg.Content)
+	return
+}
+
+// QueryInvitation returns an invitation with its policy and uses
+func (s *SystemController) QueryInvitation(ctx *gin.Context) {
+	resp := common.Gin{C: ctx}
+	data, isForward, err := common.ParseMessage(common.EnablePackage, ctx, s.packager, common.QueryInvitationType, s.msgSvr)
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	if isForward {
+		resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
+		return
+	}
+	req, ok := data.(*message.InvitationRequest)
+	if !ok {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, fmt.Errorf("data convert err").Error(), nil)
+		return
+	}
+	rec, err := s.GetInvitation(req.Did, req.Id)
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	resp.Response(http.StatusOK, message.SUCCEED_CODE, "", rec)
+	return
+}
+
+// RevokeInvitation rejects the later connection requests of an invitation
+func (s *SystemController) RevokeInvitation(ctx *gin.Context) {
+	resp := common.Gin{C: ctx}
+	data, isForward, err := common.ParseMessage(common.EnablePackage, ctx, s.packager, common.RevokeInvitationType, s.msgSvr)
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	if isForward {
+		resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
+		return
+	}
+	req, ok := data.(*message.InvitationRequest)
+	if !ok {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, fmt.Errorf("data convert err").Error(), nil)
+		return
+	}
+	rec, err := s.RevokeInvitationInStore(req.Did, req.Id)
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	resp.Response(http.StatusOK, message.SUCCEED_CODE, "", rec)
+	return
+}
+
+// ListConnections lists the connections of a did in all states
+func (s *SystemController) ListConnections(ctx *gin.Context) {
+	resp := common.Gin{C: ctx}
+	data, isForward, err := common.ParseMessage(common.EnablePackage, ctx, s.packager, common.ListConnectionsType, s.msgSvr)
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	if isForward {
+		resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
+		return
+	}
+	req, ok := data.(*message.ListConnectionsRequest)
+	if !ok {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, fmt.Errorf("data convert err").Error(), nil)
+		return
+	}
+	ret, err := s.ListConnectionsFromStore(req)
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	resp.Response(http.StatusOK, message.SUCCEED_CODE, "", ret)
+	return
+}
+
+// QueryConnectionRequest returns a connection request sent or received by a
+// did
+func (s *SystemController) QueryConnectionRequest(ctx *gin.Context) {
+	resp := common.Gin{C: ctx}
+	data, isForward, err := common.ParseMessage(common.EnablePackage, ctx, s.packager, common.QueryConnectionRequestType, s.msgSvr)
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	if isForward {
+		resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
+		return
+	}
+	req, ok := data.(*message.PendingRequest)
+	if !ok {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, fmt.Errorf("data convert err").Error(), nil)
+		return
+	}
+	rec, err := s.GetConnectionRequest(req.DID, req.Id)
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	resp.Response(http.StatusOK, message.SUCCEED_CODE, "", rec)
+	return
+}
+
+// CancelConnectionRequest cancels a pending connection request
+func (s *SystemController) CancelConnectionRequest(ctx *gin.Context) {
+	resp := common.Gin{C: ctx}
+	data, isForward, err := common.ParseMessage(common.EnablePackage, ctx, s.packager, common.CancelConnectionRequestType, s.msgSvr)
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	if isForward {
+		resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
+		return
+	}
+	req, ok := data.(*message.PendingRequest)
+	if !ok {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, fmt.Errorf("data convert err").Error(), nil)
+		return
+	}
+	rec, err := s.CancelConnectionRequestInStore(req.DID, req.Id)
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	resp.Response(http.StatusOK, message.SUCCEED_CODE, "", rec)
+	return
+}
+
+// UpdateConnection changes the alias, tags or metadata of a connection
+func (s *SystemController) UpdateConnection(ctx *gin.Context) {
+	resp := common.Gin{C: ctx}
+	data, isForward, err := common.ParseMessage(common.EnablePackage, ctx, s.packager, common.UpdateConnectionType, s.msgSvr)
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	if isForward {
+		resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
+		return
+	}
+	req, ok := data.(*message.UpdateConnectionRequest)
+	if !ok {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, fmt.Errorf("data convert err").Error(), nil)
+		return
+	}
+	info, err := s.UpdateConnectionInStore(req)
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	resp.Response(http.StatusOK, message.SUCCEED_CODE, "", info)
+	return
+}
+
+// SendTrustPing pings a connection and waits for the response to report
+// the round trip time
+func (s *SystemController) SendTrustPing(ctx *gin.Context) {
+	resp := common.Gin{C: ctx}
+	data, isForward, err := common.ParseMessage(common.EnablePackage, ctx, s.packager, common.SendTrustPingType, s.msgSvr)
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	if isForward {
+		resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
+		return
+	}
+	req, ok := data.(*message.SendTrustPingRequest)
+	if !ok {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, fmt.Errorf("data convert err").Error(), nil)
+		return
+	}
+	conn, err := s.GetConnection(req.DID, req.TheirDid)
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	res, err := s.pingConnection(conn, req.Comment, req.ResponseRequested == nil || *req.ResponseRequested, trustPingTimeout(req.Timeout))
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), res)
+		return
+	}
+	resp.Response(http.StatusOK, message.SUCCEED_CODE, "", res)
+	return
+}
+
+func (s *SystemController) TrustPing(ctx *gin.Context) {
+	resp := common.Gin{C: ctx}
+	data, isForward, err := common.ParseMessage(common.EnablePackage, ctx, s.packager, common.TrustPingType, s.msgSvr)
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	if isForward {
+		resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
+		return
+	}
+	req, ok := data.(*message.TrustPing)
+	if !ok {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, fmt.Errorf("data convert err").Error(), nil)
+		return
+	}
+	err = utils.CheckConnection(req.Connection.TheirDid, req.Connection.MyDid, s.store)
+	if err != nil {
+		log.Infof("no connect found with did:%s", req.Connection.MyDid)
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	if req.ResponseRequested {
+		res := &message.TrustPingResponse{
+			Type:       vdri.TrustPingResponseSpec,
+			Id:         utils.GenUUID(),
+			Thread:     message.Thread{ID: req.Id},
+			Connection: common.ReverseConnection(req.Connection),
+		}
+		err = s.msgSvr.HandleOutBound(common.OutboundMsg{
+			Msg: common.Message{
+				MessageType: common.TrustPingResponseType,
+				Content:     res,
+			},
+			Conn: res.Connection,
+		})
+		if err != nil {
+			log.Errorf("err on HandleOutBound:%s\n", err.Error())
+			resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+			return
+		}
+	}
+	resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
+	return
+}
+
+func (s *SystemController) TrustPingResponse(ctx *gin.Context) {
+	resp := common.Gin{C: ctx}
+	data, isForward, err := common.ParseMessage(common.EnablePackage, ctx, s.packager, common.TrustPingResponseType, s.msgSvr)
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	if isForward {
+		resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
+		return
+	}
+	req, ok := data.(*message.TrustPingResponse)
+	if !ok {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, fmt.Errorf("data convert err").Error(), nil)
+		return
+	}
+	err = utils.CheckConnection(req.Connection.TheirDid, req.Connection.MyDid, s.store)
+	if err != nil {
+		log.Infof("no connect found with did:%s", req.Connection.MyDid)
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	err = s.ReceiveTrustPingResponse(req.Connection.TheirDid, req.Thread.ID)
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
+	return
+}
+
+// DIDExchangeRequest answers a did exchange request to an invitation with
+// the signed did doc of the inviter
+func (s *SystemController) DIDExchangeRequest(ctx *gin.Context) {
+	resp := common.Gin{C: ctx}
+	data, isForward, err := common.ParseMessage(common.EnablePackage, ctx, s.packager, common.DIDExchangeRequestType, s.msgSvr)
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	if isForward {
+		resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
+		return
+	}
+	req, ok := data.(*message.DIDExchangeRequest)
+	if !ok {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, fmt.Errorf("data convert err").Error(), nil)
+		return
+	}
+	if req.Did != req.Connection.MyDid {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, fmt.Errorf("request did %s is not the connection did", req.Did).Error(), nil)
+		return
+	}
+	err = s.verifyDIDDoc(req.DIDDoc, req.Did)
+	if err != nil {
+		log.Infof("err on verifyDIDDoc:%s\n", err.Error())
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	ivrc, err := s.UseInvitation(req.Connection.TheirDid, req.Thread.PID, vdri.DIDExchangeProtocol)
+	if err != nil {
+		log.Infof("err on UseInvitation:%s\n", err.Error())
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	err = s.SaveDIDExchangeRequest(req)
+	if err != nil {
+		log.Infof("err on SaveDIDExchangeRequest:%s\n", err.Error())
+		s.ReleaseInvitation(req.Connection.TheirDid, req.Thread.PID)
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	doc, err := s.signDIDDoc(ivrc.Invitation.Did)
+	if err != nil {
+		log.Errorf("err on signDIDDoc:%s\n", err.Error())
+		s.abandonConnectionRequest(req.Connection.TheirDid, req.Thread.PID, req.Id)
+		s.msgSvr.SendProblemReport(req.Connection, req.Id, common.ProblemRequestNotAccepted, err)
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	res := &message.DIDExchangeResponse{
+		Type:   vdri.DIDExchangeResponseSpec,
+		Id:     utils.GenUUID(),
+		Thread: message.Thread{ID: req.Id, PID: req.Thread.PID},
+		Did:    ivrc.Invitation.Did,
+		DIDDoc: doc,
+		Connection: message.Connection{
+			MyDid:       ivrc.Invitation.Did,
+			MyRouter:    ivrc.Invitation.Router,
+			TheirDid:    req.Connection.MyDid,
+			TheirRouter: req.Connection.MyRouter,
+		},
+	}
+	err = s.msgSvr.HandleOutBound(common.OutboundMsg{
+		Msg: common.Message{
+			MessageType: common.DIDExchangeResponseType,
+			Content:     res,
+		},
+		Conn: res.Connection,
+	})
+	if err != nil {
+		log.Errorf("err on HandleOutBound:%s\n", err.Error())
+		s.abandonConnectionRequest(req.Connection.TheirDid, req.Thread.PID, req.Id)
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	err = s.MarkResponseSent(req.Connection.TheirDid, req.Id)
+	if err != nil {
+		log.Errorf("err on MarkResponseSent:%s\n", err.Error())
+	}
+	resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
+	return
+}
+
+// DIDExchangeResponse saves the connection once the did doc of the inviter
+// is verified, and completes the exchange
+func (s *SystemController) DIDExchangeResponse(ctx *gin.Context) {
+	resp := common.Gin{C: ctx}
+	data, isForward, err := common.ParseMessage(common.EnablePackage, ctx, s.packager, common.DIDExchangeResponseType, s.msgSvr)
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	if isForward {
+		resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
+		return
+	}
+	req, ok := data.(*message.DIDExchangeResponse)
+	if !ok {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, fmt.Errorf("data convert err").Error(), nil)
+		return
+	}
+	if req.Did != req.Connection.MyDid {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, fmt.Errorf("response did %s is not the connection did", req.Did).Error(), nil)
+		return
+	}
+	connId := req.Thread.ID
+	err = s.verifyDIDDoc(req.DIDDoc, req.Did)
+	if err != nil {
+		log.Infof("err on verifyDIDDoc:%s\n", err.Error())
+		s.reportConnectionProblem(req.Connection, connId, common.ProblemResponseNotAccepted, err)
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	sent, err := s.GetConnectionRequest(req.Connection.TheirDid, connId)
+	if err == nil && requestProtocol(sent) != vdri.DIDExchangeProtocol {
+		err = fmt.Errorf("connection request %s is not a did exchange request", connId)
+	}
+	if err != nil {
+		log.Errorf("err on GetConnectionRequest:%s\n", err.Error())
+		s.reportConnectionProblem(req.Connection, connId, common.ProblemResponseNotAccepted, err)
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	_, err = s.ReceiveConnectionResponse(req.Connection.TheirDid, connId)
+	if err != nil {
+		log.Errorf("err on ReceiveConnectionResponse:%s\n", err.Error())
+		s.reportConnectionProblem(req.Connection, connId, common.ProblemResponseNotAccepted, err)
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	err = s.SaveConnection(common.ReverseConnection(req.Connection), sent.TheirLabel)
+	if err != nil {
+		log.Errorf("err on SaveConnection:%s\n", err.Error())
+		s.reportConnectionProblem(req.Connection, connId, common.ProblemResponseNotAccepted, err)
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	complete := &message.DIDExchangeComplete{
+		Type:       vdri.DIDExchangeCompleteSpec,
+		Id:         utils.GenUUID(),
+		Thread:     message.Thread{ID: connId, PID: req.Thread.PID},
+		Connection: common.ReverseConnection(req.Connection),
+	}
+	err = s.msgSvr.HandleOutBound(common.OutboundMsg{
+		Msg: common.Message{
+			MessageType: common.DIDExchangeCompleteType,
+			Content:     complete,
+		},
+		Conn: complete.Connection,
+	})
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
+	return
+}
+
+func (s *SystemController) DIDExchangeComplete(ctx *gin.Context) {
+	resp := common.Gin{C: ctx}
+	data, isForward, err := common.ParseMessage(common.EnablePackage, ctx, s.packager, common.DIDExchangeCompleteType, s.msgSvr)
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	if isForward {
+		resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
+		return
+	}
+	req, ok := data.(*message.DIDExchangeComplete)
+	if !ok {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, fmt.Errorf("data convert err").Error(), nil)
+		return
+	}
+	err = s.completeConnectionRequest(req.Connection.TheirDid, req.Thread.ID, vdri.DIDExchangeProtocol)
+	if err != nil {
+		log.Errorf("err on completeConnectionRequest:%s\n", err.Error())
+		s.reportConnectionProblem(req.Connection, req.Thread.ID, common.ProblemConnectionAbandoned, err)
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
+	return
+}
+
+// RotateDID announces a new did and router of a connection to the other
+// party, the connection is rotated on this side once the other party acks.
+// Only local clients are served.
+func (s *SystemController) RotateDID(ctx *gin.Context) {
+	resp := common.Gin{C: ctx}
+	if !fromLoopback(ctx) {
+		ctx.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+	data, isForward, err := common.ParseMessage(common.EnablePackage, ctx, s.packager, common.RotateDIDType, s.msgSvr)
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	if isForward {
+		resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
+		return
+	}
+	req, ok := data.(*message.RotateDIDRequest)
+	if !ok {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, fmt.Errorf("data convert err").Error(), nil)
+		return
+	}
+	err = checkPeerFeatures(s.store, req.DID, req.TheirDid, vdri.DIDRotateSpec)
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	rotate, rotation, err := s.newDIDRotate(req)
+	if err != nil {
+		log.Errorf("err on newDIDRotate:%s\n", err.Error())
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	err = s.SaveDIDRotation(rotate, rotation)
+	if err != nil {
+		log.Errorf("err on SaveDIDRotation:%s\n", err.Error())
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	err = s.msgSvr.HandleOutBound(common.OutboundMsg{
+		Msg: common.Message{
+			MessageType: common.DIDRotateType,
+			Content:     rotate,
+		},
+		Conn: rotate.Connection,
+	})
+	if err != nil {
+		log.Errorf("err on HandleOutBound:%s\n", err.Error())
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	resp.Response(http.StatusOK, message.SUCCEED_CODE, "", rotate)
+	return
+}
+
+// DIDRotate verifies a rotation against the connection it arrived on,
+// rotates the connection and acks on the rotated connection
+func (s *SystemController) DIDRotate(ctx *gin.Context) {
+	resp := common.Gin{C: ctx}
+	data, isForward, err := common.ParseMessage(common.EnablePackage, ctx, s.packager, common.DIDRotateType, s.msgSvr)
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	if isForward {
+		resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
+		return
+	}
+	req, ok := data.(*message.DIDRotate)
+	if !ok {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, fmt.Errorf("data convert err").Error(), nil)
+		return
+	}
+	err = utils.CheckConnection(req.Connection.TheirDid, req.Connection.MyDid, s.store)
+	if err != nil {
+		log.Infof("no connect found with did:%s", req.Connection.MyDid)
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	rotation, conn, err := s.verifyDIDRotate(req)
+	if err != nil {
+		log.Infof("err on verifyDIDRotate:%s\n", err.Error())
+		s.msgSvr.SendProblemReport(req.Connection, req.Id, common.ProblemRotationNotAccepted, err)
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	conn, err = s.RotateTheirDid(conn.MyDid, rotation)
+	if err != nil {
+		log.Errorf("err on RotateTheirDid:%s\n", err.Error())
+		s.msgSvr.SendProblemReport(req.Connection, req.Id, common.ProblemRotationNotAccepted, err)
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	ack := &message.DIDRotateAck{
+		Type:       vdri.DIDRotateAckSpec,
+		Id:         utils.GenUUID(),
+		Thread:     message.Thread{ID: req.Id},
+		Status:     utils.ACK_SUCCEED,
+		Connection: conn,
+	}
+	err = s.msgSvr.HandleOutBound(common.OutboundMsg{
+		Msg: common.Message{
+			MessageType: common.DIDRotateAckType,
+			Content:     ack,
+		},
+		Conn: ack.Connection,
+	})
+	if err != nil {
+		log.Errorf("err on HandleOutBound:%s\n", err.Error())
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
+	return
+}
+
+// DIDRotateAck rotates the connection on this side once the other party
+// rotated it
+func (s *SystemController) DIDRotateAck(ctx *gin.Context) {
+	resp := common.Gin{C: ctx}
+	data, isForward, err := common.ParseMessage(common.EnablePackage, ctx, s.packager, common.DIDRotateAckType, s.msgSvr)
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	if isForward {
+		resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
+		return
+	}
+	req, ok := data.(*message.DIDRotateAck)
+	if !ok {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, fmt.Errorf("data convert err").Error(), nil)
+		return
+	}
+	if req.Status != utils.ACK_SUCCEED {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, fmt.Errorf("got failed ACK on did rotation %s", req.Thread.ID).Error(), nil)
+		return
+	}
+	_, err = s.CompleteDIDRotation(req.Connection.TheirDid, req.Thread.ID, req.Connection.MyDid)
+	if err != nil {
+		log.Errorf("err on CompleteDIDRotation:%s\n", err.Error())
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
+	return
+}
+
+// DiscoverFeatures returns the protocols supported by the other party of a
+// connection, cached for FeaturesCacheTTL
+func (s *SystemController) DiscoverFeatures(ctx *gin.Context) {
+	resp := common.Gin{C: ctx}
+	data, isForward, err := common.ParseMessage(common.EnablePackage, ctx, s.packager, common.DiscoverFeaturesType, s.msgSvr)
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	if isForward {
+		resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
+		return
+	}
+	req, ok := data.(*message.DiscoverFeaturesRequest)
+	if !ok {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, fmt.Errorf("data convert err").Error(), nil)
+		return
+	}
+	conn, err := s.GetConnection(req.DID, req.TheirDid)
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	if !req.Refresh {
+		if rec := s.cachedFeatures(req.DID, req.TheirDid); rec != nil {
+			resp.Response(http.StatusOK, message.SUCCEED_CODE, "", featuresResponse(rec, req.Query, true))
+			return
+		}
+	}
+	rec, err := s.discoverFeatures(conn, trustPingTimeout(req.Timeout))
+	if err != nil {
+		log.Errorf("err on discoverFeatures:%s\n", err.Error())
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	resp.Response(http.StatusOK, message.SUCCEED_CODE, "", featuresResponse(rec, req.Query, false))
+	return
+}
+
+// FeaturesQuery discloses the protocols of the registered handlers matching
+// the query
+func (s *SystemController) FeaturesQuery(ctx *gin.Context) {
+	resp := common.Gin{C: ctx}
+	data, isForward, err := common.ParseMessage(common.EnablePackage, ctx, s.packager, common.FeaturesQueryType, s.msgSvr)
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	if isForward {
+		resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
+		return
+	}
+	req, ok := data.(*message.FeaturesQuery)
+	if !ok {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, fmt.Errorf("data convert err").Error(), nil)
+		return
+	}
+	err = utils.CheckConnection(req.Connection.TheirDid, req.Connection.MyDid, s.store)
+	if err != nil {
+		log.Infof("no connect found with did:%s", req.Connection.MyDid)
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	disclose := &message.FeaturesDisclose{
+		Type:       vdri.FeaturesDiscloseSpec,
+		Id:         utils.GenUUID(),
+		Thread:     message.Thread{ID: req.Id},
+		Protocols:  s.msgSvr.Protocols(req.Query),
+		Connection: common.ReverseConnection(req.Connection),
+	}
+	err = s.msgSvr.HandleOutBound(common.OutboundMsg{
+		Msg: common.Message{
+			MessageType: common.FeaturesDiscloseType,
+			Content:     disclose,
+		},
+		Conn: disclose.Connection,
+	})
+	if err != nil {
+		log.Errorf("err on HandleOutBound:%s\n", err.Error())
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
+	return
+}
+
+func (s *SystemController) FeaturesDisclose(ctx *gin.Context) {
+	resp := common.Gin{C: ctx}
+	data, isForward, err := common.ParseMessage(common.EnablePackage, ctx, s.packager, common.FeaturesDiscloseType, s.msgSvr)
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	if isForward {
+		resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
+		return
+	}
+	req, ok := data.(*message.FeaturesDisclose)
+	if !ok {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, fmt.Errorf("data convert err").Error(), nil)
+		return
+	}
+	err = utils.CheckConnection(req.Connection.TheirDid, req.Connection.MyDid, s.store)
+	if err != nil {
+		log.Infof("no connect found with did:%s", req.Connection.MyDid)
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	err = s.SaveFeatures(req.Connection.TheirDid, req.Connection.MyDid, req.Thread.ID, req.Protocols)
+	if err != nil {
+		log.Errorf("err on SaveFeatures:%s\n", err.Error())
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
+	return
+}
+
+// newConnectionRequest builds the request answering the invitation of req,
+// and returns it with the invitation
+func newConnectionRequest(req *message.AcceptInvitationRequest) (*message.ConnectionRequest, *message.Invitation, error) {
+	iv := req.Invitation
+	if req.Url != "" {
+		var err error
+		iv, err = message.ParseInvitationURL(req.Url)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if iv == nil {
+		return nil, nil, fmt.Errorf("url or invitation is required")
+	}
+	if err := message.ValidateInvitation(iv); err != nil {
+		return nil, nil, err
+	}
+	if req.MyDid == "" || len(req.MyRouter) == 0 {
+		return nil, nil, fmt.Errorf("my_did and my_router are required")
+	}
+	return &message.ConnectionRequest{
+		Type:  vdri.ConnectionRequestSpec,
+		Id:    utils.GenUUID(),
+		Label: req.Label,
+		Connection: message.Connection{
+			MyDid:       req.MyDid,
+			MyRouter:    req.MyRouter,
+			TheirDid:    iv.Did,
+			TheirRouter: iv.Router,
+		},
+		InvitationId: iv.Id,
+	}, iv, nil
+}
+
+// ReloadPolicy reloads the policy file and returns the new policy, only
+// local clients are served
+func (s *SystemController) ReloadPolicy(ctx *gin.Context) {
+	resp := common.Gin{C: ctx}
+	if !fromLoopback(ctx) {
+		ctx.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+	data, isForward, err := common.ParseMessage(common.EnablePackage, ctx, s.packager, common.ReloadPolicyType, s.msgSvr)
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	if isForward {
+		resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
+		return
+	}
+	if _, ok := data.(*message.ReloadPolicyRequest); !ok {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, fmt.Errorf("data convert err").Error(), nil)
+		return
+	}
+	engine := s.msgSvr.Policy()
+	if engine == nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, "no policy file", nil)
+		return
+	}
+	p, err := engine.Reload()
+	if err != nil {
+		log.Errorf("err on ReloadPolicy:%s\n", err.Error())
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	resp.Response(http.StatusOK, message.SUCCEED_CODE, "", p)
+}
+
+// RegisterMediation registers a DID the agent forwards messages for, only local clients are served
+func (s *SystemController) RegisterMediation(ctx *gin.Context) {
+	resp := common.Gin{C: ctx}
+	if !fromLoopback(ctx) {
+		ctx.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+	data, isForward, err := common.ParseMessage(common.EnablePackage, ctx, s.packager, common.RegisterMediationType, s.msgSvr)
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	if isForward {
+		resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
+		return
+	}
+	req, ok := data.(*message.RegisterMediationRequest)
+	if !ok {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, fmt.Errorf("data convert err").Error(), nil)
+		return
+	}
+	rec, err := s.SaveMediation(req)
+	if err != nil {
+		log.Errorf("err on SaveMediation:%s\n", err.Error())
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	resp.Response(http.StatusOK, message.SUCCEED_CODE, "", rec)
+}
+
+// RemoveMediation stops forwarding messages for a DID, only local clients are served
+func (s *SystemController) RemoveMediation(ctx *gin.Context) {
+	resp := common.Gin{C: ctx}
+	if !fromLoopback(ctx) {
+		ctx.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+	data, isForward, err := common.ParseMessage(common.EnablePackage, ctx, s.packager, common.RemoveMediationType, s.msgSvr)
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	if isForward {
+		resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
+		return
+	}
+	req, ok := data.(*message.RemoveMediationRequest)
+	if !ok {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, fmt.Errorf("data convert err").Error(), nil)
+		return
+	}
+	err = s.RemoveMediationInStore(req.TheirDid)
+	if err != nil {
+		log.Errorf("err on RemoveMediationInStore:%s\n", err.Error())
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
+}
+
+// QueryForwardUsage lists what was forwarded for a DID by day, only local clients are served
+func (s *SystemController) QueryForwardUsage(ctx *gin.Context) {
+	resp := common.Gin{C: ctx}
+	if !fromLoopback(ctx) {
+		ctx.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+	data, isForward, err := common.ParseMessage(common.EnablePackage, ctx, s.packager, common.QueryForwardUsageType, s.msgSvr)
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	if isForward {
+		resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
+		return
+	}
+	req, ok := data.(*message.QueryForwardUsageRequest)
+	if !ok {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, fmt.Errorf("data convert err").Error(), nil)
+		return
+	}
+	ret, err := s.QueryForwardUsageFromStore(req)
+	if err != nil {
+		log.Errorf("err on QueryForwardUsageFromStore:%s\n", err.Error())
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	resp.Response(http.StatusOK, message.SUCCEED_CODE, "", ret)
+}
+
+// RequestMediation asks a connection to mediate for the did and returns
+// the grant or deny, only local clients are served
+func (s *SystemController) RequestMediation(ctx *gin.Context) {
+	resp := common.Gin{C: ctx}
+	if !fromLoopback(ctx) {
+		ctx.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+	data, isForward, err := common.ParseMessage(common.EnablePackage, ctx, s.packager, common.RequestMediationType, s.msgSvr)
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	if isForward {
+		resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
+		return
+	}
+	req, ok := data.(*message.RequestMediationRequest)
+	if !ok {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, fmt.Errorf("data convert err").Error(), nil)
+		return
+	}
+	conn, err := s.GetConnection(req.DID, req.TheirDid)
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	rec, err := s.requestMediation(conn, trustPingTimeout(req.Timeout))
+	if err != nil {
+		log.Errorf("err on requestMediation:%s\n", err.Error())
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	resp.Response(http.StatusOK, message.SUCCEED_CODE, "", rec)
+	return
+}
+
+// MediateRequest grants or denies a connection to forward messages for it
+func (s *SystemController) MediateRequest(ctx *gin.Context) {
+	resp := common.Gin{C: ctx}
+	data, isForward, err := common.ParseMessage(common.EnablePackage, ctx, s.packager, common.MediateRequestType, s.msgSvr)
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	if isForward {
+		resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
+		return
+	}
+	req, ok := data.(*message.MediateRequest)
+	if !ok {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, fmt.Errorf("data convert err").Error(), nil)
+		return
+	}
+	err = utils.CheckConnection(req.Connection.TheirDid, req.Connection.MyDid, s.store)
+	if err != nil {
+		log.Infof("no connect found with did:%s", req.Connection.MyDid)
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	var answer interface{}
+	msgType := common.MediateGrantType
+	thread := message.Thread{ID: req.Id}
+	reply := common.ReverseConnection(req.Connection)
+	router, err := s.mediatorRouter(req.Connection.TheirDid, req.Connection.MyDid)
+	if err == nil {
+		err = s.grantMediation(req.Connection.MyDid)
+	}
+	if err == nil {
+		answer = &message.MediateGrant{
+			Type:       vdri.MediateGrantSpec,
+			Id:         utils.GenUUID(),
+			Thread:     thread,
+			Router:     router,
+			Connection: reply,
+		}
+	} else {
+		log.Infof("mediation denied to %s:%s", req.Connection.MyDid, err.Error())
+		msgType = common.MediateDenyType
+		answer = &message.MediateDeny{
+			Type:       vdri.MediateDenySpec,
+			Id:         utils.GenUUID(),
+			Thread:     thread,
+			Comment:    err.Error(),
+			Connection: reply,
+		}
+	}
+	err = s.msgSvr.HandleOutBound(common.OutboundMsg{
+		Msg: common.Message{
+			MessageType: msgType,
+			Content:     answer,
+		},
+		Conn: reply,
+	})
+	if err != nil {
+		log.Errorf("err on HandleOutBound:%s\n", err.Error())
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
+	return
+}
+
+func (s *SystemController) MediateGrant(ctx *gin.Context) {
+	resp := common.Gin{C: ctx}
+	data, isForward, err := common.ParseMessage(common.EnablePackage, ctx, s.packager, common.MediateGrantType, s.msgSvr)
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	if isForward {
+		resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
+		return
+	}
+	req, ok := data.(*message.MediateGrant)
+	if !ok {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, fmt.Errorf("data convert err").Error(), nil)
+		return
+	}
+	err = utils.CheckConnection(req.Connection.TheirDid, req.Connection.MyDid, s.store)
+	if err != nil {
+		log.Infof("no connect found with did:%s", req.Connection.MyDid)
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	err = s.SaveMediationAnswer(req.Connection.TheirDid, req.Connection.MyDid, req.Thread.ID, message.MediationGranted, req.Router, "")
+	if err != nil {
+		log.Errorf("err on SaveMediationAnswer:%s\n", err.Error())
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
+	return
+}
+
+func (s *SystemController) MediateDeny(ctx *gin.Context) {
+	resp := common.Gin{C: ctx}
+	data, isForward, err := common.ParseMessage(common.EnablePackage, ctx, s.packager, common.MediateDenyType, s.msgSvr)
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	if isForward {
+		resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
+		return
+	}
+	req, ok := data.(*message.MediateDeny)
+	if !ok {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, fmt.Errorf("data convert err").Error(), nil)
+		return
+	}
+	err = utils.CheckConnection(req.Connection.TheirDid, req.Connection.MyDid, s.store)
+	if err != nil {
+		log.Infof("no connect found with did:%s", req.Connection.MyDid)
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	err = s.SaveMediationAnswer(req.Connection.TheirDid, req.Connection.MyDid, req.Thread.ID, message.MediationDenied, nil, req.Comment)
+	if err != nil {
+		log.Errorf("err on SaveMediationAnswer:%s\n", err.Error())
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
+	return
+}
+
+// UpdateKeylist changes the DIDs a mediator forwards for besides the did and
+// returns the mediation with its keys, only local clients are served
+func (s *SystemController) UpdateKeylist(ctx *gin.Context) {
+	resp := common.Gin{C: ctx}
+	if !fromLoopback(ctx) {
+		ctx.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+	data, isForward, err := common.ParseMessage(common.EnablePackage, ctx, s.packager, common.UpdateKeylistType, s.msgSvr)
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	if isForward {
+		resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
+		return
+	}
+	req, ok := data.(*message.UpdateKeylistRequest)
+	if !ok {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, fmt.Errorf("data convert err").Error(), nil)
+		return
+	}
+	conn, err := s.GetConnection(req.DID, req.TheirDid)
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	rec, err := s.sendKeylistUpdate(conn, req.Add, req.Remove, trustPingTimeout(req.Timeout))
+	if err != nil {
+		log.Errorf("err on sendKeylistUpdate:%s\n", err.Error())
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	resp.Response(http.StatusOK, message.SUCCEED_CODE, "", rec)
+	return
+}
+
+// KeylistUpdate changes the keylist of a connection granted mediation
+func (s *SystemController) KeylistUpdate(ctx *gin.Context) {
+	resp := common.Gin{C: ctx}
+	data, isForward, err := common.ParseMessage(common.EnablePackage, ctx, s.packager, common.KeylistUpdateType, s.msgSvr)
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	if isForward {
+		resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
+		return
+	}
+	req, ok := data.(*message.KeylistUpdate)
+	if !ok {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, fmt.Errorf("data convert err").Error(), nil)
+		return
+	}
+	err = utils.CheckConnection(req.Connection.TheirDid, req.Connection.MyDid, s.store)
+	if err != nil {
+		log.Infof("no connect found with did:%s", req.Connection.MyDid)
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	updated, err := s.UpdateKeylistInStore(req.Connection.MyDid, req.Updates)
+	if err != nil {
+		log.Errorf("err on UpdateKeylistInStore:%s\n", err.Error())
+		s.msgSvr.SendProblemReport(req.Connection, req.Id, common.ProblemMediationNotGranted, err)
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	response := &message.KeylistUpdateResponse{
+		Type:       vdri.KeylistResponseSpec,
+		Id:         utils.GenUUID(),
+		Thread:     message.Thread{ID: req.Id},
+		Updated:    updated,
+		Connection: common.ReverseConnection(req.Connection),
+	}
+	err = s.msgSvr.HandleOutBound(common.OutboundMsg{
+		Msg: common.Message{
+			MessageType: common.KeylistResponseType,
+			Content:     response,
+		},
+		Conn: response.Connection,
+	})
+	if err != nil {
+		log.Errorf("err on HandleOutBound:%s\n", err.Error())
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
+	return
+}
+
+func (s *SystemController) KeylistResponse(ctx *gin.Context) {
+	resp := common.Gin{C: ctx}
+	data, isForward, err := common.ParseMessage(common.EnablePackage, ctx, s.packager, common.KeylistResponseType, s.msgSvr)
+	if err != nil {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	if isForward {
+		resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
+		return
+	}
+	req, ok := data.(*message.KeylistUpdateResponse)
+	if !ok {
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, fmt.Errorf("data convert err").Error(), nil)
+		return
+	}
+	err = utils.CheckConnection(req.Connection.TheirDid, req.Connection.MyDid, s.store)
+	if err != nil {
+		log.Infof("no connect found with did:%s", req.Connection.MyDid)
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	err = s.SaveKeylistResponse(req.Connection.TheirDid, req.Connection.MyDid, req.Thread.ID, req.Updated)
+	if err != nil {
+		log.Errorf("err on SaveKeylistResponse:%s\n", err.Error())
+		resp.Response(http.StatusOK, message.ERROR_CODE_INNER, err.Error(), nil)
+		return
+	}
+	resp.Response(http.StatusOK, message.SUCCEED_CODE, "", nil)
+	return
+}
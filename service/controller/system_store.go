@@ -19,198 +19,344 @@
 package controller
 
 import (
-	"encoding/json"
 	"fmt"
+	"math"
+	"time"
+
 	"github.com/ontio/mercury/common/log"
 
 	"github.com/ontio/mercury/common/message"
+	"github.com/ontio/mercury/store"
 	"github.com/ontio/mercury/utils"
+	"github.com/ontio/mercury/vdri"
 )
 
 func (s *SystemController) SaveInvitation(iv message.Invitation) error {
-	key := fmt.Sprintf("%s_%s_%s", utils.InvitationKey, iv.Did, iv.Id)
-	b, err := s.store.Has([]byte(key))
-	if err != nil {
-		return err
+	return s.SaveInvitationWithPolicy(iv, message.InvitationPolicy{})
+}
+
+// SaveInvitationWithPolicy stores a new invitation whose uses are limited
+// by policy
+func (s *SystemController) SaveInvitationWithPolicy(iv message.Invitation, policy message.InvitationPolicy) error {
+	if policy.MaxUses < 0 || (!policy.MultiUse && policy.MaxUses > 1) {
+		return fmt.Errorf("invalid max uses %d", policy.MaxUses)
 	}
-	if b {
-		return fmt.Errorf("invitation with id:%s existed", iv.Id)
+	if policy.ExpireAt > 0 && policy.ExpireAt <= time.Now().Unix() {
+		return fmt.Errorf("invitation expires in the past")
 	}
-	rec := message.InvitationRec{
+	key := store.Key(utils.InvitationKey, iv.Did, iv.Id)
+	rec := &message.InvitationRec{
 		Invitation: iv,
 		State:      message.InvitationInit,
+		Policy:     policy,
+		Created:    time.Now().Unix(),
 	}
-	bs, err := json.Marshal(rec)
+	data, err := store.EncodeRecord(rec, invitationExpireAt(rec))
 	if err != nil {
 		return err
 	}
-	return s.store.Put([]byte(key), bs)
+	ok, err := s.store.CompareAndSwap(key, nil, data)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("invitation with id:%s existed", iv.Id)
+	}
+	return nil
 }
 
-func (s SystemController) GetInvitation(did, id string) (*message.InvitationRec, error) {
-	key := []byte(fmt.Sprintf("%s_%s_%s", utils.InvitationKey, did, id))
-	data, err := s.store.Get(key)
+// invitationExpireAt keeps a usable multi use invitation until it expires,
+// other invitations follow the retention of invitations
+func invitationExpireAt(rec *message.InvitationRec) int64 {
+	if rec.Revoked {
+		return 0
+	}
+	if rec.Policy.ExpireAt > 0 {
+		return rec.Policy.ExpireAt
+	}
+	if rec.Policy.MultiUse && (rec.Policy.MaxUses == 0 || rec.Uses < rec.Policy.MaxUses) {
+		return store.NeverExpire
+	}
+	return 0
+}
+
+// maxUpdateRetries bounds the attempts of an update losing the race against
+// other writers of the record
+const maxUpdateRetries = 16
+
+// NewInvitation creates and saves an invitation to connect to req.Did, the
+// self did of the agent by default
+func (s *SystemController) NewInvitation(req *message.CreateInvitationRequest) (*message.Invitation, error) {
+	if len(req.Router) == 0 && req.Mediator == "" {
+		return nil, fmt.Errorf("router is required")
+	}
+	protocols, err := handshakeProtocols(req.HandshakeProtocols)
 	if err != nil {
 		return nil, err
 	}
+	iv := message.Invitation{
+		Type:               vdri.InvitationSpec,
+		Id:                 utils.GenUUID(),
+		Label:              req.Label,
+		Did:                req.Did,
+		Router:             req.Router,
+		HandshakeProtocols: protocols,
+	}
+	if iv.Did == "" {
+		iv.Did = s.msgSvr.Cfg.SelfDID
+	}
+	if req.Mediator != "" {
+		grant, err := s.GetMediationGrant(iv.Did, req.Mediator)
+		if err != nil {
+			return nil, err
+		}
+		if grant.State != message.MediationGranted {
+			return nil, fmt.Errorf("mediation by %s is %s", req.Mediator, grant.State)
+		}
+		iv.Router = append(append([]string{}, req.Router...), grant.Router...)
+	}
+	if err = s.SaveInvitationWithPolicy(iv, req.Policy); err != nil {
+		return nil, err
+	}
+	return &iv, nil
+}
+
+func (s SystemController) GetInvitation(did, id string) (*message.InvitationRec, error) {
+	key := store.Key(utils.InvitationKey, did, id)
 	rec := new(message.InvitationRec)
-	err = json.Unmarshal(data, rec)
+	err := store.GetRecord(s.store, key, rec)
 	if err != nil {
 		return nil, err
 	}
 	return rec, nil
 }
 
-func (s SystemController) UpdateInvitation(did, id string, state message.ConnectionState) error {
-	key := []byte(fmt.Sprintf("%s_%s_%s", utils.InvitationKey, did, id))
-	data, err := s.store.Get(key)
+// UseInvitation counts one use of an invitation with a handshake protocol
+// if its policy allows it, concurrent uses of a multi use invitation are all
+// counted
+func (s *SystemController) UseInvitation(did, id, protocol string) (*message.InvitationRec, error) {
+	return s.updateInvitation(did, id, func(rec *message.InvitationRec) error {
+		if err := rec.Check(time.Now()); err != nil {
+			return err
+		}
+		if !acceptsProtocol(&rec.Invitation, protocol) {
+			return fmt.Errorf("invitation %s doesn't accept %s", id, protocol)
+		}
+		rec.Uses++
+		rec.State = message.InvitationUsed
+		return nil
+	})
+}
+
+// ReleaseInvitation gives back a use counted by UseInvitation, when the
+// connection request couldn't be accepted after all
+func (s *SystemController) ReleaseInvitation(did, id string) {
+	_, err := s.updateInvitation(did, id, func(rec *message.InvitationRec) error {
+		if rec.Uses > 0 {
+			rec.Uses--
+		}
+		if rec.Uses == 0 {
+			rec.State = message.InvitationInit
+		}
+		return nil
+	})
 	if err != nil {
-		return err
+		log.Errorf("err on ReleaseInvitation %s:%s", id, err.Error())
 	}
-	rec := new(message.InvitationRec)
-	err = json.Unmarshal(data, rec)
+}
+
+// abandonConnectionRequest cancels a saved request which couldn't be
+// answered and gives back its invitation use
+func (s *SystemController) abandonConnectionRequest(did, invitationId, requestId string) {
+	if _, err := s.CancelConnectionRequestInStore(did, requestId); err != nil {
+		log.Errorf("err on CancelConnectionRequestInStore %s:%s", requestId, err.Error())
+	}
+	s.ReleaseInvitation(did, invitationId)
+}
+
+// reportConnectionProblem answers a message on the connection request id
+// with a problem report. Nothing is sent unless the request is saved with
+// the sender of the message, so an unknown party can't have reports sent
+// to routers of its choice.
+func (s *SystemController) reportConnectionProblem(conn message.Connection, id, code string, reason error) {
+	rec, err := s.GetConnectionRequest(conn.TheirDid, id)
 	if err != nil {
-		return err
+		log.Infof("no problem report on unknown connection request %s:%s", id, reason)
+		return
 	}
-	//fixme introduce some FSM
-	if rec.State >= state {
-		return fmt.Errorf("error state with id:%s", id)
+	peer := rec.ConnReq.Connection.MyDid
+	if peer == conn.TheirDid {
+		peer = rec.ConnReq.Connection.TheirDid
 	}
-	rec.State = state
-	bts, err := json.Marshal(rec)
-	if err != nil {
-		return err
+	if peer != conn.MyDid {
+		log.Infof("no problem report on connection request %s from %s:%s", id, conn.MyDid, reason)
+		return
 	}
-	return s.store.Put(key, bts)
+	s.msgSvr.SendProblemReport(conn, id, code, reason)
 }
 
-func (s SystemController) SaveConnectionRequest(cr message.ConnectionRequest, state message.ConnectionState) error {
-	key := []byte(fmt.Sprintf("%s_%s_%s", utils.ConnectionReqKey, cr.Connection.TheirDid, cr.Id))
-	b, err := s.store.Has(key)
-	if err != nil {
-		return err
-	}
-	if b {
-		return fmt.Errorf("connection request with id:%s existed", cr.Id)
+// RevokeInvitationInStore stops an invitation from accepting connection
+// requests
+func (s *SystemController) RevokeInvitationInStore(did, id string) (*message.InvitationRec, error) {
+	return s.updateInvitation(did, id, func(rec *message.InvitationRec) error {
+		rec.Revoked = true
+		return nil
+	})
+}
+
+func (s *SystemController) updateInvitation(did, id string, update func(rec *message.InvitationRec) error) (*message.InvitationRec, error) {
+	key := store.Key(utils.InvitationKey, did, id)
+	for i := 0; i < maxUpdateRetries; i++ {
+		old, err := s.store.Get(key)
+		if err != nil {
+			return nil, err
+		}
+		rec := new(message.InvitationRec)
+		if _, err = store.DecodeRecord(old, rec); err != nil {
+			return nil, err
+		}
+		if err = update(rec); err != nil {
+			return nil, err
+		}
+		data, err := store.EncodeRecord(rec, invitationExpireAt(rec))
+		if err != nil {
+			return nil, err
+		}
+		ok, err := s.store.CompareAndSwap(key, old, data)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return rec, nil
+		}
 	}
-	rec := message.ConnectionRequestRec{
+	return nil, fmt.Errorf("invitation %s is busy, try again", id)
+}
+
+func (s SystemController) SaveConnectionRequest(cr message.ConnectionRequest, state message.ConnectionState) error {
+	return s.saveConnectionRequestRec(cr.Connection.TheirDid, &message.ConnectionRequestRec{
 		ConnReq: cr,
 		State:   state,
-	}
+	})
+}
 
-	bs, err := json.Marshal(rec)
+func (s SystemController) saveConnectionRequestRec(did string, rec *message.ConnectionRequestRec) error {
+	key := store.Key(utils.ConnectionReqKey, did, rec.ConnReq.Id)
+	rec.Created = time.Now().Unix()
+	data, err := store.NewRecord(rec)
 	if err != nil {
 		return err
 	}
-	return s.store.Put(key, bs)
+	ok, err := s.store.CompareAndSwap(key, nil, data)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("connection request with id:%s existed", rec.ConnReq.Id)
+	}
+	return nil
 }
 
 func (s SystemController) GetConnectionRequest(did, id string) (*message.ConnectionRequestRec, error) {
-	key := []byte(fmt.Sprintf("%s_%s_%s", utils.ConnectionReqKey, did, id))
-	data, err := s.store.Get(key)
-	if err != nil {
-		return nil, err
-	}
+	key := store.Key(utils.ConnectionReqKey, did, id)
 	cr := new(message.ConnectionRequestRec)
-	err = json.Unmarshal(data, cr)
+	err := store.GetRecord(s.store, key, cr)
 	if err != nil {
 		return nil, err
 	}
 	return cr, nil
 }
 
-func (s *SystemController) SaveConnection(con message.Connection) error {
+// SaveConnection saves a connection, label is the label of the other party
+// and is kept when empty
+func (s *SystemController) SaveConnection(con message.Connection, label string) error {
 	log.Infof("===GetConnection:myDid:%s,theirDid:%s===", con.MyDid, con.TheirDid)
+	key := store.Key(utils.ConnectionKey, con.MyDid, con.TheirDid)
 	cr := new(message.ConnectionRec)
-	key := []byte(fmt.Sprintf("%s_%s", utils.ConnectionKey, con.MyDid))
-	exist, err := s.store.Has(key)
-	if err != nil {
+	err := store.GetRecord(s.store, key, cr)
+	if err != nil && err != store.ErrNotFound {
 		return err
 	}
-
-	if exist {
-		data, err := s.store.Get(key)
-		if err != nil {
-			return err
-		}
-		err = json.Unmarshal(data, cr)
-		if err != nil {
-			return err
-		}
-		cr.Connections[con.TheirDid] = con
-	} else {
+	if err == store.ErrNotFound {
 		cr.OwnerDID = con.MyDid
-		m := make(map[string]message.Connection)
-		m[con.TheirDid] = con
-		cr.Connections = m
+		cr.Timestamp = time.Now()
+		cr.Alias = label
 	}
-	bts, err := json.Marshal(cr)
-	if err != nil {
-		return err
+	cr.Connection = con
+	if label != "" {
+		cr.Label = label
 	}
-	return s.store.Put(key, bts)
+	return store.PutRecord(s.store, key, cr)
 }
 
 func (s *SystemController) UpdateConnectionRequest(did, id string, state message.ConnectionState) error {
-	key := []byte(fmt.Sprintf("%s_%s_%s", utils.ConnectionReqKey, did, id))
-	data, err := s.store.Get(key)
-	if err != nil {
-		return err
-	}
-	rec := new(message.ConnectionRequestRec)
-	err = json.Unmarshal(data, rec)
-	if err != nil {
-		return err
-	}
-	if rec.State >= state {
-		return fmt.Errorf("error state with id:%s", id)
-	}
-	rec.State = state
-	bts, err := json.Marshal(rec)
-	if err != nil {
-		return err
+	_, err := s.updateConnectionRequest(did, id, func(rec *message.ConnectionRequestRec) error {
+		if rec.State >= state {
+			return fmt.Errorf("error state with id:%s", id)
+		}
+		rec.State = state
+		return nil
+	})
+	return err
+}
+
+// updateConnectionRequest applies update to a connection request which is
+// not cancelled
+func (s *SystemController) updateConnectionRequest(did, id string, update func(rec *message.ConnectionRequestRec) error) (*message.ConnectionRequestRec, error) {
+	key := store.Key(utils.ConnectionReqKey, did, id)
+	for i := 0; i < maxUpdateRetries; i++ {
+		old, err := s.store.Get(key)
+		if err != nil {
+			return nil, err
+		}
+		rec := new(message.ConnectionRequestRec)
+		if _, err = store.DecodeRecord(old, rec); err != nil {
+			return nil, err
+		}
+		if rec.Cancelled {
+			return nil, fmt.Errorf("connection request %s is cancelled", id)
+		}
+		if err = update(rec); err != nil {
+			return nil, err
+		}
+		data, err := store.NewRecord(rec)
+		if err != nil {
+			return nil, err
+		}
+		ok, err := s.store.CompareAndSwap(key, old, data)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return rec, nil
+		}
 	}
-	return s.store.Put(key, bts)
+	return nil, fmt.Errorf("connection request %s is busy, try again", id)
 }
 
 func (s *SystemController) GetConnection(myDID, theirDID string) (message.Connection, error) {
 	log.Infof("===GetConnection:myDid:%s,theirDid:%s===", myDID, theirDID)
-	key := []byte(fmt.Sprintf("%s_%s", utils.ConnectionKey, myDID))
-	data, err := s.store.Get(key)
-	if err != nil {
-		return message.Connection{}, err
-	}
+	key := store.Key(utils.ConnectionKey, myDID, theirDID)
 	cr := new(message.ConnectionRec)
-	err = json.Unmarshal(data, cr)
+	err := store.GetRecord(s.store, key, cr)
+	if err == store.ErrNotFound {
+		return message.Connection{}, fmt.Errorf("connection not found!")
+	}
 	if err != nil {
 		return message.Connection{}, err
 	}
-	c, ok := cr.Connections[theirDID]
-	if !ok {
-		return message.Connection{}, fmt.Errorf("connection not found!")
-	}
-
-	return c, nil
+	return cr.Connection, nil
 }
 
 func (s *SystemController) DeleteConnection(myDID, theirDID string) error {
-	key := []byte(fmt.Sprintf("%s_%s", utils.ConnectionKey, myDID))
+	key := store.Key(utils.ConnectionKey, myDID, theirDID)
+	return s.store.Delete(key)
+}
 
-	data, err := s.store.Get(key)
-	if err != nil {
-		return err
-	}
-	cr := new(message.ConnectionRec)
-	err = json.Unmarshal(data, cr)
-	if err != nil {
-		return err
-	}
-	delete(cr.Connections, theirDID)
-	data, err = json.Marshal(cr)
-	if err != nil {
-		return err
-	}
-	return s.store.Put(key, data)
+// basicMsgKey orders the messages of a did newest first, so reading the
+// latest messages doesn't scan the whole history
+func basicMsgKey(did string, t time.Time, id string) []byte {
+	return store.Key(utils.BasicMsgKey, did, fmt.Sprintf("%020d", math.MaxInt64-t.UnixNano()), id)
 }
 
 func (s *SystemController) SaveBasicMsgToStore(m *message.BasicMessage, send bool) error {
@@ -220,90 +366,71 @@ func (s *SystemController) SaveBasicMsgToStore(m *message.BasicMessage, send boo
 	} else {
 		did = m.Connection.TheirDid
 	}
-	key := []byte(fmt.Sprintf("%s_%s", utils.BasicMsgKey, did))
-	b, err := s.store.Has(key)
-	if err != nil {
-		return err
+	id := m.Id
+	if id == "" {
+		id = utils.GenUUID()
 	}
-	rec := new(message.BasicMsgRec)
-	if b {
-		data, err := s.store.Get(key)
-		if err != nil {
-			return err
+	return store.PutRecord(s.store, basicMsgKey(did, time.Now(), id), m)
+}
+
+// QueryBasicMsgFromStore returns messages of did oldest first. Offset and limit
+// page from the latest message backwards, latest returns only the latest one.
+func (s *SystemController) QueryBasicMsgFromStore(did string, latest bool, removeAfterRead bool, offset, limit int) ([]message.BasicMessage, error) {
+	if latest {
+		offset, limit = 0, 1
+	}
+	keys := make([][]byte, 0)
+	msgs := make([]message.BasicMessage, 0)
+	iter := s.store.NewIterator(store.KeyPrefix(utils.BasicMsgKey, did))
+	defer iter.Release()
+	for i := 0; iter.Next(); i++ {
+		if i < offset {
+			continue
+		}
+		if limit > 0 && len(msgs) >= limit {
+			break
 		}
-		err = json.Unmarshal(data, rec)
+		var m message.BasicMessage
+		_, err := store.DecodeRecord(iter.Value(), &m)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		rec.Msglist = append(rec.Msglist, *m)
-	} else {
-		rec.Msglist = []message.BasicMessage{*m}
-	}
-	data, err := json.Marshal(rec)
-	if err != nil {
-		return err
+		keys = append(keys, append([]byte{}, iter.Key()...))
+		msgs = append(msgs, m)
 	}
-	return s.store.Put(key, data)
-}
-
-func (s *SystemController) QueryBasicMsgFromStore(did string, latest bool, removeAfterRead bool) ([]message.BasicMessage, error) {
-	key := []byte(fmt.Sprintf("%s_%s", utils.BasicMsgKey, did))
-	b, err := s.store.Has(key)
-	if err != nil {
+	if err := iter.Error(); err != nil {
 		return nil, err
 	}
-	if !b {
+	if len(msgs) == 0 {
 		return nil, nil
 	}
-	data, err := s.store.Get(key)
-	if err != nil {
-		return nil, err
-	}
-	rec := new(message.BasicMsgRec)
-	err = json.Unmarshal(data, rec)
-	if err != nil {
-		return nil, err
-	}
-	if rec.Msglist == nil || len(rec.Msglist) == 0 {
-		return nil, nil
-	}
-	var retlist []message.BasicMessage
-	if latest {
-		retlist = rec.Msglist[len(rec.Msglist)-1:]
-		if removeAfterRead {
-			rec.Msglist = rec.Msglist[0 : len(rec.Msglist)-1]
-			data, err := json.Marshal(rec)
-			if err != nil {
-				return nil, err
-			}
-			err = s.store.Put(key, data)
-			if err != nil {
-				return nil, err
-			}
+	if removeAfterRead {
+		batch := store.NewBatch()
+		for _, key := range keys {
+			batch.Delete(key)
 		}
-	} else {
-		retlist = rec.Msglist
-		if removeAfterRead {
-			err = s.store.Delete(key)
-			if err != nil {
-				return nil, err
-			}
+		err := s.store.Write(batch)
+		if err != nil {
+			return nil, err
 		}
 	}
-	return retlist, nil
+	for i, j := 0, len(msgs)-1; i < j; i, j = i+1, j-1 {
+		msgs[i], msgs[j] = msgs[j], msgs[i]
+	}
+	return msgs, nil
 }
 
 func (s *SystemController) QueryConnectsFromStore(did string) (map[string]message.Connection, error) {
-	key := []byte(fmt.Sprintf("%s_%s", utils.ConnectionKey, did))
-	data, err := s.store.Get(key)
-	if err != nil {
-		return nil, err
-	}
-	rec := &message.ConnectionRec{}
-	err = json.Unmarshal(data, rec)
-	if err != nil {
-		return nil, err
+	conns := make(map[string]message.Connection)
+	iter := s.store.NewIterator(store.KeyPrefix(utils.ConnectionKey, did))
+	defer iter.Release()
+	for iter.Next() {
+		cr := new(message.ConnectionRec)
+		_, err := store.DecodeRecord(iter.Value(), cr)
+		if err != nil {
+			return nil, err
+		}
+		conns[cr.Connection.TheirDid] = cr.Connection
 	}
-	return rec.Connections, nil
-
+	return conns, iter.Error()
 }
@@ -0,0 +1,189 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package controller
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ontio/mercury/common/config"
+	"github.com/ontio/mercury/common/message"
+	"github.com/ontio/mercury/service/common"
+	"github.com/ontio/mercury/store"
+	leveldb "github.com/ontio/mercury/store/leveldb"
+	"github.com/ontio/mercury/utils"
+	"github.com/ontio/mercury/vdri"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBasicMsgPaging(t *testing.T) {
+	db, err := leveldb.NewMemStore()
+	assert.Nil(t, err)
+	defer db.Close()
+	s := &SystemController{store: db}
+
+	conn := message.Connection{MyDid: "did:ont:alice", TheirDid: "did:ont:bob"}
+	for i := 0; i < 5; i++ {
+		err = s.SaveBasicMsgToStore(&message.BasicMessage{
+			Id:         fmt.Sprintf("m%d", i),
+			Content:    fmt.Sprintf("%d", i),
+			Connection: conn,
+		}, true)
+		assert.Nil(t, err)
+	}
+
+	msgs, err := s.QueryBasicMsgFromStore("did:ont:alice", false, false, 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, len(msgs))
+	assert.Equal(t, "0", msgs[0].Content)
+
+	msgs, err = s.QueryBasicMsgFromStore("did:ont:alice", false, false, 1, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(msgs))
+	assert.Equal(t, "2", msgs[0].Content)
+	assert.Equal(t, "3", msgs[1].Content)
+
+	msgs, err = s.QueryBasicMsgFromStore("did:ont:alice", true, true, 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(msgs))
+	assert.Equal(t, "4", msgs[0].Content)
+	msgs, err = s.QueryBasicMsgFromStore("did:ont:alice", true, false, 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, "3", msgs[0].Content)
+}
+
+func TestConnectionRecords(t *testing.T) {
+	db, err := leveldb.NewMemStore()
+	assert.Nil(t, err)
+	defer db.Close()
+	s := &SystemController{store: db}
+
+	assert.Nil(t, s.SaveConnection(message.Connection{MyDid: "did:ont:alice", TheirDid: "did:ont:bob"}, ""))
+	assert.Nil(t, s.SaveConnection(message.Connection{MyDid: "did:ont:alice", TheirDid: "did:ont:carol"}, ""))
+	conns, err := s.QueryConnectsFromStore("did:ont:alice")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(conns))
+
+	assert.Nil(t, s.DeleteConnection("did:ont:alice", "did:ont:bob"))
+	_, err = s.GetConnection("did:ont:alice", "did:ont:bob")
+	assert.NotNil(t, err)
+	c, err := s.GetConnection("did:ont:alice", "did:ont:carol")
+	assert.Nil(t, err)
+	assert.Equal(t, "did:ont:carol", c.TheirDid)
+}
+
+func TestNewInvitation(t *testing.T) {
+	db, err := leveldb.NewMemStore()
+	assert.Nil(t, err)
+	defer db.Close()
+	s := &SystemController{store: db, msgSvr: &common.MsgService{Cfg: &config.Cfg{SelfDID: "did:ont:agent"}}}
+
+	_, err = s.NewInvitation(&message.CreateInvitationRequest{})
+	assert.NotNil(t, err)
+	iv, err := s.NewInvitation(&message.CreateInvitationRequest{Router: []string{"did:ont:agent#1"}})
+	assert.Nil(t, err)
+	assert.Equal(t, "did:ont:agent", iv.Did)
+	rec, err := s.GetInvitation("did:ont:agent", iv.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, message.InvitationInit, rec.State)
+
+	u, err := message.InvitationURL("http://127.0.0.1:8080", iv)
+	assert.Nil(t, err)
+	cr, _, err := newConnectionRequest(&message.AcceptInvitationRequest{
+		Url:      u,
+		MyDid:    "did:ont:bob",
+		MyRouter: []string{"did:ont:bob#1"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, iv.Id, cr.InvitationId)
+	assert.Equal(t, "did:ont:agent", cr.Connection.TheirDid)
+	assert.Equal(t, iv.Router, cr.Connection.TheirRouter)
+}
+
+func TestInvitationPolicy(t *testing.T) {
+	db, err := leveldb.NewMemStore()
+	assert.Nil(t, err)
+	defer db.Close()
+	s := &SystemController{store: db, msgSvr: &common.MsgService{Cfg: &config.Cfg{SelfDID: "did:ont:agent"}}}
+	router := []string{"did:ont:agent#1"}
+
+	single, err := s.NewInvitation(&message.CreateInvitationRequest{Router: router})
+	assert.Nil(t, err)
+	_, err = s.UseInvitation(single.Did, single.Id, vdri.ConnectionsProtocol)
+	assert.Nil(t, err)
+	_, err = s.UseInvitation(single.Did, single.Id, vdri.ConnectionsProtocol)
+	assert.NotNil(t, err)
+	// a use given back after a failed request can be used again
+	s.ReleaseInvitation(single.Did, single.Id)
+	_, err = s.UseInvitation(single.Did, single.Id, vdri.ConnectionsProtocol)
+	assert.Nil(t, err)
+
+	limited, err := s.NewInvitation(&message.CreateInvitationRequest{
+		Router: router,
+		Policy: message.InvitationPolicy{MultiUse: true, MaxUses: 2},
+	})
+	assert.Nil(t, err)
+	for i := 0; i < 2; i++ {
+		_, err = s.UseInvitation(limited.Did, limited.Id, vdri.ConnectionsProtocol)
+		assert.Nil(t, err)
+	}
+	_, err = s.UseInvitation(limited.Did, limited.Id, vdri.ConnectionsProtocol)
+	assert.NotNil(t, err)
+
+	// every concurrent use of an unlimited invitation is counted
+	open, err := s.NewInvitation(&message.CreateInvitationRequest{Router: router, Policy: message.InvitationPolicy{MultiUse: true}})
+	assert.Nil(t, err)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.UseInvitation(open.Did, open.Id, vdri.ConnectionsProtocol)
+			assert.Nil(t, err)
+		}()
+	}
+	wg.Wait()
+	rec, err := s.GetInvitation(open.Did, open.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, 8, rec.Uses)
+	value, err := db.Get(store.Key(utils.InvitationKey, open.Did, open.Id))
+	assert.Nil(t, err)
+	r, err := store.ParseRecord(value)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(store.NeverExpire), r.ExpireAt)
+
+	_, err = s.RevokeInvitationInStore(open.Did, open.Id)
+	assert.Nil(t, err)
+	_, err = s.UseInvitation(open.Did, open.Id, vdri.ConnectionsProtocol)
+	assert.NotNil(t, err)
+
+	expiring, err := s.NewInvitation(&message.CreateInvitationRequest{
+		Router: router,
+		Policy: message.InvitationPolicy{ExpireAt: time.Now().Add(time.Hour).Unix()},
+	})
+	assert.Nil(t, err)
+	rec, err = s.GetInvitation(expiring.Did, expiring.Id)
+	assert.Nil(t, err)
+	assert.NotNil(t, rec.Check(time.Now().Add(2*time.Hour)))
+
+	_, err = s.NewInvitation(&message.CreateInvitationRequest{Router: router, Policy: message.InvitationPolicy{MaxUses: 3}})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,205 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package controller
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ontio/mercury/common/log"
+	"github.com/ontio/mercury/common/message"
+	"github.com/ontio/mercury/service/common"
+	"github.com/ontio/mercury/store"
+	"github.com/ontio/mercury/utils"
+	"github.com/ontio/mercury/vdri"
+)
+
+const (
+	TrustPingKey = "TrustPing"
+
+	DefaultTrustPingTimeout = 5 * time.Second
+	MaxTrustPingTimeout     = time.Minute
+
+	// pingPollInterval is how often a ping waiting for its response reads
+	// its record, the response may be received by another agent sharing
+	// the store
+	pingPollInterval = 200 * time.Millisecond
+)
+
+// pingWaiters wakes up the pings waiting for their response in this agent
+type pingWaiters struct {
+	lock    sync.Mutex
+	waiters map[string]chan struct{}
+}
+
+func newPingWaiters() *pingWaiters {
+	return &pingWaiters{waiters: make(map[string]chan struct{})}
+}
+
+func (p *pingWaiters) add(id string) chan struct{} {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	c := make(chan struct{})
+	p.waiters[id] = c
+	return c
+}
+
+func (p *pingWaiters) remove(id string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	delete(p.waiters, id)
+}
+
+func (p *pingWaiters) notify(id string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if c, ok := p.waiters[id]; ok {
+		close(c)
+		delete(p.waiters, id)
+	}
+}
+
+// pingConnection sends a trust ping on conn and waits for its response if
+// requested. The answer or the lack of it is recorded on the connection.
+func (s *SystemController) pingConnection(conn message.Connection, comment string, responseRequested bool, timeout time.Duration) (*message.SendTrustPingResponse, error) {
+	ping := message.TrustPing{
+		Type:              vdri.TrustPingSpec,
+		Id:                utils.GenUUID(),
+		Comment:           comment,
+		ResponseRequested: responseRequested,
+		Connection:        conn,
+	}
+	//the response may arrive before the ping is sent out
+	err := s.SaveTrustPing(ping, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	wake := s.pings.add(ping.Id)
+	defer s.pings.remove(ping.Id)
+	err = s.msgSvr.HandleOutBound(common.OutboundMsg{
+		Msg: common.Message{
+			MessageType: common.TrustPingType,
+			Content:     &ping,
+		},
+		Conn: conn,
+	})
+	if err != nil {
+		log.Errorf("err on HandleOutBound:%s\n", err.Error())
+		return nil, err
+	}
+	res := &message.SendTrustPingResponse{Id: ping.Id}
+	if !responseRequested {
+		return res, nil
+	}
+	rec, err := s.waitTrustPingResponse(conn.MyDid, ping.Id, wake, timeout)
+	if rerr := s.RecordProbe(conn.MyDid, conn.TheirDid, err == nil); rerr != nil {
+		log.Warnf("record probe of %s err:%s", conn.TheirDid, rerr)
+	}
+	if err != nil {
+		return res, err
+	}
+	res.Responded = true
+	res.RTT = float64(rec.Responded-rec.Sent) / float64(time.Millisecond)
+	return res, nil
+}
+
+// SaveTrustPing keeps a ping sent by its Connection.MyDid
+func (s *SystemController) SaveTrustPing(ping message.TrustPing, sent time.Time) error {
+	key := store.Key(TrustPingKey, ping.Connection.MyDid, ping.Id)
+	return store.PutRecord(s.store, key, &message.TrustPingRec{
+		Ping: ping,
+		Sent: sent.UnixNano(),
+	})
+}
+
+func (s *SystemController) GetTrustPing(did, id string) (*message.TrustPingRec, error) {
+	rec := new(message.TrustPingRec)
+	err := store.GetRecord(s.store, store.Key(TrustPingKey, did, id), rec)
+	if err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// ReceiveTrustPingResponse records the response to the ping id of did, a
+// repeated response keeps the first response time
+func (s *SystemController) ReceiveTrustPingResponse(did, id string) error {
+	key := store.Key(TrustPingKey, did, id)
+	old, err := s.store.Get(key)
+	if err != nil {
+		return fmt.Errorf("trust ping %s:%s", id, err)
+	}
+	rec := new(message.TrustPingRec)
+	if _, err = store.DecodeRecord(old, rec); err != nil {
+		return err
+	}
+	if rec.Responded == 0 {
+		rec.Responded = time.Now().UnixNano()
+		data, err := store.NewRecord(rec)
+		if err != nil {
+			return err
+		}
+		// losing the swap means a response was recorded meanwhile
+		if _, err = s.store.CompareAndSwap(key, old, data); err != nil {
+			return err
+		}
+	}
+	if s.pings != nil {
+		s.pings.notify(id)
+	}
+	return nil
+}
+
+// waitTrustPingResponse waits until the response of the ping is recorded or
+// timeout, wake is closed when this agent receives it
+func (s *SystemController) waitTrustPingResponse(did, id string, wake chan struct{}, timeout time.Duration) (*message.TrustPingRec, error) {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	poll := time.NewTicker(pingPollInterval)
+	defer poll.Stop()
+	for {
+		select {
+		case <-wake:
+			wake = nil
+		case <-poll.C:
+		case <-deadline.C:
+			return nil, fmt.Errorf("no trust ping response within %s", timeout)
+		}
+		rec, err := s.GetTrustPing(did, id)
+		if err != nil {
+			return nil, err
+		}
+		if rec.Responded > 0 {
+			return rec, nil
+		}
+	}
+}
+
+// trustPingTimeout bounds the timeout in milliseconds of a ping request
+func trustPingTimeout(ms int64) time.Duration {
+	timeout := time.Duration(ms) * time.Millisecond
+	if timeout <= 0 {
+		return DefaultTrustPingTimeout
+	}
+	if timeout > MaxTrustPingTimeout {
+		return MaxTrustPingTimeout
+	}
+	return timeout
+}
@@ -0,0 +1,66 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ontio/mercury/common/message"
+	leveldb "github.com/ontio/mercury/store/leveldb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrustPing(t *testing.T) {
+	db, err := leveldb.NewMemStore()
+	assert.Nil(t, err)
+	defer db.Close()
+	s := &SystemController{store: db, pings: newPingWaiters()}
+	ping := message.TrustPing{
+		Id:                "ping-1",
+		ResponseRequested: true,
+		Connection:        message.Connection{MyDid: "did:ont:alice", TheirDid: "did:ont:bob"},
+	}
+	sent := time.Now()
+	assert.Nil(t, s.SaveTrustPing(ping, sent))
+
+	wake := s.pings.add(ping.Id)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		assert.Nil(t, s.ReceiveTrustPingResponse("did:ont:alice", ping.Id))
+	}()
+	rec, err := s.waitTrustPingResponse("did:ont:alice", ping.Id, wake, time.Second)
+	assert.Nil(t, err)
+	assert.True(t, rec.Responded >= sent.UnixNano())
+
+	// a repeated response keeps the first one
+	assert.Nil(t, s.ReceiveTrustPingResponse("did:ont:alice", ping.Id))
+	again, err := s.GetTrustPing("did:ont:alice", ping.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, rec.Responded, again.Responded)
+	assert.NotNil(t, s.ReceiveTrustPingResponse("did:ont:alice", "unknown"))
+
+	ping.Id = "ping-2"
+	assert.Nil(t, s.SaveTrustPing(ping, time.Now()))
+	_, err = s.waitTrustPingResponse("did:ont:alice", ping.Id, s.pings.add(ping.Id), 50*time.Millisecond)
+	assert.NotNil(t, err)
+
+	assert.Equal(t, DefaultTrustPingTimeout, trustPingTimeout(0))
+	assert.Equal(t, MaxTrustPingTimeout, trustPingTimeout(int64(time.Hour/time.Millisecond)))
+}
@@ -19,21 +19,26 @@
 package service
 
 import (
+	"github.com/gin-gonic/gin"
 	"github.com/ontio/mercury/common/packager/ecdsa"
 	"github.com/ontio/mercury/service/common"
 	"github.com/ontio/mercury/service/controller"
 	"github.com/ontio/mercury/store"
 	"github.com/ontio/mercury/vdri"
-	"github.com/gin-gonic/gin"
 )
 
-func NewApiRouter(packager *ecdsa.Packager, store store.Store,
+func NewApiRouter(systemController *controller.SystemController, packager *ecdsa.Packager, store store.Store,
 	msgSvr *common.MsgService, v vdri.VDRI) *gin.Engine {
 
-	systemController := controller.NewSystemController(packager, store, msgSvr)
 	credentialController := controller.NewCredentialController(packager, store, msgSvr, v)
 	presentationController := controller.NewPresentationController(packager, store, msgSvr, v)
-	return NewRouter(credentialController, systemController, presentationController)
+	blobController := controller.NewBlobController(msgSvr)
+	routers := []common.Router{credentialController, systemController, presentationController, blobController}
+	//the peer messages handled are disclosed to the peers
+	for _, r := range routers {
+		msgSvr.RegisterRoutes(r.Routes())
+	}
+	return NewRouter(routers...)
 }
 
 func NewRouter(routers ...common.Router) *gin.Engine {
@@ -0,0 +1,340 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// Package backup writes and reads database exports. An export is a json
+// line file: a header, one line per record and a trailer with the record
+// count, so a truncated file is detected. With a password every line after
+// the header is sealed with AES-256-GCM under a scrypt derived key, the
+// header and the line number are authenticated so lines can't be dropped,
+// reordered or moved into another export.
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/ontio/mercury/store"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	Format  = "mercury-export"
+	Version = 1
+
+	cipherName = "aes-256-gcm"
+	kdfName    = "scrypt"
+	scryptN    = 1 << 15
+	scryptR    = 8
+	scryptP    = 1
+)
+
+type Header struct {
+	Format        string      `json:"format"`
+	Version       int         `json:"version"`
+	SchemaVersion int         `json:"schema_version"`
+	Created       int64       `json:"created"`
+	Encryption    *Encryption `json:"encryption,omitempty"`
+}
+
+type Encryption struct {
+	Cipher string `json:"cipher"`
+	KDF    string `json:"kdf"`
+	Salt   []byte `json:"salt"`
+	N      int    `json:"n"`
+	R      int    `json:"r"`
+	P      int    `json:"p"`
+}
+
+type line struct {
+	Key   []byte `json:"key,omitempty"`
+	Value []byte `json:"value,omitempty"`
+	End   bool   `json:"end,omitempty"`
+	Count int    `json:"count,omitempty"`
+}
+
+// Writer writes an export, Close must be called to complete it
+type Writer struct {
+	w      *bufio.Writer
+	aead   cipher.AEAD
+	header []byte
+	seq    uint64
+	count  int
+}
+
+// NewWriter writes the header of an export of a database at schemaVersion,
+// the records are encrypted if password is not empty
+func NewWriter(w io.Writer, schemaVersion int, password []byte) (*Writer, error) {
+	header := &Header{
+		Format:        Format,
+		Version:       Version,
+		SchemaVersion: schemaVersion,
+		Created:       time.Now().Unix(),
+	}
+	ew := &Writer{w: bufio.NewWriter(w)}
+	if len(password) > 0 {
+		enc := &Encryption{
+			Cipher: cipherName,
+			KDF:    kdfName,
+			Salt:   make([]byte, 16),
+			N:      scryptN,
+			R:      scryptR,
+			P:      scryptP,
+		}
+		_, err := rand.Read(enc.Salt)
+		if err != nil {
+			return nil, err
+		}
+		ew.aead, err = newAEAD(enc, password)
+		if err != nil {
+			return nil, err
+		}
+		header.Encryption = enc
+	}
+	data, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+	err = ew.writeLine(data)
+	if err != nil {
+		return nil, err
+	}
+	ew.header = data
+	return ew, nil
+}
+
+// Write adds one record
+func (ew *Writer) Write(key, value []byte) error {
+	ew.count++
+	return ew.writeEntry(&line{Key: key, Value: value})
+}
+
+// Close writes the trailer and flushes the export
+func (ew *Writer) Close() error {
+	err := ew.writeEntry(&line{End: true, Count: ew.count})
+	if err != nil {
+		return err
+	}
+	return ew.w.Flush()
+}
+
+func (ew *Writer) writeEntry(l *line) error {
+	data, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	if ew.aead != nil {
+		nonce := make([]byte, ew.aead.NonceSize())
+		_, err = rand.Read(nonce)
+		if err != nil {
+			return err
+		}
+		sealed := ew.aead.Seal(nonce, nonce, data, additionalData(ew.header, ew.seq))
+		data = []byte(base64.StdEncoding.EncodeToString(sealed))
+	}
+	ew.seq++
+	return ew.writeLine(data)
+}
+
+func (ew *Writer) writeLine(data []byte) error {
+	_, err := ew.w.Write(append(data, '\n'))
+	return err
+}
+
+// Export writes every record of snap except the schema version
+func Export(snap store.Snapshot, w io.Writer, password []byte) (int, error) {
+	version, err := SchemaVersion(snap)
+	if err != nil {
+		return 0, err
+	}
+	ew, err := NewWriter(w, version, password)
+	if err != nil {
+		return 0, err
+	}
+	iter := snap.NewIterator(nil)
+	defer iter.Release()
+	for iter.Next() {
+		if string(iter.Key()) == store.SchemaVersionKey {
+			continue
+		}
+		err = ew.Write(iter.Key(), iter.Value())
+		if err != nil {
+			return ew.count, err
+		}
+	}
+	if err = iter.Error(); err != nil {
+		return ew.count, err
+	}
+	return ew.count, ew.Close()
+}
+
+// SchemaVersion returns the schema version recorded in snap, an empty
+// database is at the current version
+func SchemaVersion(snap store.Snapshot) (int, error) {
+	data, err := snap.Get([]byte(store.SchemaVersionKey))
+	if err == nil {
+		return strconv.Atoi(string(data))
+	}
+	if err != store.ErrNotFound {
+		return 0, err
+	}
+	iter := snap.NewIterator(nil)
+	defer iter.Release()
+	if iter.Next() {
+		return 0, nil
+	}
+	return store.SchemaVersion, iter.Error()
+}
+
+// Reader reads an export
+type Reader struct {
+	Header *Header
+	br     *bufio.Reader
+	aead   cipher.AEAD
+	header []byte
+}
+
+// NewReader checks the header of an export, the password is only asked
+// for if the export is encrypted
+func NewReader(r io.Reader, password func() ([]byte, error)) (*Reader, error) {
+	br := bufio.NewReader(r)
+	data, err := readLine(br)
+	if err != nil {
+		return nil, fmt.Errorf("read export header:%s", err)
+	}
+	header := new(Header)
+	err = json.Unmarshal(data, header)
+	if err != nil || header.Format != Format {
+		return nil, fmt.Errorf("not a database export")
+	}
+	if header.Version != Version {
+		return nil, fmt.Errorf("unsupported export version %d", header.Version)
+	}
+	er := &Reader{
+		Header: header,
+		br:     br,
+		header: data,
+	}
+	if header.Encryption != nil {
+		if password == nil {
+			return nil, fmt.Errorf("export is encrypted, a password is required")
+		}
+		pwd, err := password()
+		if err != nil {
+			return nil, err
+		}
+		er.aead, err = newAEAD(header.Encryption, pwd)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return er, nil
+}
+
+// ReadAll calls fn for every record and checks the export is complete
+func (er *Reader) ReadAll(fn func(key, value []byte) error) (int, error) {
+	count := 0
+	for seq := uint64(0); ; seq++ {
+		data, err := readLine(er.br)
+		if err == io.EOF {
+			return count, fmt.Errorf("export is truncated after %d records", count)
+		}
+		if err != nil {
+			return count, err
+		}
+		if er.aead != nil {
+			data, err = open(er.aead, data, additionalData(er.header, seq), seq)
+			if err != nil {
+				return count, err
+			}
+		}
+		l := new(line)
+		err = json.Unmarshal(data, l)
+		if err != nil {
+			return count, fmt.Errorf("invalid export line %d:%s", seq+2, err)
+		}
+		if l.End {
+			if l.Count != count {
+				return count, fmt.Errorf("export holds %d records, trailer says %d", count, l.Count)
+			}
+			return count, nil
+		}
+		if len(l.Key) == 0 {
+			return count, fmt.Errorf("invalid export line %d:empty key", seq+2)
+		}
+		count++
+		err = fn(l.Key, l.Value)
+		if err != nil {
+			return count, err
+		}
+	}
+}
+
+func readLine(br *bufio.Reader) ([]byte, error) {
+	data, err := br.ReadBytes('\n')
+	if err == io.EOF && len(data) > 0 {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(data, "\r\n"), nil
+}
+
+func open(aead cipher.AEAD, data, ad []byte, seq uint64) ([]byte, error) {
+	sealed, err := base64.StdEncoding.DecodeString(string(data))
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("invalid encrypted export line %d", seq+2)
+	}
+	nonce := sealed[:aead.NonceSize()]
+	plain, err := aead.Open(nil, nonce, sealed[aead.NonceSize():], ad)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt export line %d failed, wrong password or modified export", seq+2)
+	}
+	return plain, nil
+}
+
+func newAEAD(enc *Encryption, password []byte) (cipher.AEAD, error) {
+	if enc.Cipher != cipherName || enc.KDF != kdfName {
+		return nil, fmt.Errorf("unsupported export encryption %s/%s", enc.Cipher, enc.KDF)
+	}
+	key, err := scrypt.Key(password, enc.Salt, enc.N, enc.R, enc.P, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func additionalData(header []byte, seq uint64) []byte {
+	b := make([]byte, 8, 8+len(header))
+	binary.BigEndian.PutUint64(b, seq)
+	return append(b, header...)
+}
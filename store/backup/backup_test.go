@@ -0,0 +1,91 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package backup
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ontio/mercury/store"
+	leveldb "github.com/ontio/mercury/store/leveldb"
+	"github.com/stretchr/testify/assert"
+)
+
+func exportTestStore(t *testing.T, password []byte) []byte {
+	db, err := leveldb.NewMemStore()
+	assert.Nil(t, err)
+	defer db.Close()
+	assert.Nil(t, store.PutRecord(db, store.Key("Invitation", "did:ont:a", "1"), "one"))
+	assert.Nil(t, store.PutRecord(db, store.Key("Invitation", "did:ont:a", "2"), "two"))
+	snap, err := db.Snapshot()
+	assert.Nil(t, err)
+	defer snap.Release()
+	// writes after the snapshot are not exported
+	assert.Nil(t, store.PutRecord(db, store.Key("Invitation", "did:ont:a", "3"), "three"))
+
+	buf := new(bytes.Buffer)
+	n, err := Export(snap, buf, password)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	return buf.Bytes()
+}
+
+func readAll(data []byte, password string) (map[string]string, error) {
+	er, err := NewReader(bytes.NewReader(data), func() ([]byte, error) { return []byte(password), nil })
+	if err != nil {
+		return nil, err
+	}
+	records := make(map[string]string)
+	_, err = er.ReadAll(func(key, value []byte) error {
+		var s string
+		_, err := store.DecodeRecord(value, &s)
+		records[string(key)] = s
+		return err
+	})
+	return records, err
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	for _, password := range []string{"", "secret"} {
+		data := exportTestStore(t, []byte(password))
+		records, err := readAll(data, password)
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]string{
+			"Invitation/did:ont:a/1": "one",
+			"Invitation/did:ont:a/2": "two",
+		}, records)
+	}
+}
+
+func TestExportRejected(t *testing.T) {
+	data := exportTestStore(t, []byte("secret"))
+	assert.False(t, bytes.Contains(data, []byte("Invitation")))
+
+	_, err := readAll(data, "wrong")
+	assert.NotNil(t, err)
+
+	lines := bytes.Split(bytes.TrimSpace(data), []byte("\n"))
+	truncated := bytes.Join(lines[:len(lines)-1], []byte("\n"))
+	_, err = readAll(truncated, "secret")
+	assert.NotNil(t, err)
+
+	lines[1], lines[2] = lines[2], lines[1]
+	_, err = readAll(bytes.Join(lines, []byte("\n")), "secret")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,171 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// Package blob keeps attachment contents out of the records. A blob is
+// addressed by the hex SHA-256 of its content, so the same content is
+// stored once and a blob can be verified by whoever fetches it.
+package blob
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// ErrNotFound is returned by Get when the blob does not exist
+var ErrNotFound = errors.New("blob: not found")
+
+// Store keeps blobs by their sum
+type Store interface {
+	// Put stores data and returns its sum
+	Put(data []byte) (string, error)
+	// Get returns the blob with sum, verified against it
+	Get(sum string) ([]byte, error)
+	Has(sum string) (bool, error)
+	Delete(sum string) error
+}
+
+// Sum returns the hex SHA-256 of data
+func Sum(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
+
+// ValidSum reports whether sum is a lower case hex SHA-256
+func ValidSum(sum string) bool {
+	if len(sum) != sha256.Size*2 {
+		return false
+	}
+	for _, c := range sum {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// Verify checks that data has sum
+func Verify(data []byte, sum string) error {
+	if got := Sum(data); got != sum {
+		return fmt.Errorf("blob sha256 mismatch, expect %s got %s", sum, got)
+	}
+	return nil
+}
+
+// FileStore keeps every blob in a file named by its sum, spread over sub
+// directories named by the first two characters
+type FileStore struct {
+	dir string
+}
+
+func NewFileStore(dir string) (*FileStore, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+func (s *FileStore) path(sum string) (string, error) {
+	if !ValidSum(sum) {
+		return "", fmt.Errorf("invalid blob sha256 %q", sum)
+	}
+	return filepath.Join(s.dir, sum[:2], sum), nil
+}
+
+// Put writes the blob through a temporary file, so a blob file is either
+// complete or missing
+func (s *FileStore) Put(data []byte) (string, error) {
+	sum := Sum(data)
+	path, err := s.path(sum)
+	if err != nil {
+		return "", err
+	}
+	if _, err = os.Stat(path); err == nil {
+		return sum, nil
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return "", err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), sum+".tmp")
+	if err != nil {
+		return "", err
+	}
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return sum, nil
+}
+
+func (s *FileStore) Get(sum string) ([]byte, error) {
+	path, err := s.path(sum)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = Verify(data, sum); err != nil {
+		return nil, fmt.Errorf("blob %s is corrupted:%s", sum, err)
+	}
+	return data, nil
+}
+
+func (s *FileStore) Has(sum string) (bool, error) {
+	path, err := s.path(sum)
+	if err != nil {
+		return false, err
+	}
+	_, err = os.Stat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *FileStore) Delete(sum string) error {
+	path, err := s.path(sum)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,65 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package blob
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mercury-blob")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	s, err := NewFileStore(dir)
+	assert.Nil(t, err)
+
+	data := []byte("a scanned document")
+	sum, err := s.Put(data)
+	assert.Nil(t, err)
+	assert.Equal(t, Sum(data), sum)
+	assert.True(t, ValidSum(sum))
+	again, err := s.Put(data)
+	assert.Nil(t, err)
+	assert.Equal(t, sum, again)
+
+	got, err := s.Get(sum)
+	assert.Nil(t, err)
+	assert.Equal(t, data, got)
+	ok, err := s.Has(sum)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	// a sum is never used as a path as is
+	_, err = s.Get("../" + sum[3:])
+	assert.NotNil(t, err)
+
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, sum[:2], sum), []byte("tampered"), 0600))
+	_, err = s.Get(sum)
+	assert.NotNil(t, err)
+
+	assert.Nil(t, s.Delete(sum))
+	_, err = s.Get(sum)
+	assert.Equal(t, ErrNotFound, err)
+	assert.Nil(t, s.Delete(sum))
+}
@@ -0,0 +1,166 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// Package gc removes expired records from a store
+package gc
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ontio/mercury/common/log"
+	"github.com/ontio/mercury/store"
+)
+
+// Policy is the retention of each record type, zero keeps the records
+type Policy map[string]time.Duration
+
+// ParsePolicy overrides the retentions of base with a list like
+// "Invitation=24h,ConnectionReq=720h"
+func ParsePolicy(s string, base map[string]time.Duration) (Policy, error) {
+	p := make(Policy)
+	for k, v := range base {
+		p[k] = v
+	}
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid retention:%s", item)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(kv[1]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid retention:%s, %s", item, err)
+		}
+		p[strings.TrimSpace(kv[0])] = d
+	}
+	return p, nil
+}
+
+// Finished reports whether a record is done with. The retention only
+// applies to finished records, so records still waiting for an answer are
+// kept. A nil Finished treats all records as finished.
+type Finished func(key []byte, rec *store.Record) bool
+
+// Result counts the records of a sweep
+type Result struct {
+	Scanned int            `json:"scanned"`
+	Expired map[string]int `json:"expired"`
+}
+
+type expiredRecord struct {
+	key   []byte
+	value []byte
+}
+
+// Sweep deletes the records expired at now, with dryRun it only counts them
+func Sweep(db store.Store, policy Policy, finished Finished, now time.Time, dryRun bool) (*Result, error) {
+	res := &Result{Expired: make(map[string]int)}
+	expired := make([]expiredRecord, 0)
+	iter := db.NewIterator(nil)
+	for iter.Next() {
+		if string(iter.Key()) == store.SchemaVersionKey {
+			continue
+		}
+		res.Scanned++
+		rec, err := store.ParseRecord(iter.Value())
+		if err != nil {
+			log.Warnf("gc skip record %s:%s", iter.Key(), err)
+			continue
+		}
+		retention := policy[store.RecordType(iter.Key())]
+		if retention > 0 && finished != nil && !finished(iter.Key(), rec) {
+			retention = 0
+		}
+		if rec.Expired(now, retention) {
+			expired = append(expired, expiredRecord{
+				key:   append([]byte{}, iter.Key()...),
+				value: append([]byte{}, iter.Value()...),
+			})
+		}
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+	for _, e := range expired {
+		if !dryRun {
+			//the record may be updated since it was scanned
+			ok, err := db.CompareAndSwap(e.key, e.value, nil)
+			if err != nil {
+				return res, err
+			}
+			if !ok {
+				continue
+			}
+		}
+		res.Expired[store.RecordType(e.key)]++
+	}
+	return res, nil
+}
+
+// Sweeper runs Sweep periodically in background
+type Sweeper struct {
+	db       store.Store
+	policy   Policy
+	finished Finished
+	interval time.Duration
+	quitC    chan struct{}
+}
+
+func NewSweeper(db store.Store, policy Policy, finished Finished, interval time.Duration) *Sweeper {
+	return &Sweeper{
+		db:       db,
+		policy:   policy,
+		finished: finished,
+		interval: interval,
+		quitC:    make(chan struct{}),
+	}
+}
+
+func (s *Sweeper) Start() {
+	go s.run()
+}
+
+func (s *Sweeper) Stop() {
+	close(s.quitC)
+}
+
+func (s *Sweeper) run() {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			res, err := Sweep(s.db, s.policy, s.finished, time.Now(), false)
+			if err != nil {
+				log.Errorf("gc sweep err:%s", err)
+				continue
+			}
+			for t, n := range res.Expired {
+				log.Infof("gc removed %d expired %s records", n, t)
+			}
+		case <-s.quitC:
+			return
+		}
+	}
+}
@@ -0,0 +1,105 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package gc
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/ontio/mercury/store"
+	leveldb "github.com/ontio/mercury/store/leveldb"
+	"github.com/stretchr/testify/assert"
+)
+
+func putRecord(t *testing.T, db store.Store, key string, updated, expireAt int64) {
+	data, err := json.Marshal(&store.Record{
+		Version:  store.SchemaVersion,
+		Updated:  updated,
+		ExpireAt: expireAt,
+		Data:     json.RawMessage(`{}`),
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, db.Put([]byte(key), data))
+}
+
+func TestParsePolicy(t *testing.T) {
+	p, err := ParsePolicy("Invitation=1h, Credential=0", map[string]time.Duration{"Invitation": time.Minute, "Basic": time.Second})
+	assert.Nil(t, err)
+	assert.Equal(t, time.Hour, p["Invitation"])
+	assert.Equal(t, time.Duration(0), p["Credential"])
+	assert.Equal(t, time.Second, p["Basic"])
+	_, err = ParsePolicy("Invitation", nil)
+	assert.NotNil(t, err)
+}
+
+func TestSweep(t *testing.T) {
+	db, err := leveldb.NewMemStore()
+	assert.Nil(t, err)
+	defer db.Close()
+	now := time.Now()
+	putRecord(t, db, "Invitation/a/1", now.Add(-2*time.Hour).Unix(), 0)
+	putRecord(t, db, "Invitation/a/2", now.Unix(), 0)
+	putRecord(t, db, "Invitation/a/3", now.Add(-2*time.Hour).Unix(), store.NeverExpire)
+	putRecord(t, db, "Credential/a/1", now.Add(-48*time.Hour).Unix(), 0)
+	putRecord(t, db, "Credential/a/2", now.Unix(), now.Add(-time.Second).Unix())
+	policy := Policy{"Invitation": time.Hour}
+
+	res, err := Sweep(db, policy, nil, now, true)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, res.Scanned)
+	assert.Equal(t, 1, res.Expired["Invitation"])
+	assert.Equal(t, 1, res.Expired["Credential"])
+	has, _ := db.Has([]byte("Invitation/a/1"))
+	assert.True(t, has)
+
+	res, err = Sweep(db, policy, nil, now, false)
+	assert.Nil(t, err)
+	for k, exist := range map[string]bool{
+		"Invitation/a/1": false,
+		"Invitation/a/2": true,
+		"Invitation/a/3": true,
+		"Credential/a/1": true,
+		"Credential/a/2": false,
+	} {
+		has, err := db.Has([]byte(k))
+		assert.Nil(t, err)
+		assert.Equal(t, exist, has, k)
+	}
+}
+
+func TestSweepFinished(t *testing.T) {
+	db, err := leveldb.NewMemStore()
+	assert.Nil(t, err)
+	defer db.Close()
+	now := time.Now()
+	putRecord(t, db, "Request/a/1", now.Add(-2*time.Hour).Unix(), 0)
+	putRecord(t, db, "Request/a/2", now.Add(-2*time.Hour).Unix(), 0)
+	putRecord(t, db, "Request/a/3", now.Add(-2*time.Hour).Unix(), now.Add(-time.Second).Unix())
+	finished := func(key []byte, rec *store.Record) bool {
+		return string(key) == "Request/a/1"
+	}
+
+	res, err := Sweep(db, Policy{"Request": time.Hour}, finished, now, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, res.Expired["Request"])
+	has, err := db.Has([]byte("Request/a/2"))
+	assert.Nil(t, err)
+	assert.True(t, has)
+}
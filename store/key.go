@@ -0,0 +1,59 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package store
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// KeySeparator separates the parts of a key. Parts are escaped so the
+// separator never occurs inside one, two different part lists therefore
+// never produce the same key and a prefix never matches a longer part.
+const KeySeparator = "/"
+
+var keyEscaper = strings.NewReplacer("%", "%25", KeySeparator, "%2F")
+
+// Key joins the record type and parts into a store key
+func Key(parts ...string) []byte {
+	escaped := make([]string, len(parts))
+	for i, p := range parts {
+		escaped[i] = keyEscaper.Replace(p)
+	}
+	return []byte(strings.Join(escaped, KeySeparator))
+}
+
+// KeyPrefix returns the prefix shared by all keys starting with parts
+func KeyPrefix(parts ...string) []byte {
+	return append(Key(parts...), KeySeparator...)
+}
+
+// SplitKey splits a key built by Key into its unescaped parts
+func SplitKey(key []byte) ([]string, error) {
+	parts := strings.Split(string(key), KeySeparator)
+	for i, p := range parts {
+		s, err := url.PathUnescape(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %q:%s", key, err)
+		}
+		parts[i] = s
+	}
+	return parts, nil
+}
@@ -0,0 +1,49 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package store
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKey(t *testing.T) {
+	a := Key("Credential", "did:ont:a", "x_y")
+	b := Key("Credential", "did:ont:a_x", "y")
+	assert.NotEqual(t, a, b)
+	assert.NotEqual(t, Key("Credential", "did:ont:a/x", "y"), Key("Credential", "did:ont:a", "x/y"))
+
+	for _, parts := range [][]string{
+		{"Credential", "did:ont:a", "x_y"},
+		{"Credential", "did:ont:a/b", "%2F/%"},
+		{"Connection", ""},
+	} {
+		got, err := SplitKey(Key(parts...))
+		assert.Nil(t, err)
+		assert.Equal(t, parts, got)
+	}
+
+	prefix := KeyPrefix("Credential", "did:ont:a")
+	assert.True(t, bytes.HasPrefix(Key("Credential", "did:ont:a", "1"), prefix))
+	assert.False(t, bytes.HasPrefix(Key("Credential", "did:ont:ab", "1"), prefix))
+	assert.False(t, bytes.HasPrefix(Key("CredentialIndex", "did:ont:a", "1"), KeyPrefix("Credential")))
+	assert.Equal(t, "Credential", RecordType(Key("Credential", "did:ont:a", "1")))
+}
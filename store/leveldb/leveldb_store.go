@@ -19,9 +19,15 @@
 package store
 
 import (
+	"bytes"
+	"sync"
+
 	"github.com/ontio/mercury/store"
 	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/errors"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/storage"
+	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
 // Provider leveldb implementation of storage.Provider interface
@@ -40,6 +46,8 @@ func NewProvider(dbPath string) *Provider {
 type levelDBStore struct {
 	db    *leveldb.DB
 	batch *leveldb.Batch
+	//serializes writes so CompareAndSwap is atomic
+	lock sync.Mutex
 }
 
 func (p *Provider) OpenStore(path string) (store.Store, error) {
@@ -60,18 +68,48 @@ func (p *Provider) newLevelDBStore(path string) (*levelDBStore, error) {
 	}, nil
 }
 
+//OpenReadOnly open an existing leveldb database without writing to it,
+//it fails while another process holds the database
+func OpenReadOnly(path string) (store.Store, error) {
+	db, err := leveldb.OpenFile(path, &opt.Options{ReadOnly: true, ErrorIfMissing: true})
+	if err != nil {
+		return nil, err
+	}
+	return &levelDBStore{
+		db:    db,
+		batch: nil,
+	}, nil
+}
+
+//NewMemStore open a leveldb store which lives in memory only
+func NewMemStore() (store.Store, error) {
+	db, err := leveldb.Open(storage.NewMemStorage(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return &levelDBStore{
+		db:    db,
+		batch: nil,
+	}, nil
+}
+
 func (p *Provider) Close() error {
 	return p.dbStore.Close()
 }
 
 //Put a key-value pair to leveldb
 func (self *levelDBStore) Put(key []byte, value []byte) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
 	return self.db.Put(key, value, nil)
 }
 
 //Get the value of a key from leveldb
 func (self *levelDBStore) Get(key []byte) ([]byte, error) {
 	dat, err := self.db.Get(key, nil)
+	if err == leveldb.ErrNotFound {
+		return nil, store.ErrNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -85,9 +123,75 @@ func (self *levelDBStore) Has(key []byte) (bool, error) {
 
 //Delete the the in leveldb
 func (self *levelDBStore) Delete(key []byte) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
 	return self.db.Delete(key, nil)
 }
 
+//NewIterator return an iterator of the records with the key prefix
+func (self *levelDBStore) NewIterator(prefix []byte) store.Iterator {
+	return self.db.NewIterator(util.BytesPrefix(prefix), nil)
+}
+
+//Write commit a store batch to leveldb
+func (self *levelDBStore) Write(b *store.Batch) error {
+	batch := new(leveldb.Batch)
+	b.Replay(batch.Put, batch.Delete)
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.db.Write(batch, nil)
+}
+
+//CompareAndSwap set the value of a key only if it still holds the old value
+func (self *levelDBStore) CompareAndSwap(key []byte, old []byte, value []byte) (bool, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	cur, err := self.db.Get(key, nil)
+	if err != nil && err != leveldb.ErrNotFound {
+		return false, err
+	}
+	exist := err == nil
+	if old == nil && exist {
+		return false, nil
+	}
+	if old != nil && (!exist || !bytes.Equal(cur, old)) {
+		return false, nil
+	}
+	if value == nil {
+		return true, self.db.Delete(key, nil)
+	}
+	return true, self.db.Put(key, value, nil)
+}
+
+//Snapshot return a leveldb snapshot of the current records
+func (self *levelDBStore) Snapshot() (store.Snapshot, error) {
+	snap, err := self.db.GetSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	return &levelDBSnapshot{snap: snap}, nil
+}
+
+type levelDBSnapshot struct {
+	snap *leveldb.Snapshot
+}
+
+func (self *levelDBSnapshot) Get(key []byte) ([]byte, error) {
+	dat, err := self.snap.Get(key, nil)
+	if err == leveldb.ErrNotFound {
+		return nil, store.ErrNotFound
+	}
+	return dat, err
+}
+
+func (self *levelDBSnapshot) NewIterator(prefix []byte) store.Iterator {
+	return self.snap.NewIterator(util.BytesPrefix(prefix), nil)
+}
+
+func (self *levelDBSnapshot) Release() {
+	self.snap.Release()
+}
+
 //Close leveldb
 func (self *levelDBStore) Close() error {
 	err := self.db.Close()
@@ -0,0 +1,151 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// Package migrate upgrades the records of a store to the current schema version
+package migrate
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/ontio/mercury/store"
+)
+
+// Migration upgrades the database from Version-1 to Version
+type Migration struct {
+	Version     int
+	Description string
+	// Migrate reads the records from db and puts the changes into b,
+	// the batch is committed together with the new schema version
+	Migrate func(db store.Store, b *store.Batch) error
+}
+
+// Result reports an applied migration
+type Result struct {
+	Version     int    `json:"version"`
+	Description string `json:"description"`
+	Changes     int    `json:"changes"`
+}
+
+// CurrentVersion returns the schema version of db, an empty database is
+// considered up to date and a database without version is 0
+func CurrentVersion(db store.Store) (int, error) {
+	data, err := db.Get([]byte(store.SchemaVersionKey))
+	if err == nil {
+		return strconv.Atoi(string(data))
+	}
+	if err != store.ErrNotFound {
+		return 0, err
+	}
+	empty, err := isEmpty(db)
+	if err != nil {
+		return 0, err
+	}
+	if empty {
+		return store.SchemaVersion, nil
+	}
+	return 0, nil
+}
+
+// Pending returns the migrations which are not applied to db yet
+func Pending(db store.Store, migrations []Migration) ([]Migration, error) {
+	err := check(migrations)
+	if err != nil {
+		return nil, err
+	}
+	version, err := CurrentVersion(db)
+	if err != nil {
+		return nil, err
+	}
+	if version > store.SchemaVersion {
+		return nil, fmt.Errorf("database schema version %d is newer than %d", version, store.SchemaVersion)
+	}
+	return migrations[version:], nil
+}
+
+// Run applies all pending migrations to db, each one in its own batch
+func Run(db store.Store, migrations []Migration) ([]Result, error) {
+	pending, err := Pending(db, migrations)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]Result, 0, len(pending))
+	for _, m := range pending {
+		b := store.NewBatch()
+		err = m.Migrate(db, b)
+		if err != nil {
+			return results, fmt.Errorf("migration %d %s failed:%s", m.Version, m.Description, err)
+		}
+		changes := b.Len()
+		b.Put([]byte(store.SchemaVersionKey), []byte(strconv.Itoa(m.Version)))
+		err = db.Write(b)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, Result{
+			Version:     m.Version,
+			Description: m.Description,
+			Changes:     changes,
+		})
+	}
+	return results, markVersion(db)
+}
+
+// Copy writes every record of src into dst, it is used for backups and dry runs
+func Copy(src, dst store.Store) (int, error) {
+	iter := src.NewIterator(nil)
+	defer iter.Release()
+	count := 0
+	for iter.Next() {
+		k := append([]byte{}, iter.Key()...)
+		v := append([]byte{}, iter.Value()...)
+		err := dst.Put(k, v)
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, iter.Error()
+}
+
+func check(migrations []Migration) error {
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return fmt.Errorf("migration %s has version %d, expect %d", m.Description, m.Version, i+1)
+		}
+	}
+	if len(migrations) != store.SchemaVersion {
+		return fmt.Errorf("%d migrations registered for schema version %d", len(migrations), store.SchemaVersion)
+	}
+	return nil
+}
+
+func markVersion(db store.Store) error {
+	has, err := db.Has([]byte(store.SchemaVersionKey))
+	if err != nil || has {
+		return err
+	}
+	return db.Put([]byte(store.SchemaVersionKey), []byte(strconv.Itoa(store.SchemaVersion)))
+}
+
+func isEmpty(db store.Store) (bool, error) {
+	iter := db.NewIterator(nil)
+	defer iter.Release()
+	empty := !iter.Next()
+	return empty, iter.Error()
+}
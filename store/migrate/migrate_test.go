@@ -0,0 +1,105 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package migrate_test
+
+import (
+	"testing"
+
+	"github.com/ontio/mercury/common/message"
+	"github.com/ontio/mercury/service/controller"
+	"github.com/ontio/mercury/store"
+	leveldb "github.com/ontio/mercury/store/leveldb"
+	"github.com/ontio/mercury/store/migrate"
+	"github.com/ontio/mercury/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunOnEmptyStore(t *testing.T) {
+	db, err := leveldb.NewMemStore()
+	assert.Nil(t, err)
+	defer db.Close()
+	results, err := migrate.Run(db, controller.Migrations)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(results))
+	v, err := migrate.CurrentVersion(db)
+	assert.Nil(t, err)
+	assert.Equal(t, store.SchemaVersion, v)
+}
+
+func TestRunOnLegacyStore(t *testing.T) {
+	db, err := leveldb.NewMemStore()
+	assert.Nil(t, err)
+	defer db.Close()
+	err = db.Put([]byte("Invitation_did:ont:abc_1"), []byte(`{"invitation":{"@id":"1","did":"did:ont:abc","router":null},"state":1}`))
+	assert.Nil(t, err)
+	err = db.Put([]byte("RequestPresentation_did:ont:abc_2"), []byte(`{"requester_did":"did:ont:abc","rerquest_prentation":{"@id":"2"},"state":0}`))
+	assert.Nil(t, err)
+	err = db.Put([]byte("Credential_did:ont:abc_3_x"), []byte(`{"owner_did":"did:ont:abc","credential":{"@id":"3","connection":{"my_did":"did:ont:iss"}}}`))
+	assert.Nil(t, err)
+	err = db.Put([]byte("Basic_did:ont:abc"), []byte(`{"msglist":[{"@id":"m1","content":"a"},{"@id":"m2","content":"b"}]}`))
+	assert.Nil(t, err)
+	err = db.Put([]byte("Connection_did:ont:abc"), []byte(`{"owner_did":"did:ont:abc","connections":{"did:ont:def":{"my_did":"did:ont:abc","their_did":"did:ont:def"}}}`))
+	assert.Nil(t, err)
+
+	v, err := migrate.CurrentVersion(db)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, v)
+	results, err := migrate.Run(db, controller.Migrations)
+	assert.Nil(t, err)
+	assert.Equal(t, store.SchemaVersion, len(results))
+	assert.Equal(t, 5, results[0].Changes)
+
+	iv := new(message.InvitationRec)
+	err = store.GetRecord(db, store.Key("Invitation", "did:ont:abc", "1"), iv)
+	assert.Nil(t, err)
+	assert.Equal(t, "1", iv.Invitation.Id)
+	assert.Equal(t, message.InvitationUsed, iv.State)
+	rp := new(message.RequestPresentationRec)
+	err = store.GetRecord(db, store.Key("RequestPresentation", "did:ont:abc", "2"), rp)
+	assert.Nil(t, err)
+	assert.Equal(t, "2", rp.RequestPresentation.Id)
+	cr := new(message.CredentialRec)
+	err = store.GetRecord(db, store.Key("Credential", "did:ont:abc", "3_x"), cr)
+	assert.Nil(t, err)
+	assert.Equal(t, "3", cr.Credential.Id)
+	has, err := db.Has([]byte("Invitation_did:ont:abc_1"))
+	assert.Nil(t, err)
+	assert.False(t, has)
+	has, err = db.Has(store.Key("CredentialIndex", "did:ont:abc", "issuer", "did:ont:iss", "3_x"))
+	assert.Nil(t, err)
+	assert.True(t, has)
+	has, err = db.Has([]byte("CredentialIndex_did:ont:abc_issuer_did:ont:iss_3_x"))
+	assert.Nil(t, err)
+	assert.False(t, has)
+	assert.Nil(t, utils.CheckConnection("did:ont:abc", "did:ont:def", db))
+	var contents []string
+	iter := db.NewIterator(store.KeyPrefix("Basic", "did:ont:abc"))
+	for iter.Next() {
+		m := new(message.BasicMessage)
+		_, err = store.DecodeRecord(iter.Value(), m)
+		assert.Nil(t, err)
+		contents = append(contents, m.Content)
+	}
+	iter.Release()
+	assert.Equal(t, []string{"b", "a"}, contents)
+
+	results, err = migrate.Run(db, controller.Migrations)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(results))
+}
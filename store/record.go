@@ -0,0 +1,139 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// SchemaVersion is the record format written by this build,
+	// bump it together with a new migration
+	SchemaVersion = 5
+	// SchemaVersionKey holds the schema version of the whole database
+	SchemaVersionKey = "SchemaVersion"
+)
+
+// Record is the envelope of every value in the store
+type Record struct {
+	Version int `json:"version"`
+	// Updated is the unix time of the last write
+	Updated int64 `json:"updated,omitempty"`
+	// ExpireAt is the unix time after which the record may be collected,
+	// NeverExpire keeps the record until it is deleted
+	ExpireAt int64           `json:"expire_at,omitempty"`
+	Data     json.RawMessage `json:"data"`
+}
+
+// NeverExpire as ExpireAt exempts a record from the retention
+const NeverExpire = -1
+
+// Expired reports whether the record should be collected at now, records
+// without explicit expiry are kept for the retention after their last update
+func (r *Record) Expired(now time.Time, retention time.Duration) bool {
+	if r.ExpireAt == NeverExpire {
+		return false
+	}
+	if r.ExpireAt > 0 {
+		return now.Unix() >= r.ExpireAt
+	}
+	return retention > 0 && r.Updated > 0 && now.Sub(time.Unix(r.Updated, 0)) >= retention
+}
+
+// NewRecord wraps v into a record of the current schema version
+func NewRecord(v interface{}) ([]byte, error) {
+	return newRecord(v, 0)
+}
+
+func newRecord(v interface{}, expireAt int64) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(&Record{
+		Version:  SchemaVersion,
+		Updated:  time.Now().Unix(),
+		ExpireAt: expireAt,
+		Data:     data,
+	})
+}
+
+// RecordType returns the record type prefix of a key
+func RecordType(key []byte) string {
+	return strings.SplitN(string(key), KeySeparator, 2)[0]
+}
+
+// DecodeRecord parses a stored value and unmarshals the payload into v
+func DecodeRecord(value []byte, v interface{}) (*Record, error) {
+	rec, err := ParseRecord(value)
+	if err != nil {
+		return nil, err
+	}
+	if v != nil {
+		err = json.Unmarshal(rec.Data, v)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rec, nil
+}
+
+// ParseRecord parses the envelope of a stored value without decoding the payload
+func ParseRecord(value []byte) (*Record, error) {
+	rec := new(Record)
+	err := json.Unmarshal(value, rec)
+	if err != nil {
+		return nil, err
+	}
+	if rec.Version == 0 || rec.Data == nil {
+		return nil, fmt.Errorf("record without schema version, run agent db migrate")
+	}
+	if rec.Version > SchemaVersion {
+		return nil, fmt.Errorf("record schema version %d is newer than %d", rec.Version, SchemaVersion)
+	}
+	return rec, nil
+}
+
+// PutRecord stores v under key in a record envelope
+func PutRecord(s Store, key []byte, v interface{}) error {
+	data, err := NewRecord(v)
+	if err != nil {
+		return err
+	}
+	return s.Put(key, data)
+}
+
+// EncodeRecord wraps v into a record expiring at the unix time expireAt,
+// 0 applies the retention of its type
+func EncodeRecord(v interface{}, expireAt int64) ([]byte, error) {
+	return newRecord(v, expireAt)
+}
+
+// GetRecord loads the record under key into v
+func GetRecord(s Store, key []byte, v interface{}) error {
+	data, err := s.Get(key)
+	if err != nil {
+		return err
+	}
+	_, err = DecodeRecord(data, v)
+	return err
+}
@@ -0,0 +1,628 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// Package redis stores the agent records in a server speaking the redis
+// protocol, so several agents can share them. Every Put, Delete and batch
+// is atomic on the server and CompareAndSwap is a WATCH/MULTI transaction,
+// see doc/Redis_Store.md for what readers can rely on.
+package redis
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ontio/mercury/store"
+)
+
+const (
+	DefaultPort     = "6379"
+	DefaultPoolSize = 16
+	DefaultTimeout  = 10 * time.Second
+
+	// scanCount is the SCAN page size hint, fetchCount the number of
+	// values an iterator fetches at once
+	scanCount  = 1000
+	fetchCount = 256
+	// casRetries bounds the retries of a CompareAndSwap whose key keeps
+	// changing before the transaction runs
+	casRetries = 100
+)
+
+// Options configures the connection to the server
+type Options struct {
+	Addr     string
+	Password string
+	DB       int
+	PoolSize int
+	Timeout  time.Duration
+}
+
+// ParseURL reads redis://[:password@]host[:port][/db]
+func ParseURL(rawurl string) (*Options, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "redis" {
+		return nil, fmt.Errorf("invalid redis url %s, scheme must be redis", rawurl)
+	}
+	opts := &Options{
+		Addr:     u.Host,
+		PoolSize: DefaultPoolSize,
+		Timeout:  DefaultTimeout,
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid redis url %s, host is missing", rawurl)
+	}
+	if u.Port() == "" {
+		opts.Addr = u.Host + ":" + DefaultPort
+	}
+	if u.User != nil {
+		opts.Password, _ = u.User.Password()
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		opts.DB, err = strconv.Atoi(db)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redis url %s, db must be a number", rawurl)
+		}
+	}
+	return opts, nil
+}
+
+// Provider redis implementation of storage.Provider interface
+type Provider struct {
+	opts   *Options
+	lock   sync.Mutex
+	stores []*redisStore
+}
+
+func NewProvider(rawurl string) (*Provider, error) {
+	opts, err := ParseURL(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	return NewProviderWithOptions(opts), nil
+}
+
+func NewProviderWithOptions(opts *Options) *Provider {
+	return &Provider{opts: opts}
+}
+
+// OpenStore opens the store of the name space name, its keys are stored
+// as <name>:<key> so several stores can share a server
+func (p *Provider) OpenStore(name string) (store.Store, error) {
+	s := &redisStore{
+		pool: newPool(p.opts),
+	}
+	if name != "" {
+		s.ns = []byte(name + ":")
+	}
+	c, err := s.pool.get()
+	if err != nil {
+		return nil, fmt.Errorf("connect redis %s err:%s", p.opts.Addr, err)
+	}
+	_, err = c.do("PING")
+	s.pool.put(c, err)
+	if err != nil {
+		s.pool.close()
+		return nil, fmt.Errorf("connect redis %s err:%s", p.opts.Addr, err)
+	}
+	p.lock.Lock()
+	p.stores = append(p.stores, s)
+	p.lock.Unlock()
+	return s, nil
+}
+
+func (p *Provider) Close() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for _, s := range p.stores {
+		s.Close()
+	}
+	p.stores = nil
+	return nil
+}
+
+// pool keeps idle connections for reuse
+type pool struct {
+	opts *Options
+	idle chan *conn
+}
+
+func newPool(opts *Options) *pool {
+	size := opts.PoolSize
+	if size <= 0 {
+		size = DefaultPoolSize
+	}
+	return &pool{
+		opts: opts,
+		idle: make(chan *conn, size),
+	}
+}
+
+func (p *pool) get() (*conn, error) {
+	select {
+	case c := <-p.idle:
+		return c, nil
+	default:
+		return dial(p.opts)
+	}
+}
+
+// put returns c for reuse unless err shows the connection is broken
+func (p *pool) put(c *conn, err error) {
+	if _, ok := err.(Error); err != nil && !ok {
+		c.close()
+		return
+	}
+	select {
+	case p.idle <- c:
+	default:
+		c.close()
+	}
+}
+
+func (p *pool) close() {
+	for {
+		select {
+		case c := <-p.idle:
+			c.close()
+		default:
+			return
+		}
+	}
+}
+
+type redisStore struct {
+	pool *pool
+	ns   []byte
+}
+
+func (self *redisStore) key(k []byte) []byte {
+	return append(append([]byte{}, self.ns...), k...)
+}
+
+func (self *redisStore) do(args ...interface{}) (interface{}, error) {
+	c, err := self.pool.get()
+	if err != nil {
+		return nil, err
+	}
+	reply, err := c.do(args...)
+	self.pool.put(c, err)
+	return reply, err
+}
+
+// Put a key-value pair to redis
+func (self *redisStore) Put(key []byte, value []byte) error {
+	_, err := self.do("SET", self.key(key), value)
+	return err
+}
+
+// Get the value of a key from redis
+func (self *redisStore) Get(key []byte) ([]byte, error) {
+	reply, err := self.do("GET", self.key(key))
+	if err != nil {
+		return nil, err
+	}
+	data, ok := reply.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("redis: unexpected GET reply %v", reply)
+	}
+	if data == nil {
+		return nil, store.ErrNotFound
+	}
+	return data, nil
+}
+
+// Has return whether the key is exist in redis
+func (self *redisStore) Has(key []byte) (bool, error) {
+	reply, err := self.do("EXISTS", self.key(key))
+	if err != nil {
+		return false, err
+	}
+	n, ok := reply.(int64)
+	if !ok {
+		return false, fmt.Errorf("redis: unexpected EXISTS reply %v", reply)
+	}
+	return n > 0, nil
+}
+
+// Delete the key in redis
+func (self *redisStore) Delete(key []byte) error {
+	_, err := self.do("DEL", self.key(key))
+	return err
+}
+
+// Write commit a store batch in one MULTI/EXEC transaction
+func (self *redisStore) Write(b *store.Batch) error {
+	if b.Len() == 0 {
+		return nil
+	}
+	c, err := self.pool.get()
+	if err != nil {
+		return err
+	}
+	_, err = self.exec(c, func() error {
+		var err error
+		b.Replay(func(k, v []byte) {
+			if err == nil {
+				err = c.send("SET", self.key(k), v)
+			}
+		}, func(k []byte) {
+			if err == nil {
+				err = c.send("DEL", self.key(k))
+			}
+		})
+		return err
+	}, b.Len())
+	self.pool.put(c, err)
+	return err
+}
+
+// exec runs the n commands queued by queue in a transaction and returns
+// their replies, nil if a watched key changed
+func (self *redisStore) exec(c *conn, queue func() error, n int) ([]interface{}, error) {
+	if err := c.send("MULTI"); err != nil {
+		return nil, err
+	}
+	if err := queue(); err != nil {
+		return nil, err
+	}
+	if err := c.send("EXEC"); err != nil {
+		return nil, err
+	}
+	if err := c.flush(); err != nil {
+		return nil, err
+	}
+	// the replies to MULTI and the queued commands, an error here makes
+	// EXEC fail as well so it is read before returning
+	var queueErr error
+	for i := 0; i <= n; i++ {
+		if _, err := c.receive(); err != nil {
+			if _, ok := err.(Error); !ok {
+				return nil, err
+			}
+			queueErr = err
+		}
+	}
+	reply, err := c.receive()
+	if queueErr != nil {
+		return nil, queueErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	items, ok := reply.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("redis: unexpected EXEC reply %v", reply)
+	}
+	return items, nil
+}
+
+// CompareAndSwap set the value of a key only if it still holds the old
+// value, the key is watched so the swap fails if it changes in between
+func (self *redisStore) CompareAndSwap(key []byte, old []byte, value []byte) (bool, error) {
+	c, err := self.pool.get()
+	if err != nil {
+		return false, err
+	}
+	ok, err := self.compareAndSwap(c, self.key(key), old, value)
+	if err != nil {
+		// the key may still be watched, don't reuse the connection
+		c.close()
+		return false, err
+	}
+	self.pool.put(c, nil)
+	return ok, nil
+}
+
+func (self *redisStore) compareAndSwap(c *conn, key []byte, old []byte, value []byte) (bool, error) {
+	for i := 0; i < casRetries; i++ {
+		if _, err := c.do("WATCH", key); err != nil {
+			return false, err
+		}
+		reply, err := c.do("GET", key)
+		if err != nil {
+			return false, err
+		}
+		cur, _ := reply.([]byte)
+		if (old == nil) != (cur == nil) || (old != nil && !bytes.Equal(cur, old)) {
+			_, err = c.do("UNWATCH")
+			return false, err
+		}
+		items, err := self.exec(c, func() error {
+			if value == nil {
+				return c.send("DEL", key)
+			}
+			return c.send("SET", key, value)
+		}, 1)
+		if err != nil {
+			return false, err
+		}
+		if items != nil {
+			return true, nil
+		}
+	}
+	return false, fmt.Errorf("redis: key %q keeps changing, compare and swap gave up", key)
+}
+
+// scan returns the sorted keys under prefix without the name space
+func (self *redisStore) scan(prefix []byte) ([][]byte, error) {
+	c, err := self.pool.get()
+	if err != nil {
+		return nil, err
+	}
+	keys, err := self.scanConn(c, prefix)
+	self.pool.put(c, err)
+	return keys, err
+}
+
+func (self *redisStore) scanConn(c *conn, prefix []byte) ([][]byte, error) {
+	pattern := append(globEscape(self.key(prefix)), '*')
+	seen := make(map[string]bool)
+	cursor := "0"
+	for {
+		reply, err := c.do("SCAN", cursor, "MATCH", pattern, "COUNT", strconv.Itoa(scanCount))
+		if err != nil {
+			return nil, err
+		}
+		items, ok := reply.([]interface{})
+		if !ok || len(items) != 2 {
+			return nil, fmt.Errorf("redis: unexpected SCAN reply %v", reply)
+		}
+		next, _ := items[0].([]byte)
+		found, _ := items[1].([]interface{})
+		for _, item := range found {
+			if k, ok := item.([]byte); ok {
+				seen[string(k[len(self.ns):])] = true
+			}
+		}
+		cursor = string(next)
+		if cursor == "0" || cursor == "" {
+			break
+		}
+	}
+	keys := make([][]byte, 0, len(seen))
+	for k := range seen {
+		keys = append(keys, []byte(k))
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return bytes.Compare(keys[i], keys[j]) < 0
+	})
+	return keys, nil
+}
+
+// mget fetches the values of keys, a nil value is a key deleted since
+func (self *redisStore) mget(c *conn, keys [][]byte) ([][]byte, error) {
+	args := make([]interface{}, 0, len(keys)+1)
+	args = append(args, "MGET")
+	for _, k := range keys {
+		args = append(args, self.key(k))
+	}
+	reply, err := c.do(args...)
+	if err != nil {
+		return nil, err
+	}
+	return mgetValues(reply, len(keys))
+}
+
+func mgetValues(reply interface{}, n int) ([][]byte, error) {
+	items, ok := reply.([]interface{})
+	if !ok || len(items) != n {
+		return nil, fmt.Errorf("redis: unexpected MGET reply %v", reply)
+	}
+	values := make([][]byte, n)
+	for i, item := range items {
+		values[i], _ = item.([]byte)
+	}
+	return values, nil
+}
+
+// NewIterator return an iterator of the records with the key prefix, the
+// keys are listed first and the values fetched while iterating
+func (self *redisStore) NewIterator(prefix []byte) store.Iterator {
+	keys, err := self.scan(prefix)
+	return &iterator{
+		store: self,
+		keys:  keys,
+		pos:   -1,
+		err:   err,
+	}
+}
+
+// Snapshot copies the current records, they are read in one transaction so
+// the copy is consistent, records added while the keys are listed may miss
+func (self *redisStore) Snapshot() (store.Snapshot, error) {
+	c, err := self.pool.get()
+	if err != nil {
+		return nil, err
+	}
+	snap, err := self.snapshot(c)
+	self.pool.put(c, err)
+	return snap, err
+}
+
+func (self *redisStore) snapshot(c *conn) (store.Snapshot, error) {
+	keys, err := self.scanConn(c, nil)
+	if err != nil {
+		return nil, err
+	}
+	snap := &snapshot{}
+	if len(keys) == 0 {
+		return snap, nil
+	}
+	items, err := self.exec(c, func() error {
+		args := make([]interface{}, 0, len(keys)+1)
+		args = append(args, "MGET")
+		for _, k := range keys {
+			args = append(args, self.key(k))
+		}
+		return c.send(args...)
+	}, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) != 1 {
+		return nil, fmt.Errorf("redis: unexpected EXEC reply %v", items)
+	}
+	values, err := mgetValues(items[0], len(keys))
+	if err != nil {
+		return nil, err
+	}
+	for i, k := range keys {
+		if values[i] != nil {
+			snap.keys = append(snap.keys, k)
+			snap.values = append(snap.values, values[i])
+		}
+	}
+	return snap, nil
+}
+
+// Close releases the connections of the store
+func (self *redisStore) Close() error {
+	self.pool.close()
+	return nil
+}
+
+type iterator struct {
+	store  *redisStore
+	keys   [][]byte
+	values [][]byte
+	// pos indexes keys, values holds the values of keys[start:]
+	pos   int
+	start int
+	err   error
+}
+
+func (it *iterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	for {
+		it.pos++
+		if it.pos >= len(it.keys) {
+			return false
+		}
+		if it.pos-it.start >= len(it.values) {
+			if err := it.fetch(); err != nil {
+				it.err = err
+				return false
+			}
+		}
+		if it.values[it.pos-it.start] != nil {
+			return true
+		}
+	}
+}
+
+func (it *iterator) fetch() error {
+	end := it.pos + fetchCount
+	if end > len(it.keys) {
+		end = len(it.keys)
+	}
+	c, err := it.store.pool.get()
+	if err != nil {
+		return err
+	}
+	values, err := it.store.mget(c, it.keys[it.pos:end])
+	it.store.pool.put(c, err)
+	if err != nil {
+		return err
+	}
+	it.start = it.pos
+	it.values = values
+	return nil
+}
+
+func (it *iterator) Key() []byte {
+	if it.pos < 0 || it.pos >= len(it.keys) {
+		return nil
+	}
+	return it.keys[it.pos]
+}
+
+func (it *iterator) Value() []byte {
+	if it.pos < 0 || it.pos >= len(it.keys) {
+		return nil
+	}
+	return it.values[it.pos-it.start]
+}
+
+func (it *iterator) Release() {
+	it.keys = nil
+	it.values = nil
+}
+
+func (it *iterator) Error() error {
+	return it.err
+}
+
+// snapshot holds a sorted copy of the records
+type snapshot struct {
+	keys   [][]byte
+	values [][]byte
+}
+
+func (s *snapshot) Get(key []byte) ([]byte, error) {
+	i := sort.Search(len(s.keys), func(i int) bool {
+		return bytes.Compare(s.keys[i], key) >= 0
+	})
+	if i < len(s.keys) && bytes.Equal(s.keys[i], key) {
+		return s.values[i], nil
+	}
+	return nil, store.ErrNotFound
+}
+
+func (s *snapshot) NewIterator(prefix []byte) store.Iterator {
+	i := sort.Search(len(s.keys), func(i int) bool {
+		return bytes.Compare(s.keys[i], prefix) >= 0
+	})
+	j := i
+	for j < len(s.keys) && bytes.HasPrefix(s.keys[j], prefix) {
+		j++
+	}
+	return &iterator{
+		keys:   s.keys[i:j],
+		values: s.values[i:j],
+		pos:    -1,
+	}
+}
+
+func (s *snapshot) Release() {
+	s.keys = nil
+	s.values = nil
+}
+
+// globEscape escapes the pattern characters of SCAN MATCH
+func globEscape(b []byte) []byte {
+	escaped := make([]byte, 0, len(b))
+	for _, c := range b {
+		switch c {
+		case '*', '?', '[', ']', '\\':
+			escaped = append(escaped, '\\')
+		}
+		escaped = append(escaped, c)
+	}
+	return escaped
+}
@@ -0,0 +1,161 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package redis
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/ontio/mercury/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func openTestStore(t *testing.T, url, name string) store.Store {
+	prov, err := NewProvider(url)
+	assert.Nil(t, err)
+	db, err := prov.OpenStore(name)
+	assert.Nil(t, err)
+	return db
+}
+
+func collect(t *testing.T, iter store.Iterator) []string {
+	defer iter.Release()
+	keys := make([]string, 0)
+	for iter.Next() {
+		keys = append(keys, string(iter.Key())+"="+string(iter.Value()))
+	}
+	assert.Nil(t, iter.Error())
+	return keys
+}
+
+func TestParseURL(t *testing.T) {
+	opts, err := ParseURL("redis://:secret@example.com/2")
+	assert.Nil(t, err)
+	assert.Equal(t, "example.com:6379", opts.Addr)
+	assert.Equal(t, "secret", opts.Password)
+	assert.Equal(t, 2, opts.DB)
+	_, err = ParseURL("http://example.com")
+	assert.NotNil(t, err)
+	_, err = ParseURL("redis://example.com/x")
+	assert.NotNil(t, err)
+}
+
+func TestStore(t *testing.T) {
+	srv, err := newTestServer("secret")
+	assert.Nil(t, err)
+	defer srv.Close()
+	_, err = NewProviderWithOptions(&Options{Addr: srv.ln.Addr().String()}).OpenStore("agent")
+	assert.NotNil(t, err)
+
+	// two agents sharing the server see the same records
+	a := openTestStore(t, srv.URL(), "agent")
+	defer a.Close()
+	b := openTestStore(t, srv.URL(), "agent")
+	defer b.Close()
+	other := openTestStore(t, srv.URL(), "other")
+	defer other.Close()
+
+	assert.Nil(t, a.Put(store.Key("Connection", "did:ont:a", "did:ont:b"), []byte("1")))
+	v, err := b.Get(store.Key("Connection", "did:ont:a", "did:ont:b"))
+	assert.Nil(t, err)
+	assert.Equal(t, "1", string(v))
+	_, err = other.Get(store.Key("Connection", "did:ont:a", "did:ont:b"))
+	assert.Equal(t, store.ErrNotFound, err)
+	ok, err := b.Has(store.Key("Connection", "did:ont:a", "did:ont:b"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	batch := store.NewBatch()
+	for i := 0; i < 10; i++ {
+		batch.Put(store.Key("Basic", "did:ont:a", strconv.Itoa(i)), []byte(strconv.Itoa(i)))
+	}
+	// pattern characters in a key must not widen the scan
+	batch.Put(store.Key("Basic", "did:ont:*", "x"), []byte("x"))
+	batch.Delete(store.Key("Connection", "did:ont:a", "did:ont:b"))
+	assert.Nil(t, a.Write(batch))
+	ok, err = b.Has(store.Key("Connection", "did:ont:a", "did:ont:b"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	keys := collect(t, b.NewIterator(store.KeyPrefix("Basic", "did:ont:a")))
+	assert.Equal(t, 10, len(keys))
+	assert.Equal(t, "Basic/did:ont:a/0=0", keys[0])
+	assert.Equal(t, "Basic/did:ont:a/9=9", keys[9])
+	assert.Equal(t, []string{"Basic/did:ont:*/x=x"}, collect(t, b.NewIterator(store.KeyPrefix("Basic", "did:ont:*"))))
+
+	snap, err := a.Snapshot()
+	assert.Nil(t, err)
+	defer snap.Release()
+	assert.Nil(t, a.Delete(store.Key("Basic", "did:ont:a", "0")))
+	assert.Nil(t, a.Put(store.Key("Basic", "did:ont:a", "new"), []byte("new")))
+	v, err = snap.Get(store.Key("Basic", "did:ont:a", "0"))
+	assert.Nil(t, err)
+	assert.Equal(t, "0", string(v))
+	assert.Equal(t, 11, len(collect(t, snap.NewIterator(nil))))
+	assert.Equal(t, 10, len(collect(t, snap.NewIterator(store.KeyPrefix("Basic", "did:ont:a")))))
+	assert.Equal(t, 10, len(collect(t, b.NewIterator(store.KeyPrefix("Basic", "did:ont:a")))))
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	srv, err := newTestServer("")
+	assert.Nil(t, err)
+	defer srv.Close()
+	db := openTestStore(t, srv.URL(), "agent")
+	defer db.Close()
+
+	key := []byte("counter")
+	ok, err := db.CompareAndSwap(key, nil, []byte("0"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	ok, err = db.CompareAndSwap(key, nil, []byte("0"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	// every agent increments through its own connections
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		agent := openTestStore(t, srv.URL(), "agent")
+		defer agent.Close()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 25; {
+				cur, err := agent.Get(key)
+				assert.Nil(t, err)
+				v, _ := strconv.Atoi(string(cur))
+				ok, err := agent.CompareAndSwap(key, cur, []byte(strconv.Itoa(v+1)))
+				assert.Nil(t, err)
+				if ok {
+					n++
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	v, err := db.Get(key)
+	assert.Nil(t, err)
+	assert.Equal(t, "100", string(v))
+
+	ok, err = db.CompareAndSwap(key, []byte("100"), nil)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	_, err = db.Get(key)
+	assert.Equal(t, store.ErrNotFound, err)
+}
@@ -0,0 +1,186 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package redis
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// Error is an error reply of the server, the connection stays usable
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
+
+// conn is one connection speaking RESP, replies are decoded into string
+// (status), Error, int64, []byte (nil for a missing value) and
+// []interface{} (nil for an aborted transaction)
+type conn struct {
+	nc      net.Conn
+	br      *bufio.Reader
+	bw      *bufio.Writer
+	timeout time.Duration
+}
+
+func dial(opts *Options) (*conn, error) {
+	nc, err := net.DialTimeout("tcp", opts.Addr, opts.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &conn{
+		nc:      nc,
+		br:      bufio.NewReader(nc),
+		bw:      bufio.NewWriter(nc),
+		timeout: opts.Timeout,
+	}
+	if opts.Password != "" {
+		if _, err = c.do("AUTH", opts.Password); err != nil {
+			c.close()
+			return nil, err
+		}
+	}
+	if opts.DB != 0 {
+		if _, err = c.do("SELECT", strconv.Itoa(opts.DB)); err != nil {
+			c.close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// do sends one command and reads its reply, an error reply is returned as
+// error
+func (c *conn) do(args ...interface{}) (interface{}, error) {
+	if err := c.send(args...); err != nil {
+		return nil, err
+	}
+	if err := c.flush(); err != nil {
+		return nil, err
+	}
+	return c.receive()
+}
+
+// send buffers a command, args are strings or []byte
+func (c *conn) send(args ...interface{}) error {
+	fmt.Fprintf(c.bw, "*%d\r\n", len(args))
+	for _, arg := range args {
+		var b []byte
+		switch v := arg.(type) {
+		case string:
+			b = []byte(v)
+		case []byte:
+			b = v
+		default:
+			return fmt.Errorf("redis: unsupported argument type %T", arg)
+		}
+		fmt.Fprintf(c.bw, "$%d\r\n", len(b))
+		c.bw.Write(b)
+		c.bw.WriteString("\r\n")
+	}
+	return nil
+}
+
+func (c *conn) flush() error {
+	if c.timeout > 0 {
+		c.nc.SetDeadline(time.Now().Add(c.timeout))
+	}
+	return c.bw.Flush()
+}
+
+func (c *conn) receive() (interface{}, error) {
+	if c.timeout > 0 {
+		c.nc.SetDeadline(time.Now().Add(c.timeout))
+	}
+	reply, err := readReply(c.br)
+	if err != nil {
+		return nil, err
+	}
+	if e, ok := reply.(Error); ok {
+		return nil, e
+	}
+	return reply, nil
+}
+
+func (c *conn) close() error {
+	return c.nc.Close()
+}
+
+func readReply(br *bufio.Reader) (interface{}, error) {
+	line, err := readLine(br)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, fmt.Errorf("redis: empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return string(line[1:]), nil
+	case '-':
+		return Error(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(string(line[1:]), 10, 64)
+	case '$':
+		n, err := strconv.Atoi(string(line[1:]))
+		if err != nil || n < -1 {
+			return nil, fmt.Errorf("redis: invalid bulk length %q", line)
+		}
+		if n == -1 {
+			return []byte(nil), nil
+		}
+		b := make([]byte, n+2)
+		if _, err = io.ReadFull(br, b); err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	case '*':
+		n, err := strconv.Atoi(string(line[1:]))
+		if err != nil || n < -1 {
+			return nil, fmt.Errorf("redis: invalid array length %q", line)
+		}
+		if n == -1 {
+			return []interface{}(nil), nil
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = readReply(br); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: invalid reply %q", line)
+}
+
+func readLine(br *bufio.Reader) ([]byte, error) {
+	line, err := br.ReadSlice('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("redis: invalid line %q", line)
+	}
+	return line[:len(line)-2], nil
+}
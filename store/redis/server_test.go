@@ -0,0 +1,330 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package redis
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// testServer is an in-process stand-in for a redis server, it implements
+// the commands the store uses with the same atomicity: every command and
+// every EXEC runs under one lock, WATCH compares per key versions.
+type testServer struct {
+	ln       net.Listener
+	password string
+	lock     sync.Mutex
+	data     map[string]string
+	versions map[string]uint64
+	version  uint64
+}
+
+func newTestServer(password string) (*testServer, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &testServer{
+		ln:       ln,
+		password: password,
+		data:     make(map[string]string),
+		versions: make(map[string]uint64),
+	}
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(nc)
+		}
+	}()
+	return s, nil
+}
+
+func (s *testServer) URL() string {
+	if s.password != "" {
+		return "redis://:" + s.password + "@" + s.ln.Addr().String()
+	}
+	return "redis://" + s.ln.Addr().String()
+}
+
+func (s *testServer) Close() {
+	s.ln.Close()
+}
+
+type session struct {
+	authed  bool
+	multi   bool
+	queued  [][]string
+	watched map[string]uint64
+}
+
+func (s *testServer) serve(nc net.Conn) {
+	defer nc.Close()
+	br := bufio.NewReader(nc)
+	bw := bufio.NewWriter(nc)
+	sess := &session{authed: s.password == ""}
+	for {
+		args, err := readCommand(br)
+		if err != nil {
+			return
+		}
+		writeReply(bw, s.handle(sess, args))
+		if br.Buffered() == 0 {
+			if bw.Flush() != nil {
+				return
+			}
+		}
+	}
+}
+
+func readCommand(br *bufio.Reader) ([]string, error) {
+	reply, err := readReply(br)
+	if err != nil {
+		return nil, err
+	}
+	items, ok := reply.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("not a command")
+	}
+	args := make([]string, len(items))
+	for i, item := range items {
+		b, ok := item.([]byte)
+		if !ok {
+			return nil, fmt.Errorf("not a command")
+		}
+		args[i] = string(b)
+	}
+	return args, nil
+}
+
+func writeReply(w io.Writer, reply interface{}) {
+	switch v := reply.(type) {
+	case string:
+		fmt.Fprintf(w, "+%s\r\n", v)
+	case Error:
+		fmt.Fprintf(w, "-%s\r\n", string(v))
+	case int64:
+		fmt.Fprintf(w, ":%d\r\n", v)
+	case *string:
+		if v == nil {
+			fmt.Fprint(w, "$-1\r\n")
+		} else {
+			fmt.Fprintf(w, "$%d\r\n%s\r\n", len(*v), *v)
+		}
+	case []interface{}:
+		if v == nil {
+			fmt.Fprint(w, "*-1\r\n")
+			return
+		}
+		fmt.Fprintf(w, "*%d\r\n", len(v))
+		for _, item := range v {
+			writeReply(w, item)
+		}
+	}
+}
+
+func bulk(s string) *string {
+	return &s
+}
+
+func (s *testServer) handle(sess *session, args []string) interface{} {
+	if len(args) == 0 {
+		return Error("ERR empty command")
+	}
+	cmd := strings.ToUpper(args[0])
+	if cmd == "AUTH" {
+		if len(args) != 2 || args[1] != s.password {
+			return Error("WRONGPASS invalid password")
+		}
+		sess.authed = true
+		return "OK"
+	}
+	if !sess.authed {
+		return Error("NOAUTH Authentication required.")
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	switch cmd {
+	case "MULTI":
+		sess.multi = true
+		sess.queued = nil
+		return "OK"
+	case "EXEC":
+		if !sess.multi {
+			return Error("ERR EXEC without MULTI")
+		}
+		sess.multi = false
+		watched := sess.watched
+		sess.watched = nil
+		for k, v := range watched {
+			if s.versions[k] != v {
+				return []interface{}(nil)
+			}
+		}
+		replies := make([]interface{}, 0, len(sess.queued))
+		for _, q := range sess.queued {
+			replies = append(replies, s.run(q))
+		}
+		return replies
+	case "WATCH":
+		if sess.watched == nil {
+			sess.watched = make(map[string]uint64)
+		}
+		for _, k := range args[1:] {
+			sess.watched[k] = s.versions[k]
+		}
+		return "OK"
+	case "UNWATCH":
+		sess.watched = nil
+		return "OK"
+	}
+	if sess.multi {
+		sess.queued = append(sess.queued, args)
+		return "QUEUED"
+	}
+	return s.run(args)
+}
+
+func (s *testServer) write(k string, v *string) {
+	s.version++
+	s.versions[k] = s.version
+	if v == nil {
+		delete(s.data, k)
+	} else {
+		s.data[k] = *v
+	}
+}
+
+func (s *testServer) get(k string) *string {
+	if v, ok := s.data[k]; ok {
+		return bulk(v)
+	}
+	return nil
+}
+
+func (s *testServer) run(args []string) interface{} {
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		return "PONG"
+	case "SELECT":
+		return "OK"
+	case "GET":
+		return s.get(args[1])
+	case "SET":
+		s.write(args[1], bulk(args[2]))
+		return "OK"
+	case "DEL":
+		n := int64(0)
+		for _, k := range args[1:] {
+			if _, ok := s.data[k]; ok {
+				s.write(k, nil)
+				n++
+			}
+		}
+		return n
+	case "EXISTS":
+		n := int64(0)
+		for _, k := range args[1:] {
+			if _, ok := s.data[k]; ok {
+				n++
+			}
+		}
+		return n
+	case "MGET":
+		values := make([]interface{}, 0, len(args)-1)
+		for _, k := range args[1:] {
+			values = append(values, s.get(k))
+		}
+		return values
+	case "SCAN":
+		return s.scan(args)
+	}
+	return Error("ERR unknown command '" + args[0] + "'")
+}
+
+// scan pages through the sorted keys, the cursor is the offset of the next
+// page and the pages are small so the client has to follow the cursor
+func (s *testServer) scan(args []string) interface{} {
+	cursor, err := strconv.Atoi(args[1])
+	if err != nil {
+		return Error("ERR invalid cursor")
+	}
+	pattern := "*"
+	for i := 2; i+1 < len(args); i += 2 {
+		if strings.ToUpper(args[i]) == "MATCH" {
+			pattern = args[i+1]
+		}
+	}
+	keys := make([]string, 0, len(s.data))
+	for k := range s.data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	const page = 3
+	found := make([]interface{}, 0)
+	end := cursor + page
+	for i := cursor; i < end && i < len(keys); i++ {
+		if globMatch(pattern, keys[i]) {
+			found = append(found, bulk(keys[i]))
+		}
+	}
+	next := "0"
+	if end < len(keys) {
+		next = strconv.Itoa(end)
+	}
+	return []interface{}{bulk(next), found}
+}
+
+// globMatch matches the subset of redis patterns the store produces:
+// escaped characters, ? and *
+func globMatch(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(s); i >= 0; i-- {
+				if globMatch(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+		case '\\':
+			pattern = pattern[1:]
+			fallthrough
+		default:
+			if len(s) == 0 || len(pattern) == 0 || s[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern = pattern[1:]
+		s = s[1:]
+	}
+	return len(s) == 0
+}
@@ -18,6 +18,11 @@
 
 package store
 
+import "errors"
+
+// ErrNotFound is returned by Get when the key does not exist
+var ErrNotFound = errors.New("store: not found")
+
 // Provider storage provider interface
 type Provider interface {
 	// OpenStore opens a store with given name space and returns the handle
@@ -35,4 +40,71 @@ type Store interface {
 	Has(k []byte) (bool, error)
 	// Delete stores by key
 	Delete(k []byte) error
+	// NewIterator iterates the records whose key starts with prefix, in key order
+	NewIterator(prefix []byte) Iterator
+	// Write applies all operations of the batch atomically
+	Write(b *Batch) error
+	// CompareAndSwap replaces the value of k with v only if it is still old,
+	// a nil old requires k to be absent and a nil v deletes k
+	CompareAndSwap(k []byte, old []byte, v []byte) (bool, error)
+	// Snapshot returns a consistent read only view of the current records
+	Snapshot() (Snapshot, error)
+	// Close releases the store
+	Close() error
+}
+
+// Snapshot is a frozen view of a store, later writes are not visible in it,
+// it must be released after use
+type Snapshot interface {
+	Get(k []byte) ([]byte, error)
+	NewIterator(prefix []byte) Iterator
+	Release()
+}
+
+// Iterator walks a range of records, it must be released after use
+type Iterator interface {
+	Next() bool
+	Key() []byte
+	Value() []byte
+	Release()
+	Error() error
+}
+
+type batchOp struct {
+	key    []byte
+	value  []byte
+	delete bool
+}
+
+// Batch collects puts and deletes which are written by Store.Write at once
+type Batch struct {
+	ops []batchOp
+}
+
+func NewBatch() *Batch {
+	return &Batch{}
+}
+
+func (b *Batch) Put(k, v []byte) {
+	b.ops = append(b.ops, batchOp{key: k, value: v})
+}
+
+func (b *Batch) Delete(k []byte) {
+	b.ops = append(b.ops, batchOp{key: k, delete: true})
+}
+
+// Len returns the number of operations in the batch
+func (b *Batch) Len() int {
+	return len(b.ops)
+}
+
+// Replay calls put or del for every operation in the order they were added
+func (b *Batch) Replay(put func(k, v []byte), del func(k []byte)) {
+	for _, op := range b.ops {
+		if op.delete {
+			del(op.key)
+		} else {
+			put(op.key, op.value)
+		}
+	}
 }
@@ -23,6 +23,7 @@ import (
 	"fmt"
 	"github.com/ontio/mercury/common/message"
 	sdk "github.com/ontio/ontology-go-sdk"
+	"strings"
 )
 
 type PublicKey struct {
@@ -105,21 +106,47 @@ func GetServiceEndpointByDid(did string, ontSdk *sdk.OntologySdk) ([]string, err
 }
 
 func GetPubKeyByDid(did string, ontSdk *sdk.OntologySdk) (string, error) {
+	pks, err := getPubKeys(did, ontSdk)
+	if err != nil {
+		return "", err
+	}
+	return pks[0].PublicKeyHex, nil
+}
+
+//GetPubKeyByKeyId returns the public key kid like did#keys-1, a did alone
+//is its first key
+func GetPubKeyByKeyId(kid string, ontSdk *sdk.OntologySdk) (string, error) {
+	did := strings.SplitN(kid, "#", 2)[0]
+	pks, err := getPubKeys(did, ontSdk)
+	if err != nil {
+		return "", err
+	}
+	if did == kid {
+		return pks[0].PublicKeyHex, nil
+	}
+	for _, pk := range pks {
+		if pk.Id == kid {
+			return pk.PublicKeyHex, nil
+		}
+	}
+	return "", fmt.Errorf("public key %s not found", kid)
+}
+
+func getPubKeys(did string, ontSdk *sdk.OntologySdk) ([]DidPubkey, error) {
 	if ontSdk.Native == nil || ontSdk.Native.OntId == nil {
-		return "", fmt.Errorf("ontsdk is nil")
+		return nil, fmt.Errorf("ontsdk is nil")
 	}
 	pubKey, err := ontSdk.Native.OntId.GetPublicKeysJson(did)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	var pks []DidPubkey
 	err = json.Unmarshal(pubKey, &pks)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	if len(pks) == 0 {
-		return "", fmt.Errorf("no public key found")
+		return nil, fmt.Errorf("no public key found")
 	}
-
-	return pks[0].PublicKeyHex, nil
+	return pks, nil
 }
@@ -0,0 +1,63 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// JWTPayload is the part of a jwt verifiable credential or presentation payload the agent reads
+type JWTPayload struct {
+	Iss string `json:"iss,omitempty"`
+	Exp int64  `json:"exp,omitempty"`
+	Nbf int64  `json:"nbf,omitempty"`
+	Iat int64  `json:"iat,omitempty"`
+	VC  *struct {
+		Type []string `json:"type,omitempty"`
+	} `json:"vc,omitempty"`
+	VP *struct {
+		Type []string `json:"type,omitempty"`
+	} `json:"vp,omitempty"`
+}
+
+// ParseJWTPayload decodes the payload of a jwt without verifying it,
+// both standard and url base64 segments are accepted
+func ParseJWTPayload(token string) (*JWTPayload, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid jwt with %d parts", len(parts))
+	}
+	seg := strings.TrimRight(parts[1], "=")
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		data, err = base64.RawStdEncoding.DecodeString(seg)
+		if err != nil {
+			return nil, err
+		}
+	}
+	payload := new(JWTPayload)
+	err = json.Unmarshal(data, payload)
+	if err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
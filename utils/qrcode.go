@@ -0,0 +1,94 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"bytes"
+	"fmt"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+const (
+	QRCodePNG = "png"
+	QRCodeSVG = "svg"
+
+	DefaultQRCodeSize = 256
+	// MaxQRCodeSize bounds the side of a rendered qr code in pixels
+	MaxQRCodeSize = 2048
+)
+
+// CheckQRCode checks the format and size of a qr code before rendering it,
+// a size of 0 is the default size
+func CheckQRCode(format string, size int) error {
+	if format != QRCodePNG && format != QRCodeSVG {
+		return fmt.Errorf("unsupported qr code format %q, use png or svg", format)
+	}
+	if size > MaxQRCodeSize {
+		return fmt.Errorf("qr code size %d is larger than %d", size, MaxQRCodeSize)
+	}
+	return nil
+}
+
+// QRCode renders content as a png or svg qr code of size pixels and returns
+// it with its mime type
+func QRCode(content, format string, size int) ([]byte, string, error) {
+	if err := CheckQRCode(format, size); err != nil {
+		return nil, "", err
+	}
+	if size <= 0 {
+		size = DefaultQRCodeSize
+	}
+	q, err := qrcode.New(content, qrcode.Medium)
+	if err != nil {
+		return nil, "", fmt.Errorf("encode qr code err:%s", err)
+	}
+	if format == QRCodeSVG {
+		return qrCodeSVG(q.Bitmap(), size), "image/svg+xml", nil
+	}
+	data, err := q.PNG(size)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, "image/png", nil
+}
+
+// qrCodeSVG draws every run of dark modules of a row as one rect, in a view
+// box of one unit per module
+func qrCodeSVG(bitmap [][]bool, size int) []byte {
+	var buf bytes.Buffer
+	n := len(bitmap)
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, size, size, n, n)
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, n, n)
+	for y, row := range bitmap {
+		for x := 0; x < len(row); {
+			if !row[x] {
+				x++
+				continue
+			}
+			start := x
+			for x < len(row) && row[x] {
+				x++
+			}
+			fmt.Fprintf(&buf, "M%d %dh%dv1h-%dz", start, y, x-start, x-start)
+		}
+	}
+	buf.WriteString(`"/></svg>`)
+	return buf.Bytes()
+}
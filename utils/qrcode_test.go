@@ -0,0 +1,48 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"bytes"
+	"encoding/xml"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQRCode(t *testing.T) {
+	url := "http://127.0.0.1:8080?c_i=eyJAaWQiOiJhIiwiZGlkIjoiZGlkOm9udDp4In0"
+	data, mimeType, err := QRCode(url, QRCodePNG, 300)
+	assert.Nil(t, err)
+	assert.Equal(t, "image/png", mimeType)
+	img, err := png.Decode(bytes.NewReader(data))
+	assert.Nil(t, err)
+	assert.Equal(t, 300, img.Bounds().Dx())
+
+	data, mimeType, err = QRCode(url, QRCodeSVG, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, "image/svg+xml", mimeType)
+	assert.Nil(t, xml.Unmarshal(data, new(struct{})))
+
+	_, _, err = QRCode(url, "gif", 0)
+	assert.NotNil(t, err)
+	_, _, err = QRCode(url, QRCodePNG, MaxQRCodeSize+1)
+	assert.NotNil(t, err)
+}
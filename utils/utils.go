@@ -19,12 +19,11 @@
 package utils
 
 import (
-	"encoding/json"
 	"fmt"
-	"github.com/ontio/mercury/common/message"
-	"github.com/ontio/mercury/store"
 	"github.com/google/uuid"
 	"github.com/howeyc/gopass"
+	"github.com/ontio/mercury/common/message"
+	"github.com/ontio/mercury/store"
 	sdk "github.com/ontio/ontology-go-sdk"
 	"io/ioutil"
 	"net/http"
@@ -91,23 +90,41 @@ func CutDId(did string) string {
 
 }
 
+//activityInterval throttles the writes of the last activity of a connection
+const activityInterval = 60
+
+//CheckConnection checks the connection of myDid with theirDid exists and
+//records the activity on it
 func CheckConnection(myDid, theirDid string, db store.Store) error {
-	connectionKey := []byte(fmt.Sprintf("%s_%s", ConnectionKey, myDid))
-	data, err := db.Get(connectionKey)
+	connectionKey := store.Key(ConnectionKey, myDid, theirDid)
+	value, err := db.Get(connectionKey)
+	if err == store.ErrNotFound {
+		return fmt.Errorf("connection not found!")
+	}
 	if err != nil {
 		return err
 	}
+	touchConnection(db, connectionKey, value)
+	return nil
+}
 
-	cr := new(message.ConnectionRec)
-	err = json.Unmarshal(data, cr)
+func touchConnection(db store.Store, key, value []byte) {
+	rec := new(message.ConnectionRec)
+	r, err := store.DecodeRecord(value, rec)
 	if err != nil {
-		return err
+		return
 	}
-	_, ok := cr.Connections[theirDid]
-	if !ok {
-		return fmt.Errorf("connection not found!")
+	now := time.Now().Unix()
+	if now-rec.LastActivity < activityInterval {
+		return
 	}
-	return nil
+	rec.LastActivity = now
+	data, err := store.EncodeRecord(rec, r.ExpireAt)
+	if err != nil {
+		return
+	}
+	//losing the swap means the connection was just written
+	db.CompareAndSwap(key, value, data)
 }
 
 func HttpPostData(client *http.Client, url, data string) ([]byte, error) {
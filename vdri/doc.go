@@ -33,6 +33,26 @@ const (
 	RequestPresentationSpec = "spec/present-proof/" + Version + "/request-presentation"
 	PresentationProofSpec   = "spec/present-proof/" + Version + "/presentation"
 	PresentationACKSpec     = "spec/present-proof/" + Version + "/ack"
+	ProblemReportSpec       = "spec/notification/" + Version + "/problem-report"
+	TrustPingSpec           = "spec/trust_ping/" + Version + "/ping"
+	TrustPingResponseSpec   = "spec/trust_ping/" + Version + "/ping_response"
+	DIDExchangeRequestSpec  = "spec/did-exchange/" + Version + "/request"
+	DIDExchangeResponseSpec = "spec/did-exchange/" + Version + "/response"
+	DIDExchangeCompleteSpec = "spec/did-exchange/" + Version + "/complete"
+	DIDRotateSpec           = "spec/did-rotate/" + Version + "/rotate"
+	DIDRotateAckSpec        = "spec/did-rotate/" + Version + "/ack"
+	FeaturesQuerySpec       = "spec/discover-features/" + Version + "/query"
+	FeaturesDiscloseSpec    = "spec/discover-features/" + Version + "/disclose"
+	MediateRequestSpec      = "spec/coordinate-mediation/" + Version + "/mediate-request"
+	MediateGrantSpec        = "spec/coordinate-mediation/" + Version + "/mediate-grant"
+	MediateDenySpec         = "spec/coordinate-mediation/" + Version + "/mediate-deny"
+	KeylistUpdateSpec       = "spec/coordinate-mediation/" + Version + "/keylist-update"
+	KeylistResponseSpec     = "spec/coordinate-mediation/" + Version + "/keylist-update-response"
+
+	//ConnectionsProtocol and DIDExchangeProtocol are the handshake
+	//protocols an invitation can be accepted with
+	ConnectionsProtocol = "spec/connections/" + Version
+	DIDExchangeProtocol = "spec/did-exchange/" + Version
 )
 
 type DidDoc interface {
@@ -20,14 +20,13 @@ package ontdid
 
 import (
 	"encoding/json"
-	"fmt"
+	"github.com/google/uuid"
 	"github.com/ontio/mercury/common/message"
 	"github.com/ontio/mercury/service/common"
 	"github.com/ontio/mercury/service/controller"
 	"github.com/ontio/mercury/store"
 	"github.com/ontio/mercury/utils"
 	"github.com/ontio/mercury/vdri"
-	"github.com/google/uuid"
 	sdk "github.com/ontio/ontology-go-sdk"
 	"strings"
 	"time"
@@ -132,14 +131,9 @@ func (ontVdri *OntVDRI) PresentProof(req *message.RequestPresentation, db store.
 		}
 		credid := string(bts)
 
-		key := []byte(fmt.Sprintf("%s_%s_%s", controller.CredentialKey, holderdid, credid))
-		data, err := db.Get(key)
-		if err != nil {
-			return nil, err
-		}
-
+		key := store.Key(controller.CredentialKey, holderdid, credid)
 		credrec := new(message.CredentialRec)
-		err = json.Unmarshal(data, credrec)
+		err = store.GetRecord(db, key, credrec)
 		if err != nil {
 			return nil, err
 		}